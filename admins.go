@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 机器人的管理员，和创建者一样接收用户消息
+func (m *BotManager) botAdmins(token string) []int64 {
+	rows, err := m.db.Query("SELECT user_id FROM bot_roles WHERE bot_token = ? AND role = ? ORDER BY created_at", token, string(roleBotAdmin))
+	if err != nil {
+		log.Printf("Failed to list admins of bot %s: %v", botIDFromToken(token), err)
+		return nil
+	}
+	defer rows.Close()
+
+	var admins []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			admins = append(admins, id)
+		}
+	}
+	return admins
+}
+
+func (m *BotManager) isBotAdmin(token string, userID int64) bool {
+	var exists bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM bot_roles WHERE bot_token = ? AND user_id = ? AND role = ?)",
+		token, userID, string(roleBotAdmin)).Scan(&exists)
+	if err != nil {
+		log.Printf("Failed to check admin %d of bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return exists
+}
+
+// 记录转交到某个聊天的消息对应的用户消息。各私聊的消息 ID 会重复，
+// 管理员私聊中的消息单独记录，其余记入 message_map
+func (m *BotManager) saveChatMapping(token string, chatID int64, messageID int, userID int64, userMessageID int) {
+	if !m.isBotAdmin(token, chatID) {
+		m.saveMessageMapping(token, messageID, userID, userMessageID)
+		return
+	}
+	_, err := m.db.Exec(`INSERT OR REPLACE INTO admin_message_map (bot_token, chat_id, message_id, user_id, user_message_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, token, chatID, messageID, userID, userMessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to save message mapping for bot %s, admin %d message %d: %v", botIDFromToken(token), chatID, messageID, err)
+	}
+}
+
+// 根据某个聊天中转交的消息查找原始用户
+func (m *BotManager) lookupChatMapping(token string, chatID int64, messageID int) (int64, bool) {
+	if !m.isBotAdmin(token, chatID) {
+		userID, _, ok := m.lookupMessageMapping(token, messageID)
+		return userID, ok
+	}
+	var userID int64
+	err := m.db.QueryRow("SELECT user_id FROM admin_message_map WHERE bot_token = ? AND chat_id = ? AND message_id = ?",
+		token, chatID, messageID).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up message mapping for bot %s, admin %d message %d: %v", botIDFromToken(token), chatID, messageID, err)
+		}
+		return 0, false
+	}
+	return userID, true
+}
+
+// 把转交给创建者私聊的用户消息同样交给各位管理员。转交到群组时管理员在群组中查看，不再单独转交；
+// 某位管理员收不到时只记录日志，不影响其他人
+func (m *BotManager) relayToAdmins(bot *tgbotapi.BotAPI, dest int64, user *tgbotapi.User, chatID int64, messageID int) {
+	if dest < 0 {
+		return
+	}
+	token := bot.Token
+	for _, adminID := range m.botAdmins(token) {
+		sentID, err := m.relayToCreator(bot, adminID, chatID, messageID, user)
+		if err != nil {
+			log.Printf("Failed to relay message %d of user %d to admin %d for bot %s: %v", messageID, user.ID, adminID, botIDFromToken(token), err)
+			continue
+		}
+		m.saveChatMapping(token, adminID, sentID, user.ID, messageID)
+	}
+}
+
+// 相册同样整体交给各位管理员
+func (m *BotManager) relayAlbumToAdmins(album *pendingAlbum) {
+	if album.creatorID < 0 {
+		return
+	}
+	token := album.bot.Token
+	for _, adminID := range m.botAdmins(token) {
+		copied := *album
+		copied.creatorID = adminID
+		sentIDs, err := m.relayAlbum(&copied)
+		if err != nil {
+			log.Printf("Failed to relay album of user %d to admin %d for bot %s: %v", album.user.ID, adminID, botIDFromToken(token), err)
+			continue
+		}
+		for i, sentID := range sentIDs {
+			if i < len(album.messageIDs) {
+				m.saveChatMapping(token, adminID, sentID, album.user.ID, album.messageIDs[i])
+			}
+		}
+	}
+}
+
+// 处理 /addadmin <ID> 和 /removeadmin <ID>
+func (m *BotManager) handleAdminCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	command := message.Command()
+	userID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil || userID == m.creatorOf(token) {
+		if command == "addadmin" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/addadmin <ID> 添加管理员，管理员和你一样接收用户消息，回复转交的消息即可回答用户，也可以使用 /ban、/unban 等审核命令"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/removeadmin <ID>"))
+		}
+		return
+	}
+
+	if command == "removeadmin" {
+		res, err := m.db.Exec("DELETE FROM bot_roles WHERE bot_token = ? AND user_id = ? AND role = ?", token, userID, string(roleBotAdmin))
+		if err != nil {
+			log.Printf("Failed to remove admin %d of bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to remove admin")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("%d 不是管理员", userID)))
+			return
+		}
+		if _, err := m.db.Exec("DELETE FROM admin_message_map WHERE bot_token = ? AND chat_id = ?", token, userID); err != nil {
+			log.Printf("Failed to clear message mapping of admin %d for bot %s: %v", userID, botIDFromToken(token), err)
+		}
+		log.Printf("User %d removed admin %d from bot %s.", message.From.ID, userID, botIDFromToken(token))
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已移除管理员 %d", userID)))
+		bot.Send(tgbotapi.NewMessage(userID, fmt.Sprintf("你已不再是 @%s 的管理员", bot.Self.UserName)))
+		return
+	}
+
+	if err := m.grantBotRole(token, userID, roleBotAdmin, message.From.ID); err != nil {
+		log.Printf("Failed to add admin %d to bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add admin")))
+		return
+	}
+	log.Printf("User %d added admin %d to bot %s.", message.From.ID, userID, botIDFromToken(token))
+	// 机器人只能给启动过它的人发消息，通知失败时提醒对方先 /start
+	notice := fmt.Sprintf("你已被添加为 @%s 的管理员，用户的消息会转交给你，回复转交的消息即可回答用户", bot.Self.UserName)
+	if _, err := bot.Send(tgbotapi.NewMessage(userID, notice)); err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已添加管理员 %d，但暂时无法给对方发消息，请对方先向 @%s 发送 /start", userID, bot.Self.UserName)))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已添加管理员 %d", userID)))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 相册中的消息作为独立的更新到达，收到第一条后等待该时长再一起转交
+const albumWait = time.Second
+
+type pendingAlbum struct {
+	bot        *tgbotapi.BotAPI
+	creatorID  int64
+	chatID     int64
+	user       *tgbotapi.User
+	messageIDs []int
+}
+
+// 按机器人和 MediaGroupID 暂存的相册
+type albumBuffer struct {
+	mu     sync.Mutex
+	groups map[string]*pendingAlbum
+}
+
+func newAlbumBuffer() *albumBuffer {
+	return &albumBuffer{groups: make(map[string]*pendingAlbum)}
+}
+
+// 暂存相册中的一条消息，第一条消息到达 albumWait 后整个相册一起转交给创建者
+func (m *BotManager) bufferAlbum(bot *tgbotapi.BotAPI, creatorID int64, message *tgbotapi.Message) {
+	key := bot.Token + "/" + message.MediaGroupID
+	m.albums.mu.Lock()
+	defer m.albums.mu.Unlock()
+	album, ok := m.albums.groups[key]
+	if !ok {
+		album = &pendingAlbum{bot: bot, creatorID: creatorID, chatID: message.Chat.ID, user: message.From}
+		m.albums.groups[key] = album
+		// 交接时等待暂存的相册转交完毕
+		m.pollers.Add(1)
+		time.AfterFunc(albumWait, func() {
+			defer m.pollers.Done()
+			m.flushAlbum(key)
+		})
+	}
+	album.messageIDs = append(album.messageIDs, message.MessageID)
+}
+
+func (m *BotManager) flushAlbum(key string) {
+	m.albums.mu.Lock()
+	album := m.albums.groups[key]
+	delete(m.albums.groups, key)
+	m.albums.mu.Unlock()
+	if album == nil {
+		return
+	}
+	slices.Sort(album.messageIDs)
+
+	bot, token, userID := album.bot, album.bot.Token, album.user.ID
+	sentIDs, err := m.relayAlbum(album)
+	m.recordCreatorDelivery(bot, album.creatorID, err)
+	if err != nil {
+		log.Printf("Failed to forward album of %d messages from user %d for bot %s: %v", len(album.messageIDs), userID, botIDFromToken(token), err)
+		return
+	}
+	for i, sentID := range sentIDs {
+		if i < len(album.messageIDs) {
+			m.saveMessageMapping(token, sentID, userID, album.messageIDs[i])
+		}
+	}
+	metrics.add("forwardme_messages_forwarded_total", int64(len(sentIDs)), "bot", botIDFromToken(token))
+	m.meter(token, usageRelayed, len(sentIDs))
+	log.Printf("Album of %d messages forwarded successfully.", len(sentIDs))
+	m.archiveIncoming(bot, album.user, album.chatID, album.messageIDs...)
+	if len(sentIDs) > 0 {
+		m.attachForwardTools(bot, album.creatorID, sentIDs[0], userID, album.messageIDs[0])
+	}
+	m.relayAlbumToAdmins(album)
+}
+
+// 用 forwardMessages 把相册整体转交，复制模式下先发送来源说明再用 copyMessages 复制。
+// 两者都保留相册的分组和每条消息的说明文字。论坛模式下发到用户的话题，不需要来源说明
+func (m *BotManager) relayAlbum(album *pendingAlbum) ([]int, error) {
+	bot, token := album.bot, album.bot.Token
+	params := tgbotapi.Params{
+		"chat_id":      strconv.FormatInt(album.creatorID, 10),
+		"from_chat_id": strconv.FormatInt(album.chatID, 10),
+	}
+	if err := params.AddInterface("message_ids", album.messageIDs); err != nil {
+		return nil, err
+	}
+
+	method := "forwardMessages"
+	if forumID := m.forumChatID(token); forumID != 0 && album.creatorID == forumID {
+		threadID, err := m.userTopic(bot, forumID, album.user)
+		if err != nil {
+			return nil, err
+		}
+		params.AddNonZero("message_thread_id", threadID)
+		if m.relaysByCopy(token) {
+			method = "copyMessages"
+		}
+	} else if copying := m.relaysByCopy(token); copying || m.forwardNeedsHeader(token, album.user.ID) {
+		if copying {
+			method = "copyMessages"
+		}
+		if _, err := m.sendRelayHeader(bot, album.creatorID, album.user, album.messageIDs[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := bot.MakeRequest(method, params)
+	if err != nil {
+		return nil, err
+	}
+	var sent []tgbotapi.MessageID
+	if err := json.Unmarshal(resp.Result, &sent); err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(sent))
+	for i, s := range sent {
+		ids[i] = s.MessageID
+	}
+	return ids, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 普通用户可以使用的内置命令
+var userCommands = map[string]bool{
+	"report": true, "subscribe": true, "unsubscribe": true, "topics": true, "getcode": true,
+	"mydata": true, "stopforwarding": true, "timezone": true,
+}
+
+// 别名可以是中文等非 ASCII 文字，但这类别名不会出现在 Telegram 的命令菜单中
+func validAlias(alias string) bool {
+	return alias != "" && utf8.RuneCountInString(alias) <= 32 && !strings.ContainsAny(alias, " /@\n")
+}
+
+func (m *BotManager) lookupAlias(token, alias string) (string, bool) {
+	var command string
+	err := m.db.QueryRow("SELECT command FROM command_aliases WHERE bot_token = ? AND alias = ?", token, alias).Scan(&command)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up alias /%s of bot %s: %v", alias, botIDFromToken(token), err)
+		}
+		return "", false
+	}
+	return command, true
+}
+
+type commandAlias struct {
+	Alias, Command string
+}
+
+func (m *BotManager) listAliases(token string) ([]commandAlias, error) {
+	rows, err := m.db.Query("SELECT alias, command FROM command_aliases WHERE bot_token = ? ORDER BY command, alias", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []commandAlias
+	for rows.Next() {
+		var a commandAlias
+		if err := rows.Scan(&a.Alias, &a.Command); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// 把以别名开头的消息改写成对应的内置命令，之后的路由照常处理。
+// Telegram 不会把中文等别名标记为命令，所以这里直接看文本
+func (m *BotManager) resolveCommandAlias(token string, message *tgbotapi.Message) {
+	if !strings.HasPrefix(message.Text, "/") {
+		return
+	}
+	first, args, _ := strings.Cut(message.Text, " ")
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first, args = first[:i], message.Text[i+1:]
+	}
+	alias, _, _ := strings.Cut(strings.TrimPrefix(first, "/"), "@")
+	command, ok := m.lookupAlias(token, strings.ToLower(alias))
+	if !ok {
+		return
+	}
+
+	text := "/" + command
+	entity := tgbotapi.MessageEntity{Type: "bot_command", Offset: 0, Length: len(text)}
+	if args != "" {
+		text += " " + args
+	}
+	message.Text = text
+	message.Entities = []tgbotapi.MessageEntity{entity}
+}
+
+// 处理 /alias 和 /unalias
+func (m *BotManager) handleAliasCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	fields := strings.Fields(message.CommandArguments())
+	for i := range fields {
+		fields[i] = strings.ToLower(strings.TrimPrefix(fields[i], "/"))
+	}
+	usage := "用法：/alias <别名> <内置命令>，例如 /alias block ban 或 /alias 封禁 ban；/unalias <别名> 删除；/alias 查看列表"
+
+	if message.Command() == "unalias" {
+		if len(fields) != 1 {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		res, err := m.db.Exec("DELETE FROM command_aliases WHERE bot_token = ? AND alias = ?", token, fields[0])
+		if err != nil {
+			log.Printf("Failed to delete alias /%s of bot %s: %v", fields[0], botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete alias")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "别名不存在：/"+fields[0]))
+			return
+		}
+		m.syncCommands(bot)
+		bot.Send(tgbotapi.NewMessage(creatorID, "已删除别名 /"+fields[0]))
+		return
+	}
+
+	switch len(fields) {
+	case 0:
+		aliases, err := m.listAliases(token)
+		if err != nil {
+			log.Printf("Failed to list aliases of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list aliases")))
+			return
+		}
+		if len(aliases) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无命令别名。\n"+usage))
+			return
+		}
+		var b strings.Builder
+		for _, a := range aliases {
+			fmt.Fprintf(&b, "/%s → /%s\n", a.Alias, a.Command)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+	case 2:
+		alias, command := fields[0], fields[1]
+		if !validAlias(alias) {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		if !builtinCommands[command] || command == "alias" || command == "unalias" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "/"+command+" 不是可以设置别名的内置命令"))
+			return
+		}
+		if builtinCommands[alias] {
+			bot.Send(tgbotapi.NewMessage(creatorID, "/"+alias+" 是内置命令，不能用作别名"))
+			return
+		}
+		var isCustom bool
+		m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM custom_commands WHERE bot_token = ? AND name = ?)", token, alias).Scan(&isCustom)
+		if isCustom {
+			bot.Send(tgbotapi.NewMessage(creatorID, "/"+alias+" 已经是自定义命令"))
+			return
+		}
+		_, err := m.db.Exec(`INSERT INTO command_aliases (bot_token, alias, command, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (bot_token, alias) DO UPDATE SET command = excluded.command`, token, alias, command, time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to add alias /%s of bot %s: %v", alias, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add alias")))
+			return
+		}
+		m.syncCommands(bot)
+		reply := fmt.Sprintf("已添加别名 /%s → /%s", alias, command)
+		if !commandNamePattern.MatchString(alias) {
+			reply += "\n该别名含有 Telegram 命令名不支持的字符，可以直接输入使用，但不会出现在命令菜单中"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, reply))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
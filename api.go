@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 幂等键默认保留时间，期间使用相同键的重试直接返回第一次的结果
+const defaultIdempotencyWindow = 24 * time.Hour
+
+type apiSendRequest struct {
+	BotID  string `json:"bot_id"`
+	UserID int64  `json:"user_id"`
+	Text   string `json:"text"`
+}
+
+type apiBroadcastRequest struct {
+	BotID string `json:"bot_id"`
+	Label string `json:"label"`
+	Topic string `json:"topic"`
+	Text  string `json:"text"`
+}
+
+type apiResponse struct {
+	status int
+	body   interface{}
+}
+
+// 注册管理 API，每个接口要求相应的 token 权限范围
+func (m *BotManager) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/bots", m.apiHandler(permRead, m.apiListBots))
+	mux.HandleFunc("POST /api/ban", m.apiHandler(permModerate, m.apiBan))
+	mux.HandleFunc("POST /api/unban", m.apiHandler(permModerate, m.apiBan))
+	mux.HandleFunc("POST /api/send", m.apiHandler(permMessage, m.apiSend))
+	mux.HandleFunc("POST /api/broadcast", m.apiHandler(permMessage, m.apiBroadcast))
+	mux.HandleFunc("GET /api/usage", m.apiHandler(permRead, m.apiUsage))
+	mux.HandleFunc("GET /api/creators/{creator}/plan", m.apiHandler(permRead, m.apiGetPlan))
+	mux.HandleFunc("PUT /api/creators/{creator}/plan", m.apiHandler(permManage, m.apiSetPlan))
+}
+
+// 校验 Bearer token 及其权限范围，并按 Idempotency-Key 去重：同一个 token 的同一个键在保留期内只执行一次，
+// 之后的重试返回第一次的结果，第一次仍在处理时返回 409，请求内容与第一次不同时返回 422
+func (m *BotManager) apiHandler(scope string, handle func(r *http.Request) apiResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		have, tokenID, ok := m.authenticateAPI(r)
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if !permissionAllows(have, scope) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "token lacks the " + scope + " scope"})
+			return
+		}
+
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			resp := handle(r)
+			writeJSON(w, resp.status, resp.body)
+			return
+		}
+		key = tokenID + " " + r.URL.Path + " " + key
+
+		// 记录请求内容的摘要，键被用于不同的请求时拒绝，而不是返回另一个请求的结果
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read request body"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+		sum := sha256.Sum256([]byte(r.URL.RawQuery + "\n" + string(payload)))
+		requestHash := hex.EncodeToString(sum[:])
+
+		res, err := m.db.Exec("INSERT OR IGNORE INTO idempotency_keys (key, request_hash, status, response, created_at) VALUES (?, ?, 0, '', ?)",
+			key, requestHash, time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to store idempotency key: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var status int
+			var storedHash, response string
+			if err := m.db.QueryRow("SELECT request_hash, status, response FROM idempotency_keys WHERE key = ?", key).Scan(&storedHash, &status, &response); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+			if storedHash != requestHash {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "idempotency key was already used for a different request"})
+				return
+			}
+			if status == 0 {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "a request with this idempotency key is in progress"})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(status)
+			w.Write([]byte(response))
+			return
+		}
+
+		resp := handle(r)
+		body, _ := json.Marshal(resp.body)
+		if resp.status >= http.StatusInternalServerError {
+			// 服务端错误允许用相同的键重试
+			m.db.Exec("DELETE FROM idempotency_keys WHERE key = ?", key)
+		} else if _, err := m.db.Exec("UPDATE idempotency_keys SET status = ?, response = ? WHERE key = ?", resp.status, string(body), key); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		w.Write(body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func apiError(status int, message string) apiResponse {
+	return apiResponse{status, map[string]string{"error": message}}
+}
+
+// 按机器人 ID（token 冒号前的部分）查找运行中的机器人
+func (m *BotManager) botByID(id string) (*tgbotapi.BotAPI, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for token, bot := range m.bots {
+		if botIDFromToken(token) == id {
+			return bot, true
+		}
+	}
+	return nil, false
+}
+
+type apiBot struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	CreatorID int64  `json:"creator_id"`
+}
+
+func (m *BotManager) apiListBots(r *http.Request) apiResponse {
+	m.mu.RLock()
+	bots := make([]apiBot, 0, len(m.bots))
+	for token, bot := range m.bots {
+		bots = append(bots, apiBot{ID: botIDFromToken(token), Username: bot.Self.UserName, CreatorID: m.creator[token]})
+	}
+	m.mu.RUnlock()
+	sort.Slice(bots, func(i, j int) bool { return bots[i].ID < bots[j].ID })
+	return apiResponse{http.StatusOK, map[string][]apiBot{"bots": bots}}
+}
+
+type apiBanRequest struct {
+	BotID  string `json:"bot_id"`
+	UserID int64  `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// /api/ban 和 /api/unban
+func (m *BotManager) apiBan(r *http.Request) apiResponse {
+	var req apiBanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		return apiError(http.StatusBadRequest, "bot_id and user_id are required")
+	}
+	bot, ok := m.botByID(req.BotID)
+	if !ok {
+		return apiError(http.StatusNotFound, "bot not found")
+	}
+	var err error
+	action := eventBan
+	if r.URL.Path == "/api/ban" {
+		err = m.blockUser(bot.Token, req.UserID, req.Reason)
+	} else {
+		action = eventUnban
+		err = m.unblockUser(bot.Token, req.UserID)
+	}
+	if err != nil {
+		return apiError(http.StatusInternalServerError, "failed to update block list")
+	}
+	m.logEvent(bot.Token, 0, action, req.UserID, "api: "+req.Reason)
+	return apiResponse{http.StatusOK, map[string]bool{"banned": m.isUserBlocked(bot.Token, req.UserID)}}
+}
+
+func (m *BotManager) apiSend(r *http.Request) apiResponse {
+	var req apiSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 || req.Text == "" {
+		return apiError(http.StatusBadRequest, "bot_id, user_id and text are required")
+	}
+	bot, ok := m.botByID(req.BotID)
+	if !ok {
+		return apiError(http.StatusNotFound, "bot not found")
+	}
+	if m.isUserBlocked(bot.Token, req.UserID) {
+		return apiError(http.StatusForbidden, "user is banned")
+	}
+	sent, err := bot.Send(tgbotapi.NewMessage(req.UserID, m.expandUserVars(bot.Token, req.UserID, req.Text)))
+	if err != nil {
+		log.Printf("API send to user %d via bot %s failed: %v", req.UserID, req.BotID, err)
+		return apiError(http.StatusBadGateway, err.Error())
+	}
+	m.logEvent(bot.Token, 0, eventSend, req.UserID, "api: "+m.storedText(bot.Token, truncateText(req.Text, 200)))
+	return apiResponse{http.StatusOK, map[string]int{"message_id": sent.MessageID}}
+}
+
+// 群发在后台进行，立即返回收件人数量
+func (m *BotManager) apiBroadcast(r *http.Request) apiResponse {
+	var req apiBroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		return apiError(http.StatusBadRequest, "bot_id and text are required")
+	}
+	bot, ok := m.botByID(req.BotID)
+	if !ok {
+		return apiError(http.StatusNotFound, "bot not found")
+	}
+	recipients, err := m.broadcastRecipients(bot.Token, audience{Label: req.Label, Topic: req.Topic})
+	var limitErr *planLimitError
+	if errors.As(err, &limitErr) {
+		return apiError(http.StatusForbidden, limitErr.Error())
+	}
+	if err != nil {
+		log.Printf("Failed to load API broadcast recipients of bot %s: %v", req.BotID, err)
+		return apiError(http.StatusInternalServerError, "failed to load recipients")
+	}
+	go func() {
+		sent, failed := m.broadcastText(bot, recipients, req.Text)
+		log.Printf("API broadcast via bot %s sent to %d users, %d failed.", req.BotID, sent, failed)
+		target := audience{Label: req.Label, Topic: req.Topic}
+		m.logEvent(bot.Token, 0, eventBroadcast, 0, fmt.Sprintf("api %s，成功 %d，失败 %d: %s", target, sent, failed, m.storedText(bot.Token, truncateText(req.Text, 200))))
+	}()
+	return apiResponse{http.StatusAccepted, map[string]int{"recipients": len(recipients)}}
+}
+
+// 定期清理超过保留期的幂等键
+func (m *BotManager) runIdempotencyCleanup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-m.idempotencyWindow).Unix()
+		if _, err := m.db.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", cutoff); err != nil {
+			log.Printf("Failed to clean up idempotency keys: %v", err)
+		}
+	}
+}
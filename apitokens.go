@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// API token 的权限范围与角色使用同一套权限
+var apiScopes = []string{permRead, permModerate, permMessage, permManage}
+
+func validScope(scope string) bool {
+	for _, s := range apiScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成新的 token，只保存哈希，明文只在创建时展示一次
+func (m *BotManager) createAPIToken(name, scope string, createdBy int64) (id int64, token string, err error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return 0, "", err
+	}
+	token = "fm_" + hex.EncodeToString(secret)
+	res, err := m.db.Exec("INSERT INTO api_tokens (name, token_hash, scope, created_by, created_at) VALUES (?, ?, ?, ?, ?)",
+		name, hashAPIToken(token), scope, createdBy, time.Now().Unix())
+	if err != nil {
+		return 0, "", err
+	}
+	id, _ = res.LastInsertId()
+	return id, token, nil
+}
+
+// 根据 Authorization 头返回调用方的权限范围和 token 编号，环境变量 API_TOKEN 拥有 admin 权限，编号为 env
+func (m *BotManager) authenticateAPI(r *http.Request) (scope, tokenID string, ok bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", "", false
+	}
+	if m.apiToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(m.apiToken)) == 1 {
+		return permManage, "env", true
+	}
+
+	var id int64
+	err := m.db.QueryRow("SELECT id, scope FROM api_tokens WHERE token_hash = ? AND revoked_at = 0", hashAPIToken(token)).Scan(&id, &scope)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up API token: %v", err)
+		}
+		return "", "", false
+	}
+	m.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now().Unix(), id)
+	return scope, strconv.FormatInt(id, 10), true
+}
+
+// 处理运营者的 /apitoken
+func (m *BotManager) handleAPITokenCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	fields := strings.Fields(message.CommandArguments())
+	usage := "用法：\n/apitoken create <read|moderation|messaging|admin> [名称]\n/apitoken revoke <编号>\n/apitoken 查看列表"
+
+	switch {
+	case len(fields) == 0:
+		rows, err := m.db.Query("SELECT id, name, scope, created_at, last_used_at FROM api_tokens WHERE revoked_at = 0 ORDER BY id")
+		if err != nil {
+			log.Printf("Failed to list API tokens: %v", err)
+			managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to list API tokens.")))
+			return
+		}
+		defer rows.Close()
+		var b strings.Builder
+		for rows.Next() {
+			var id, createdAt, lastUsed int64
+			var name, scope string
+			if err := rows.Scan(&id, &name, &scope, &createdAt, &lastUsed); err != nil {
+				continue
+			}
+			used := "从未使用"
+			if lastUsed > 0 {
+				used = "最近使用 " + time.Unix(lastUsed, 0).Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(&b, "#%d %s [%s] 创建于 %s，%s\n", id, name, scope, time.Unix(createdAt, 0).Format("2006-01-02"), used)
+		}
+		if b.Len() == 0 {
+			managerBot.Send(tgbotapi.NewMessage(chatID, "暂无 API token。\n"+usage))
+			return
+		}
+		managerBot.Send(tgbotapi.NewMessage(chatID, b.String()))
+	case fields[0] == "create" && len(fields) >= 2 && validScope(fields[1]):
+		name := strings.Join(fields[2:], " ")
+		if name == "" {
+			name = fields[1]
+		}
+		id, token, err := m.createAPIToken(name, fields[1], message.From.ID)
+		if err != nil {
+			log.Printf("Failed to create API token: %v", err)
+			managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to create API token.")))
+			return
+		}
+		log.Printf("Operator %d created API token #%d with scope %s.", message.From.ID, id, fields[1])
+		m.logEvent("", message.From.ID, eventTokenCreate, 0, fmt.Sprintf("#%d %s [%s]", id, name, fields[1]))
+		managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("已创建 API token #%d [%s]：\n%s\n请立即保存，之后无法再次查看", id, fields[1], token)))
+	case fields[0] == "revoke" && len(fields) == 2:
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			managerBot.Send(tgbotapi.NewMessage(chatID, usage))
+			return
+		}
+		res, err := m.db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at = 0", time.Now().Unix(), id)
+		if err != nil {
+			log.Printf("Failed to revoke API token #%d: %v", id, err)
+			managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to revoke API token.")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("API token #%d 不存在或已撤销", id)))
+			return
+		}
+		log.Printf("Operator %d revoked API token #%d.", message.From.ID, id)
+		m.logEvent("", message.From.ID, eventTokenRevoke, 0, fmt.Sprintf("#%d", id))
+		managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("已撤销 API token #%d", id)))
+	default:
+		managerBot.Send(tgbotapi.NewMessage(chatID, usage))
+	}
+}
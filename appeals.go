@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// 申诉处理结果
+const (
+	appealPending  = ""
+	appealApproved = "approved"
+	appealRejected = "rejected"
+)
+
+// token 冒号前的部分是机器人的数字 ID，可以公开用于日志和指标
+func botIDFromToken(token string) string {
+	if i := strings.Index(token, ":"); i > 0 {
+		return token[:i]
+	}
+	return "unknown"
+}
+
+func (m *BotManager) recordAppeal(token string, userID int64, text string) {
+	_, err := m.db.Exec("INSERT INTO appeals (bot_token, user_id, message, outcome, created_at) VALUES (?, ?, ?, ?, ?)",
+		token, userID, m.storedText(token, text), appealPending, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to record appeal of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return
+	}
+	metrics.inc("forwardme_appeals_total", "bot", botIDFromToken(token))
+}
+
+// 将该用户所有待处理的申诉标记为指定结果
+func (m *BotManager) resolveAppeals(token string, userID int64, outcome string) {
+	_, err := m.db.Exec("UPDATE appeals SET outcome = ?, resolved_at = ? WHERE bot_token = ? AND user_id = ? AND outcome = ?",
+		outcome, time.Now().Unix(), token, userID, appealPending)
+	if err != nil {
+		log.Printf("Failed to resolve appeals of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+type appealStats struct {
+	Total    int
+	Recent   int
+	Pending  int
+	Approved int
+	Rejected int
+}
+
+// 申诉通过率，只统计已处理的申诉
+func (s appealStats) approvalRate() float64 {
+	resolved := s.Approved + s.Rejected
+	if resolved == 0 {
+		return 0
+	}
+	return float64(s.Approved) / float64(resolved) * 100
+}
+
+func (m *BotManager) getAppealStats(since time.Time) (appealStats, error) {
+	var s appealStats
+	err := m.db.QueryRow(`SELECT
+			COUNT(*),
+			COALESCE(SUM(created_at >= ?), 0),
+			COALESCE(SUM(outcome = ?), 0),
+			COALESCE(SUM(outcome = ?), 0),
+			COALESCE(SUM(outcome = ?), 0)
+		FROM appeals`, since.Unix(), appealPending, appealApproved, appealRejected).
+		Scan(&s.Total, &s.Recent, &s.Pending, &s.Approved, &s.Rejected)
+	return s, err
+}
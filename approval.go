@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (m *BotManager) approvalEnabled(token string) bool {
+	var enabled bool
+	err := m.db.QueryRow("SELECT approval_mode FROM bots WHERE token = ?", token).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get approval mode of bot %s: %v", botIDFromToken(token), err)
+	}
+	return enabled
+}
+
+func (m *BotManager) isApproved(token string, userID int64) bool {
+	var approved bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM approved_users WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&approved)
+	if err != nil {
+		log.Printf("Failed to get approval of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return approved
+}
+
+// 审核模式下新用户的第一条消息先交给创建者审核，通过前不转发任何消息
+func (m *BotManager) holdForApproval(bot *tgbotapi.BotAPI, creatorID int64, message *tgbotapi.Message) bool {
+	token, userID := bot.Token, message.From.ID
+	if !m.approvalEnabled(token) || m.isApproved(token, userID) || m.isVIP(token, userID) {
+		return false
+	}
+
+	res, err := m.db.Exec(`INSERT OR IGNORE INTO pending_approvals (bot_token, user_id, chat_id, message_id, created_at)
+		VALUES (?, ?, ?, ?, ?)`, token, userID, message.Chat.ID, message.MessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to hold message of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		bot.Send(tgbotapi.NewMessage(userID, "你的第一条消息正在等待审核，通过后即可继续发送。"))
+		return true
+	}
+
+	card := tgbotapi.NewMessage(creatorID, fmt.Sprintf("🆕 新用户 %s (ID: %d) 请求联系你：\n\n%s",
+		displayName(message.From.UserName, message.From.FirstName, message.From.LastName), userID, messagePreview(message)))
+	card.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("通过", signCallback(token, cbApprove, userID)),
+		tgbotapi.NewInlineKeyboardButtonData("拒绝", signCallback(token, cbReject, userID)),
+	))
+	if _, err := bot.Send(card); err != nil {
+		log.Printf("Failed to send approval request of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	metrics.inc("forwardme_approvals_requested_total", "bot", botIDFromToken(token))
+	bot.Send(tgbotapi.NewMessage(userID, "消息已提交审核，通过后会转交给对方。"))
+	return true
+}
+
+// 处理审核卡片上的通过和拒绝按钮，返回是否已处理
+func (m *BotManager) handleApprovalCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData, creatorID int64) bool {
+	if cb.Action != cbApprove && cb.Action != cbReject {
+		return false
+	}
+	if query.Message == nil {
+		return true
+	}
+	token := bot.Token
+	userID, ok := cb.int(0)
+	if !ok {
+		log.Printf("Invalid approval callback: %s", query.Data)
+		return true
+	}
+
+	var chatID int64
+	var messageID int
+	err := m.db.QueryRow("SELECT chat_id, message_id FROM pending_approvals WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&chatID, &messageID)
+	if err != nil {
+		bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\n已处理"))
+		return true
+	}
+
+	var status string
+	if cb.Action == cbApprove {
+		if _, err := m.db.Exec("INSERT OR IGNORE INTO approved_users (bot_token, user_id, approved_at) VALUES (?, ?, ?)", token, userID, time.Now().Unix()); err != nil {
+			log.Printf("Failed to approve user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to approve user")))
+			return true
+		}
+		m.forwardUserMessage(bot, creatorID, chatID, userID, messageID)
+		bot.Send(tgbotapi.NewMessage(userID, "你的消息已通过审核，现在可以直接发送消息了。"))
+		status = "✅ 已通过"
+	} else {
+		if err := m.blockUser(token, userID, "首条消息未通过审核"); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to block user")))
+			return true
+		}
+		m.logEvent(token, query.From.ID, eventBan, userID, "首条消息未通过审核")
+		status = "⛔ 已拒绝"
+	}
+	if _, err := m.db.Exec("DELETE FROM pending_approvals WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+		log.Printf("Failed to remove pending approval of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\n"+status))
+	return true
+}
+
+// 处理 /approval on|off，开启时已联系过的用户自动视为已通过
+func (m *BotManager) handleApprovalCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "on":
+		if _, err := m.db.Exec(`INSERT OR IGNORE INTO approved_users (bot_token, user_id, approved_at)
+			SELECT DISTINCT bot_token, user_id, ? FROM message_map WHERE bot_token = ?`, time.Now().Unix(), token); err != nil {
+			log.Printf("Failed to approve existing users of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to enable approval mode")))
+			return
+		}
+		if _, err := m.db.Exec("UPDATE bots SET approval_mode = 1 WHERE token = ?", token); err != nil {
+			log.Printf("Failed to update approval mode of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to enable approval mode")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已开启审核模式，新用户的第一条消息需要你通过后才会转发。已联系过你的用户不受影响"))
+	case "off":
+		if _, err := m.db.Exec("UPDATE bots SET approval_mode = 0 WHERE token = ?", token); err != nil {
+			log.Printf("Failed to update approval mode of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to disable approval mode")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已关闭审核模式，等待审核的消息仍可在原卡片上处理"))
+	default:
+		state := "关闭"
+		if m.approvalEnabled(token) {
+			state = "开启"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "审核模式："+state+"\n用法：/approval on 或 /approval off"))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 存档频道，未设置时为 0
+func (m *BotManager) archiveChatID(token string) int64 {
+	var chatID int64
+	err := m.db.QueryRow("SELECT archive_chat_id FROM bots WHERE token = ?", token).Scan(&chatID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get archive chat of bot %s: %v", botIDFromToken(token), err)
+	}
+	return chatID
+}
+
+// 存档频道使用的熔断器，每个机器人一个
+func archiveBreakerName(token string) string {
+	return "archive:" + botIDFromToken(token)
+}
+
+// 把一批消息连同说明复制到存档频道。在后台进行，不等待也不影响主要的转交；
+// 存档频道持续出错时由熔断器暂停存档，恢复后自动继续，期间的消息不再补发
+func (m *BotManager) archiveMessages(bot *tgbotapi.BotAPI, header string, fromChatID int64, messageIDs ...int) {
+	token := bot.Token
+	archiveID := m.archiveChatID(token)
+	if archiveID == 0 || len(messageIDs) == 0 {
+		return
+	}
+	go func() {
+		// 同一机器人的存档依次发送，说明和消息不会与其他存档交错
+		lock, _ := m.archiveLocks.LoadOrStore(token, &sync.Mutex{})
+		lock.(*sync.Mutex).Lock()
+		defer lock.(*sync.Mutex).Unlock()
+
+		err := breakers.get(archiveBreakerName(token)).call(func() error {
+			headerMsg := tgbotapi.NewMessage(archiveID, header)
+			headerMsg.DisableNotification = true
+			if _, err := bot.Send(headerMsg); err != nil {
+				return err
+			}
+			params := tgbotapi.Params{
+				"chat_id":      strconv.FormatInt(archiveID, 10),
+				"from_chat_id": strconv.FormatInt(fromChatID, 10),
+			}
+			params.AddBool("disable_notification", true)
+			if err := params.AddInterface("message_ids", messageIDs); err != nil {
+				return err
+			}
+			_, err := bot.MakeRequest("copyMessages", params)
+			return err
+		})
+		if err != nil {
+			metrics.inc("forwardme_archive_failures_total", "bot", botIDFromToken(token))
+			if err != errBreakerOpen {
+				log.Printf("Failed to archive %d messages from chat %d for bot %s: %v", len(messageIDs), fromChatID, botIDFromToken(token), err)
+			}
+		}
+	}()
+}
+
+// 存档一条转交给创建者的用户消息
+func (m *BotManager) archiveIncoming(bot *tgbotapi.BotAPI, user *tgbotapi.User, chatID int64, messageIDs ...int) {
+	m.archiveMessages(bot, relayHeader(user), chatID, messageIDs...)
+}
+
+// 存档一条发给用户的回复，复制的是用户实际收到的消息
+func (m *BotManager) archiveOutgoing(bot *tgbotapi.BotAPI, operator *tgbotapi.User, userID int64, messageID int) {
+	header := fmt.Sprintf("📤 %s 回复 %s", userDisplayName(operator), relayHeader(m.knownUser(bot.Token, userID)))
+	m.archiveMessages(bot, header, userID, messageID)
+}
+
+// 处理 /archive <频道 ID>|off
+func (m *BotManager) handleArchiveCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/archive <频道 ID> 把所有用户消息和回复另外复制一份到私有频道存档，机器人需要是频道管理员并能发布消息；存档失败不影响消息转交。/archive off 停止存档"
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "未开启"
+		if archiveID := m.archiveChatID(token); archiveID != 0 {
+			state = fmt.Sprintf("频道 %d", archiveID)
+			if status := breakers.get(archiveBreakerName(token)).status(); status.State != "closed" {
+				state += fmt.Sprintf("（连续 %d 次失败，已暂停存档，稍后自动重试）", status.Failures)
+			}
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "存档："+state+"\n"+usage))
+		return
+	}
+
+	var archiveID int64
+	if arg != "off" {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id >= 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		chat, err := bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: id}})
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to check archive channel")))
+			return
+		}
+		if !chat.IsChannel() {
+			bot.Send(tgbotapi.NewMessage(creatorID, "只能存档到频道"))
+			return
+		}
+		// 先发一条消息确认机器人可以在频道中发布
+		if _, err := bot.Send(tgbotapi.NewMessage(id, "🗄 @"+bot.Self.UserName+" 的消息将存档到这里")); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to post to archive channel")))
+			return
+		}
+		archiveID = id
+	}
+
+	if _, err := m.db.Exec("UPDATE bots SET archive_chat_id = ? WHERE token = ?", archiveID, token); err != nil {
+		log.Printf("Failed to update archive chat of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update archive channel")))
+		return
+	}
+	if archiveID == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已停止存档"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户消息和回复将同时存档到频道 %d", archiveID)))
+	}
+}
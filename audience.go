@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// 群发的目标人群：按标签或话题筛选，都为空时为全部用户
+type audience struct {
+	Label string
+	Topic string
+}
+
+func (a audience) String() string {
+	switch {
+	case a.Label != "":
+		return "#" + a.Label
+	case a.Topic != "":
+		return "话题 " + a.Topic
+	}
+	return "全部用户"
+}
+
+// 从参数开头解析 "#标签" 或 "topic:话题"，返回剩余文本
+func parseAudience(args string) (audience, string) {
+	args = strings.TrimSpace(args)
+	first, rest, _ := strings.Cut(args, " ")
+	if i := strings.IndexAny(first, "\n"); i >= 0 {
+		first, rest = first[:i], args[i:]
+	}
+	var a audience
+	switch {
+	case strings.HasPrefix(first, "#") && len(first) > 1:
+		a.Label = strings.TrimPrefix(first, "#")
+	case strings.HasPrefix(first, "topic:") && len(first) > len("topic:"):
+		a.Topic = strings.TrimPrefix(first, "topic:")
+	default:
+		return a, args
+	}
+	return a, strings.TrimSpace(rest)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 离开期间同一用户最多每隔这么久收到一次自动回复
+const awayRepeatAfter = 6 * time.Hour
+
+// 离开模式的自动回复，未开启时为空
+func (m *BotManager) awayText(token string) string {
+	var text string
+	err := m.db.QueryRow("SELECT away_text FROM bots WHERE token = ?", token).Scan(&text)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get away text of bot %s: %v", botIDFromToken(token), err)
+	}
+	return text
+}
+
+// 离开模式下给用户发送自动回复，消息照常转交。记录发送时间和发送在同一条语句中判断，
+// 同一用户的多条消息（包括相册的每一项）只回复一次
+func (m *BotManager) sendAwayReply(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token := bot.Token
+	text := m.awayText(token)
+	if text == "" {
+		return
+	}
+	userID := message.From.ID
+	now := time.Now()
+	res, err := m.db.Exec(`INSERT INTO away_replies (bot_token, user_id, sent_at) VALUES (?, ?, ?)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET sent_at = excluded.sent_at WHERE sent_at <= ?`,
+		token, userID, now.Unix(), now.Add(-awayRepeatAfter).Unix())
+	if err != nil {
+		log.Printf("Failed to record away reply to user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	if _, err := bot.Send(tgbotapi.NewMessage(message.Chat.ID, m.expandUserVars(token, userID, text))); err != nil {
+		log.Printf("Failed to send away reply to user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+// 设置离开模式的自动回复，text 为空时关闭。重新设置后每位用户都会再收到一次
+func (m *BotManager) setAwayText(token, text string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE bots SET away_text = ? WHERE token = ?", text, token); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM away_replies WHERE bot_token = ?", token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 处理 /away <自动回复> 和 /back
+func (m *BotManager) handleAwayCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	text := strings.TrimSpace(message.CommandArguments())
+	if message.Command() == "away" && text == "" {
+		usage := fmt.Sprintf("用法：/away <自动回复> 开启离开模式，用户发来消息时自动回复，同一用户每 %d 小时最多一次，消息照常转交给你；可以用 {{变量名}} 引用用户变量。/back 关闭离开模式", int(awayRepeatAfter.Hours()))
+		if current := m.awayText(token); current != "" {
+			usage = "离开模式已开启，自动回复：\n" + current + "\n\n" + usage
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if message.Command() == "back" {
+		text = ""
+	}
+
+	if err := m.setAwayText(token, text); err != nil {
+		log.Printf("Failed to update away text of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update away mode")))
+		return
+	}
+	if text == "" {
+		log.Printf("User %d turned off away mode of bot %s.", message.From.ID, botIDFromToken(token))
+		bot.Send(tgbotapi.NewMessage(creatorID, "欢迎回来，离开模式已关闭"))
+		return
+	}
+	log.Printf("User %d turned on away mode of bot %s.", message.From.ID, botIDFromToken(token))
+	bot.Send(tgbotapi.NewMessage(creatorID, "离开模式已开启，用户发来消息时会收到自动回复，发送 /back 关闭"))
+}
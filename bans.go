@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 封禁列表每页显示的条数
+const banListPageSize = 10
+
+type banEntry struct {
+	UserID   int64
+	Name     string
+	Reason   string
+	BannedAt time.Time
+}
+
+// 记录与机器人交互过的用户资料和消息数，用于在列表中显示用户名
+func (m *BotManager) recordUser(token string, user *tgbotapi.User) {
+	if user == nil {
+		return
+	}
+	now := time.Now().Unix()
+	if m.userWrites.add(token, user, now) {
+		return
+	}
+	_, err := m.db.Exec(`INSERT INTO bot_users (bot_token, user_id, username, first_name, last_name, language_code, first_seen, last_seen, message_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET
+			username = excluded.username,
+			first_name = excluded.first_name,
+			last_name = excluded.last_name,
+			language_code = COALESCE(NULLIF(excluded.language_code, ''), language_code),
+			last_seen = excluded.last_seen,
+			message_count = message_count + 1`,
+		token, user.ID, user.UserName, user.FirstName, user.LastName, user.LanguageCode, now, now)
+	if err != nil {
+		log.Printf("Failed to record user %d for bot %s: %v", user.ID, botIDFromToken(token), err)
+		return
+	}
+	m.userWrites.markKnown(token, user.ID)
+}
+
+// 用户的显示名称，优先使用 @username
+func displayName(username, firstName, lastName string) string {
+	if username != "" {
+		return "@" + username
+	}
+	return strings.TrimSpace(firstName + " " + lastName)
+}
+
+func (m *BotManager) listBans(token string, page int) (entries []banEntry, total int, err error) {
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM bans WHERE bot_token = ?", token).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := m.db.Query(`SELECT b.user_id, b.reason, b.banned_at,
+			COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, '')
+		FROM bans b
+		LEFT JOIN bot_users u ON u.bot_token = b.bot_token AND u.user_id = b.user_id
+		WHERE b.bot_token = ?
+		ORDER BY b.banned_at DESC, b.user_id
+		LIMIT ? OFFSET ?`, token, banListPageSize, page*banListPageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e banEntry
+		var bannedAt int64
+		var username, firstName, lastName string
+		if err := rows.Scan(&e.UserID, &e.Reason, &bannedAt, &username, &firstName, &lastName); err != nil {
+			return nil, 0, err
+		}
+		e.BannedAt = time.Unix(bannedAt, 0)
+		e.Name = displayName(username, firstName, lastName)
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// 生成封禁列表某一页的文本和按钮
+func (m *BotManager) renderBanList(token string, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	entries, total, err := m.listBans(token, page)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return "当前没有封禁用户", nil, nil
+	}
+
+	pages := (total + banListPageSize - 1) / banListPageSize
+	if page >= pages {
+		return m.renderBanList(token, pages-1)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "封禁列表（共 %d 人，第 %d/%d 页）\n\n", total, page+1, pages)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, e := range entries {
+		name := e.Name
+		if name == "" {
+			name = "未知用户"
+		}
+		fmt.Fprintf(&b, "%d. %s (ID: %d)\n   封禁时间: %s\n", page*banListPageSize+i+1, name, e.UserID, e.BannedAt.Format("2006-01-02 15:04"))
+		if e.Reason != "" {
+			fmt.Fprintf(&b, "   原因: %s\n", e.Reason)
+		}
+		label := fmt.Sprintf("解封 %s", name)
+		if e.Name == "" {
+			label = fmt.Sprintf("解封 %d", e.UserID)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, signCallback(token, cbBanListUnban, e.UserID, page)),
+		))
+	}
+
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("« 上一页", signCallback(token, cbBanListPage, page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("下一页 »", signCallback(token, cbBanListPage, page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return b.String(), &keyboard, nil
+}
+
+func (m *BotManager) sendBanList(bot *tgbotapi.BotAPI, chatID int64, page int) {
+	text, keyboard, err := m.renderBanList(bot.Token, page)
+	if err != nil {
+		log.Printf("Failed to get blocked users for bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to get blocked users.")))
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send ban list for bot %s: %v", botIDFromToken(bot.Token), err)
+	}
+}
+
+// 翻页或解封后原地刷新封禁列表消息
+func (m *BotManager) refreshBanList(bot *tgbotapi.BotAPI, message *tgbotapi.Message, page int) {
+	text, keyboard, err := m.renderBanList(bot.Token, page)
+	if err != nil {
+		log.Printf("Failed to get blocked users for bot %s: %v", botIDFromToken(bot.Token), err)
+		return
+	}
+	var edit tgbotapi.EditMessageTextConfig
+	if keyboard != nil {
+		edit = tgbotapi.NewEditMessageTextAndMarkup(message.Chat.ID, message.MessageID, text, *keyboard)
+	} else {
+		edit = tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
+	}
+	if _, err := bot.Send(edit); err != nil {
+		log.Printf("Failed to refresh ban list for bot %s: %v", botIDFromToken(bot.Token), err)
+	}
+}
+
+// 处理封禁列表上的翻页和解封按钮，返回是否已处理
+func (m *BotManager) handleBanListCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData) bool {
+	if query.Message == nil {
+		return false
+	}
+
+	if cb.Action == cbBanListPage {
+		page, ok := cb.int(0)
+		if !ok {
+			log.Printf("Invalid page in callback: %s", query.Data)
+			return true
+		}
+		m.refreshBanList(bot, query.Message, int(page))
+		return true
+	}
+
+	if cb.Action == cbBanListUnban {
+		userID, ok := cb.int(0)
+		if !ok {
+			log.Printf("Invalid ban list callback: %s", query.Data)
+			return true
+		}
+		page, _ := cb.int(1)
+		if err := m.unblockUser(bot.Token, userID); err != nil {
+			log.Printf("Failed to unblock user: %v", err)
+			return true
+		}
+		m.logEvent(bot.Token, query.From.ID, eventUnban, userID, "")
+		m.refreshBanList(bot, query.Message, int(page))
+		return true
+	}
+
+	return false
+}
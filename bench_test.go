@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SenLief/forwardme/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	benchBotToken  = "3000001:bench"
+	benchCreatorID = 10
+	benchUsers     = 100
+)
+
+// 临时数据库上的 BotManager，日志在基准测试期间关闭
+func newBenchManager(b *testing.B) *BotManager {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	db, err := sql.Open("sqlite", filepath.Join(b.TempDir(), "bots.db")+sqliteOptions)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	if err := initSchema(db); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO bots (token, creator_id) VALUES (?, ?)", benchBotToken, benchCreatorID); err != nil {
+		b.Fatal(err)
+	}
+	return NewBotManager(db)
+}
+
+func benchUser(i int) *tgbotapi.User {
+	id := int64(100000 + i%benchUsers)
+	return &tgbotapi.User{ID: id, FirstName: "User", UserName: fmt.Sprintf("user%d", id)}
+}
+
+// 用户消息从过滤、转交到写入对话记录的完整处理，Bot API 请求发往本地的模拟服务器
+func BenchmarkIncomingMessage(b *testing.B) {
+	m := newBenchManager(b)
+	telegram := telegramtest.NewServer()
+	b.Cleanup(telegram.Close)
+	telegram.AddBot(benchBotToken, "bench_bot")
+	m.apiEndpoint = telegram.Endpoint()
+	bot, err := m.newBotAPI(benchBotToken)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m.bots[benchBotToken] = bot
+	m.creator[benchBotToken] = benchCreatorID
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		user := benchUser(i)
+		message := &tgbotapi.Message{
+			MessageID: i + 1,
+			From:      user,
+			Chat:      &tgbotapi.Chat{ID: user.ID, Type: "private"},
+			Date:      int(time.Now().Unix()),
+			Text:      fmt.Sprintf("基准测试消息 %d", i),
+		}
+		m.handleIncomingMessage(bot, message, benchCreatorID, bot, benchBotToken)
+	}
+	b.StopTimer()
+	m.flushUserWrites()
+	// 消息被过滤时测到的不是转交流程
+	if _, err := telegram.Expect(time.Second, telegramtest.Call(benchBotToken, "forwardMessage")); err != nil {
+		b.Fatal("messages were not forwarded:", err)
+	}
+}
+
+// 存储层：用户资料的写入和合并写入，消息对应关系的写入和查找
+func BenchmarkStore(b *testing.B) {
+	b.Run("RecordUser", func(b *testing.B) {
+		m := newBenchManager(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.recordUser(benchBotToken, benchUser(i))
+		}
+		m.flushUserWrites()
+	})
+
+	b.Run("FlushUserWrites", func(b *testing.B) {
+		m := newBenchManager(b)
+		for i := 0; i < benchUsers; i++ {
+			m.recordUser(benchBotToken, benchUser(i))
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < benchUsers; j++ {
+				m.recordUser(benchBotToken, benchUser(j))
+			}
+			m.flushUserWrites()
+		}
+	})
+
+	b.Run("MessageMap", func(b *testing.B) {
+		m := newBenchManager(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			user := benchUser(i)
+			m.saveMessageMapping(benchBotToken, i+1, user.ID, i+1)
+			if _, _, ok := m.lookupMessageMapping(benchBotToken, i+1); !ok {
+				b.Fatalf("mapping of creator message %d not found", i+1)
+			}
+		}
+	})
+}
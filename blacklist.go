@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 全局黑名单列表最多显示的条数
+const globalBlacklistDisplayLimit = 50
+
+func (m *BotManager) addGlobalBlacklist(userID, addedBy int64, reason string) error {
+	_, err := m.db.Exec(`INSERT INTO global_blacklist (user_id, reason, added_by, added_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET reason = excluded.reason, added_by = excluded.added_by, added_at = excluded.added_at`,
+		userID, reason, addedBy, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to add user %d to the global blacklist: %v", userID, err)
+		return err
+	}
+	log.Printf("User ID: %d added to the global blacklist by %d.", userID, addedBy)
+	return nil
+}
+
+func (m *BotManager) removeGlobalBlacklist(userID int64) (bool, error) {
+	res, err := m.db.Exec("DELETE FROM global_blacklist WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("Failed to remove user %d from the global blacklist: %v", userID, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// 用户在全局黑名单中，且该机器人的创建者没有选择退出
+func (m *BotManager) isGloballyBlocked(creatorID, userID int64) bool {
+	var blocked bool
+	err := m.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM global_blacklist WHERE user_id = ?)
+		AND NOT EXISTS(SELECT 1 FROM creators WHERE creator_id = ? AND global_blacklist_optout = 1)`, userID, creatorID).Scan(&blocked)
+	if err != nil {
+		log.Printf("Failed to check global blacklist for user %d: %v", userID, err)
+		return false
+	}
+	return blocked
+}
+
+func (m *BotManager) setGlobalBlacklistOptOut(creatorID int64, optOut bool) error {
+	_, err := m.db.Exec(`INSERT INTO creators (creator_id, global_blacklist_optout) VALUES (?, ?)
+		ON CONFLICT (creator_id) DO UPDATE SET global_blacklist_optout = excluded.global_blacklist_optout`, creatorID, optOut)
+	if err != nil {
+		log.Printf("Failed to update global blacklist preference of creator %d: %v", creatorID, err)
+	}
+	return err
+}
+
+func (m *BotManager) formatGlobalBlacklist() (string, error) {
+	var total int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM global_blacklist").Scan(&total); err != nil {
+		return "", err
+	}
+	if total == 0 {
+		return "全局黑名单为空", nil
+	}
+
+	rows, err := m.db.Query("SELECT user_id, reason, added_at FROM global_blacklist ORDER BY added_at DESC LIMIT ?", globalBlacklistDisplayLimit)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "全局黑名单（共 %d 人）\n\n", total)
+	for rows.Next() {
+		var userID, addedAt int64
+		var reason string
+		if err := rows.Scan(&userID, &reason, &addedAt); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%d  %s", userID, time.Unix(addedAt, 0).Format("2006-01-02"))
+		if reason != "" {
+			fmt.Fprintf(&b, "  %s", reason)
+		}
+		b.WriteString("\n")
+	}
+	if total > globalBlacklistDisplayLimit {
+		fmt.Fprintf(&b, "... 仅显示最近 %d 条", globalBlacklistDisplayLimit)
+	}
+	return b.String(), rows.Err()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 白标品牌：同一进程中运行的另一个管理机器人，有自己的名称和服务条款。
+// 通过它添加的机器人属于该品牌，创建者只能在同一品牌的管理机器人中管理它们。
+// 转发引擎、数据库、运营者和套餐在所有品牌之间共用
+type brand struct {
+	// 配置中的名称，记录在 bots.brand 中
+	name string
+	// 展示给创建者的品牌名
+	title      string
+	bot        *tgbotapi.BotAPI
+	tosVersion string
+	tosText    string
+}
+
+// 主管理机器人使用的品牌名
+const defaultBrandTitle = "forwardme"
+
+// 从 BRANDS=acme,beta 和 BRAND_ACME_TOKEN、BRAND_ACME_NAME、BRAND_ACME_TOS_VERSION、BRAND_ACME_TOS_TEXT 读取品牌
+func (m *BotManager) loadBrands() error {
+	for _, name := range strings.Split(os.Getenv("BRANDS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "BRAND_" + strings.ToUpper(name) + "_"
+		bot, err := m.newBotAPI(os.Getenv(prefix + "TOKEN"))
+		if err != nil {
+			return fmt.Errorf("brand %s: %w", name, err)
+		}
+		b := &brand{
+			name:       name,
+			title:      os.Getenv(prefix + "NAME"),
+			bot:        bot,
+			tosVersion: os.Getenv(prefix + "TOS_VERSION"),
+			tosText:    os.Getenv(prefix + "TOS_TEXT"),
+		}
+		if b.title == "" {
+			b.title = name
+		}
+		m.brands = append(m.brands, b)
+		log.Printf("Manager bot @%s of brand %s created successfully.", bot.Self.UserName, name)
+	}
+	return nil
+}
+
+// 管理机器人所属的品牌，主管理机器人和备用管理机器人返回 nil
+func (m *BotManager) brandOf(managerBot *tgbotapi.BotAPI) *brand {
+	for _, b := range m.brands {
+		if b.bot.Token == managerBot.Token {
+			return b
+		}
+	}
+	return nil
+}
+
+func (m *BotManager) brandName(managerBot *tgbotapi.BotAPI) string {
+	if b := m.brandOf(managerBot); b != nil {
+		return b.name
+	}
+	return ""
+}
+
+func (m *BotManager) brandTitle(managerBot *tgbotapi.BotAPI) string {
+	if b := m.brandOf(managerBot); b != nil {
+		return b.title
+	}
+	return defaultBrandTitle
+}
+
+// 机器人所属的品牌，空字符串是主管理机器人
+func (m *BotManager) botBrand(token string) string {
+	var name string
+	err := m.db.QueryRow("SELECT brand FROM bots WHERE token = ?", token).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get brand of bot %s: %v", botIDFromToken(token), err)
+	}
+	return name
+}
+
+// 机器人是否可以在该管理机器人中管理。运营者可以跨品牌管理
+func (m *BotManager) inBrand(managerBot *tgbotapi.BotAPI, token string, userID int64) bool {
+	return m.botBrand(token) == m.brandName(managerBot) || m.instanceCan(userID, permManage)
+}
+
+// 给机器人的创建者发送通知时使用的管理机器人：机器人所属品牌的管理机器人，
+// 主品牌使用当前可用的主管理机器人或备用管理机器人
+func (m *BotManager) managerBotFor(token string) *tgbotapi.BotAPI {
+	if name := m.botBrand(token); name != "" {
+		for _, b := range m.brands {
+			if b.name == name {
+				return b.bot
+			}
+		}
+	}
+	return m.activeManagerBot()
+}
+
+// 给创建者发送账户通知时使用的管理机器人，按其最早添加的机器人所属的品牌
+func (m *BotManager) managerBotForCreator(creatorID int64) *tgbotapi.BotAPI {
+	var token string
+	err := m.db.QueryRow("SELECT token FROM bots WHERE creator_id = ? ORDER BY deleted_at != 0, rowid LIMIT 1", creatorID).Scan(&token)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get bots of creator %d: %v", creatorID, err)
+	}
+	return m.managerBotFor(token)
+}
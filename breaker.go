@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 连续失败这么多次后熔断
+	breakerThreshold = 5
+	// 熔断后等待这么久再放行一次试探请求
+	breakerCooldown = time.Minute
+)
+
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// 外部集成的熔断器：连续失败达到阈值后打开，冷却期内直接拒绝调用，
+// 冷却结束后放行一次试探，成功则关闭，失败则重新打开
+type circuitBreaker struct {
+	mu       sync.Mutex
+	name     string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+var breakers = &breakerRegistry{breakers: make(map[string]*circuitBreaker)}
+
+func (r *breakerRegistry) get(name string) *circuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[name]
+	if !ok {
+		b = &circuitBreaker{name: name}
+		r.breakers[name] = b
+	}
+	return b
+}
+
+type breakerStatus struct {
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+func (r *breakerRegistry) snapshot() []breakerStatus {
+	r.mu.Lock()
+	list := make([]*circuitBreaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		list = append(list, b)
+	}
+	r.mu.Unlock()
+
+	statuses := make([]breakerStatus, 0, len(list))
+	for _, b := range list {
+		statuses = append(statuses, b.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (b *circuitBreaker) status() breakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := breakerStatus{Name: b.name, State: "closed", Failures: b.failures}
+	if !b.openedAt.IsZero() {
+		s.State, s.OpenedAt = "open", b.openedAt
+		if b.probing || time.Since(b.openedAt) >= breakerCooldown {
+			s.State = "half-open"
+		}
+	}
+	return s
+}
+
+// 通过熔断器调用 fn，熔断期间直接返回 errBreakerOpen
+func (b *circuitBreaker) call(fn func() error) error {
+	b.mu.Lock()
+	if !b.openedAt.IsZero() {
+		if b.probing || time.Since(b.openedAt) < breakerCooldown {
+			b.mu.Unlock()
+			return errBreakerOpen
+		}
+		b.probing = true
+	}
+	b.mu.Unlock()
+
+	err := fn()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		if !b.openedAt.IsZero() {
+			log.Printf("Circuit breaker %s closed.", b.name)
+		}
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return nil
+	}
+	b.failures++
+	if !b.openedAt.IsZero() || b.failures >= breakerThreshold {
+		if b.openedAt.IsZero() {
+			log.Printf("Circuit breaker %s opened after %d failures: %v", b.name, b.failures, err)
+			metrics.inc("forwardme_breaker_trips_total", "breaker", b.name)
+		}
+		b.openedAt = time.Now()
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 群发时两条消息之间的间隔，Telegram 限制每秒约 30 条
+const broadcastInterval = 40 * time.Millisecond
+
+// 群发的收件人：与机器人交互过且未被封禁的用户，再按标签或话题筛选
+func (m *BotManager) broadcastRecipients(token string, target audience) ([]int64, error) {
+	rows, err := m.db.Query(`SELECT u.user_id FROM bot_users u
+		WHERE u.bot_token = ?
+			AND NOT EXISTS (SELECT 1 FROM bans b WHERE b.bot_token = u.bot_token AND b.user_id = u.user_id)
+			AND (? = '' OR EXISTS (SELECT 1 FROM user_labels l WHERE l.bot_token = u.bot_token AND l.user_id = u.user_id AND l.label = ?))
+			AND (? = '' OR EXISTS (SELECT 1 FROM topic_subscriptions s JOIN topics t ON t.id = s.topic_id
+				WHERE t.bot_token = u.bot_token AND s.user_id = u.user_id AND t.name = ?))
+		ORDER BY u.user_id`, token, target.Label, target.Label, target.Topic, target.Topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// 套餐限制单次群发的人数
+	if err := m.checkBroadcastLimit(token, len(ids)); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// 逐个发送并限速，send 负责给一个收件人发送。返回成功和失败的数量
+func (m *BotManager) broadcast(bot *tgbotapi.BotAPI, recipients []int64, send func(userID int64) error) (sent, failed int) {
+	var unreachable []string
+	for _, userID := range recipients {
+		err := send(userID)
+		if m.recordDelivery(bot.Token, userID, err) {
+			unreachable = append(unreachable, strconv.FormatInt(userID, 10))
+		}
+		if err != nil {
+			log.Printf("Failed to broadcast to user %d for bot %s: %v", userID, botIDFromToken(bot.Token), err)
+			failed++
+		} else {
+			sent++
+		}
+		time.Sleep(broadcastInterval)
+	}
+	metrics.add("forwardme_broadcast_messages_total", int64(sent), "bot", botIDFromToken(bot.Token))
+	m.meter(bot.Token, usageBroadcast, sent)
+	// 群发时逐个通知会刷屏，合并为一条
+	if len(unreachable) > 0 {
+		bot.Send(tgbotapi.NewMessage(m.creatorOf(bot.Token), fmt.Sprintf("⚠️ %d 位用户连续 %d 次无法送达，对方可能已注销账号或屏蔽了机器人：%s",
+			len(unreachable), unreachableThreshold, strings.Join(unreachable, ", "))))
+	}
+	return sent, failed
+}
+
+// 群发文本，文本中的 {{变量}} 和 {{code}} 按收件人展开
+func (m *BotManager) broadcastText(bot *tgbotapi.BotAPI, recipients []int64, text string) (sent, failed int) {
+	return m.broadcast(bot, recipients, func(userID int64) error {
+		_, err := bot.Send(tgbotapi.NewMessage(userID, m.expandCode(bot.Token, userID, m.expandUserVars(bot.Token, userID, text))))
+		return err
+	})
+}
+
+// 处理 /broadcast [#标签|topic:话题] <内容>，在后台发送，完成后汇报结果
+func (m *BotManager) handleBroadcastCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	target, text := parseAudience(message.CommandArguments())
+	if text == "" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用法：/broadcast [#标签|topic:话题] <内容>，内容中可以使用 {{变量}}，{{code}} 会替换为给该用户的兑换码"))
+		return
+	}
+	recipients, err := m.broadcastRecipients(bot.Token, target)
+	if err != nil {
+		log.Printf("Failed to load broadcast recipients of bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to load recipients")))
+		return
+	}
+	if len(recipients) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "没有符合条件的用户："+target.String()))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("开始向 %s 的 %d 位用户群发", target, len(recipients))))
+	go func() {
+		sent, failed := m.broadcastText(bot, recipients, text)
+		m.logEvent(bot.Token, message.From.ID, eventBroadcast, 0, fmt.Sprintf("%s，成功 %d，失败 %d: %s", target, sent, failed, m.storedText(bot.Token, truncateText(text, 200))))
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("群发完成：成功 %d，失败 %d", sent, failed)))
+	}()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 批量导入文件的大小上限
+const maxBulkFileSize = 1 << 20
+
+// 解析以空白、逗号或换行分隔的 Telegram ID 列表
+func parseUserIDList(text string) (ids []int64, invalid []string) {
+	seen := make(map[int64]bool)
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '，' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, field := range fields {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || id <= 0 {
+			invalid = append(invalid, field)
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, invalid
+}
+
+// 下载创建者上传的 ID 列表文件
+func (m *BotManager) downloadDocumentText(bot *tgbotapi.BotAPI, doc *tgbotapi.Document) (string, error) {
+	if doc.FileSize > maxBulkFileSize {
+		return "", fmt.Errorf("file too large: %d bytes", doc.FileSize)
+	}
+	body, _, err := m.openFile(bot, doc.FileID)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxBulkFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxBulkFileSize {
+		return "", fmt.Errorf("file too large")
+	}
+	return string(data), nil
+}
+
+// 在一个事务中批量封禁或解封，返回发生变化和保持不变的 ID
+func (m *BotManager) bulkSetBlocked(token string, ids []int64, block bool) (changed, unchanged []int64, err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for _, id := range ids {
+		var res sql.Result
+		if block {
+			res, err = tx.Exec("INSERT OR IGNORE INTO bans (bot_token, user_id, reason, banned_at) VALUES (?, ?, ?, ?)", token, id, "批量封禁", now)
+		} else {
+			res, err = tx.Exec("DELETE FROM bans WHERE bot_token = ? AND user_id = ?", token, id)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			changed = append(changed, id)
+		} else {
+			unchanged = append(unchanged, id)
+		}
+	}
+
+	// 解封时同时重置申诉次数
+	if !block && len(changed) > 0 {
+		var appealCountsStr string
+		if err := tx.QueryRow("SELECT appeal_counts FROM bots WHERE token = ?", token).Scan(&appealCountsStr); err != nil {
+			return nil, nil, err
+		}
+		appealCounts := make(map[string]int)
+		if appealCountsStr != "" {
+			if err := json.Unmarshal([]byte(appealCountsStr), &appealCounts); err != nil {
+				log.Printf("Failed to unmarshal appeal counts: %v", err)
+			}
+		}
+		for _, id := range changed {
+			delete(appealCounts, strconv.FormatInt(id, 10))
+		}
+		updated, err := json.Marshal(appealCounts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := tx.Exec("UPDATE bots SET appeal_counts = ? WHERE token = ?", string(updated), token); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	if block {
+		metrics.add("forwardme_bans_total", int64(len(changed)), "bot", botIDFromToken(token))
+	} else {
+		metrics.add("forwardme_unbans_total", int64(len(changed)), "bot", botIDFromToken(token))
+		for _, id := range changed {
+			m.resolveAppeals(token, id, appealApproved)
+		}
+	}
+	return changed, unchanged, nil
+}
+
+// 处理 /banmany 和 /unbanmany，ID 可写在参数里，也可以来自上传的文本文件
+func (m *BotManager) handleBulkModeration(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64, args string, block bool) {
+	botToken := bot.Token
+	text := args
+
+	doc := message.Document
+	if doc == nil && message.ReplyToMessage != nil {
+		doc = message.ReplyToMessage.Document
+	}
+	if doc != nil {
+		defer m.chatActionHeartbeat(bot, creatorID)()
+		content, err := m.downloadDocumentText(bot, doc)
+		if err != nil {
+			log.Printf("Failed to download bulk moderation file for bot %s: %v", botIDFromToken(botToken), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, "读取文件失败: "+err.Error()))
+			return
+		}
+		text += "\n" + content
+	}
+
+	ids, invalid := parseUserIDList(text)
+	if len(ids) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID 列表，例如：/banmany 123 456 789，或上传每行一个 ID 的文本文件并附上该命令"))
+		return
+	}
+
+	apply := func() {
+		changed, unchanged, err := m.bulkSetBlocked(botToken, ids, block)
+		if err != nil {
+			log.Printf("Failed to apply bulk moderation for bot %s: %v", botIDFromToken(botToken), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, "批量操作失败，未做任何更改"))
+			return
+		}
+
+		action, state := "封禁", "已在封禁列表中"
+		event := eventBan
+		if !block {
+			action, state = "解封", "不在封禁列表中"
+			event = eventUnban
+		}
+		for _, id := range changed {
+			m.logEvent(botToken, message.From.ID, event, id, "批量"+action)
+		}
+		log.Printf("Bulk %s for bot %s: %d changed, %d unchanged, %d invalid", action, botIDFromToken(botToken), len(changed), len(unchanged), len(invalid))
+
+		summary := fmt.Sprintf("批量%s完成\n成功: %d\n%s: %d\n无效 ID: %d", action, len(changed), state, len(unchanged), len(invalid))
+		if len(invalid) > 0 {
+			if len(invalid) > 20 {
+				invalid = append(invalid[:20], "...")
+			}
+			summary += "\n无效内容: " + strings.Join(invalid, ", ")
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, summary))
+	}
+	// 批量解封无法撤销，需要先确认
+	if !block {
+		m.askConfirmation(bot, creatorID, message.From.ID, fmt.Sprintf("确认解封 %d 个用户？", len(ids)), "确认解封", apply)
+		return
+	}
+	apply()
+}
+
+// 带文件上传的批量命令写在说明文字里，不会被识别为普通命令
+func bulkCaptionCommand(message *tgbotapi.Message) (command, args string, ok bool) {
+	if message.Document == nil || !strings.HasPrefix(message.Caption, "/") {
+		return "", "", false
+	}
+	fields := strings.Fields(message.Caption)
+	command = strings.TrimPrefix(fields[0], "/")
+	if at := strings.Index(command, "@"); at >= 0 {
+		command = command[:at]
+	}
+	if command != "banmany" && command != "unbanmany" && command != "codes" && command != "applytemplate" {
+		return "", "", false
+	}
+	return command, strings.TrimSpace(strings.TrimPrefix(message.Caption, fields[0])), true
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 检查是否有排队消息可以投递的间隔
+const queueDeliveryInterval = time.Minute
+
+// 每个机器人的工作时间，每天 Start 到 End（分钟数），End 小于 Start 时跨越午夜
+type businessHours struct {
+	Start, End int
+	Loc        *time.Location
+}
+
+// 解析 "09:00-18:00" 或 "09:00-18:00 Asia/Shanghai"，未指定时区时使用服务器时区
+func parseBusinessHours(value string) (businessHours, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return businessHours{}, fmt.Errorf("invalid business hours %q", value)
+	}
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return businessHours{}, fmt.Errorf("invalid business hours %q", value)
+	}
+	start, err := time.Parse("15:04", bounds[0])
+	if err != nil {
+		return businessHours{}, err
+	}
+	end, err := time.Parse("15:04", bounds[1])
+	if err != nil {
+		return businessHours{}, err
+	}
+	h := businessHours{Start: start.Hour()*60 + start.Minute(), End: end.Hour()*60 + end.Minute(), Loc: time.Local}
+	if h.Start == h.End {
+		return businessHours{}, fmt.Errorf("business hours %q are empty", value)
+	}
+	if len(fields) == 2 {
+		if h.Loc, err = time.LoadLocation(fields[1]); err != nil {
+			return businessHours{}, err
+		}
+	}
+	return h, nil
+}
+
+func (h businessHours) String() string {
+	s := fmt.Sprintf("%02d:%02d-%02d:%02d", h.Start/60, h.Start%60, h.End/60, h.End%60)
+	if h.Loc != time.Local {
+		s += " " + h.Loc.String()
+	}
+	return s
+}
+
+func (h businessHours) isOpen(t time.Time) bool {
+	t = t.In(h.Loc)
+	minute := t.Hour()*60 + t.Minute()
+	if h.Start < h.End {
+		return minute >= h.Start && minute < h.End
+	}
+	return minute >= h.Start || minute < h.End
+}
+
+// 下一次开始营业的时间
+func (h businessHours) nextOpen(t time.Time) time.Time {
+	t = t.In(h.Loc)
+	open := time.Date(t.Year(), t.Month(), t.Day(), h.Start/60, h.Start%60, 0, 0, h.Loc)
+	if !open.After(t) {
+		open = open.AddDate(0, 0, 1)
+	}
+	return open
+}
+
+// 机器人配置的工作时间，未配置时 ok 为 false
+func (m *BotManager) getBusinessHours(token string) (businessHours, bool) {
+	var value string
+	err := m.db.QueryRow("SELECT business_hours FROM bots WHERE token = ?", token).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get business hours of bot %s: %v", botIDFromToken(token), err)
+	}
+	if value == "" {
+		return businessHours{}, false
+	}
+	h, err := parseBusinessHours(value)
+	if err != nil {
+		log.Printf("Invalid business hours of bot %s: %v", botIDFromToken(token), err)
+		return businessHours{}, false
+	}
+	return h, true
+}
+
+func (m *BotManager) getUrgentKeywords(token string) []string {
+	var value string
+	err := m.db.QueryRow("SELECT urgent_keywords FROM bots WHERE token = ?", token).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get urgent keywords of bot %s: %v", botIDFromToken(token), err)
+	}
+	var keywords []string
+	for _, k := range strings.Split(value, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+func (m *BotManager) isVIP(token string, userID int64) bool {
+	var exists bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM vip_users WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&exists)
+	if err != nil {
+		log.Printf("Failed to check VIP state of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	return exists
+}
+
+// 设为 VIP 或取消 VIP
+func (m *BotManager) setVIP(token string, userID int64, vip bool) error {
+	var err error
+	if vip {
+		_, err = m.db.Exec("INSERT OR IGNORE INTO vip_users (bot_token, user_id, created_at) VALUES (?, ?, ?)", token, userID, time.Now().Unix())
+	} else {
+		_, err = m.db.Exec("DELETE FROM vip_users WHERE bot_token = ? AND user_id = ?", token, userID)
+	}
+	return err
+}
+
+// 非工作时间收到的消息进入队列，VIP 用户和包含紧急关键词的消息除外。
+// 返回消息是否已入队
+func (m *BotManager) queueOutsideHours(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	token := bot.Token
+	hours, ok := m.getBusinessHours(token)
+	if !ok || hours.isOpen(time.Now()) {
+		return false
+	}
+	if m.isVIP(token, message.From.ID) {
+		return false
+	}
+	if _, urgent := matchKeyword(message.Text+" "+message.Caption, m.getUrgentKeywords(token)); urgent {
+		return false
+	}
+
+	var alreadyQueued bool
+	m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM queued_messages WHERE bot_token = ? AND user_id = ?)", token, message.From.ID).Scan(&alreadyQueued)
+
+	_, err := m.db.Exec("INSERT INTO queued_messages (bot_token, user_id, chat_id, message_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		token, message.From.ID, message.Chat.ID, message.MessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to queue message of user %d for bot %s: %v", message.From.ID, botIDFromToken(token), err)
+		return false
+	}
+	log.Printf("Queued message from user ID: %d for bot %s outside business hours.", message.From.ID, botIDFromToken(token))
+
+	// 每段排队期间只提示一次
+	if !alreadyQueued {
+		open := hours.nextOpen(time.Now())
+		notice := fmt.Sprintf("现在是非工作时间（%s），你的消息已收到，将在 %s 后转交处理。", hours, open.Format("01-02 15:04"))
+		if _, err := bot.Send(tgbotapi.NewMessage(message.Chat.ID, notice)); err != nil {
+			log.Printf("Failed to send business hours notice to user %d: %v", message.From.ID, err)
+		}
+	}
+	return true
+}
+
+// 投递某个机器人队列中的全部消息
+func (m *BotManager) deliverQueue(bot *tgbotapi.BotAPI, creatorID int64) {
+	token := bot.Token
+	rows, err := m.db.Query("SELECT id, user_id, chat_id, message_id FROM queued_messages WHERE bot_token = ? ORDER BY id", token)
+	if err != nil {
+		log.Printf("Failed to load queued messages for bot %s: %v", botIDFromToken(token), err)
+		return
+	}
+	type queuedMessage struct {
+		id, userID, chatID int64
+		messageID          int
+	}
+	var queued []queuedMessage
+	for rows.Next() {
+		var q queuedMessage
+		if err := rows.Scan(&q.id, &q.userID, &q.chatID, &q.messageID); err == nil {
+			queued = append(queued, q)
+		}
+	}
+	rows.Close()
+	if len(queued) == 0 {
+		return
+	}
+
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("以下是非工作时间收到的 %d 条消息", len(queued))))
+	for _, q := range queued {
+		m.forwardUserMessage(bot, creatorID, q.chatID, q.userID, q.messageID)
+		if _, err := m.db.Exec("DELETE FROM queued_messages WHERE id = ?", q.id); err != nil {
+			log.Printf("Failed to remove queued message %d for bot %s: %v", q.id, botIDFromToken(token), err)
+		}
+	}
+	log.Printf("Delivered %d queued messages for bot %s.", len(queued), botIDFromToken(token))
+}
+
+// 定期检查进入工作时间的机器人并投递其队列
+func (m *BotManager) runQueueDelivery() {
+	ticker := time.NewTicker(queueDeliveryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rows, err := m.db.Query("SELECT DISTINCT bot_token FROM queued_messages")
+		if err != nil {
+			log.Printf("Failed to load queued bots: %v", err)
+			continue
+		}
+		var tokens []string
+		for rows.Next() {
+			var token string
+			if err := rows.Scan(&token); err == nil {
+				tokens = append(tokens, token)
+			}
+		}
+		rows.Close()
+
+		for _, token := range tokens {
+			if hours, ok := m.getBusinessHours(token); ok && !hours.isOpen(time.Now()) {
+				continue
+			}
+			m.mu.RLock()
+			bot, running := m.bots[token]
+			creatorID := m.creator[token]
+			m.mu.RUnlock()
+			if running {
+				m.deliverQueue(bot, m.onDutyID(creatorID))
+			}
+		}
+	}
+}
+
+// 处理 /hours、/vip、/unvip 和 /urgent
+func (m *BotManager) handleBusinessHoursCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	args := strings.TrimSpace(message.CommandArguments())
+
+	switch message.Command() {
+	case "hours":
+		if args == "" {
+			if hours, ok := m.getBusinessHours(token); ok {
+				bot.Send(tgbotapi.NewMessage(creatorID, "当前工作时间："+hours.String()+"\n发送 /hours off 取消"))
+			} else {
+				bot.Send(tgbotapi.NewMessage(creatorID, "未设置工作时间。用法：/hours 09:00-18:00 [Asia/Shanghai]"))
+			}
+			return
+		}
+		value := ""
+		if !strings.EqualFold(args, "off") {
+			hours, err := parseBusinessHours(args)
+			if err != nil {
+				bot.Send(tgbotapi.NewMessage(creatorID, "无效的工作时间，例如：/hours 09:00-18:00 或 /hours 09:00-18:00 Asia/Shanghai"))
+				return
+			}
+			value = hours.String()
+		}
+		if _, err := m.db.Exec("UPDATE bots SET business_hours = ? WHERE token = ?", value, token); err != nil {
+			log.Printf("Failed to update business hours of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update business hours")))
+			return
+		}
+		if value == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "已取消工作时间，排队中的消息将尽快转发"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "工作时间已设置为 "+value+"，非工作时间的消息将排队，在工作时间开始时一并转发"))
+		}
+	case "vip", "unvip":
+		userID, _, err := m.commandTarget(token, message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID，例如：/"+message.Command()+" 123456，或回复一条转发消息发送 /"+message.Command()))
+			return
+		}
+		if err := m.setVIP(token, userID, message.Command() == "vip"); err != nil {
+			log.Printf("Failed to update VIP state of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update VIP list")))
+			return
+		}
+		if message.Command() == "vip" {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已设为 VIP，非工作时间的消息也会立即转发", userID)))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已取消 VIP", userID)))
+		}
+	case "urgent":
+		if args == "" {
+			keywords := m.getUrgentKeywords(token)
+			if len(keywords) == 0 {
+				bot.Send(tgbotapi.NewMessage(creatorID, "未设置紧急关键词。用法：/urgent 紧急,down,refund"))
+			} else {
+				bot.Send(tgbotapi.NewMessage(creatorID, "紧急关键词："+strings.Join(keywords, ", ")+"\n发送 /urgent off 清除"))
+			}
+			return
+		}
+		value := ""
+		if !strings.EqualFold(args, "off") {
+			value = strings.Join(strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == '，' }), ",")
+		}
+		if _, err := m.db.Exec("UPDATE bots SET urgent_keywords = ? WHERE token = ?", value, token); err != nil {
+			log.Printf("Failed to update urgent keywords of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update urgent keywords")))
+			return
+		}
+		if value == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "已清除紧急关键词"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "紧急关键词已设置，包含这些词的消息会带 🚨 提示立即转发，非工作时间也不排队"))
+		}
+	}
+}
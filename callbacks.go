@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 按钮回调数据的格式：版本|动作|参数,参数|随机数签名。签名用机器人 token 派生的密钥计算，
+// 客户端伪造或篡改的回调数据无法通过校验；动作是完整匹配的字段，不会因为前缀相同而互相误判
+const callbackVersion = "1"
+
+// Telegram 限制 callback_data 最多 64 字节
+const maxCallbackData = 64
+
+const (
+	callbackNonceBytes = 3
+	callbackMACBytes   = 8
+)
+
+// 按钮的动作，新增按钮时在这里登记
+const (
+	cbBan           = "ban"
+	cbUnban         = "unban"
+	cbAppeal        = "appeal"
+	cbBanListPage   = "bans"
+	cbBanListUnban  = "bansunban"
+	cbBanChat       = "banchat"
+	cbConfirm       = "confirm"
+	cbCancel        = "cancel"
+	cbTopic         = "topic"
+	cbForm          = "form"
+	cbFAQHuman      = "faqhuman"
+	cbQuarantineOK  = "qrelease"
+	cbQuarantineBan = "qban"
+	cbApprove       = "firstok"
+	cbReject        = "firstno"
+	cbReportSuspend = "rsuspend"
+	cbReportDismiss = "rdismiss"
+	cbTosAccept     = "tos"
+)
+
+// 各动作需要的权限，不在表中的动作面向用户，任何人都可以点击
+var callbackPermissions = map[string]string{
+	cbBan:           permModerate,
+	cbUnban:         permModerate,
+	cbBanListPage:   permRead,
+	cbBanListUnban:  permModerate,
+	cbBanChat:       permModerate,
+	cbQuarantineOK:  permModerate,
+	cbQuarantineBan: permModerate,
+	cbApprove:       permModerate,
+	cbReject:        permModerate,
+	cbReportSuspend: permModerate,
+	cbReportDismiss: permModerate,
+}
+
+// 签名格式之前的按钮数据是“前缀参数_参数”。签名格式第一次启动前发出的申诉、隔离、审核、确认等按钮
+// 在过渡期内仍然可用，权限检查与签名的按钮相同；之后发出的消息上的旧格式数据一律拒绝
+type legacyCallbackWindow struct {
+	// 签名格式第一次启动的时间，记录在 migrations 表中
+	signedSince time.Time
+	until       time.Time
+}
+
+// 过渡期的默认天数，由 LEGACY_CALLBACK_DAYS 设置，0 表示不接受旧格式
+const defaultLegacyCallbackDays = 30
+
+// 零值不接受任何旧格式的按钮，启动时由 loadLegacyCallbackWindow 设置
+var legacyCallbacks legacyCallbackWindow
+
+// 读取签名格式的启动时间，第一次运行时记为现在
+func loadLegacyCallbackWindow(db *sql.DB, days int, now time.Time) (legacyCallbackWindow, error) {
+	if _, err := db.Exec("INSERT OR IGNORE INTO migrations (name, applied_at) VALUES ('signed_callbacks', ?)", now.Unix()); err != nil {
+		return legacyCallbackWindow{}, err
+	}
+	var appliedAt int64
+	if err := db.QueryRow("SELECT applied_at FROM migrations WHERE name = 'signed_callbacks'").Scan(&appliedAt); err != nil {
+		return legacyCallbackWindow{}, err
+	}
+	since := time.Unix(appliedAt, 0)
+	return legacyCallbackWindow{signedSince: since, until: since.AddDate(0, 0, days)}, nil
+}
+
+// 按钮所在的消息发送于 sentAt，现在是否仍接受它的旧格式数据。不知道消息时间时不接受
+func (w legacyCallbackWindow) accepts(sentAt, now time.Time) bool {
+	return !sentAt.IsZero() && sentAt.Before(w.signedSince) && now.Before(w.until)
+}
+
+// 按钮所在消息的发送时间，消息不可用时返回零值
+func callbackSentAt(query *tgbotapi.CallbackQuery) time.Time {
+	if query.Message == nil || query.Message.Date == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(query.Message.Date), 0)
+}
+
+// 旧格式的前缀、对应的动作和参数个数
+var legacyCallbackPrefixes = []struct {
+	prefix, action string
+	args           int
+}{
+	{"ban_", cbBan, 1},
+	{"unban_", cbUnban, 1},
+	{"appeal_", cbAppeal, 1},
+	{"bans_", cbBanListPage, 1},
+	{"bansunban_", cbBanListUnban, 2},
+	{"banchat_", cbBanChat, 1},
+	{"confirm_", cbConfirm, 1},
+	{"cancel_", cbCancel, 1},
+	{"topic_", cbTopic, 1},
+	{"form_", cbForm, 2},
+	{"faq_human_", cbFAQHuman, 1},
+	{"qrelease_", cbQuarantineOK, 1},
+	{"qban_", cbQuarantineBan, 1},
+	{"firstok_", cbApprove, 1},
+	{"firstno_", cbReject, 1},
+	{"report_suspend_", cbReportSuspend, 1},
+	{"report_dismiss_", cbReportDismiss, 1},
+	{"tos_accept_", cbTosAccept, 1},
+}
+
+// 解析后的回调数据
+type callbackData struct {
+	Action string
+	Args   []string
+}
+
+// 第 i 个参数作为整数
+func (c callbackData) int(i int) (int64, bool) {
+	if i >= len(c.Args) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(c.Args[i], 10, 64)
+	return n, err == nil
+}
+
+func (c callbackData) arg(i int) string {
+	if i >= len(c.Args) {
+		return ""
+	}
+	return c.Args[i]
+}
+
+func callbackMAC(token, payload string) []byte {
+	key := sha256.Sum256([]byte("forwardme-callback:" + token))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)[:callbackMACBytes]
+}
+
+// 生成带签名的回调数据，参数中不能包含 | 和 ,
+func signCallback(token, action string, args ...interface{}) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = fmt.Sprint(a)
+	}
+	nonce := make([]byte, callbackNonceBytes)
+	rand.Read(nonce)
+	payload := callbackVersion + "|" + action + "|" + strings.Join(parts, ",") + "|" + base64.RawURLEncoding.EncodeToString(nonce)
+	data := payload + base64.RawURLEncoding.EncodeToString(callbackMAC(token, payload))
+	if len(data) > maxCallbackData {
+		log.Printf("Callback data for action %s is %d bytes, over the Telegram limit of %d", action, len(data), maxCallbackData)
+	}
+	return data
+}
+
+// 校验并解析回调数据，签名不符、版本未知或格式错误时返回 false。
+// sentAt 是按钮所在消息的发送时间，过渡期内签名格式启动前的消息也接受旧格式的按钮
+func parseCallback(token, data string, sentAt time.Time) (callbackData, bool) {
+	if !strings.Contains(data, "|") {
+		if !legacyCallbacks.accepts(sentAt, time.Now()) {
+			return callbackData{}, false
+		}
+		return parseLegacyCallback(data)
+	}
+	fields := strings.Split(data, "|")
+	if len(fields) != 4 || fields[0] != callbackVersion {
+		return callbackData{}, false
+	}
+	nonceLen := base64.RawURLEncoding.EncodedLen(callbackNonceBytes)
+	if len(fields[3]) <= nonceLen {
+		return callbackData{}, false
+	}
+	payload := data[:len(data)-len(fields[3])+nonceLen]
+	mac, err := base64.RawURLEncoding.DecodeString(fields[3][nonceLen:])
+	if err != nil || !hmac.Equal(mac, callbackMAC(token, payload)) {
+		return callbackData{}, false
+	}
+	c := callbackData{Action: fields[1]}
+	if fields[2] != "" {
+		c.Args = strings.Split(fields[2], ",")
+	}
+	return c, true
+}
+
+// 解析签名格式之前发出的按钮数据，前缀未知或参数不全时返回 false
+func parseLegacyCallback(data string) (callbackData, bool) {
+	for _, l := range legacyCallbackPrefixes {
+		rest, ok := strings.CutPrefix(data, l.prefix)
+		if !ok {
+			continue
+		}
+		args := strings.SplitN(rest, "_", l.args)
+		if len(args) != l.args || slices.Contains(args, "") {
+			return callbackData{}, false
+		}
+		metrics.inc("forwardme_legacy_callbacks_total", "action", l.action)
+		return callbackData{Action: l.action, Args: args}, true
+	}
+	return callbackData{}, false
+}
+
+// 点击按钮的用户是否有权执行该动作。token 为空时是管理机器人上的按钮，按实例角色检查。
+// 申诉按钮只有被封禁的用户本人可以点击
+func (m *BotManager) callbackAllowed(token string, userID int64, cb callbackData) bool {
+	if cb.Action == cbAppeal {
+		appellant, ok := cb.int(0)
+		return ok && appellant == userID
+	}
+	perm, ok := callbackPermissions[cb.Action]
+	if !ok {
+		return true
+	}
+	if token == "" {
+		return m.instanceCan(userID, perm)
+	}
+	return m.botCan(token, userID, perm)
+}
+
+// 管理机器人的按钮都用主管理机器人的 token 签名，备用管理机器人和品牌的管理机器人收到的回调也能校验
+func (m *BotManager) managerCallbackKey() string {
+	if m.managerBot == nil {
+		return ""
+	}
+	return m.managerBot.Token
+}
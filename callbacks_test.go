@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCallbackToken = "3000002:callbacks"
+
+func TestSignCallback(t *testing.T) {
+	data := signCallback(testCallbackToken, cbBanListUnban, 2, int64(1234567890))
+	if len(data) > maxCallbackData {
+		t.Fatalf("callback data is %d bytes, over %d: %q", len(data), maxCallbackData, data)
+	}
+	if !strings.HasPrefix(data, callbackVersion+"|"+cbBanListUnban+"|2,1234567890|") {
+		t.Fatalf("unexpected callback data %q", data)
+	}
+	if again := signCallback(testCallbackToken, cbBanListUnban, 2, int64(1234567890)); again == data {
+		t.Fatal("two signed buttons got the same nonce")
+	}
+
+	cb, ok := parseCallback(testCallbackToken, data, time.Time{})
+	if !ok {
+		t.Fatalf("signed data %q was rejected", data)
+	}
+	if cb.Action != cbBanListUnban || !slices.Equal(cb.Args, []string{"2", "1234567890"}) {
+		t.Fatalf("parsed %+v", cb)
+	}
+	if page, ok := cb.int(0); !ok || page != 2 {
+		t.Fatalf("int(0) = %d, %v", page, ok)
+	}
+	if _, ok := cb.int(2); ok || cb.arg(2) != "" {
+		t.Fatal("missing argument was reported as present")
+	}
+
+	cb, ok = parseCallback(testCallbackToken, signCallback(testCallbackToken, cbCancel), time.Time{})
+	if !ok || cb.Action != cbCancel || len(cb.Args) != 0 {
+		t.Fatalf("button without arguments parsed as %+v, %v", cb, ok)
+	}
+}
+
+func TestParseCallbackRejectsForgedData(t *testing.T) {
+	data := signCallback(testCallbackToken, cbBan, 42)
+	fields := strings.Split(data, "|")
+	tests := []struct {
+		name, token, data string
+	}{
+		{"other bot", "3000003:other", data},
+		{"changed action", testCallbackToken, strings.Replace(data, "|"+cbBan+"|", "|"+cbUnban+"|", 1)},
+		{"changed argument", testCallbackToken, strings.Replace(data, "|42|", "|43|", 1)},
+		{"unknown version", testCallbackToken, "2" + data[1:]},
+		{"truncated signature", testCallbackToken, data[:len(data)-2]},
+		{"missing signature", testCallbackToken, strings.Join(fields[:3], "|") + "|"},
+		{"extra field", testCallbackToken, data + "|x"},
+		{"empty", testCallbackToken, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cb, ok := parseCallback(tt.token, tt.data, time.Time{}); ok {
+				t.Fatalf("%q was accepted as %+v", tt.data, cb)
+			}
+		})
+	}
+}
+
+func TestParseLegacyCallback(t *testing.T) {
+	tests := []struct {
+		data   string
+		action string
+		args   []string
+	}{
+		{"ban_42", cbBan, []string{"42"}},
+		{"bans_3", cbBanListPage, []string{"3"}},
+		{"bansunban_3_42", cbBanListUnban, []string{"3", "42"}},
+		{"faq_human_7", cbFAQHuman, []string{"7"}},
+		{"form_5_42", cbForm, []string{"5", "42"}},
+		{"report_suspend_9", cbReportSuspend, []string{"9"}},
+		{"tos_accept_v2", cbTosAccept, []string{"v2"}},
+		{"ban_", "", nil},
+		{"form_5", "", nil},
+		{"bansunban__42", "", nil},
+		{"delete_42", "", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		cb, ok := parseLegacyCallback(tt.data)
+		if ok != (tt.action != "") {
+			t.Errorf("parseLegacyCallback(%q) ok = %v", tt.data, ok)
+			continue
+		}
+		if ok && (cb.Action != tt.action || !slices.Equal(cb.Args, tt.args)) {
+			t.Errorf("parseLegacyCallback(%q) = %+v, want %s %v", tt.data, cb, tt.action, tt.args)
+		}
+	}
+}
+
+func TestParseCallbackLegacyWindow(t *testing.T) {
+	saved := legacyCallbacks
+	t.Cleanup(func() { legacyCallbacks = saved })
+	now := time.Now()
+	legacyCallbacks = legacyCallbackWindow{signedSince: now.Add(-time.Hour), until: now.Add(time.Hour)}
+
+	if cb, ok := parseCallback(testCallbackToken, "qban_42", now.Add(-2*time.Hour)); !ok || cb.Action != cbQuarantineBan {
+		t.Fatalf("legacy button on an old message parsed as %+v, %v", cb, ok)
+	}
+	if _, ok := parseCallback(testCallbackToken, "qban_42", now.Add(-time.Minute)); ok {
+		t.Fatal("unsigned data on a message sent after the migration was accepted")
+	}
+	if _, ok := parseCallback(testCallbackToken, "qban_42", time.Time{}); ok {
+		t.Fatal("unsigned data without a message date was accepted")
+	}
+
+	legacyCallbacks.until = now.Add(-time.Minute)
+	if _, ok := parseCallback(testCallbackToken, "qban_42", now.Add(-2*time.Hour)); ok {
+		t.Fatal("legacy button was accepted after the transition ended")
+	}
+
+	legacyCallbacks = legacyCallbackWindow{}
+	if _, ok := parseCallback(testCallbackToken, "qban_42", now.Add(-2*time.Hour)); ok {
+		t.Fatal("legacy button was accepted before the window was loaded")
+	}
+}
+
+func TestLoadLegacyCallbackWindow(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "bots.db")+sqliteOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := initSchema(db); err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Unix(1700000000, 0)
+	w, err := loadLegacyCallbackWindow(db, 30, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.signedSince.Equal(first) || !w.until.Equal(first.AddDate(0, 0, 30)) {
+		t.Fatalf("first load: %+v", w)
+	}
+
+	// 之后的启动沿用第一次记录的时间
+	w, err = loadLegacyCallbackWindow(db, 0, first.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.signedSince.Equal(first) || w.accepts(first.Add(-time.Hour), first.Add(time.Hour)) {
+		t.Fatalf("second load with 0 days: %+v", w)
+	}
+}
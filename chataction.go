@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// 处理超过这个时间才开始显示"正在输入"，快速处理的消息不发送多余的请求
+	chatActionDelay = time.Second
+	// Telegram 的聊天动作约 5 秒后消失，需要在此之前重发
+	chatActionInterval = 4 * time.Second
+)
+
+// 在处理较慢时向聊天发送"正在输入"，直到调用返回的 stop。
+// 用法：defer m.chatActionHeartbeat(bot, chatID)()
+func (m *BotManager) chatActionHeartbeat(bot *tgbotapi.BotAPI, chatIDs ...int64) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		timer := time.NewTimer(chatActionDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+			for _, chatID := range chatIDs {
+				if _, err := bot.Request(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)); err != nil {
+					log.Printf("Failed to send chat action to %d for bot %s: %v", chatID, botIDFromToken(bot.Token), err)
+				}
+			}
+			timer.Reset(chatActionInterval)
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 群组和频道的 ID 都是负数，用户用 /ban 封禁
+func isChatID(id int64) bool {
+	return id < 0
+}
+
+func (m *BotManager) isChatBlocked(token string, chatID int64) bool {
+	var exists bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM blocked_chats WHERE bot_token = ? AND chat_id = ?)", token, chatID).Scan(&exists)
+	if err != nil {
+		log.Printf("Failed to check chat block of %d for bot %s: %v", chatID, botIDFromToken(token), err)
+	}
+	return exists
+}
+
+// 消息所在的群组或代为发言的频道是否被封禁，私聊不查询数据库
+func (m *BotManager) fromBlockedChat(token string, message *tgbotapi.Message) bool {
+	if isChatID(message.Chat.ID) && m.isChatBlocked(token, message.Chat.ID) {
+		return true
+	}
+	return message.SenderChat != nil && message.SenderChat.ID != message.Chat.ID && m.isChatBlocked(token, message.SenderChat.ID)
+}
+
+func (m *BotManager) blockChat(token string, chatID int64, reason string) error {
+	res, err := m.db.Exec("INSERT OR IGNORE INTO blocked_chats (bot_token, chat_id, reason, banned_at) VALUES (?, ?, ?, ?)",
+		token, chatID, reason, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		metrics.inc("forwardme_bans_total", "bot", botIDFromToken(token))
+		log.Printf("Chat ID: %d added to the block list for bot %s.", chatID, botIDFromToken(token))
+	}
+	return nil
+}
+
+// 返回该聊天是否在封禁列表中
+func (m *BotManager) unblockChat(token string, chatID int64) (bool, error) {
+	res, err := m.db.Exec("DELETE FROM blocked_chats WHERE bot_token = ? AND chat_id = ?", token, chatID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		metrics.inc("forwardme_unbans_total", "bot", botIDFromToken(token))
+		log.Printf("Chat ID: %d removed from the block list for bot %s.", chatID, botIDFromToken(token))
+	}
+	return n > 0, nil
+}
+
+// 解析 /banchat 和 /unbanchat 的目标：回复一条频道或匿名管理员的转发消息时取其来源聊天，
+// 否则取参数中的第一个 ID
+func chatCommandTarget(message *tgbotapi.Message) (chatID int64, rest string, err error) {
+	args := strings.TrimSpace(message.CommandArguments())
+	if reply := message.ReplyToMessage; reply != nil && reply.ForwardFromChat != nil {
+		return reply.ForwardFromChat.ID, args, nil
+	}
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return 0, "", fmt.Errorf("missing chat ID")
+	}
+	chatID, err = strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || !isChatID(chatID) {
+		return 0, "", fmt.Errorf("invalid chat ID %q", fields[0])
+	}
+	return chatID, strings.TrimSpace(strings.TrimPrefix(args, fields[0])), nil
+}
+
+// 处理 /banchat、/unbanchat 和 /chatbans
+func (m *BotManager) handleChatBanCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token, from := bot.Token, message.From.ID
+
+	switch message.Command() {
+	case "banchat":
+		chatID, reason, err := chatCommandTarget(message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要封禁的群组或频道 ID，例如：/banchat -1001234567890 广告，或回复一条频道消息的转发发送 /banchat"))
+			return
+		}
+		if err := m.blockChat(token, chatID, reason); err != nil {
+			log.Printf("Failed to block chat %d for bot %s: %v", chatID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to block chat")))
+			return
+		}
+		m.logEvent(token, from, eventBanChat, chatID, reason)
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("聊天ID: %d 已被封禁，来自该群组或频道的消息不再转发", chatID)))
+	case "unbanchat":
+		chatID, _, err := chatCommandTarget(message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要解封的群组或频道 ID，例如：/unbanchat -1001234567890"))
+			return
+		}
+		found, err := m.unblockChat(token, chatID)
+		if err != nil {
+			log.Printf("Failed to unblock chat %d for bot %s: %v", chatID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to unblock chat")))
+			return
+		}
+		if !found {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("聊天ID: %d 不在封禁列表中", chatID)))
+			return
+		}
+		m.logEvent(token, from, eventUnbanChat, chatID, "")
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("聊天ID: %d 已被解封", chatID)))
+	default:
+		entries, err := m.queryStrings(`SELECT chat_id || CASE reason WHEN '' THEN '' ELSE '：' || reason END
+			FROM blocked_chats WHERE bot_token = ? ORDER BY banned_at`, token)
+		if err != nil {
+			log.Printf("Failed to list blocked chats of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list blocked chats")))
+			return
+		}
+		if len(entries) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "没有被封禁的群组或频道。用法：/banchat <聊天ID> [原因]，/unbanchat <聊天ID>"))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "被封禁的群组和频道：\n"+strings.Join(entries, "\n")))
+	}
+}
+
+// 处理频道消息提示下的封禁按钮，返回是否已处理
+func (m *BotManager) handleChatBanCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData) bool {
+	if cb.Action != cbBanChat {
+		return false
+	}
+	token := bot.Token
+	chatID, ok := cb.int(0)
+	if !ok || !isChatID(chatID) {
+		log.Printf("Invalid chat ID in callback: %s", query.Data)
+		return true
+	}
+	if err := m.blockChat(token, chatID, ""); err != nil {
+		log.Printf("Failed to block chat %d for bot %s: %v", chatID, botIDFromToken(token), err)
+		return true
+	}
+	m.logEvent(token, query.From.ID, eventBanChat, chatID, "")
+	bot.Send(tgbotapi.NewMessage(query.From.ID, fmt.Sprintf("聊天ID: %d 已被封禁，发送 /unbanchat %d 解封", chatID, chatID)))
+	return true
+}
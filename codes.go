@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 群发内容中的占位符，发送时替换为该用户领取的兑换码
+const codePlaceholder = "{{code}}"
+
+type codeStock struct {
+	Total, Claimed int
+}
+
+func (s codeStock) String() string {
+	return fmt.Sprintf("共 %d 个，已领取 %d 个，剩余 %d 个", s.Total, s.Claimed, s.Total-s.Claimed)
+}
+
+// 解析每行一个（或以空白、逗号分隔）的兑换码
+func parseCodes(text string) []string {
+	seen := make(map[string]bool)
+	var codes []string
+	for _, code := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '，' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// 在一个事务中导入兑换码，返回新增的数量，已存在的码会被忽略
+func (m *BotManager) addCodes(token string, codes []string) (int, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var added int
+	now := time.Now().Unix()
+	for _, code := range codes {
+		res, err := tx.Exec("INSERT OR IGNORE INTO promo_codes (bot_token, code, created_at) VALUES (?, ?, ?)", token, code, now)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	return added, tx.Commit()
+}
+
+func (m *BotManager) getCodeStock(token string) (codeStock, error) {
+	var s codeStock
+	err := m.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(user_id != 0), 0) FROM promo_codes WHERE bot_token = ?", token).Scan(&s.Total, &s.Claimed)
+	return s, err
+}
+
+// 给用户分配一个兑换码，每个用户只能领取一次，再次领取时返回原来的码。
+// 库存用完时 code 为空
+func (m *BotManager) claimCode(token string, userID int64) (code string, fresh bool, err error) {
+	err = m.db.QueryRow("SELECT code FROM promo_codes WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&code)
+	if err == nil {
+		return code, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", false, err
+	}
+
+	// 单条语句完成分配，并发领取时不会重复
+	res, err := m.db.Exec(`UPDATE promo_codes SET user_id = ?, claimed_at = ?
+		WHERE id = (SELECT id FROM promo_codes WHERE bot_token = ? AND user_id = 0 ORDER BY id LIMIT 1)`,
+		userID, time.Now().Unix(), token)
+	if err != nil {
+		return "", false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", false, nil
+	}
+	err = m.db.QueryRow("SELECT code FROM promo_codes WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&code)
+	if err != nil {
+		return "", false, err
+	}
+	metrics.inc("forwardme_codes_claimed_total", "bot", botIDFromToken(token))
+	return code, true, nil
+}
+
+// 替换群发内容中的 {{code}}，库存用完时提示已领完
+func (m *BotManager) expandCode(token string, userID int64, text string) string {
+	if !strings.Contains(text, codePlaceholder) {
+		return text
+	}
+	code, _, err := m.claimCode(token, userID)
+	if err != nil {
+		log.Printf("Failed to claim code for user %d of bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	if code == "" {
+		code = "（兑换码已领完）"
+	}
+	return strings.ReplaceAll(text, codePlaceholder, code)
+}
+
+// 处理用户的 /getcode
+func (m *BotManager) handleGetCodeCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token, userID := bot.Token, message.From.ID
+	if m.isUserBlocked(token, userID) {
+		return
+	}
+	code, fresh, err := m.claimCode(token, userID)
+	if err != nil {
+		log.Printf("Failed to claim code for user %d of bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "领取失败，请稍后再试。"))
+		return
+	}
+	switch {
+	case code == "":
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "兑换码已经领完了。"))
+	case fresh:
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "你的兑换码："+code))
+	default:
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "你已经领取过兑换码："+code))
+	}
+}
+
+// 处理 /codes：/codes add 后接兑换码或附带文本文件导入，无参数时显示库存
+func (m *BotManager) handleCodesCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64, args string) {
+	token := bot.Token
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	usage := "用法：/codes add CODE1 CODE2 …，或上传每行一个兑换码的文本文件并附上 /codes add\n用户发送 /getcode 领取，每人限领一个；/broadcast 的内容中可以用 {{code}} 给每位收件人发一个码"
+
+	switch action {
+	case "":
+		stock, err := m.getCodeStock(token)
+		if err != nil {
+			log.Printf("Failed to get code stock of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get code stock")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "兑换码："+stock.String()+"\n"+usage))
+	case "add":
+		doc := message.Document
+		if doc == nil && message.ReplyToMessage != nil {
+			doc = message.ReplyToMessage.Document
+		}
+		if doc != nil {
+			defer m.chatActionHeartbeat(bot, creatorID)()
+			content, err := m.downloadDocumentText(bot, doc)
+			if err != nil {
+				log.Printf("Failed to download code file for bot %s: %v", botIDFromToken(token), err)
+				bot.Send(tgbotapi.NewMessage(creatorID, "读取文件失败: "+err.Error()))
+				return
+			}
+			rest += "\n" + content
+		}
+		codes := parseCodes(rest)
+		if len(codes) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		added, err := m.addCodes(token, codes)
+		if err != nil {
+			log.Printf("Failed to add codes for bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, "导入失败，未做任何更改"))
+			return
+		}
+		stock, _ := m.getCodeStock(token)
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已导入 %d 个兑换码（%d 个重复已忽略）\n%s", added, len(codes)-added, stock)))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram 对命令名的要求：小写字母、数字和下划线，最长 32 个字符
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// 内置命令，自定义命令不能与之重名
+var builtinCommands = map[string]bool{
+	"start": true, "report": true, "subscribe": true, "unsubscribe": true, "topics": true, "getcode": true,
+	"mydata": true, "stopforwarding": true, "timezone": true,
+	"getbans": true, "ban": true, "unban": true, "banchat": true, "unbanchat": true, "chatbans": true, "banmany": true, "unbanmany": true,
+	"hours": true, "vip": true, "unvip": true, "urgent": true, "urgentcontact": true,
+	"rules": true, "label": true, "unlabel": true, "labels": true,
+	"setvar": true, "delvar": true, "vars": true,
+	"codes": true, "poll": true, "broadcast": true, "feeds": true, "schedules": true,
+	"limit": true, "approval": true, "quarantine": true, "risk": true,
+	"webapp": true, "setmenu": true, "faq": true, "form": true, "sentiment": true,
+	"mute": true, "unmute": true, "snoozeuser": true, "note": true, "info": true, "share": true, "transcript": true, "handled": true, "digest": true, "signature": true, "del": true,
+	"addcommand": true, "delcommand": true, "commands": true,
+	"alias": true, "unalias": true, "role": true, "roles": true, "auditlog": true, "retention": true, "privacy": true, "forgetuser": true, "service": true, "forwardbuttons": true,
+	"exporttemplate": true, "relaymode": true, "applytemplate": true, "forum": true, "setdestination": true, "archive": true, "reaction": true, "addadmin": true, "removeadmin": true,
+	"pin": true, "unpin": true, "pending": true, "away": true, "back": true, "sendat": true, "usertz": true,
+	"save": true, "delsnippet": true, "snippets": true, "r": true, "asktimezone": true,
+}
+
+type customCommand struct {
+	Name, Response string
+}
+
+// 命令菜单中显示的说明，取回复的第一行
+func (c customCommand) description() string {
+	line, _, _ := strings.Cut(c.Response, "\n")
+	if r := []rune(line); len(r) > 50 {
+		line = string(r[:50]) + "…"
+	}
+	return line
+}
+
+func (m *BotManager) listCustomCommands(token string) ([]customCommand, error) {
+	rows, err := m.db.Query("SELECT name, response FROM custom_commands WHERE bot_token = ? ORDER BY name", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []customCommand
+	for rows.Next() {
+		var c customCommand
+		if err := rows.Scan(&c.Name, &c.Response); err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+	return commands, rows.Err()
+}
+
+// 把自定义命令和别名同步到 Telegram 的命令菜单。用户命令的别名所有人可见，
+// 管理命令的别名只在创建者的聊天中显示
+func (m *BotManager) syncCommands(bot *tgbotapi.BotAPI) {
+	commands, err := m.listCustomCommands(bot.Token)
+	if err != nil {
+		log.Printf("Failed to list custom commands of bot %s: %v", botIDFromToken(bot.Token), err)
+		return
+	}
+	aliases, err := m.listAliases(bot.Token)
+	if err != nil {
+		log.Printf("Failed to list aliases of bot %s: %v", botIDFromToken(bot.Token), err)
+		return
+	}
+
+	menu := []tgbotapi.BotCommand{
+		{Command: "report", Description: "举报该机器人"},
+		{Command: "mydata", Description: "查看机器人保存的我的数据"},
+		{Command: "stopforwarding", Description: "停止转发我的消息"},
+	}
+	for _, c := range commands {
+		menu = append(menu, tgbotapi.BotCommand{Command: c.Name, Description: c.description()})
+	}
+	var adminMenu []tgbotapi.BotCommand
+	for _, a := range aliases {
+		if !commandNamePattern.MatchString(a.Alias) {
+			continue
+		}
+		item := tgbotapi.BotCommand{Command: a.Alias, Description: "同 /" + a.Command}
+		if userCommands[a.Command] {
+			menu = append(menu, item)
+		} else {
+			adminMenu = append(adminMenu, item)
+		}
+	}
+	if _, err := bot.Request(tgbotapi.NewSetMyCommands(menu...)); err != nil {
+		log.Printf("Failed to set commands of bot %s: %v", botIDFromToken(bot.Token), err)
+	}
+
+	scope := tgbotapi.NewBotCommandScopeChat(m.creatorOf(bot.Token))
+	if len(adminMenu) == 0 {
+		_, err = bot.Request(tgbotapi.NewDeleteMyCommandsWithScope(scope))
+	} else {
+		_, err = bot.Request(tgbotapi.NewSetMyCommandsWithScope(scope, append(menu, adminMenu...)...))
+	}
+	if err != nil {
+		log.Printf("Failed to set creator commands of bot %s: %v", botIDFromToken(bot.Token), err)
+	}
+}
+
+// 自定义命令直接回复，不再转发。返回是否已处理
+func (m *BotManager) answerCustomCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	var response string
+	err := m.db.QueryRow("SELECT response FROM custom_commands WHERE bot_token = ? AND name = ?", bot.Token, strings.ToLower(message.Command())).Scan(&response)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get custom command /%s of bot %s: %v", message.Command(), botIDFromToken(bot.Token), err)
+		}
+		return false
+	}
+	if m.isUserBlocked(bot.Token, message.From.ID) {
+		return true
+	}
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, m.expandUserVars(bot.Token, message.From.ID, response)))
+	return true
+}
+
+// 处理 /addcommand、/delcommand 和 /commands
+func (m *BotManager) handleCustomCommandAdmin(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	name, response, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	response = strings.TrimSpace(response)
+
+	switch message.Command() {
+	case "addcommand":
+		if !commandNamePattern.MatchString(name) || response == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/addcommand <命令名> <回复内容>，例如：/addcommand pricing 基础版 9 元/月。命令名只能包含小写字母、数字和下划线"))
+			return
+		}
+		if builtinCommands[name] {
+			bot.Send(tgbotapi.NewMessage(creatorID, "/"+name+" 是内置命令，请换一个名字"))
+			return
+		}
+		_, err := m.db.Exec(`INSERT INTO custom_commands (bot_token, name, response, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (bot_token, name) DO UPDATE SET response = excluded.response`, token, name, response, time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to add custom command /%s for bot %s: %v", name, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add command")))
+			return
+		}
+		m.syncCommands(bot)
+		bot.Send(tgbotapi.NewMessage(creatorID, "已添加命令 /"+name))
+	case "delcommand":
+		res, err := m.db.Exec("DELETE FROM custom_commands WHERE bot_token = ? AND name = ?", token, name)
+		if err != nil {
+			log.Printf("Failed to delete custom command /%s of bot %s: %v", name, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete command")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "命令不存在：/"+name))
+			return
+		}
+		m.syncCommands(bot)
+		bot.Send(tgbotapi.NewMessage(creatorID, "已删除命令 /"+name))
+	default:
+		commands, err := m.listCustomCommands(token)
+		if err != nil {
+			log.Printf("Failed to list custom commands of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list commands")))
+			return
+		}
+		if len(commands) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无自定义命令。用法：/addcommand <命令名> <回复内容>，/delcommand <命令名>"))
+			return
+		}
+		var b strings.Builder
+		for _, c := range commands {
+			b.WriteString("/" + c.Name + "：" + c.description() + "\n")
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 危险操作的确认有效期，过期后需要重新发送命令
+const confirmationTTL = 5 * time.Minute
+
+// 等待确认的危险操作，只有发起命令的用户可以确认
+type pendingConfirmation struct {
+	userID  int64
+	expires time.Time
+	// 不为空时需要在聊天中输入该文字确认，而不是点击按钮
+	expected string
+	run      func()
+}
+
+var confirmations = struct {
+	sync.Mutex
+	byID   map[string]*pendingConfirmation
+	byChat map[int64]*pendingConfirmation
+}{byID: make(map[string]*pendingConfirmation), byChat: make(map[int64]*pendingConfirmation)}
+
+func confirmationKeyboard(token, id, confirmLabel string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(confirmLabel, signCallback(token, cbConfirm, id)),
+		tgbotapi.NewInlineKeyboardButtonData("取消", signCallback(token, cbCancel, id)),
+	))
+}
+
+// 发送确认按钮，userID 点击确认后才执行 run
+func (m *BotManager) askConfirmation(bot *tgbotapi.BotAPI, chatID, userID int64, prompt, confirmLabel string, run func()) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	confirmations.Lock()
+	pruneConfirmations(time.Now())
+	confirmations.byID[id] = &pendingConfirmation{userID: userID, expires: time.Now().Add(confirmationTTL), run: run}
+	confirmations.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, prompt)
+	msg.ReplyMarkup = confirmationKeyboard(bot.Token, id, confirmLabel)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send confirmation prompt to chat %d: %v", chatID, err)
+	}
+}
+
+// 要求在聊天中输入 expected 确认，用于不可恢复的操作
+func (m *BotManager) askTypedConfirmation(bot *tgbotapi.BotAPI, chatID, userID int64, prompt, expected string, run func()) {
+	confirmations.Lock()
+	pruneConfirmations(time.Now())
+	confirmations.byChat[chatID] = &pendingConfirmation{userID: userID, expires: time.Now().Add(confirmationTTL), expected: expected, run: run}
+	confirmations.Unlock()
+	bot.Send(tgbotapi.NewMessage(chatID, prompt+"\n\n请在 5 分钟内发送 "+expected+" 确认，发送其他内容取消。"))
+}
+
+// 处理确认按钮，返回是否已处理
+func (m *BotManager) handleConfirmCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData) bool {
+	if cb.Action != cbConfirm && cb.Action != cbCancel {
+		return false
+	}
+	id, confirmed := cb.arg(0), cb.Action == cbConfirm
+
+	confirmations.Lock()
+	c, ok := confirmations.byID[id]
+	if ok && c.userID == query.From.ID {
+		delete(confirmations.byID, id)
+	}
+	confirmations.Unlock()
+	if ok && c.userID != query.From.ID {
+		return true
+	}
+
+	result := "已取消"
+	switch {
+	case !ok || time.Now().After(c.expires):
+		result = "已过期，请重新发送命令"
+	case confirmed:
+		result = "已确认"
+	}
+	if query.Message != nil {
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\n"+result)
+		if _, err := bot.Send(edit); err != nil {
+			log.Printf("Failed to update confirmation prompt: %v", err)
+		}
+	}
+	if ok && confirmed && time.Now().Before(c.expires) {
+		c.run()
+	}
+	return true
+}
+
+// 处理输入文字的确认，聊天中没有等待确认的操作时返回 false
+func (m *BotManager) handleTypedConfirmation(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	confirmations.Lock()
+	c, ok := confirmations.byChat[message.Chat.ID]
+	if ok && c.userID == message.From.ID {
+		delete(confirmations.byChat, message.Chat.ID)
+	}
+	confirmations.Unlock()
+	if !ok || c.userID != message.From.ID {
+		return false
+	}
+
+	switch {
+	case time.Now().After(c.expires):
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "确认已过期，请重新发送命令"))
+	case !strings.EqualFold(strings.TrimSpace(message.Text), c.expected):
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "输入不一致，已取消"))
+	default:
+		c.run()
+	}
+	return true
+}
+
+// 删除过期的确认，调用时须持有 confirmations 的锁
+func pruneConfirmations(now time.Time) {
+	for id, c := range confirmations.byID {
+		if now.After(c.expires) {
+			delete(confirmations.byID, id)
+		}
+	}
+	for chatID, c := range confirmations.byChat {
+		if now.After(c.expires) {
+			delete(confirmations.byChat, chatID)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 机器人是否保存用户消息的文字，关闭后转发照常进行，但数据库中只记录消息类型
+func (m *BotManager) logsText(token string) bool {
+	return m.botFlag(token, "log_text")
+}
+
+// column 须是 bots 表中默认开启的开关列
+func (m *BotManager) botFlag(token, column string) bool {
+	enabled := true
+	err := m.db.QueryRow("SELECT "+column+" FROM bots WHERE token = ?", token).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get %s setting of bot %s: %v", column, botIDFromToken(token), err)
+	}
+	return enabled
+}
+
+// 需要保存的消息摘要，不记录文字时只保留消息类型
+func (m *BotManager) storedPreview(token string, message *tgbotapi.Message) string {
+	if !m.logsText(token) {
+		return "[" + messageType(message) + "]"
+	}
+	return messagePreview(message)
+}
+
+// 需要保存的文字，不记录文字时返回空字符串
+func (m *BotManager) storedText(token, text string) string {
+	if !m.logsText(token) {
+		return ""
+	}
+	return text
+}
+
+// 处理 /privacy [text on|off]
+func (m *BotManager) handlePrivacyCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/privacy text on|off 是否保存消息文字"
+	fields := strings.Fields(strings.ToLower(message.CommandArguments()))
+
+	if len(fields) == 0 {
+		state := func(enabled bool) string {
+			if enabled {
+				return "开启"
+			}
+			return "关闭"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "保存消息文字："+state(m.logsText(token))+"\n"+usage))
+		return
+	}
+
+	if fields[0] != "text" || len(fields) != 2 || (fields[1] != "on" && fields[1] != "off") {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	enabled := fields[1] == "on"
+	if _, err := m.db.Exec("UPDATE bots SET log_text = ? WHERE token = ?", enabled, token); err != nil {
+		log.Printf("Failed to update log_text setting of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update privacy setting")))
+		return
+	}
+
+	reply := "已开启保存消息文字"
+	if !enabled {
+		reply = "已关闭保存消息文字：转发不受影响，隔离区摘要、申诉、表单结果和审计日志中只记录消息类型"
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, reply))
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "forwardme_session"
+	sessionTTL        = 7 * 24 * time.Hour
+	// Telegram 登录数据的有效期，防止旧的登录链接被重放
+	loginMaxAge = 24 * time.Hour
+)
+
+// 会话 JWT 的内容，sub 是登录用户的 Telegram ID，权限在每次请求时按角色判断
+type sessionClaims struct {
+	Subject int64  `json:"sub"`
+	Name    string `json:"name"`
+	Expires int64  `json:"exp"`
+}
+
+// 会话签名密钥由管理机器人 token 派生，更换 token 后旧会话全部失效
+func (m *BotManager) sessionKey() []byte {
+	if m.managerBot == nil {
+		return nil
+	}
+	sum := sha256.Sum256([]byte("forwardme-session:" + m.managerBot.Token))
+	return sum[:]
+}
+
+// 按 https://core.telegram.org/widgets/login#checking-authorization 校验登录数据
+func verifyTelegramLogin(query url.Values, botToken string, now time.Time) (sessionClaims, error) {
+	hash := query.Get("hash")
+	if hash == "" {
+		return sessionClaims{}, errors.New("missing hash")
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != "hash" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+"="+query.Get(key))
+	}
+
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return sessionClaims{}, errors.New("hash mismatch")
+	}
+
+	authDate, err := strconv.ParseInt(query.Get("auth_date"), 10, 64)
+	if err != nil || now.Sub(time.Unix(authDate, 0)) > loginMaxAge {
+		return sessionClaims{}, errors.New("login data expired")
+	}
+	id, err := strconv.ParseInt(query.Get("id"), 10, 64)
+	if err != nil {
+		return sessionClaims{}, errors.New("invalid id")
+	}
+	name := strings.TrimSpace(query.Get("first_name") + " " + query.Get("last_name"))
+	return sessionClaims{Subject: id, Name: name, Expires: now.Add(sessionTTL).Unix()}, nil
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func signSession(claims sessionClaims, key []byte) string {
+	payload, _ := json.Marshal(claims)
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func parseSession(token string, key []byte, now time.Time) (sessionClaims, bool) {
+	var claims sessionClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return claims, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil || now.Unix() >= claims.Expires {
+		return claims, false
+	}
+	return claims, true
+}
+
+// 从 cookie 中取出当前登录的用户
+func (m *BotManager) dashboardSession(r *http.Request) (sessionClaims, bool) {
+	key := m.sessionKey()
+	cookie, err := r.Cookie(sessionCookieName)
+	if key == nil || err != nil {
+		return sessionClaims{}, false
+	}
+	return parseSession(cookie.Value, key, time.Now())
+}
+
+func (m *BotManager) registerDashboard(mux *http.ServeMux) {
+	mux.HandleFunc("GET /dashboard", m.handleDashboard)
+	mux.HandleFunc("GET /dashboard/login", m.handleDashboardLogin)
+	mux.HandleFunc("GET /dashboard/auth", m.handleDashboardAuth)
+	mux.HandleFunc("POST /dashboard/logout", m.handleDashboardLogout)
+	mux.HandleFunc("GET /dashboard/bots/{bot}/users/{user}", m.handleDashboardConversation)
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>ForwardMe 登录</title></head>
+<body>
+<h1>ForwardMe 控制台</h1>
+<p>使用 Telegram 账号登录，查看你创建或被授权管理的机器人。</p>
+<script async src="https://telegram.org/js/telegram-widget.js?22" data-telegram-login="{{.}}" data-size="large" data-auth-url="/dashboard/auth"></script>
+</body></html>
+`))
+
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>ForwardMe 控制台</title></head>
+<body>
+<h1>ForwardMe 控制台</h1>
+<form method="post" action="/dashboard/logout">{{.Name}}（{{.CreatorID}}） <button>退出登录</button></form>
+{{if .Bots}}
+<table>
+<tr><th>机器人</th><th>角色</th><th>用户数</th><th>封禁数</th><th>近 7 天转发</th></tr>
+{{range .Bots}}<tr><td>{{.Username}}</td><td>{{.Role}}</td><td>{{.Users}}</td><td>{{.Bans}}</td><td>{{.Forwarded}}</td></tr>
+{{end}}</table>
+{{range .Bots}}{{if .Pending}}{{$bot := .ID}}
+<h2>{{.Username}} 等待回复</h2>
+<ul>
+{{range .Pending}}<li>{{if .Pinned}}📌 {{end}}<a href="/dashboard/bots/{{$bot}}/users/{{.UserID}}">{{or .Name "用户"}}（{{.UserID}}）</a>：{{.Messages}} 条，自 {{.Since.Format "01-02 15:04"}}</li>
+{{end}}</ul>
+{{end}}{{end}}
+{{else}}
+<p>你还没有可以查看的机器人，在管理机器人中发送 /newbot 创建。</p>
+{{end}}
+</body></html>
+`))
+
+var conversationPage = template.Must(template.New("conversation").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>ForwardMe 对话</title></head>
+<body>
+<p><a href="/dashboard">返回控制台</a></p>
+<h1>{{.Bot}} 与 {{.User}} 的对话</h1>
+{{if .Entries}}
+{{range .Entries}}<p><b>{{.CreatedAt.Format "2006-01-02 15:04"}} {{if .FromUser}}用户{{else}}回复{{end}}：</b><br>{{.Text}}</p>
+{{end}}
+{{else}}
+<p>暂无对话记录。</p>
+{{end}}
+</body></html>
+`))
+
+type dashboardBot struct {
+	ID, Username, Role     string
+	Users, Bans, Forwarded int64
+	// 等待回复的用户，置顶的对话在前
+	Pending []awaitingUser
+}
+
+func (m *BotManager) handleDashboardLogin(w http.ResponseWriter, r *http.Request) {
+	if m.managerBot == nil {
+		http.Error(w, "dashboard requires a manager bot", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	loginPage.Execute(w, m.managerBot.Self.UserName)
+}
+
+func (m *BotManager) handleDashboardAuth(w http.ResponseWriter, r *http.Request) {
+	if m.managerBot == nil {
+		http.Error(w, "dashboard requires a manager bot", http.StatusServiceUnavailable)
+		return
+	}
+	claims, err := verifyTelegramLogin(r.URL.Query(), m.managerBot.Token, time.Now())
+	if err != nil {
+		log.Printf("Rejected dashboard login from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "invalid login", http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    signSession(claims, m.sessionKey()),
+		Path:     "/dashboard",
+		Expires:  time.Unix(claims.Expires, 0),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.Printf("User %d logged in to the dashboard.", claims.Subject)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+func (m *BotManager) handleDashboardLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/dashboard", MaxAge: -1})
+	http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+}
+
+func (m *BotManager) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	session, ok := m.dashboardSession(r)
+	if !ok {
+		http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+		return
+	}
+
+	var tokens []string
+	m.mu.RLock()
+	for token := range m.bots {
+		tokens = append(tokens, token)
+	}
+	m.mu.RUnlock()
+
+	since := time.Now().AddDate(0, 0, -7).Unix()
+	var bots []dashboardBot
+	for _, token := range tokens {
+		r := m.botRole(token, session.Subject)
+		if !roleAllows(r, permRead) {
+			continue
+		}
+		b := dashboardBot{ID: botIDFromToken(token), Username: m.botUsername(token), Role: roleNames[r]}
+		m.db.QueryRow("SELECT COUNT(*) FROM bot_users WHERE bot_token = ?", token).Scan(&b.Users)
+		m.db.QueryRow("SELECT COUNT(*) FROM bans WHERE bot_token = ?", token).Scan(&b.Bans)
+		m.db.QueryRow("SELECT COUNT(*) FROM message_map WHERE bot_token = ? AND created_at >= ?", token, since).Scan(&b.Forwarded)
+		if pending, err := m.awaitingUsers(token); err != nil {
+			log.Printf("Failed to list awaiting users of bot %s: %v", botIDFromToken(token), err)
+		} else {
+			b.Pending = pending[:min(len(pending), digestMaxUsers)]
+		}
+		bots = append(bots, b)
+	}
+	sort.Slice(bots, func(i, j int) bool { return bots[i].Username < bots[j].Username })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardPage.Execute(w, map[string]interface{}{
+		"Name":      session.Name,
+		"CreatorID": session.Subject,
+		"Bots":      bots,
+	})
+}
+
+// 一个用户的对话记录，需要在该机器人上有查看权限
+func (m *BotManager) handleDashboardConversation(w http.ResponseWriter, r *http.Request) {
+	session, ok := m.dashboardSession(r)
+	if !ok {
+		http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+		return
+	}
+	bot, ok := m.botByID(r.PathValue("bot"))
+	userID, err := strconv.ParseInt(r.PathValue("user"), 10, 64)
+	if !ok || err != nil || !m.botCan(bot.Token, session.Subject, permRead) {
+		http.NotFound(w, r)
+		return
+	}
+	entries, err := m.loadTranscript(bot.Token, userID, transcriptMaxCount)
+	if err != nil {
+		log.Printf("Failed to load transcript of user %d for bot %s: %v", userID, botIDFromToken(bot.Token), err)
+		http.Error(w, "failed to load conversation", http.StatusInternalServerError)
+		return
+	}
+
+	user := strconv.FormatInt(userID, 10)
+	var username, firstName, lastName string
+	if m.db.QueryRow("SELECT username, first_name, last_name FROM bot_users WHERE bot_token = ? AND user_id = ?", bot.Token, userID).
+		Scan(&username, &firstName, &lastName) == nil {
+		user = displayName(username, firstName, lastName) + "（" + user + "）"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	conversationPage.Execute(w, map[string]interface{}{
+		"Bot":     m.botUsername(bot.Token),
+		"User":    user,
+		"Entries": entries,
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 连续发送失败达到该次数后视为无法联系，并通知创建者
+const unreachableThreshold = 3
+
+// Telegram 明确拒绝投递给该用户，例如账号已注销或用户屏蔽了机器人。
+// 限流和网络错误是暂时的，不计入连续失败
+func isUndeliverable(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusBadRequest
+}
+
+// 记录一次发给用户的消息的结果，成功时清除失败记录。
+// 返回该用户是否刚刚达到连续失败次数，调用方据此通知创建者
+func (m *BotManager) recordDelivery(token string, userID int64, err error) bool {
+	if err == nil {
+		if _, err := m.db.Exec("DELETE FROM delivery_failures WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+			log.Printf("Failed to clear delivery failures of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		}
+		return false
+	}
+	if !isUndeliverable(err) {
+		return false
+	}
+
+	var failures int
+	err = m.db.QueryRow(`INSERT INTO delivery_failures (bot_token, user_id, failures, last_error, last_failed_at) VALUES (?, ?, 1, ?, ?)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET failures = failures + 1, last_error = excluded.last_error, last_failed_at = excluded.last_failed_at
+		RETURNING failures`, token, userID, err.Error(), time.Now().Unix()).Scan(&failures)
+	if err != nil {
+		log.Printf("Failed to record delivery failure of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	if failures == unreachableThreshold {
+		log.Printf("User %d is unreachable for bot %s after %d failed sends.", userID, botIDFromToken(token), failures)
+		metrics.inc("forwardme_users_unreachable_total", "bot", botIDFromToken(token))
+		return true
+	}
+	return false
+}
+
+// 用户的投递状态，没有失败记录时 failures 为 0
+func (m *BotManager) deliveryState(token string, userID int64) (failures int, lastError string, lastFailed time.Time) {
+	var at int64
+	err := m.db.QueryRow("SELECT failures, last_error, last_failed_at FROM delivery_failures WHERE bot_token = ? AND user_id = ?", token, userID).
+		Scan(&failures, &lastError, &at)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get delivery state of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return failures, lastError, time.Unix(at, 0)
+}
+
+// 告知创建者某个用户已无法联系
+func (m *BotManager) notifyUnreachable(bot *tgbotapi.BotAPI, creatorID, userID int64) {
+	_, lastError, _ := m.deliveryState(bot.Token, userID)
+	text := fmt.Sprintf("⚠️ 用户ID: %d 连续 %d 次无法送达，对方可能已注销账号或屏蔽了机器人。\n最近的错误：%s\n发送 /info %d 查看详情",
+		userID, unreachableThreshold, lastError, userID)
+	bot.Send(tgbotapi.NewMessage(creatorID, text))
+}
+
+// 处理 /info <ID>，或回复一条转发消息发送 /info，查看用户的资料和状态
+func (m *BotManager) handleInfoCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	userID, _, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID，例如：/info 123456，或回复一条转发消息发送 /info"))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "用户ID: %d\n", userID)
+	var username, firstName, lastName, source string
+	var firstSeen, lastSeen, messages int64
+	err = m.db.QueryRow("SELECT username, first_name, last_name, source, first_seen, last_seen, message_count FROM bot_users WHERE bot_token = ? AND user_id = ?", token, userID).
+		Scan(&username, &firstName, &lastName, &source, &firstSeen, &lastSeen, &messages)
+	switch {
+	case err == sql.ErrNoRows:
+		b.WriteString("该用户还没有使用过机器人\n")
+	case err != nil:
+		log.Printf("Failed to get profile of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	default:
+		fmt.Fprintf(&b, "资料：%s\n首次使用：%s\n最近使用：%s\n发送的消息：%d\n", displayName(username, firstName, lastName),
+			time.Unix(firstSeen, 0).Format("2006-01-02 15:04"), time.Unix(lastSeen, 0).Format("2006-01-02 15:04"), messages)
+		if source != "" {
+			fmt.Fprintf(&b, "来源：%s\n", source)
+		}
+	}
+
+	if labels, err := m.queryStrings("SELECT label FROM user_labels WHERE bot_token = ? AND user_id = ? ORDER BY label", token, userID); err == nil && len(labels) > 0 {
+		fmt.Fprintf(&b, "标签：%s\n", strings.Join(labels, "，"))
+	}
+	if notes, err := m.getUserNotes(token, userID); err == nil && len(notes) > 0 {
+		fmt.Fprintf(&b, "备注：%d 条，发送 /note %d 查看\n", len(notes), userID)
+	}
+
+	flags := []struct {
+		label string
+		set   bool
+	}{
+		{"已封禁", m.isUserBlocked(token, userID)},
+		{"已静音", m.isUserMuted(token, userID)},
+		{"VIP 用户", m.isVIP(token, userID)},
+		{"已停止转发", m.isOptedOut(token, userID)},
+	}
+	for _, f := range flags {
+		if f.set {
+			b.WriteString(f.label + "\n")
+		}
+	}
+
+	if until, ok := m.snoozedUntil(token, userID); ok {
+		fmt.Fprintf(&b, "静默至 %s\n", until.Format("2006-01-02 15:04"))
+	}
+
+	failures, lastError, lastFailed := m.deliveryState(token, userID)
+	switch {
+	case failures >= unreachableThreshold:
+		fmt.Fprintf(&b, "投递状态：无法联系，连续 %d 次发送失败，最近一次在 %s\n错误：%s\n", failures, lastFailed.Format("2006-01-02 15:04"), lastError)
+	case failures > 0:
+		fmt.Fprintf(&b, "投递状态：最近 %d 次发送失败（%s）\n", failures, lastError)
+	default:
+		b.WriteString("投递状态：正常\n")
+	}
+
+	bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 用户消息转交到的群组，未设置时为 0
+func (m *BotManager) destinationChatID(token string) int64 {
+	var chatID int64
+	err := m.db.QueryRow("SELECT destination_chat_id FROM bots WHERE token = ?", token).Scan(&chatID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get destination chat of bot %s: %v", botIDFromToken(token), err)
+	}
+	return chatID
+}
+
+// 用户消息转交到的聊天：论坛群组、普通群组或创建者
+func (m *BotManager) relayChat(token string, creatorID int64) int64 {
+	if forumID := m.forumChatID(token); forumID != 0 {
+		return forumID
+	}
+	if groupID := m.destinationChatID(token); groupID != 0 {
+		return groupID
+	}
+	return creatorID
+}
+
+// 设置用户消息转交到的论坛群组或普通群组，两者只能设置一个，都为 0 时转交给创建者。
+// 各个聊天的消息 ID 会重复，切换时清除旧的消息映射、话题和回复对应的消息
+func (m *BotManager) setRelayChats(token string, forumID, groupID int64) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE bots SET forum_chat_id = ?, destination_chat_id = ? WHERE token = ?", forumID, groupID, token); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM message_map WHERE bot_token = ?", token); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_topics WHERE bot_token = ?", token); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE reply_log SET creator_message_id = 0 WHERE bot_token = ?", token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 转交群组中的消息：成员回复转交的消息时交给对应的用户，其他消息不处理
+func (m *BotManager) handleDestinationMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if message.ReplyToMessage == nil || message.IsCommand() || message.From == nil || message.From.IsBot && message.SenderChat == nil {
+		return
+	}
+	if _, ok := describeServiceMessage(message); ok {
+		return
+	}
+	if userID, ok := m.resolveReplyTarget(bot.Token, message); ok {
+		log.Printf("Member %d of destination chat %d replies to user ID: %d", message.From.ID, message.Chat.ID, userID)
+		m.deliverReply(bot, message, userID, message.MessageID)
+	}
+}
+
+// 处理 /setdestination <群组 ID>|me
+func (m *BotManager) handleSetDestinationCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/setdestination <群组 ID> 把用户消息转交到群组，群组成员回复转交的消息即可回答用户；机器人需要已加入该群组。/setdestination me 恢复为转交给你"
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "你"
+		if groupID := m.destinationChatID(token); groupID != 0 {
+			state = fmt.Sprintf("群组 %d", groupID)
+		} else if forumID := m.forumChatID(token); forumID != 0 {
+			state = fmt.Sprintf("论坛群组 %d", forumID)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "消息转交到："+state+"\n"+usage))
+		return
+	}
+
+	var groupID int64
+	if arg != "me" {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id >= 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		chat, err := bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: id}})
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to check destination chat")))
+			return
+		}
+		if !chat.IsGroup() && !chat.IsSuperGroup() {
+			bot.Send(tgbotapi.NewMessage(creatorID, "只能转交到群组"))
+			return
+		}
+		groupID = id
+	}
+
+	if err := m.setRelayChats(token, 0, groupID); err != nil {
+		log.Printf("Failed to update destination chat of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update destination chat")))
+		return
+	}
+	if groupID == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用户消息将转交给你，之前转交到群组的消息无法再回复"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户消息将转交到群组 %d，群组成员回复转交的消息即可回答用户，之前转交给你的消息无法再直接回复", groupID)))
+	}
+}
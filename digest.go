@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	digestCheckInterval = 30 * time.Minute
+	// 没有回复也没有标记已处理超过该时长后发送摘要
+	digestIdleAfter = 12 * time.Hour
+	// 持续未处理时最多每天发送一次
+	digestRepeatAfter = 24 * time.Hour
+	// 摘要中最多列出的用户数
+	digestMaxUsers = 30
+)
+
+type awaitingUser struct {
+	UserID   int64
+	Name     string
+	Messages int
+	Since    time.Time
+	Pinned   bool
+}
+
+// 最后一条消息之后既没有回复也没有标记已处理的用户，置顶的对话在前，其余按等待时间排列
+func (m *BotManager) awaitingUsers(token string) ([]awaitingUser, error) {
+	rows, err := m.db.Query(`SELECT t.user_id, COUNT(*), MIN(t.created_at),
+			COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''),
+			EXISTS(SELECT 1 FROM pinned_users p WHERE p.bot_token = ?1 AND p.user_id = t.user_id) AS pinned
+		FROM transcript_entries t
+		LEFT JOIN bot_users u ON u.bot_token = t.bot_token AND u.user_id = t.user_id
+		WHERE t.bot_token = ?1 AND t.from_user = 1
+			AND t.created_at > COALESCE((SELECT MAX(r.created_at) FROM transcript_entries r
+				WHERE r.bot_token = ?1 AND r.user_id = t.user_id AND r.from_user = 0), 0)
+			AND t.created_at > COALESCE((SELECT h.handled_at FROM handled_marks h
+				WHERE h.bot_token = ?1 AND h.user_id = t.user_id), 0)
+		GROUP BY t.user_id ORDER BY pinned DESC, MIN(t.created_at)`, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []awaitingUser
+	for rows.Next() {
+		var u awaitingUser
+		var since int64
+		var username, firstName, lastName string
+		if err := rows.Scan(&u.UserID, &u.Messages, &since, &username, &firstName, &lastName, &u.Pinned); err != nil {
+			return nil, err
+		}
+		u.Since = time.Unix(since, 0)
+		u.Name = displayName(username, firstName, lastName)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// 创建者和其他管理员最近一次回复或标记已处理的时间
+func (m *BotManager) lastHandledAt(token string) time.Time {
+	var at int64
+	err := m.db.QueryRow(`SELECT MAX(COALESCE((SELECT MAX(created_at) FROM reply_log WHERE bot_token = ?1), 0),
+		COALESCE((SELECT MAX(handled_at) FROM handled_marks WHERE bot_token = ?1), 0))`, token).Scan(&at)
+	if err != nil {
+		log.Printf("Failed to get last handled time of bot %s: %v", botIDFromToken(token), err)
+	}
+	return time.Unix(at, 0)
+}
+
+func formatDigest(users []awaitingUser, idle time.Duration) string {
+	var b strings.Builder
+	total := 0
+	for _, u := range users {
+		total += u.Messages
+	}
+	fmt.Fprintf(&b, "📋 已有 %d 小时没有处理消息，%d 位用户共 %d 条消息在等待回复：\n\n", int(idle.Hours()), len(users), total)
+	writeAwaitingUsers(&b, users)
+	b.WriteString("\n回复用户或发送 /handled <ID> 标记为已处理，发送 /digest off 关闭摘要")
+	return b.String()
+}
+
+// /pending 的列表，与摘要的区别是不说明多久没有处理
+func formatPending(users []awaitingUser) string {
+	var b strings.Builder
+	total := 0
+	for _, u := range users {
+		total += u.Messages
+	}
+	fmt.Fprintf(&b, "📋 %d 位用户共 %d 条消息在等待回复：\n\n", len(users), total)
+	writeAwaitingUsers(&b, users)
+	b.WriteString("\n回复用户或发送 /handled <ID> 标记为已处理，/pin <ID> 置顶对话")
+	return b.String()
+}
+
+// 每位用户一行，置顶的对话带 📌，超过 digestMaxUsers 位时只列出前面的
+func writeAwaitingUsers(b *strings.Builder, users []awaitingUser) {
+	for i, u := range users {
+		if i == digestMaxUsers {
+			fmt.Fprintf(b, "……另有 %d 位用户\n", len(users)-digestMaxUsers)
+			break
+		}
+		name := u.Name
+		if name == "" {
+			name = "用户"
+		}
+		if u.Pinned {
+			name = "📌 " + name
+		}
+		fmt.Fprintf(b, "%s（%d）：%d 条，自 %s\n", name, u.UserID, u.Messages, u.Since.Format("01-02 15:04"))
+	}
+}
+
+// 给长时间没有处理消息的机器人发送待回复摘要
+func (m *BotManager) sendDigests(now time.Time) {
+	rows, err := m.db.Query("SELECT token, digest_sent_at FROM bots WHERE deleted_at = 0 AND digest = 1")
+	if err != nil {
+		log.Printf("Failed to load digest settings: %v", err)
+		return
+	}
+	sentAt := make(map[string]int64)
+	for rows.Next() {
+		var token string
+		var at int64
+		if err := rows.Scan(&token, &at); err == nil {
+			sentAt[token] = at
+		}
+	}
+	rows.Close()
+
+	for token, at := range sentAt {
+		m.mu.RLock()
+		bot, running := m.bots[token]
+		creatorID := m.creator[token]
+		m.mu.RUnlock()
+		if !running || now.Sub(time.Unix(at, 0)) < digestRepeatAfter {
+			continue
+		}
+		last := m.lastHandledAt(token)
+		if now.Sub(last) < digestIdleAfter {
+			continue
+		}
+		users, err := m.awaitingUsers(token)
+		if err != nil {
+			log.Printf("Failed to list awaiting users of bot %s: %v", botIDFromToken(token), err)
+			continue
+		}
+		if len(users) == 0 {
+			continue
+		}
+		// 从未处理过消息时按最早等待的用户计算，置顶的用户排在前面，不一定最早
+		if last.Unix() == 0 {
+			last = users[0].Since
+			for _, u := range users[1:] {
+				if u.Since.Before(last) {
+					last = u.Since
+				}
+			}
+		}
+		idle := now.Sub(last)
+		if idle < digestIdleAfter {
+			continue
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(m.onDutyID(creatorID), formatDigest(users, idle))); err != nil {
+			log.Printf("Failed to send digest for bot %s: %v", botIDFromToken(token), err)
+			continue
+		}
+		if _, err := m.db.Exec("UPDATE bots SET digest_sent_at = ? WHERE token = ?", now.Unix(), token); err != nil {
+			log.Printf("Failed to record digest of bot %s: %v", botIDFromToken(token), err)
+		}
+		log.Printf("Sent digest of %d awaiting users for bot %s.", len(users), botIDFromToken(token))
+	}
+}
+
+func (m *BotManager) runDigests() {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.sendDigests(time.Now())
+	}
+}
+
+// 把用户标记为已处理，摘要中不再列出，直到用户发来新消息
+func (m *BotManager) markHandled(token string, userID int64) error {
+	_, err := m.db.Exec(`INSERT INTO handled_marks (bot_token, user_id, handled_at) VALUES (?, ?, ?)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET handled_at = excluded.handled_at`, token, userID, time.Now().Unix())
+	return err
+}
+
+// 处理 /handled <ID>，或回复一条转发消息发送 /handled，把用户标记为无需回复
+func (m *BotManager) handleHandledCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	userID, _, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID，例如：/handled 123456，或回复一条转发消息发送 /handled"))
+		return
+	}
+	if err := m.markHandled(token, userID); err != nil {
+		log.Printf("Failed to mark user %d handled for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to mark user handled")))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已标记为已处理", userID)))
+}
+
+// 处理 /digest [on|off]
+func (m *BotManager) handleDigestCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := fmt.Sprintf("用法：/digest on|off。开启后，超过 %d 小时没有回复或标记已处理时，会发送一份等待回复的用户摘要，每天最多一次", int(digestIdleAfter.Hours()))
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "关闭"
+		if m.botFlag(token, "digest") {
+			state = "开启"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "待回复摘要："+state+"\n"+usage))
+		return
+	}
+	if arg != "on" && arg != "off" {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if _, err := m.db.Exec("UPDATE bots SET digest = ? WHERE token = ?", arg == "on", token); err != nil {
+		log.Printf("Failed to update digest setting of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update digest setting")))
+		return
+	}
+	if arg == "on" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已开启待回复摘要"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已关闭待回复摘要"))
+	}
+}
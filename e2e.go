@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SenLief/forwardme/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 端到端场景使用的机器人和用户，请求都发往本地的模拟 Bot API
+const (
+	e2eManagerToken = "2000000:manager"
+	e2eBotToken     = "2000001:scenario"
+	e2eStepTimeout  = 5 * time.Second
+)
+
+var (
+	e2eCreator = tgbotapi.User{ID: 10, FirstName: "Creator", UserName: "creator"}
+	e2eUser    = tgbotapi.User{ID: 20, FirstName: "User", UserName: "user"}
+)
+
+// 场景中的一步：向某个机器人投递一条更新，然后等待预期的请求
+type e2eStep struct {
+	name   string
+	token  string
+	update tgbotapi.Update
+	expect func(telegramtest.Request) bool
+}
+
+func e2eScenario() []e2eStep {
+	userID := fmt.Sprint(e2eUser.ID)
+	forwarded := func(r telegramtest.Request) bool {
+		return r.Token == e2eBotToken && r.Method == "forwardMessage" && r.ChatID() == e2eCreator.ID && r.Params.Get("from_chat_id") == userID
+	}
+	hello := telegramtest.TextMessage(e2eUser, "你好")
+	return []e2eStep{
+		{"register bot", e2eManagerToken, telegramtest.TextMessage(e2eCreator, "/newbot "+e2eBotToken),
+			telegramtest.SentText(e2eManagerToken, e2eCreator.ID, "New bot created successfully")},
+		{"user message", e2eBotToken, hello, forwarded},
+		{"edited message", e2eBotToken, telegramtest.EditedMessage(hello.Message, "你好呀"),
+			telegramtest.SentText(e2eBotToken, e2eCreator.ID, "edited")},
+		{"ban", e2eBotToken, telegramtest.TextMessage(e2eCreator, "/ban "+userID+" 测试"),
+			telegramtest.SentText(e2eBotToken, e2eCreator.ID, "已被封禁")},
+		{"banned user message", e2eBotToken, telegramtest.TextMessage(e2eUser, "还在吗"),
+			func(r telegramtest.Request) bool {
+				return telegramtest.SentText(e2eBotToken, e2eUser.ID, "你已被封禁")(r) && strings.Contains(r.Params.Get("reply_markup"), "|"+cbAppeal+"|"+userID+"|")
+			}},
+		{"appeal button", e2eBotToken, telegramtest.CallbackQuery(e2eUser, signCallback(e2eBotToken, cbAppeal, e2eUser.ID)),
+			telegramtest.SentText(e2eBotToken, e2eUser.ID, "请在此输入你的申诉信息")},
+		{"appeal", e2eBotToken, telegramtest.TextMessage(e2eUser, "误封了"),
+			telegramtest.SentText(e2eBotToken, e2eCreator.ID, "发起申诉")},
+		{"unban", e2eBotToken, telegramtest.TextMessage(e2eCreator, "/unban "+userID),
+			telegramtest.SentText(e2eBotToken, e2eCreator.ID, "已被解封")},
+		{"message after unban", e2eBotToken, telegramtest.TextMessage(e2eUser, "谢谢"), forwarded},
+	}
+}
+
+// 在临时数据库和模拟的 Bot API 上启动管理机器人，返回模拟服务器和停止函数。
+// 场景中的更新经由真实的轮询和处理协程
+func startE2E() (*telegramtest.Server, func(), error) {
+	dir, err := os.MkdirTemp("", "forwardme-e2e-")
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open("sqlite", filepath.Join(dir, "bots.db")+sqliteOptions)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	if err := initSchema(db); err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+
+	telegram := telegramtest.NewServer()
+	telegram.AddBot(e2eManagerToken, "scenario_manager_bot")
+	telegram.AddBot(e2eBotToken, "scenario_bot")
+
+	m := NewBotManager(db)
+	m.apiEndpoint = telegram.Endpoint()
+	stop := func() {
+		m.draining.Store(true)
+		m.stopPolling()
+		done := make(chan struct{})
+		go func() {
+			m.pollers.Wait()
+			close(done)
+		}()
+		// 某一步卡住时不等待处理协程结束
+		select {
+		case <-done:
+		case <-time.After(e2eStepTimeout):
+		}
+		telegram.Close()
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	managerBot, err := m.newBotAPI(e2eManagerToken)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	m.managerBot = managerBot
+	go m.pollManagerBot(managerBot, true)
+	return telegram, stop, nil
+}
+
+// 投递一步的更新并等待预期的请求
+func (step e2eStep) run(telegram *telegramtest.Server) error {
+	telegram.Send(step.token, step.update)
+	_, err := telegram.Expect(e2eStepTimeout, step.expect)
+	return err
+}
+
+// 跑一遍注册机器人、用户消息、编辑、封禁、申诉和解封的完整流程，返回每一步的结果，第一步失败后停止。
+// go test 中由 TestE2E 逐步运行同一场景
+func runE2E() ([]string, error) {
+	telegram, stop, err := startE2E()
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	var results []string
+	for _, step := range e2eScenario() {
+		if err := step.run(telegram); err != nil {
+			results = append(results, "FAIL "+step.name)
+			return results, fmt.Errorf("%s: %w", step.name, err)
+		}
+		results = append(results, "ok   "+step.name)
+	}
+	return results, nil
+}
+
+func runE2ECLI() {
+	log.SetOutput(io.Discard)
+	results, err := runE2E()
+	for _, line := range results {
+		fmt.Println(line)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "e2e scenario failed:", err)
+		os.Exit(1)
+	}
+}
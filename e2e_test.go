@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// 端到端场景，每一步是一个子测试，依赖前面的步骤，失败后停止
+func TestE2E(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	telegram, stop, err := startE2E()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stop)
+
+	for _, step := range e2eScenario() {
+		if !t.Run(step.name, func(t *testing.T) {
+			if err := step.run(telegram); err != nil {
+				t.Fatal(err)
+			}
+		}) {
+			return
+		}
+	}
+}
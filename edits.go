@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 用户编辑消息后，回复在原先转交的消息上的标记
+const editedMarker = "✏️ 用户编辑了这条消息（edited），新的内容如下"
+
+// 用户编辑了已经转交给创建者的消息时，先回复原消息说明已编辑，再把编辑后的版本交给创建者。
+// 没有转交过的消息（命令、自动回答等）和封禁、禁言用户的编辑不处理。创建者编辑回复时同步到用户一侧
+func (m *BotManager) handleEditedMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, ownerID, creatorID int64) {
+	token := bot.Token
+	if message.From == nil || isChatSender(message) || m.fromBlockedChat(token, message) {
+		return
+	}
+	userID := message.From.ID
+	if userID == ownerID || userID == creatorID {
+		m.syncEditedReply(bot, message)
+		return
+	}
+	if m.isGloballyBlocked(ownerID, userID) || m.isUserBlocked(token, userID) || m.isUserMuted(token, userID) || m.isOptedOut(token, userID) {
+		return
+	}
+
+	originalID, ok := m.lookupRelayedMessage(token, userID, message.MessageID)
+	if !ok {
+		log.Printf("Edited message %d of user %d was never relayed for bot %s, ignoring.", message.MessageID, userID, botIDFromToken(token))
+		return
+	}
+
+	// 转交到群组时标记同样发到群组，论坛模式下回复在原消息上，落在用户的话题中
+	dest := m.relayChat(token, creatorID)
+	marker := tgbotapi.NewMessage(dest, editedMarker)
+	marker.ReplyToMessageID = originalID
+	marker.AllowSendingWithoutReply = true
+	sentMarker, err := bot.Send(marker)
+	if err != nil {
+		log.Printf("Failed to send edit marker for message %d of user %d for bot %s: %v", message.MessageID, userID, botIDFromToken(token), err)
+		return
+	}
+	m.saveMessageMapping(token, sentMarker.MessageID, userID, message.MessageID)
+
+	// 复制模式下编辑后的版本作为对标记的回复，不再重复来源说明
+	var sentID int
+	if dest == m.forumChatID(token) {
+		sent, err := m.relayToTopic(bot, dest, message.Chat.ID, message.MessageID, message.From)
+		if err != nil {
+			log.Printf("Failed to relay edited message %d of user %d to forum for bot %s: %v", message.MessageID, userID, botIDFromToken(token), err)
+			return
+		}
+		sentID = sent
+	} else if m.relaysByCopy(token) {
+		copyConfig := tgbotapi.NewCopyMessage(dest, message.Chat.ID, message.MessageID)
+		copyConfig.ReplyToMessageID = sentMarker.MessageID
+		copyConfig.AllowSendingWithoutReply = true
+		copied, err := bot.CopyMessage(copyConfig)
+		if err != nil {
+			log.Printf("Failed to copy edited message %d of user %d for bot %s: %v", message.MessageID, userID, botIDFromToken(token), err)
+			return
+		}
+		sentID = copied.MessageID
+	} else {
+		sent, err := bot.Send(tgbotapi.NewForward(dest, message.Chat.ID, message.MessageID))
+		if err != nil {
+			log.Printf("Failed to forward edited message %d of user %d for bot %s: %v", message.MessageID, userID, botIDFromToken(token), err)
+			return
+		}
+		sentID = sent.MessageID
+	}
+	m.saveMessageMapping(token, sentID, userID, message.MessageID)
+	metrics.inc("forwardme_edits_relayed_total", "bot", botIDFromToken(token))
+	m.archiveMessages(bot, "✏️ "+relayHeader(message.From)+" 编辑了消息", message.Chat.ID, message.MessageID)
+	m.meter(token, usageRelayed, 1)
+	m.logConversation(token, userID, true, message)
+}
+
+// 创建者编辑了一条已送达的回复时，同样修改用户收到的那条消息的文字或说明文字，
+// 变量和署名按发送时的规则重新生成
+func (m *BotManager) syncEditedReply(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token := bot.Token
+	var userID int64
+	var messageID int
+	err := m.db.QueryRow("SELECT user_id, message_id FROM reply_log WHERE bot_token = ? AND creator_message_id = ?",
+		token, message.MessageID).Scan(&userID, &messageID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up reply for edited message %d of bot %s: %v", message.MessageID, botIDFromToken(token), err)
+		}
+		return
+	}
+
+	signature := m.replySignature(token, message.From.ID)
+	render := func(text string) string {
+		return signReply(m.expandUserVars(token, userID, text), signature)
+	}
+	var edit tgbotapi.Chattable
+	if message.Text != "" {
+		edit = tgbotapi.NewEditMessageText(userID, messageID, render(message.Text))
+	} else {
+		edit = tgbotapi.NewEditMessageCaption(userID, messageID, strings.TrimSpace(render(message.Caption)))
+	}
+	if _, err := bot.Request(edit); err != nil {
+		// 只修改了格式等用户看不到的内容时 Telegram 会拒绝，忽略即可
+		if strings.Contains(err.Error(), "message is not modified") {
+			return
+		}
+		log.Printf("Failed to sync edited reply %d to user %d for bot %s: %v", messageID, userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to update reply")))
+		return
+	}
+	log.Printf("Edited reply %d synced to user %d for bot %s.", messageID, userID, botIDFromToken(token))
+}
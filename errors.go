@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 分类后的错误：给创建者看的说明和反馈问题时使用的错误代码
+type errorClass struct {
+	code   string
+	detail string
+}
+
+// 按 Telegram 的错误描述细分的分类，描述按小写匹配
+var telegramErrorClasses = []struct {
+	status      int
+	description string
+	class       errorClass
+}{
+	{http.StatusForbidden, "bot was blocked by the user", errorClass{"TG-BLOCKED", "用户已屏蔽机器人"}},
+	{http.StatusForbidden, "user is deactivated", errorClass{"TG-DEACTIVATED", "对方账号已注销"}},
+	{http.StatusForbidden, "can't initiate conversation", errorClass{"TG-NO-CHAT", "机器人无法私聊该用户，对方未曾 /start"}},
+	{http.StatusBadRequest, "chat not found", errorClass{"TG-NO-CHAT", "机器人无法私聊该用户，对方未曾 /start"}},
+	{http.StatusBadRequest, "message is too long", errorClass{"TG-TOO-LONG", "消息过长，请分成几条发送"}},
+	{http.StatusBadRequest, "not found", errorClass{"TG-NOT-FOUND", "原消息已不存在"}},
+	{http.StatusBadRequest, "message can't be", errorClass{"TG-NOT-EDITABLE", "该消息已无法修改"}},
+}
+
+// 把错误归类为创建者能理解并采取行动的说明，无法归类时返回 false
+func classifyError(err error) (errorClass, bool) {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		description := strings.ToLower(apiErr.Message)
+		for _, c := range telegramErrorClasses {
+			if apiErr.Code == c.status && strings.Contains(description, c.description) {
+				return c.class, true
+			}
+		}
+		switch apiErr.Code {
+		case http.StatusTooManyRequests:
+			return errorClass{"TG-FLOOD", fmt.Sprintf("发送过于频繁，请 %d 秒后再试", apiErr.RetryAfter)}, true
+		case http.StatusUnauthorized:
+			return errorClass{"TG-TOKEN", "机器人的 token 已失效，请在 @BotFather 检查"}, true
+		case http.StatusForbidden:
+			return errorClass{"TG-FORBIDDEN", "机器人没有权限执行该操作"}, true
+		}
+		return errorClass{fmt.Sprintf("TG-%d", apiErr.Code), "Telegram 拒绝了请求：" + apiErr.Message}, true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorClass{"NET", "无法连接 Telegram，请稍后再试"}, true
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errorClass{"DB-NOT-FOUND", "没有找到对应的记录"}, true
+	}
+	// modernc 的错误信息带有 SQLite 的结果码
+	text := err.Error()
+	switch {
+	case strings.Contains(text, "SQLITE_BUSY"), strings.Contains(text, "database is locked"):
+		return errorClass{"DB-BUSY", "数据库繁忙，请稍后再试"}, true
+	case strings.Contains(text, "SQLITE_FULL"), strings.Contains(text, "disk is full"):
+		return errorClass{"DB-FULL", "服务器存储空间不足，请联系运营者"}, true
+	case strings.Contains(text, "constraint failed"):
+		return errorClass{"DB-CONFLICT", "数据与已有记录冲突"}, true
+	}
+	return errorClass{}, false
+}
+
+// 给创建者的错误回复：fallback 说明哪个操作失败，后面附上分类说明、错误代码和日志中的参考编号，
+// 反馈问题时提供代码和编号即可在日志中找到原始错误。超出套餐限制时返回套餐的提示
+func friendlyError(err error, fallback string) string {
+	if err == nil {
+		return fallback
+	}
+	var limitErr *planLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.message()
+	}
+
+	ref := make([]byte, 3)
+	rand.Read(ref)
+	reference := hex.EncodeToString(ref)
+	class, ok := classifyError(err)
+	if !ok {
+		class.code = "INTERNAL"
+	}
+	log.Printf("Error %s (ref %s) reported to creator: %v", class.code, reference, err)
+
+	text := strings.TrimSuffix(fallback, ".")
+	if class.detail != "" {
+		text += "：" + class.detail
+	}
+	return fmt.Sprintf("%s\n错误代码：%s（参考编号 %s）", text, class.code, reference)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 审计事件类型
+const (
+	eventBan         = "ban"
+	eventUnban       = "unban"
+	eventBanChat     = "banchat"
+	eventUnbanChat   = "unbanchat"
+	eventMute        = "mute"
+	eventUnmute      = "unmute"
+	eventSnooze      = "snooze"
+	eventUnsnooze    = "unsnooze"
+	eventReply       = "reply"
+	eventRetract     = "retract"
+	eventSend        = "send"
+	eventBroadcast   = "broadcast"
+	eventGlobalBan   = "gban"
+	eventGlobalUnban = "ungban"
+	eventSuspend     = "suspend"
+	eventUnsuspend   = "unsuspend"
+	eventTokenCreate = "apitoken_create"
+	eventTokenRevoke = "apitoken_revoke"
+	eventPurge       = "purge"
+	eventForget      = "forget"
+	eventShare       = "share"
+	eventTranscript  = "transcript"
+	eventTemplate    = "applytemplate"
+	eventPlan        = "plan"
+	eventDeleteBot   = "deletebot"
+	eventRestoreBot  = "restorebot"
+	eventPurgeBot    = "purgebot"
+	eventRepair      = "repair"
+)
+
+// 每个机器人一条哈希链，实例级事件（全局黑名单、暂停机器人、API token）的 bot_token 为空。
+// 写入时需要读取上一条的哈希，串行化以免两条事件接在同一个前驱后面
+var eventLogMu sync.Mutex
+
+// 导出和校验使用的事件格式，bot 是机器人 ID 而不是 token
+type auditEvent struct {
+	ID      int64  `json:"id"`
+	Bot     string `json:"bot"`
+	Actor   int64  `json:"actor"`
+	Action  string `json:"action"`
+	Subject int64  `json:"subject"`
+	Detail  string `json:"detail"`
+	At      int64  `json:"at"`
+	Prev    string `json:"prev"`
+	Hash    string `json:"hash"`
+}
+
+// 哈希覆盖上一条的哈希和除 id 外的全部字段，detail 放在最后，其他字段都不含换行，拼接结果没有歧义
+func (e auditEvent) computeHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%d\n%s\n%d\n%d\n%s", e.Prev, e.Bot, e.Actor, e.Action, e.Subject, e.At, e.Detail)))
+	return hex.EncodeToString(sum[:])
+}
+
+// 追加一条审计事件，actor 为 0 表示系统或 API 执行的操作。写入失败只记录日志，不影响操作本身
+func (m *BotManager) logEvent(token string, actorID int64, action string, subjectID int64, detail string) {
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+
+	e := auditEvent{Actor: actorID, Action: action, Subject: subjectID, Detail: detail, At: time.Now().Unix()}
+	if token != "" {
+		e.Bot = botIDFromToken(token)
+	}
+	err := m.db.QueryRow("SELECT hash FROM event_log WHERE bot_token = ? ORDER BY id DESC LIMIT 1", token).Scan(&e.Prev)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to read the event log head for bot %s: %v", e.Bot, err)
+		return
+	}
+	_, err = m.db.Exec(`INSERT INTO event_log (bot_token, actor_id, action, subject_id, detail, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, token, e.Actor, e.Action, e.Subject, e.Detail, e.At, e.Prev, e.computeHash())
+	if err != nil {
+		log.Printf("Failed to append %s event for bot %s: %v", action, e.Bot, err)
+	}
+}
+
+func (m *BotManager) loadEvents(token string) ([]auditEvent, error) {
+	rows, err := m.db.Query(`SELECT id, actor_id, action, subject_id, detail, created_at, prev_hash, hash
+		FROM event_log WHERE bot_token = ? ORDER BY id`, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []auditEvent
+	for rows.Next() {
+		e := auditEvent{}
+		if token != "" {
+			e.Bot = botIDFromToken(token)
+		}
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Subject, &e.Detail, &e.At, &e.Prev, &e.Hash); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// 校验哈希链，返回第一条不一致的事件 ID，全部一致时返回 0
+func verifyEventChain(events []auditEvent) int64 {
+	var prev string
+	for _, e := range events {
+		if e.Prev != prev || e.computeHash() != e.Hash {
+			return e.ID
+		}
+		prev = e.Hash
+	}
+	return 0
+}
+
+// 导出一条哈希链为 JSONL 文件并附上校验结果，token 为空时导出实例级事件
+func (m *BotManager) sendEventExport(bot *tgbotapi.BotAPI, chatID int64, token string) {
+	events, err := m.loadEvents(token)
+	if err != nil {
+		log.Printf("Failed to load event log for bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to export event log.")))
+		return
+	}
+	if len(events) == 0 {
+		bot.Send(tgbotapi.NewMessage(chatID, "审计日志为空"))
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		enc.Encode(e)
+	}
+	name := "auditlog-instance.jsonl"
+	if token != "" {
+		name = "auditlog-" + botIDFromToken(token) + ".jsonl"
+	}
+
+	caption := fmt.Sprintf("共 %d 条事件，哈希链校验通过，最后一条哈希：%s", len(events), events[len(events)-1].Hash)
+	if broken := verifyEventChain(events); broken != 0 {
+		caption = fmt.Sprintf("共 %d 条事件，哈希链在 #%d 事件处校验失败，日志可能被篡改", len(events), broken)
+		log.Printf("Event log of bot %s fails verification at event %d.", botIDFromToken(token), broken)
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: buf.Bytes()})
+	doc.Caption = caption
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Failed to send event log export for bot %s: %v", botIDFromToken(token), err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 一条常见问题，消息包含任一关键词即视为匹配
+type faqEntry struct {
+	ID       int64
+	Keywords []string
+	Answer   string
+}
+
+func (m *BotManager) getFAQs(token string) ([]faqEntry, error) {
+	rows, err := m.db.Query("SELECT id, keywords, answer FROM faqs WHERE bot_token = ? ORDER BY id", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var faqs []faqEntry
+	for rows.Next() {
+		var f faqEntry
+		var keywords string
+		if err := rows.Scan(&f.ID, &keywords, &f.Answer); err != nil {
+			return nil, err
+		}
+		f.Keywords = strings.Split(keywords, ",")
+		faqs = append(faqs, f)
+	}
+	return faqs, rows.Err()
+}
+
+// 消息命中常见问题时自动回答，并附上转人工按钮。返回消息是否已被自动回答
+func (m *BotManager) answerFAQ(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	text := message.Text + " " + message.Caption
+	if strings.TrimSpace(text) == "" {
+		return false
+	}
+	faqs, err := m.getFAQs(bot.Token)
+	if err != nil {
+		log.Printf("Failed to get FAQs of bot %s: %v", botIDFromToken(bot.Token), err)
+		return false
+	}
+	for _, f := range faqs {
+		if _, ok := matchKeyword(text, f.Keywords); !ok {
+			continue
+		}
+		reply := tgbotapi.NewMessage(message.Chat.ID, f.Answer)
+		reply.ReplyToMessageID = message.MessageID
+		reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("仍需人工？", signCallback(bot.Token, cbFAQHuman, message.MessageID)),
+		))
+		if _, err := bot.Send(reply); err != nil {
+			log.Printf("Failed to send FAQ answer for bot %s: %v", botIDFromToken(bot.Token), err)
+			return false
+		}
+		metrics.inc("forwardme_faq_answers_total", "bot", botIDFromToken(bot.Token))
+		log.Printf("Answered message from user ID: %d with FAQ %d for bot %s.", message.From.ID, f.ID, botIDFromToken(bot.Token))
+		return true
+	}
+	return false
+}
+
+// 用户点击转人工后转发原消息，返回是否已处理
+func (m *BotManager) handleFAQCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData, creatorID int64) bool {
+	if cb.Action != cbFAQHuman {
+		return false
+	}
+	messageID, ok := cb.int(0)
+	if !ok {
+		log.Printf("Invalid FAQ callback: %s", query.Data)
+		return true
+	}
+	userID := query.From.ID
+	if m.isUserBlocked(bot.Token, userID) || m.isUserMuted(bot.Token, userID) {
+		return true
+	}
+	if m.forwardUserMessage(bot, creatorID, userID, userID, int(messageID)) {
+		metrics.inc("forwardme_faq_escalations_total", "bot", botIDFromToken(bot.Token))
+		if query.Message != nil {
+			bot.Send(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		}
+		bot.Send(tgbotapi.NewMessage(userID, "已转交人工，请耐心等待回复。"))
+	}
+	return true
+}
+
+// 处理 /faq
+func (m *BotManager) handleFAQCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	action, rest, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	rest = strings.TrimSpace(rest)
+	usage := "用法：\n/faq add 发货,快递,物流 | 一般在付款后 48 小时内发货\n/faq del <编号>\n/faq 查看列表"
+
+	switch action {
+	case "":
+		faqs, err := m.getFAQs(token)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get FAQs")))
+			return
+		}
+		if len(faqs) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无常见问题。\n"+usage))
+			return
+		}
+		var b strings.Builder
+		b.WriteString("常见问题:\n")
+		for i, f := range faqs {
+			fmt.Fprintf(&b, "%d. %s\n   → %s\n", i+1, strings.Join(f.Keywords, ", "), f.Answer)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+	case "add":
+		pattern, answer, ok := strings.Cut(rest, "|")
+		var keywords []string
+		for _, k := range strings.FieldsFunc(pattern, func(r rune) bool { return r == ',' || r == '，' }) {
+			if k = strings.TrimSpace(k); k != "" {
+				keywords = append(keywords, k)
+			}
+		}
+		answer = strings.TrimSpace(answer)
+		if !ok || len(keywords) == 0 || answer == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		if _, err := m.db.Exec("INSERT INTO faqs (bot_token, keywords, answer) VALUES (?, ?, ?)", token, strings.Join(keywords, ","), answer); err != nil {
+			log.Printf("Failed to add FAQ for bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add FAQ")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已添加常见问题"))
+	case "del":
+		n, err := strconv.Atoi(rest)
+		faqs, ferr := m.getFAQs(token)
+		if err != nil || ferr != nil || n < 1 || n > len(faqs) {
+			bot.Send(tgbotapi.NewMessage(creatorID, "无效的编号"))
+			return
+		}
+		if _, err := m.db.Exec("DELETE FROM faqs WHERE id = ?", faqs[n-1].ID); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete FAQ")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已删除常见问题"))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
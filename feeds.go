@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// 每个订阅源的检查间隔
+	feedCheckInterval = 15 * time.Minute
+	// 一次检查最多群发的新条目数，避免订阅源首次更新大量内容时刷屏
+	maxFeedItemsPerCheck = 5
+	maxFeedSize          = 5 << 20
+)
+
+var feedClient = &http.Client{Timeout: 30 * time.Second}
+
+type feedItem struct {
+	GUID, Title, Link string
+}
+
+// 同时兼容 RSS 2.0 和 Atom
+type feedDocument struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+			GUID  string `xml:"guid"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// 通过按站点区分的熔断器下载订阅源，某个站点持续出错时不再反复请求
+func fetchFeed(feedURL string) (title string, items []feedItem, err error) {
+	name := "feed"
+	if u, err := url.Parse(feedURL); err == nil {
+		name += ":" + u.Host
+	}
+	err = breakers.get(name).call(func() error {
+		title, items, err = downloadFeed(feedURL)
+		return err
+	})
+	return title, items, err
+}
+
+// 下载并解析订阅源，条目按源中的顺序（通常是最新的在前）返回
+func downloadFeed(feedURL string) (title string, items []feedItem, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), feedClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var doc feedDocument
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxFeedSize)).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	if len(doc.Entries) > 0 {
+		for _, e := range doc.Entries {
+			item := feedItem{GUID: e.ID, Title: strings.TrimSpace(e.Title)}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = l.Href
+					break
+				}
+			}
+			items = append(items, item)
+		}
+		title = doc.Title
+	} else {
+		for _, i := range doc.Channel.Items {
+			items = append(items, feedItem{GUID: i.GUID, Title: strings.TrimSpace(i.Title), Link: strings.TrimSpace(i.Link)})
+		}
+		title = doc.Channel.Title
+	}
+	for i := range items {
+		if items[i].GUID == "" {
+			items[i].GUID = items[i].Link
+		}
+		if items[i].GUID == "" {
+			items[i].GUID = items[i].Title
+		}
+	}
+	return strings.TrimSpace(title), items, nil
+}
+
+func formatFeedItem(feedTitle string, item feedItem) string {
+	return fmt.Sprintf("📰 %s\n\n%s\n%s", feedTitle, item.Title, item.Link)
+}
+
+// 记录条目已见过，返回是否为新条目
+func (m *BotManager) markFeedItemSeen(feedID int64, guid string) bool {
+	res, err := m.db.Exec("INSERT OR IGNORE INTO feed_items (feed_id, guid, seen_at) VALUES (?, ?, ?)", feedID, guid, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to mark item %q of feed #%d as seen: %v", guid, feedID, err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+func (m *BotManager) feedSubscribers(token string) ([]int64, error) {
+	rows, err := m.db.Query(`SELECT s.user_id FROM feed_subscribers s
+		WHERE s.bot_token = ?
+			AND NOT EXISTS (SELECT 1 FROM bans b WHERE b.bot_token = s.bot_token AND b.user_id = s.user_id)
+		ORDER BY s.user_id`, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 检查到期的订阅源，把新条目群发给订阅的用户
+func (m *BotManager) pollFeeds() {
+	rows, err := m.db.Query("SELECT id, bot_token, url, title FROM feeds WHERE next_check <= ?", time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to load due feeds: %v", err)
+		return
+	}
+	type dueFeed struct {
+		id                int64
+		token, url, title string
+	}
+	var due []dueFeed
+	for rows.Next() {
+		var f dueFeed
+		if err := rows.Scan(&f.id, &f.token, &f.url, &f.title); err == nil {
+			due = append(due, f)
+		}
+	}
+	rows.Close()
+
+	for _, f := range due {
+		if _, err := m.db.Exec("UPDATE feeds SET next_check = ? WHERE id = ?", time.Now().Add(feedCheckInterval).Unix(), f.id); err != nil {
+			log.Printf("Failed to update feed #%d: %v", f.id, err)
+			continue
+		}
+		m.mu.RLock()
+		bot, running := m.bots[f.token]
+		m.mu.RUnlock()
+		if !running {
+			continue
+		}
+
+		_, items, err := fetchFeed(f.url)
+		if err != nil {
+			log.Printf("Failed to fetch feed #%d (%s) for bot %s: %v", f.id, f.url, botIDFromToken(f.token), err)
+			continue
+		}
+		var fresh []feedItem
+		for _, item := range items {
+			if m.markFeedItemSeen(f.id, item.GUID) {
+				fresh = append(fresh, item)
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		if len(fresh) > maxFeedItemsPerCheck {
+			fresh = fresh[:maxFeedItemsPerCheck]
+		}
+
+		subscribers, err := m.feedSubscribers(f.token)
+		if err != nil {
+			log.Printf("Failed to load subscribers of bot %s: %v", botIDFromToken(f.token), err)
+			continue
+		}
+		// 从较旧的条目开始发送
+		for i := len(fresh) - 1; i >= 0; i-- {
+			sent, failed := m.broadcastText(bot, subscribers, formatFeedItem(f.title, fresh[i]))
+			log.Printf("Feed item %q of feed #%d sent to %d users, %d failed.", fresh[i].GUID, f.id, sent, failed)
+		}
+	}
+}
+
+// 处理用户的 /subscribe 和 /unsubscribe
+func (m *BotManager) handleSubscribeCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	var err error
+	if message.Command() == "subscribe" {
+		_, err = m.db.Exec("INSERT OR IGNORE INTO feed_subscribers (bot_token, user_id, created_at) VALUES (?, ?, ?)", bot.Token, message.From.ID, time.Now().Unix())
+	} else {
+		_, err = m.db.Exec("DELETE FROM feed_subscribers WHERE bot_token = ? AND user_id = ?", bot.Token, message.From.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to update subscription of user %d for bot %s: %v", message.From.ID, botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "操作失败，请稍后再试。"))
+		return
+	}
+	if message.Command() == "subscribe" {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "订阅成功，有新内容时会推送给你。发送 /unsubscribe 取消订阅。"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "已取消订阅。"))
+	}
+}
+
+// 处理 /feeds
+func (m *BotManager) handleFeedsCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	action, rest, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	rest = strings.TrimSpace(rest)
+	usage := "用法：\n/feeds add <RSS 或 Atom 地址>\n/feeds del <编号>\n/feeds 查看列表\n用户发送 /subscribe 订阅、/unsubscribe 退订后，订阅源的新内容会推送给他们"
+
+	switch action {
+	case "":
+		rows, err := m.db.Query("SELECT id, url, title FROM feeds WHERE bot_token = ? ORDER BY id", token)
+		if err != nil {
+			log.Printf("Failed to list feeds of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list feeds")))
+			return
+		}
+		defer rows.Close()
+		var b strings.Builder
+		for rows.Next() {
+			var id int64
+			var url, title string
+			if err := rows.Scan(&id, &url, &title); err == nil {
+				fmt.Fprintf(&b, "#%d %s\n%s\n", id, title, url)
+			}
+		}
+		if b.Len() == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无订阅源。\n"+usage))
+			return
+		}
+		subscribers, _ := m.feedSubscribers(token)
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("%s\n订阅用户：%d", b.String(), len(subscribers))))
+	case "add":
+		if !strings.HasPrefix(rest, "http://") && !strings.HasPrefix(rest, "https://") {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		stop := m.chatActionHeartbeat(bot, creatorID)
+		title, items, err := fetchFeed(rest)
+		stop()
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "无法读取订阅源："+err.Error()))
+			return
+		}
+		if title == "" {
+			title = rest
+		}
+		res, err := m.db.Exec("INSERT INTO feeds (bot_token, url, title, next_check, created_at) VALUES (?, ?, ?, ?, ?)",
+			token, rest, title, time.Now().Add(feedCheckInterval).Unix(), time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to add feed for bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add feed")))
+			return
+		}
+		id, _ := res.LastInsertId()
+		// 已有的条目不再推送
+		for _, item := range items {
+			m.markFeedItemSeen(id, item.GUID)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已添加订阅源 #%d：%s，之后的新内容会推送给订阅的用户", id, title)))
+	case "del":
+		id, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		res, err := m.db.Exec("DELETE FROM feeds WHERE bot_token = ? AND id = ?", token, id)
+		if err != nil {
+			log.Printf("Failed to delete feed #%d of bot %s: %v", id, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete feed")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("订阅源 #%d 不存在", id)))
+			return
+		}
+		m.db.Exec("DELETE FROM feed_items WHERE feed_id = ?", id)
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已删除订阅源 #%d", id)))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 官方 Bot API 服务器允许机器人下载的文件大小上限
+const cloudFileSizeLimit = 20 << 20
+
+// 一次文件下载的最长时间，边下载边上传时包括上传的时间
+const fileTransferTimeout = 10 * time.Minute
+
+var fileClient = &http.Client{Timeout: fileTransferTimeout}
+
+// 创建 BotAPI，配置了 BOT_API_ENDPOINT 时连接本地 Bot API 服务器
+func (m *BotManager) newBotAPI(token string) (*tgbotapi.BotAPI, error) {
+	endpoint := m.apiEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(token, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	bot.Client = &pollClient{HTTPClient: bot.Client, ctx: m.drainCtx}
+	return bot, nil
+}
+
+// 文件下载地址，本地 Bot API 服务器的文件路径与方法路径并列在 /file 下
+func (m *BotManager) fileURL(token, filePath string) string {
+	if m.apiEndpoint == "" {
+		return fmt.Sprintf(tgbotapi.FileEndpoint, token, filePath)
+	}
+	endpoint := strings.Replace(m.apiEndpoint, "/bot%s/%s", "/file/bot%s/%s", 1)
+	return fmt.Sprintf(endpoint, token, filePath)
+}
+
+// 以流的方式打开机器人收到的文件，调用方负责关闭。
+// 本地 Bot API 服务器以 --local 运行时返回磁盘上的绝对路径，直接读取，
+// 不受官方服务器 20 MB 的限制
+func (m *BotManager) openFile(bot *tgbotapi.BotAPI, fileID string) (io.ReadCloser, int64, error) {
+	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, 0, err
+	}
+	size := int64(file.FileSize)
+
+	if filepath.IsAbs(file.FilePath) {
+		f, err := os.Open(file.FilePath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open local Bot API file: %w", err)
+		}
+		return f, size, nil
+	}
+
+	if m.apiEndpoint == "" && size > cloudFileSizeLimit {
+		return nil, 0, fmt.Errorf("file of %d bytes exceeds the %d byte download limit, set BOT_API_ENDPOINT to a local Bot API server", size, cloudFileSizeLimit)
+	}
+	// 机器人停止或交接时随轮询一起取消
+	ctx := context.Background()
+	if c, ok := bot.Client.(*pollClient); ok {
+		ctx = c.ctx
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.fileURL(bot.Token, file.FilePath), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 文件服务器持续出错时不再反复下载，熔断器只判断能否开始下载
+	var resp *http.Response
+	err = breakers.get("files").call(func() error {
+		resp, err = fileClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected status downloading file: %s", resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, size, nil
+}
+
+// Telegram 不接受 file_id 的错误，例如文件来自另一个 Bot API 服务器
+func isFileIDError(err error) bool {
+	if err == nil {
+		return false
+	}
+	text := err.Error()
+	return strings.Contains(text, "file identifier") || strings.Contains(text, "remote file") || strings.Contains(text, "failed to get HTTP URL content")
+}
+
+// 通过 file_id 发送的媒体回复中的文件，返回可以修改文件的副本；其他回复返回 nil
+func replyFile(c tgbotapi.Chattable) (*tgbotapi.BaseFile, tgbotapi.Chattable) {
+	switch c := c.(type) {
+	case tgbotapi.PhotoConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.VideoConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.AnimationConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.DocumentConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.VoiceConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.AudioConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.StickerConfig:
+		return &c.BaseFile, &c
+	case tgbotapi.VideoNoteConfig:
+		return &c.BaseFile, &c
+	}
+	return nil, nil
+}
+
+// 上传时使用的文件名，Telegram 按发送方法决定文件类型
+func messageFileName(message *tgbotapi.Message) string {
+	switch {
+	case message.Document != nil && message.Document.FileName != "":
+		return message.Document.FileName
+	case message.Video != nil && message.Video.FileName != "":
+		return message.Video.FileName
+	case message.Animation != nil && message.Animation.FileName != "":
+		return message.Animation.FileName
+	case message.Audio != nil && message.Audio.FileName != "":
+		return message.Audio.FileName
+	}
+	return "file"
+}
+
+// file_id 被拒绝时下载文件并边下载边重新上传，文件不经过内存或磁盘整体缓存。
+// 超过 20 MB 的文件需要配置 BOT_API_ENDPOINT 连接本地 Bot API 服务器
+func (m *BotManager) resendWithUpload(bot *tgbotapi.BotAPI, reply tgbotapi.Chattable, name string) (tgbotapi.Message, error) {
+	base, config := replyFile(reply)
+	if base == nil {
+		return tgbotapi.Message{}, errors.New("reply has no file to upload")
+	}
+	fileID, ok := base.File.(tgbotapi.FileID)
+	if !ok {
+		return tgbotapi.Message{}, errors.New("reply file is not a file_id")
+	}
+	body, size, err := m.openFile(bot, string(fileID))
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	defer body.Close()
+	log.Printf("Re-uploading %d byte file %s for bot %s.", size, name, botIDFromToken(bot.Token))
+	base.File = tgbotapi.FileReader{Name: name, Reader: body}
+	return bot.Send(config)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 表单中的一个问题，Options 为空时为自由回答
+type formQuestion struct {
+	ID       int64
+	Question string
+	Options  []string
+}
+
+// 用户填写表单的进度
+type formProgress struct {
+	Step           int
+	Answers        []string
+	FirstMessageID int
+	Completed      bool
+}
+
+func (m *BotManager) getFormQuestions(token string) ([]formQuestion, error) {
+	rows, err := m.db.Query("SELECT id, question, options FROM form_questions WHERE bot_token = ? ORDER BY id", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []formQuestion
+	for rows.Next() {
+		var q formQuestion
+		var options string
+		if err := rows.Scan(&q.ID, &q.Question, &options); err != nil {
+			return nil, err
+		}
+		if options != "" {
+			q.Options = strings.Split(options, "|")
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+func (m *BotManager) getFormProgress(token string, userID int64) (formProgress, bool) {
+	var p formProgress
+	var answers string
+	err := m.db.QueryRow("SELECT step, answers, first_message_id, completed FROM form_progress WHERE bot_token = ? AND user_id = ?", token, userID).
+		Scan(&p.Step, &answers, &p.FirstMessageID, &p.Completed)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get form progress of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		}
+		return formProgress{}, false
+	}
+	json.Unmarshal([]byte(answers), &p.Answers)
+	return p, true
+}
+
+func (m *BotManager) saveFormProgress(token string, userID int64, p formProgress) {
+	// 不保存消息文字时，表单完成后即丢弃答案
+	if p.Completed && !m.logsText(token) {
+		p.Answers = nil
+	}
+	answers, _ := json.Marshal(p.Answers)
+	_, err := m.db.Exec(`INSERT INTO form_progress (bot_token, user_id, step, answers, first_message_id, completed, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET step = excluded.step, answers = excluded.answers,
+			first_message_id = excluded.first_message_id, completed = excluded.completed, updated_at = excluded.updated_at`,
+		token, userID, p.Step, string(answers), p.FirstMessageID, p.Completed, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to save form progress of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+func askFormQuestion(bot *tgbotapi.BotAPI, chatID int64, step int, q formQuestion) {
+	msg := tgbotapi.NewMessage(chatID, q.Question)
+	if len(q.Options) > 0 {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for i, option := range q.Options {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(option, signCallback(bot.Token, cbForm, step, i)),
+			))
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send form question to user %d: %v", chatID, err)
+	}
+}
+
+// 新用户需要先填写表单，返回消息是否已被表单流程处理
+func (m *BotManager) handleFormMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) bool {
+	token := bot.Token
+	questions, err := m.getFormQuestions(token)
+	if err != nil {
+		log.Printf("Failed to get form questions of bot %s: %v", botIDFromToken(token), err)
+		return false
+	}
+	if len(questions) == 0 {
+		return false
+	}
+
+	userID := message.From.ID
+	p, ok := m.getFormProgress(token, userID)
+	if ok && p.Completed {
+		return false
+	}
+	if !ok {
+		// 第一条消息在表单完成后再转发
+		p = formProgress{FirstMessageID: message.MessageID}
+		m.saveFormProgress(token, userID, p)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "在转交人工之前，请先回答几个问题。"))
+		askFormQuestion(bot, message.Chat.ID, 0, questions[0])
+		return true
+	}
+
+	if p.Step < len(questions) && len(questions[p.Step].Options) > 0 {
+		// 选择题只接受按钮回答
+		askFormQuestion(bot, message.Chat.ID, p.Step, questions[p.Step])
+		return true
+	}
+	m.answerForm(bot, message.Chat.ID, message.From, creatorID, questions, p, message.Text)
+	return true
+}
+
+// 记录当前问题的回答，继续下一题或提交表单
+func (m *BotManager) answerForm(bot *tgbotapi.BotAPI, chatID int64, user *tgbotapi.User, creatorID int64, questions []formQuestion, p formProgress, answer string) {
+	token := bot.Token
+	p.Answers = append(p.Answers, answer)
+	p.Step++
+	if p.Step < len(questions) {
+		m.saveFormProgress(token, user.ID, p)
+		askFormQuestion(bot, chatID, p.Step, questions[p.Step])
+		return
+	}
+
+	p.Completed = true
+	m.saveFormProgress(token, user.ID, p)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📋 用户 %s (ID: %d) 提交了表单\n\n", displayName(user.UserName, user.FirstName, user.LastName), user.ID)
+	for i, q := range questions {
+		if i < len(p.Answers) {
+			fmt.Fprintf(&b, "%s\n→ %s\n", q.Question, p.Answers[i])
+		}
+	}
+	if sent, err := bot.Send(tgbotapi.NewMessage(creatorID, b.String())); err != nil {
+		log.Printf("Failed to send form card for bot %s: %v", botIDFromToken(token), err)
+	} else {
+		m.saveMessageMapping(token, sent.MessageID, user.ID, p.FirstMessageID)
+	}
+	m.forwardUserMessage(bot, creatorID, chatID, user.ID, p.FirstMessageID)
+	bot.Send(tgbotapi.NewMessage(chatID, "谢谢，你的信息已提交，请耐心等待回复。"))
+}
+
+// 处理选择题的按钮，返回是否已处理
+func (m *BotManager) handleFormCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData, creatorID int64) bool {
+	if cb.Action != cbForm {
+		return false
+	}
+	step64, ok1 := cb.int(0)
+	option64, ok2 := cb.int(1)
+	if !ok1 || !ok2 || option64 < 0 {
+		log.Printf("Invalid form callback: %s", query.Data)
+		return true
+	}
+	step, option := int(step64), int(option64)
+
+	questions, err := m.getFormQuestions(bot.Token)
+	if err != nil {
+		return true
+	}
+	p, ok := m.getFormProgress(bot.Token, query.From.ID)
+	// 忽略旧问题上的按钮
+	if !ok || p.Completed || p.Step != step || step >= len(questions) || option >= len(questions[step].Options) {
+		return true
+	}
+
+	if query.Message != nil {
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, questions[step].Question+"\n→ "+questions[step].Options[option])
+		bot.Send(edit)
+	}
+	m.answerForm(bot, query.From.ID, query.From, creatorID, questions, p, questions[step].Options[option])
+	return true
+}
+
+// 处理 /form
+func (m *BotManager) handleFormCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	args := strings.TrimSpace(message.CommandArguments())
+	action, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	usage := "用法：\n/form add 你的订单号是？\n/form add 你需要什么帮助？ | 售前 | 售后 | 其他\n/form del <编号>\n/form clear"
+
+	switch action {
+	case "":
+		questions, err := m.getFormQuestions(token)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get form")))
+			return
+		}
+		if len(questions) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "未设置表单。\n"+usage))
+			return
+		}
+		var b strings.Builder
+		b.WriteString("新用户需要先填写的表单:\n")
+		for i, q := range questions {
+			fmt.Fprintf(&b, "%d. %s", i+1, q.Question)
+			if len(q.Options) > 0 {
+				fmt.Fprintf(&b, "（%s）", strings.Join(q.Options, " / "))
+			}
+			b.WriteString("\n")
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+	case "add":
+		parts := strings.Split(rest, "|")
+		question := strings.TrimSpace(parts[0])
+		var options []string
+		for _, o := range parts[1:] {
+			if o = strings.TrimSpace(o); o != "" {
+				options = append(options, o)
+			}
+		}
+		if question == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		if _, err := m.db.Exec("INSERT INTO form_questions (bot_token, question, options) VALUES (?, ?, ?)", token, question, strings.Join(options, "|")); err != nil {
+			log.Printf("Failed to add form question for bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add question")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已添加问题"))
+	case "del":
+		n, err := strconv.Atoi(rest)
+		questions, qerr := m.getFormQuestions(token)
+		if err != nil || qerr != nil || n < 1 || n > len(questions) {
+			bot.Send(tgbotapi.NewMessage(creatorID, "无效的问题编号"))
+			return
+		}
+		if _, err := m.db.Exec("DELETE FROM form_questions WHERE id = ?", questions[n-1].ID); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete question")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已删除问题"))
+	case "clear":
+		if _, err := m.db.Exec("DELETE FROM form_questions WHERE bot_token = ?", token); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to clear form")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已清空表单"))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram 限制话题名称最多 128 个字符
+const maxTopicName = 128
+
+// 论坛模式下用户消息转交到的群组，未开启时为 0
+func (m *BotManager) forumChatID(token string) int64 {
+	var chatID int64
+	err := m.db.QueryRow("SELECT forum_chat_id FROM bots WHERE token = ?", token).Scan(&chatID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get forum chat of bot %s: %v", botIDFromToken(token), err)
+	}
+	return chatID
+}
+
+// 用户在论坛群组中的话题名称：名字和 ID，置顶的对话带 📌 前缀
+func topicName(user *tgbotapi.User, pinned bool) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.UserName
+	}
+	prefix := ""
+	if pinned {
+		prefix = "📌 "
+	}
+	suffix := fmt.Sprintf("（%d）", user.ID)
+	if r := []rune(name); len([]rune(prefix))+len(r)+len([]rune(suffix)) > maxTopicName {
+		name = string(r[:maxTopicName-len([]rune(prefix))-len([]rune(suffix))])
+	}
+	return prefix + name + suffix
+}
+
+// 用户的话题，第一次联系时创建并记录
+func (m *BotManager) userTopic(bot *tgbotapi.BotAPI, forumID int64, user *tgbotapi.User) (int, error) {
+	token := bot.Token
+	var threadID int
+	err := m.db.QueryRow("SELECT thread_id FROM user_topics WHERE bot_token = ? AND user_id = ?", token, user.ID).Scan(&threadID)
+	if err == nil {
+		return threadID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	resp, err := bot.MakeRequest("createForumTopic", tgbotapi.Params{
+		"chat_id": strconv.FormatInt(forumID, 10),
+		"name":    topicName(user, m.isPinned(token, user.ID)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	var topic struct {
+		MessageThreadID int `json:"message_thread_id"`
+	}
+	if err := json.Unmarshal(resp.Result, &topic); err != nil {
+		return 0, err
+	}
+	if _, err := m.db.Exec("INSERT OR REPLACE INTO user_topics (bot_token, user_id, thread_id) VALUES (?, ?, ?)",
+		token, user.ID, topic.MessageThreadID); err != nil {
+		return 0, err
+	}
+	log.Printf("Created topic %d for user %d in forum %d for bot %s.", topic.MessageThreadID, user.ID, forumID, botIDFromToken(token))
+	return topic.MessageThreadID, nil
+}
+
+// 把用户消息转发或复制到用户的话题。话题名称已经说明了用户，复制时不再附加来源说明。
+// 管理员删除了话题时重新创建一次
+func (m *BotManager) relayToTopic(bot *tgbotapi.BotAPI, forumID, chatID int64, messageID int, user *tgbotapi.User) (int, error) {
+	token := bot.Token
+	method := "forwardMessage"
+	if m.relaysByCopy(token) {
+		method = "copyMessage"
+	}
+	for attempt := 0; ; attempt++ {
+		threadID, err := m.userTopic(bot, forumID, user)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := bot.MakeRequest(method, tgbotapi.Params{
+			"chat_id":           strconv.FormatInt(forumID, 10),
+			"message_thread_id": strconv.Itoa(threadID),
+			"from_chat_id":      strconv.FormatInt(chatID, 10),
+			"message_id":        strconv.Itoa(messageID),
+		})
+		if err != nil && attempt == 0 && strings.Contains(strings.ToLower(err.Error()), "thread not found") {
+			log.Printf("Topic %d of user %d is gone for bot %s, creating a new one.", threadID, user.ID, botIDFromToken(token))
+			m.db.Exec("DELETE FROM user_topics WHERE bot_token = ? AND user_id = ?", token, user.ID)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		var sent tgbotapi.MessageID
+		if err := json.Unmarshal(resp.Result, &sent); err != nil {
+			return 0, err
+		}
+		return sent.MessageID, nil
+	}
+}
+
+// 话题对应的用户
+func (m *BotManager) topicUser(token string, threadID int) (int64, bool) {
+	var userID int64
+	err := m.db.QueryRow("SELECT user_id FROM user_topics WHERE bot_token = ? AND thread_id = ?", token, threadID).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up topic %d of bot %s: %v", threadID, botIDFromToken(token), err)
+		}
+		return 0, false
+	}
+	return userID, true
+}
+
+// 论坛群组中的消息：管理员在用户话题中发送的消息交给对应的用户，
+// 一般话题、命令、服务消息和普通成员的消息不处理
+func (m *BotManager) handleForumMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, threadID int, topicService bool) {
+	token := bot.Token
+	if threadID == 0 || topicService || message.IsCommand() {
+		return
+	}
+	if _, ok := describeServiceMessage(message); ok {
+		return
+	}
+	userID, ok := m.topicUser(token, threadID)
+	if !ok {
+		return
+	}
+	if !m.isForumAdmin(bot, message) {
+		log.Printf("Ignoring message from non-admin %d in topic %d of bot %s.", message.From.ID, threadID, botIDFromToken(token))
+		return
+	}
+	m.deliverReply(bot, message, userID, 0)
+}
+
+// 发送者是否是论坛群组的管理员，匿名管理员以群组身份发言
+func (m *BotManager) isForumAdmin(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	if message.SenderChat != nil {
+		return message.SenderChat.ID == message.Chat.ID
+	}
+	if message.From == nil || message.From.IsBot {
+		return false
+	}
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+		ChatID: message.Chat.ID,
+		UserID: message.From.ID,
+	}})
+	if err != nil {
+		log.Printf("Failed to get member %d of forum %d for bot %s: %v", message.From.ID, message.Chat.ID, botIDFromToken(bot.Token), err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// 处理 /forum <群组 ID>|off
+func (m *BotManager) handleForumCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/forum <群组 ID> 把用户消息转交到开启了话题功能的超级群组，每个用户一个话题，管理员在话题中发送的消息会交给该用户；机器人需要是群组管理员并有管理话题的权限。/forum off 恢复为直接转交给你"
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "直接转交给你"
+		if forumID := m.forumChatID(token); forumID != 0 {
+			state = fmt.Sprintf("论坛群组 %d", forumID)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "消息转交到："+state+"\n"+usage))
+		return
+	}
+
+	var forumID int64
+	if arg != "off" {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id >= 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		isForum, err := chatIsForum(bot, id)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to check forum chat")))
+			return
+		}
+		if !isForum {
+			bot.Send(tgbotapi.NewMessage(creatorID, "该群组没有开启话题功能，请在群组设置中开启话题后再试"))
+			return
+		}
+		forumID = id
+	}
+
+	if err := m.setRelayChats(token, forumID, 0); err != nil {
+		log.Printf("Failed to update forum chat of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update forum chat")))
+		return
+	}
+	if forumID == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用户消息将直接转交给你，之前转交到群组的消息无法再回复"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户消息将转交到群组 %d，每个用户一个话题，之前转交给你的消息无法再直接回复", forumID)))
+	}
+}
+
+// 群组是否开启了话题功能，tgbotapi 的 Chat 没有 is_forum 字段
+func chatIsForum(bot *tgbotapi.BotAPI, chatID int64) (bool, error) {
+	resp, err := bot.MakeRequest("getChat", tgbotapi.Params{"chat_id": strconv.FormatInt(chatID, 10)})
+	if err != nil {
+		return false, err
+	}
+	var chat struct {
+		Type    string `json:"type"`
+		IsForum bool   `json:"is_forum"`
+	}
+	if err := json.Unmarshal(resp.Result, &chat); err != nil {
+		return false, err
+	}
+	return chat.Type == "supergroup" && chat.IsForum, nil
+}
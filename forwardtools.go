@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 机器人是否在转发的消息下附上工具按钮，默认关闭
+func (m *BotManager) showsForwardTools(token string) bool {
+	var enabled bool
+	err := m.db.QueryRow("SELECT forward_tools FROM bots WHERE token = ?", token).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get forward tools setting of bot %s: %v", botIDFromToken(token), err)
+	}
+	return enabled
+}
+
+// 工具按钮：把用户 ID 填入输入框、打开用户资料，配置了 DASHBOARD_URL 时还可以打开控制台中的对话
+func (m *BotManager) forwardToolsKeyboard(token string, userID int64, withProfile bool) tgbotapi.InlineKeyboardMarkup {
+	id := fmt.Sprint(userID)
+	row := []tgbotapi.InlineKeyboardButton{{Text: "复制 ID", SwitchInlineQueryCurrentChat: &id}}
+	if withProfile {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL("用户资料", "tg://user?id="+id))
+	}
+	if m.dashboardURL != "" {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL("控制台", fmt.Sprintf("%s/dashboard/bots/%s/users/%d", m.dashboardURL, botIDFromToken(token), userID)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// 在转发的消息下附上工具按钮。转发消息本身不能带按钮，所以另发一条回复
+func (m *BotManager) attachForwardTools(bot *tgbotapi.BotAPI, creatorID int64, forwarded int, userID int64, userMessageID int) {
+	if !m.showsForwardTools(bot.Token) {
+		return
+	}
+	note := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: `%d`", userID))
+	note.ParseMode = tgbotapi.ModeMarkdown
+	note.ReplyToMessageID = forwarded
+	note.DisableNotification = true
+	note.ReplyMarkup = m.forwardToolsKeyboard(bot.Token, userID, true)
+	sent, err := bot.Send(note)
+	// 用户的隐私设置不允许链接到其资料时 Telegram 会拒绝整条消息，去掉该按钮重试
+	if err != nil && strings.Contains(err.Error(), "BUTTON_USER_PRIVACY_RESTRICTED") {
+		note.ReplyMarkup = m.forwardToolsKeyboard(bot.Token, userID, false)
+		sent, err = bot.Send(note)
+	}
+	if err != nil {
+		log.Printf("Failed to send forward tools for bot %s: %v", botIDFromToken(bot.Token), err)
+		return
+	}
+	m.saveMessageMapping(bot.Token, sent.MessageID, userID, userMessageID)
+}
+
+// 处理 /forwardbuttons on|off
+func (m *BotManager) handleForwardButtonsCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/forwardbuttons on 在转发的消息下附上复制 ID、用户资料和控制台按钮，/forwardbuttons off 关闭"
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "关闭"
+		if m.showsForwardTools(token) {
+			state = "开启"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "转发工具按钮："+state+"\n"+usage))
+		return
+	}
+	if arg != "on" && arg != "off" {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if _, err := m.db.Exec("UPDATE bots SET forward_tools = ? WHERE token = ?", arg == "on", token); err != nil {
+		log.Printf("Failed to update forward tools setting of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update forward buttons setting")))
+		return
+	}
+	if arg == "on" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已开启转发工具按钮"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已关闭转发工具按钮"))
+	}
+}
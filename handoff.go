@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// 新进程启动时请求正在运行的进程交接：旧进程停止拉取更新，处理完已拉取的更新并保存各机器人的
+// 轮询偏移后退出，新进程从保存的偏移继续轮询，重启期间的消息既不丢失也不重复
+const (
+	handoffHeartbeatInterval = 5 * time.Second
+	// 心跳超过该时间未更新视为没有正在运行的进程
+	handoffStaleAfter = 20 * time.Second
+	// 最长等待旧进程交接的时间，需要长于最长的长轮询超时
+	handoffWait = 3 * time.Minute
+)
+
+var (
+	instanceID      = instanceName()
+	instanceStarted = time.Now().Unix()
+)
+
+func instanceName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().Unix())
+}
+
+// 上次保存的轮询偏移，没有时为 0
+func (m *BotManager) savedOffset(token string) int {
+	var offset int
+	m.db.QueryRow("SELECT next_offset FROM poll_offsets WHERE bot_token = ?", token).Scan(&offset)
+	return offset
+}
+
+func (m *BotManager) saveOffset(token string, offset int) {
+	_, err := m.db.Exec(`INSERT INTO poll_offsets (bot_token, next_offset, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (bot_token) DO UPDATE SET next_offset = excluded.next_offset, updated_at = excluded.updated_at`,
+		token, offset, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to save polling offset of bot %s: %v", botIDFromToken(token), err)
+	}
+}
+
+// 有正在运行的进程时请求交接，等待其保存偏移并退出
+func waitForHandoff(db *sql.DB) {
+	var owner string
+	var heartbeat int64
+	err := db.QueryRow("SELECT owner, heartbeat_at FROM instance_handoff WHERE id = 1").Scan(&owner, &heartbeat)
+	if err != nil || owner == "" || time.Since(time.Unix(heartbeat, 0)) > handoffStaleAfter {
+		return
+	}
+	if _, err := db.Exec("UPDATE instance_handoff SET requested_by = ?, requested_at = ?, ready_at = 0 WHERE id = 1", instanceID, time.Now().Unix()); err != nil {
+		log.Printf("Failed to request handoff from instance %s: %v", owner, err)
+		return
+	}
+	log.Printf("Waiting for instance %s to hand over polling...", owner)
+
+	deadline := time.Now().Add(handoffWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		var readyAt int64
+		if err := db.QueryRow("SELECT ready_at, heartbeat_at FROM instance_handoff WHERE id = 1").Scan(&readyAt, &heartbeat); err != nil {
+			log.Printf("Failed to check handoff state: %v", err)
+			continue
+		}
+		if readyAt > 0 {
+			log.Printf("Instance %s handed over.", owner)
+			return
+		}
+		if time.Since(time.Unix(heartbeat, 0)) > handoffStaleAfter {
+			log.Printf("Instance %s stopped without handing over.", owner)
+			return
+		}
+	}
+	log.Printf("Instance %s did not hand over within %s, starting anyway.", owner, handoffWait)
+}
+
+// 登记为当前运行的进程
+func claimInstance(db *sql.DB) error {
+	_, err := db.Exec(`INSERT INTO instance_handoff (id, owner, heartbeat_at) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET owner = excluded.owner, heartbeat_at = excluded.heartbeat_at,
+			requested_by = '', requested_at = 0, ready_at = 0`, instanceID, time.Now().Unix())
+	return err
+}
+
+// 定期更新心跳，发现新进程请求交接时开始排空
+func (m *BotManager) runHandoffWatch() {
+	ticker := time.NewTicker(handoffHeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := m.db.Exec("UPDATE instance_handoff SET heartbeat_at = ? WHERE id = 1 AND owner = ?", time.Now().Unix(), instanceID); err != nil {
+			log.Printf("Failed to update instance heartbeat: %v", err)
+		}
+		if m.draining.Load() {
+			continue
+		}
+		var requestedBy string
+		var requestedAt int64
+		m.db.QueryRow("SELECT requested_by, requested_at FROM instance_handoff WHERE id = 1").Scan(&requestedBy, &requestedAt)
+		if requestedBy != "" && requestedBy != instanceID && requestedAt >= instanceStarted {
+			log.Printf("Instance %s requested a handoff.", requestedBy)
+			go m.drain(handoffWait)
+		}
+	}
+}
+
+// 停止拉取更新，等待各机器人处理完已拉取的更新并保存偏移，写入缓冲的数据后退出。超过 timeout
+// 仍未处理完的机器人不保存偏移，下一个进程从上次保存的偏移继续
+func (m *BotManager) drain(timeout time.Duration) {
+	if m.draining.Swap(true) {
+		return
+	}
+	m.stopPolling()
+	sdNotify("STOPPING=1")
+	log.Println("Draining: polling stopped, finishing fetched updates.")
+	done := make(chan struct{})
+	go func() {
+		m.pollers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Fetched updates were not finished within %s, exiting with them unconfirmed.", timeout)
+	}
+	m.flushUserWrites()
+	m.flushUsage()
+	if _, err := m.db.Exec("UPDATE instance_handoff SET ready_at = ?, owner = '' WHERE id = 1 AND owner = ?", time.Now().Unix(), instanceID); err != nil {
+		log.Printf("Failed to mark handoff ready: %v", err)
+	}
+	log.Println("Drained, exiting.")
+	os.Exit(0)
+}
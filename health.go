@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 默认连续轮询失败多久后告警，可以通过 BOT_ALERT_MINUTES 覆盖
+const defaultBotAlertAfter = 10 * time.Minute
+
+// 看门狗的检查间隔
+const healthCheckInterval = time.Minute
+
+// 轮询失败后的退避时间范围
+const (
+	pollBackoffMin = time.Second
+	pollBackoffMax = 2 * time.Minute
+)
+
+// 管理机器人轮询时请求的更新类型，子机器人见 botAllowedUpdates
+var managerAllowedUpdates = []string{tgbotapi.UpdateTypeMessage, tgbotapi.UpdateTypeCallbackQuery, tgbotapi.UpdateTypePreCheckoutQuery}
+
+// 子机器人轮询时请求的更新类型，只包含该机器人已启用的功能需要的类型，每次轮询重新计算。
+// 消息、编辑同步和按钮始终需要；表情回应只在设置了快捷操作时、投票答案只在发出过调查时请求
+func (m *BotManager) botAllowedUpdates(token string) []string {
+	allowed := []string{tgbotapi.UpdateTypeMessage, tgbotapi.UpdateTypeEditedMessage, tgbotapi.UpdateTypeCallbackQuery}
+	var reactions, polls bool
+	err := m.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM reaction_actions WHERE bot_token = ?),
+		EXISTS (SELECT 1 FROM survey_polls WHERE bot_token = ?)`, token, token).Scan(&reactions, &polls)
+	if err != nil {
+		// 查询失败时宁可多收更新，也不要漏掉
+		log.Printf("Failed to check allowed updates of bot %s: %v", botIDFromToken(token), err)
+		reactions, polls = true, true
+	}
+	if reactions {
+		allowed = append(allowed, "message_reaction")
+	}
+	if polls {
+		allowed = append(allowed, tgbotapi.UpdateTypePollAnswer)
+	}
+	return allowed
+}
+
+// 机器人轮询的健康状态
+type botHealth struct {
+	LastOK       time.Time
+	FailingSince time.Time
+	LastErr      error
+	Alerted      bool
+	// 当前的轮询方式，见 choosePollMode
+	PollMode string
+}
+
+// 自行轮询 getUpdates，记录每次轮询的结果，供看门狗判断机器人是否失联
+// ctx 取消或实例交接时停止轮询并关闭返回的通道，偏移由 startBot 在更新处理完后保存
+func (m *BotManager) pollUpdates(ctx context.Context, bot *tgbotapi.BotAPI) <-chan botUpdate {
+	ch := make(chan botUpdate, bot.Buffer)
+	u := tgbotapi.NewUpdate(m.savedOffset(bot.Token))
+
+	go func() {
+		var failures int
+		var lastUpdate time.Time
+		mode := pollModeNormal
+		if m.adaptivePolling {
+			lastUpdate = m.lastActivity(bot.Token)
+			mode = choosePollMode(lastUpdate, time.Now())
+		}
+		m.recordPollMode(bot.Token, mode)
+		for {
+			if m.draining.Load() || ctx.Err() != nil {
+				close(ch)
+				return
+			}
+			if m.adaptivePolling {
+				if next := choosePollMode(lastUpdate, time.Now()); next != mode {
+					mode = next
+					m.recordPollMode(bot.Token, mode)
+				}
+			}
+			u.Timeout = mode.timeout
+			u.AllowedUpdates = m.botAllowedUpdates(bot.Token)
+			metrics.inc("forwardme_polls_total", "mode", mode.name)
+			updates, err := getBotUpdates(bot, u)
+			if err != nil && (m.draining.Load() || ctx.Err() != nil) {
+				continue
+			}
+			if err != nil {
+				failures++
+				delay := pollBackoff(failures)
+				log.Printf("Failed to get updates for bot %s, retrying in %s: %v", botIDFromToken(bot.Token), delay, err)
+				metrics.inc("forwardme_poll_errors_total", "bot", botIDFromToken(bot.Token))
+				m.recordPollFailure(bot.Token, err)
+				if isConflictError(err) {
+					m.ensurePolling(bot, m.creatorOf(bot.Token))
+				}
+				sleepContext(ctx, delay)
+				continue
+			}
+			if failures > 0 {
+				log.Printf("Bot %s reconnected after %d failed polls.", botIDFromToken(bot.Token), failures)
+				metrics.inc("forwardme_poll_reconnects_total", "bot", botIDFromToken(bot.Token))
+				failures = 0
+			}
+			m.recordPollSuccess(bot.Token)
+			if len(updates) == 0 {
+				sleepContext(ctx, mode.pause)
+				continue
+			}
+			lastUpdate = time.Now()
+
+			for _, update := range updates {
+				if update.UpdateID >= u.Offset {
+					u.Offset = update.UpdateID + 1
+					ch <- update
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (m *BotManager) recordPollFailure(token string, err error) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	h, ok := m.health[token]
+	if !ok {
+		h = &botHealth{}
+		m.health[token] = h
+	}
+	if h.FailingSince.IsZero() {
+		h.FailingSince = time.Now()
+	}
+	h.LastErr = err
+}
+
+func (m *BotManager) recordPollSuccess(token string) {
+	m.healthMu.Lock()
+	h, ok := m.health[token]
+	if !ok {
+		h = &botHealth{}
+		m.health[token] = h
+	}
+	recovered := h.Alerted
+	h.LastOK = time.Now()
+	h.FailingSince = time.Time{}
+	h.LastErr = nil
+	h.Alerted = false
+	m.healthMu.Unlock()
+
+	if recovered {
+		log.Printf("Bot %s recovered.", botIDFromToken(token))
+		m.alertBotHealth(token, m.creatorOf(token), m.botUsername(token)+" 已恢复正常")
+	}
+}
+
+// 定期检查所有机器人，持续失败超过 alertAfter 的发出告警并尝试重连
+func (m *BotManager) runHealthWatchdog(alertAfter time.Duration) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		type failingBot struct {
+			token string
+			since time.Time
+			err   error
+		}
+		var failing []failingBot
+
+		m.healthMu.Lock()
+		for token, h := range m.health {
+			if h.Alerted || h.FailingSince.IsZero() || time.Since(h.FailingSince) < alertAfter {
+				continue
+			}
+			h.Alerted = true
+			failing = append(failing, failingBot{token, h.FailingSince, h.LastErr})
+		}
+		m.healthMu.Unlock()
+
+		for _, f := range failing {
+			log.Printf("Bot %s has been failing since %s: %v", botIDFromToken(f.token), f.since.Format(time.RFC3339), f.err)
+			m.alertBotHealth(f.token, m.creatorOf(f.token), fmt.Sprintf("%s 自 %s 起无法连接 Telegram，正在尝试重连。\n错误: %v",
+				m.botUsername(f.token), f.since.Format("2006-01-02 15:04"), f.err))
+			m.reconnectBot(f.token)
+		}
+	}
+}
+
+// 通过机器人所属品牌的管理机器人通知创建者，并通知运营者
+func (m *BotManager) alertBotHealth(token string, creatorID int64, text string) {
+	if managerBot := m.managerBotFor(token); managerBot != nil && creatorID != 0 {
+		if _, err := managerBot.Send(tgbotapi.NewMessage(creatorID, text)); err != nil {
+			log.Printf("Failed to send health alert of bot %s to creator %d: %v", botIDFromToken(token), creatorID, err)
+		}
+	}
+	m.notifyOperators(fmt.Sprintf("%s（创建者 %d）\n%s", m.botUsername(token), creatorID, text), nil)
+}
+
+// 关闭机器人的空闲连接，下一次轮询会重新建立连接
+func (m *BotManager) reconnectBot(token string) {
+	m.mu.RLock()
+	bot, ok := m.bots[token]
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+	client := bot.Client
+	if c, ok := client.(*pollClient); ok {
+		client = c.HTTPClient
+	}
+	if client, ok := client.(*http.Client); ok {
+		client.CloseIdleConnections()
+	}
+	log.Printf("Reconnecting bot %s.", botIDFromToken(token))
+}
+
+// 第 failures 次连续失败后的等待时间：指数增长，上限 pollBackoffMax，
+// 并在后一半区间内随机抖动，避免大量机器人在故障恢复时同时重连
+func pollBackoff(failures int) time.Duration {
+	d := pollBackoffMax
+	if failures < 20 {
+		d = min(pollBackoffMin<<(failures-1), pollBackoffMax)
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// 启动 HTTP 服务，提供 /metrics、/debug/bots、管理 API 和创建者控制台
+func (m *BotManager) startHTTPServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.handleMetrics)
+	mux.HandleFunc("/debug/bots", m.handleDebugBots)
+	m.registerAPI(mux)
+	m.registerDashboard(mux)
+
+	log.Printf("HTTP server listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("HTTP server stopped: %v", err)
+	}
+}
+
+func (m *BotManager) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.writeTo(w)
+
+	var bots, users, bans int64
+	m.db.QueryRow("SELECT COUNT(*) FROM bots WHERE deleted_at = 0").Scan(&bots)
+	m.db.QueryRow("SELECT COUNT(*) FROM bot_users").Scan(&users)
+	m.db.QueryRow("SELECT COUNT(*) FROM bans").Scan(&bans)
+	writeGauge(w, "forwardme_bots", "Managed bots registered in the database.", bots)
+	writeGauge(w, "forwardme_users", "Users known across all bots.", users)
+	writeGauge(w, "forwardme_banned_users", "Block list entries across all bots.", bans)
+
+	if stats, err := m.getAppealStats(time.Time{}); err == nil {
+		writeGauge(w, "forwardme_appeals_pending", "Appeals waiting for a decision.", int64(stats.Pending))
+		writeGauge(w, "forwardme_appeals_approved", "Appeals resolved by unbanning the user.", int64(stats.Approved))
+		writeGauge(w, "forwardme_appeals_rejected", "Appeals resolved by a permanent ban.", int64(stats.Rejected))
+	}
+
+	if depths := m.queueDepths(); len(depths) > 0 {
+		fmt.Fprintf(w, "# HELP forwardme_update_queue_depth Updates waiting to be handled per bot.\n# TYPE forwardme_update_queue_depth gauge\n")
+		ids := make([]string, 0, len(depths))
+		for id := range depths {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintf(w, "forwardme_update_queue_depth%s %d\n", formatLabels("bot", id), depths[id])
+		}
+	}
+
+	if counts := m.pollModeCounts(); len(counts) > 0 {
+		fmt.Fprintf(w, "# HELP forwardme_bots_polling Running bots by polling mode.\n# TYPE forwardme_bots_polling gauge\n")
+		for _, mode := range []pollMode{pollModeActive, pollModeNormal, pollModeIdle} {
+			fmt.Fprintf(w, "forwardme_bots_polling%s %d\n", formatLabels("mode", mode.name), counts[mode.name])
+		}
+	}
+
+	if statuses := breakers.snapshot(); len(statuses) > 0 {
+		fmt.Fprintf(w, "# HELP forwardme_breaker_open Whether a circuit breaker is open (1) or closed (0).\n# TYPE forwardme_breaker_open gauge\n")
+		for _, b := range statuses {
+			var open int
+			if b.State != "closed" {
+				open = 1
+			}
+			fmt.Fprintf(w, "forwardme_breaker_open%s %d\n", formatLabels("breaker", b.Name), open)
+		}
+	}
+}
+
+type debugBot struct {
+	ID           string    `json:"id"`
+	CreatorID    int64     `json:"creator_id"`
+	LastOK       time.Time `json:"last_ok,omitempty"`
+	FailingSince time.Time `json:"failing_since,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	PollMode     string    `json:"poll_mode,omitempty"`
+}
+
+// 运行中的机器人的轮询状态和外部集成的熔断器状态
+func (m *BotManager) handleDebugBots(w http.ResponseWriter, r *http.Request) {
+	var bots []debugBot
+	m.mu.RLock()
+	m.healthMu.Lock()
+	for token := range m.bots {
+		b := debugBot{ID: botIDFromToken(token), CreatorID: m.creator[token]}
+		if h, ok := m.health[token]; ok {
+			b.LastOK, b.FailingSince, b.PollMode = h.LastOK, h.FailingSince, h.PollMode
+			if h.LastErr != nil {
+				b.LastError = h.LastErr.Error()
+			}
+		}
+		bots = append(bots, b)
+	}
+	m.healthMu.Unlock()
+	m.mu.RUnlock()
+	sort.Slice(bots, func(i, j int) bool { return bots[i].ID < bots[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bots":     bots,
+		"breakers": breakers.snapshot(),
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 一项数据一致性检查。count 返回有问题的行数，repair 修复这些行
+type integrityCheck struct {
+	label  string
+	count  string
+	repair string
+}
+
+type integrityIssue struct {
+	check integrityCheck
+	rows  int64
+}
+
+func integrityChecks() []integrityCheck {
+	checks := []integrityCheck{
+		// 无法确定创建者的机器人没有人能管理，移入回收站，恢复期过后自动删除
+		{"没有创建者的机器人",
+			"SELECT COUNT(*) FROM bots WHERE creator_id = 0 AND deleted_at = 0",
+			"UPDATE bots SET deleted_at = " + fmt.Sprint(time.Now().Unix()) + " WHERE creator_id = 0 AND deleted_at = 0"},
+		{"无法解析的申诉次数",
+			"SELECT COUNT(*) FROM bots WHERE appeal_counts != '' AND NOT json_valid(appeal_counts)",
+			"UPDATE bots SET appeal_counts = '' WHERE appeal_counts != '' AND NOT json_valid(appeal_counts)"},
+		{"未迁移的旧版封禁列表",
+			`SELECT COUNT(*) FROM bots WHERE blocked_users != ""`,
+			""},
+		{"指向不存在的订阅源的条目",
+			"SELECT COUNT(*) FROM feed_items WHERE feed_id NOT IN (SELECT id FROM feeds)",
+			"DELETE FROM feed_items WHERE feed_id NOT IN (SELECT id FROM feeds)"},
+		{"指向不存在的投票的答案",
+			"SELECT COUNT(*) FROM survey_answers WHERE survey_id NOT IN (SELECT id FROM surveys)",
+			"DELETE FROM survey_answers WHERE survey_id NOT IN (SELECT id FROM surveys)"},
+	}
+	for _, table := range botScopedTables {
+		checks = append(checks, integrityCheck{
+			table + " 中指向不存在的机器人的记录",
+			"SELECT COUNT(*) FROM " + table + " WHERE bot_token NOT IN (SELECT token FROM bots)",
+			"DELETE FROM " + table + " WHERE bot_token NOT IN (SELECT token FROM bots)",
+		})
+	}
+	return checks
+}
+
+// 检查数据库的引用完整性，返回发现的问题
+func checkIntegrity(db *sql.DB) ([]integrityIssue, error) {
+	var issues []integrityIssue
+	for _, c := range integrityChecks() {
+		var n int64
+		if err := db.QueryRow(c.count).Scan(&n); err != nil {
+			return nil, fmt.Errorf("integrity check %q: %w", c.label, err)
+		}
+		if n > 0 {
+			issues = append(issues, integrityIssue{c, n})
+		}
+	}
+	return issues, nil
+}
+
+// 修复能自动修复的问题，返回修复的行数
+func repairIntegrity(db *sql.DB, issues []integrityIssue) (int64, error) {
+	var repaired int64
+	for _, issue := range issues {
+		if issue.check.repair == "" {
+			continue
+		}
+		res, err := db.Exec(issue.check.repair)
+		if err != nil {
+			return repaired, fmt.Errorf("repair %q: %w", issue.check.label, err)
+		}
+		n, _ := res.RowsAffected()
+		repaired += n
+		log.Printf("Repaired %d row(s): %s", n, issue.check.label)
+	}
+	return repaired, nil
+}
+
+func formatIntegrityIssues(issues []integrityIssue) string {
+	if len(issues) == 0 {
+		return "数据完整性检查通过"
+	}
+	var b strings.Builder
+	b.WriteString("数据完整性检查发现以下问题：\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "• %s：%d 条", issue.check.label, issue.rows)
+		if issue.check.repair == "" {
+			b.WriteString("（重启后自动迁移）")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// 启动时检查数据完整性，repair 为 true 时自动修复。返回需要告知运营者的报告，没有问题时为空
+func startupIntegrityCheck(db *sql.DB, repair bool) string {
+	issues, err := checkIntegrity(db)
+	if err != nil {
+		log.Printf("Failed to check database integrity: %v", err)
+		return ""
+	}
+	if len(issues) == 0 {
+		log.Println("Database integrity check passed.")
+		return ""
+	}
+	for _, issue := range issues {
+		log.Printf("Integrity problem: %s (%d)", issue.check.label, issue.rows)
+	}
+	report := formatIntegrityIssues(issues)
+	if !repair {
+		return report + "\n发送 /integrity repair 修复，或设置 INTEGRITY_REPAIR=true 在启动时自动修复。"
+	}
+	repaired, err := repairIntegrity(db, issues)
+	if err != nil {
+		log.Printf("Failed to repair database integrity: %v", err)
+		return report + "\n自动修复失败：" + err.Error()
+	}
+	return report + fmt.Sprintf("\n已自动修复 %d 条记录", repaired)
+}
+
+// 处理运营者的 /integrity [repair]
+func (m *BotManager) handleIntegrityCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	issues, err := checkIntegrity(m.db)
+	if err != nil {
+		log.Printf("Failed to check database integrity: %v", err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to check database integrity.")))
+		return
+	}
+	if strings.TrimSpace(message.CommandArguments()) != "repair" || len(issues) == 0 {
+		text := formatIntegrityIssues(issues)
+		if len(issues) > 0 {
+			text += "\n发送 /integrity repair 修复"
+		}
+		managerBot.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	if !m.instanceCan(message.From.ID, permManage) {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "无权限"))
+		return
+	}
+	repaired, err := repairIntegrity(m.db, issues)
+	if err != nil {
+		log.Printf("Failed to repair database integrity: %v", err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, "Failed to repair database integrity: "+err.Error()))
+		return
+	}
+	m.logEvent("", message.From.ID, eventRepair, 0, fmt.Sprintf("%d", repaired))
+	managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("已修复 %d 条记录", repaired)))
+}
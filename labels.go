@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 自动标签规则的条件类型
+const (
+	ruleKeyword = "keyword"
+	ruleType    = "type"
+	ruleLang    = "lang"
+	ruleSource  = "source"
+)
+
+type labelRule struct {
+	ID    int64
+	Label string
+	Kind  string
+	Value string
+}
+
+func (r labelRule) String() string {
+	return fmt.Sprintf("#%d %s ← %s:%s", r.ID, r.Label, r.Kind, r.Value)
+}
+
+// 消息类型，用于 type 规则
+func messageType(message *tgbotapi.Message) string {
+	switch {
+	case message.Photo != nil:
+		return "photo"
+	case message.Video != nil:
+		return "video"
+	case message.Document != nil:
+		return "document"
+	case message.Voice != nil:
+		return "voice"
+	case message.Audio != nil:
+		return "audio"
+	case message.Sticker != nil:
+		return "sticker"
+	case message.Animation != nil:
+		return "animation"
+	case message.VideoNote != nil:
+		return "video_note"
+	case message.Location != nil:
+		return "location"
+	case message.Contact != nil:
+		return "contact"
+	}
+	return "text"
+}
+
+// 规则是否匹配消息，source 为用户通过 /start 深链接进入时带的参数
+func (r labelRule) matches(message *tgbotapi.Message, source string) bool {
+	switch r.Kind {
+	case ruleKeyword:
+		_, ok := matchKeyword(message.Text+" "+message.Caption, []string{r.Value})
+		return ok
+	case ruleType:
+		return messageType(message) == r.Value
+	case ruleLang:
+		return message.From != nil && strings.HasPrefix(strings.ToLower(message.From.LanguageCode), strings.ToLower(r.Value))
+	case ruleSource:
+		return source == r.Value
+	}
+	return false
+}
+
+// 解析 "<label> <kind>:<value>"
+func parseLabelRule(args string) (labelRule, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return labelRule{}, fmt.Errorf("missing label or condition")
+	}
+	kind, value, ok := strings.Cut(strings.Join(fields[1:], " "), ":")
+	if !ok || value == "" {
+		return labelRule{}, fmt.Errorf("invalid condition %q", strings.Join(fields[1:], " "))
+	}
+	switch kind {
+	case ruleKeyword, ruleType, ruleLang, ruleSource:
+	default:
+		return labelRule{}, fmt.Errorf("unknown condition type %q", kind)
+	}
+	return labelRule{Label: fields[0], Kind: kind, Value: strings.TrimSpace(value)}, nil
+}
+
+func (m *BotManager) listLabelRules(token string) ([]labelRule, error) {
+	rows, err := m.db.Query("SELECT id, label, kind, value FROM label_rules WHERE bot_token = ? ORDER BY id", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []labelRule
+	for rows.Next() {
+		var r labelRule
+		if err := rows.Scan(&r.ID, &r.Label, &r.Kind, &r.Value); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// 给用户加标签，返回是否为新标签
+func (m *BotManager) addUserLabel(token string, userID int64, label string) (bool, error) {
+	res, err := m.db.Exec("INSERT OR IGNORE INTO user_labels (bot_token, user_id, label, created_at) VALUES (?, ?, ?, ?)",
+		token, userID, label, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to add label %q to user %d for bot %s: %v", label, userID, botIDFromToken(token), err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (m *BotManager) removeUserLabel(token string, userID int64, label string) error {
+	_, err := m.db.Exec("DELETE FROM user_labels WHERE bot_token = ? AND user_id = ? AND label = ?", token, userID, label)
+	if err != nil {
+		log.Printf("Failed to remove label %q from user %d for bot %s: %v", label, userID, botIDFromToken(token), err)
+	}
+	return err
+}
+
+func (m *BotManager) getUserLabels(token string, userID int64) ([]string, error) {
+	rows, err := m.db.Query("SELECT label FROM user_labels WHERE bot_token = ? AND user_id = ? ORDER BY created_at", token, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []string
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+// 用户通过 /start 深链接进入时带的参数
+func (m *BotManager) recordUserSource(token string, userID int64, source string) {
+	if _, err := m.db.Exec("UPDATE bot_users SET source = ? WHERE bot_token = ? AND user_id = ?", source, token, userID); err != nil {
+		log.Printf("Failed to record source of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+func (m *BotManager) getUserSource(token string, userID int64) string {
+	var source string
+	m.db.QueryRow("SELECT source FROM bot_users WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&source)
+	return source
+}
+
+// 对收到的消息执行自动标签规则，新加上的标签会通知创建者
+func (m *BotManager) applyLabelRules(bot *tgbotapi.BotAPI, creatorID int64, message *tgbotapi.Message) {
+	rules, err := m.listLabelRules(bot.Token)
+	if err != nil {
+		log.Printf("Failed to load label rules of bot %s: %v", botIDFromToken(bot.Token), err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	source := m.getUserSource(bot.Token, message.From.ID)
+	var added []string
+	for _, r := range rules {
+		if !r.matches(message, source) {
+			continue
+		}
+		if isNew, err := m.addUserLabel(bot.Token, message.From.ID, r.Label); err == nil && isNew {
+			added = append(added, r.Label)
+		}
+	}
+	if len(added) > 0 {
+		text := fmt.Sprintf("🏷 用户 %s (ID: %d) 被自动标记为：%s",
+			displayName(message.From.UserName, message.From.FirstName, message.From.LastName), message.From.ID, strings.Join(added, ", "))
+		if sent, err := bot.Send(tgbotapi.NewMessage(creatorID, text)); err == nil {
+			m.saveMessageMapping(bot.Token, sent.MessageID, message.From.ID, message.MessageID)
+		}
+	}
+}
+
+// 处理 /rules、/label、/unlabel 和 /labels
+func (m *BotManager) handleLabelCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+
+	switch message.Command() {
+	case "rules":
+		fields := strings.Fields(message.CommandArguments())
+		switch {
+		case len(fields) == 0:
+			rules, err := m.listLabelRules(token)
+			if err != nil {
+				bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get rules")))
+				return
+			}
+			if len(rules) == 0 {
+				bot.Send(tgbotapi.NewMessage(creatorID, "暂无自动标签规则。用法：/rules add <标签> keyword:退款|type:photo|lang:en|source:ad1，/rules del <编号>"))
+				return
+			}
+			var b strings.Builder
+			b.WriteString("自动标签规则:\n")
+			for _, r := range rules {
+				b.WriteString(r.String() + "\n")
+			}
+			bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+		case fields[0] == "add":
+			rule, err := parseLabelRule(strings.TrimSpace(strings.TrimPrefix(message.CommandArguments(), "add")))
+			if err != nil {
+				bot.Send(tgbotapi.NewMessage(creatorID, "用法：/rules add <标签> <条件>，条件为 keyword:关键词、type:photo、lang:en 或 source:深链接参数"))
+				return
+			}
+			if _, err := m.db.Exec("INSERT INTO label_rules (bot_token, label, kind, value) VALUES (?, ?, ?, ?)", token, rule.Label, rule.Kind, rule.Value); err != nil {
+				log.Printf("Failed to add label rule for bot %s: %v", botIDFromToken(token), err)
+				bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add rule")))
+				return
+			}
+			bot.Send(tgbotapi.NewMessage(creatorID, "已添加规则"))
+		case fields[0] == "del" && len(fields) == 2:
+			id, err := strconv.ParseInt(strings.TrimPrefix(fields[1], "#"), 10, 64)
+			if err != nil {
+				bot.Send(tgbotapi.NewMessage(creatorID, "无效的规则编号"))
+				return
+			}
+			res, err := m.db.Exec("DELETE FROM label_rules WHERE id = ? AND bot_token = ?", id, token)
+			if err != nil {
+				bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete rule")))
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				bot.Send(tgbotapi.NewMessage(creatorID, "未找到该规则"))
+				return
+			}
+			bot.Send(tgbotapi.NewMessage(creatorID, "已删除规则"))
+		default:
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/rules、/rules add <标签> <条件>、/rules del <编号>"))
+		}
+	case "label", "unlabel":
+		userID, label, err := m.commandTarget(token, message)
+		if err != nil || label == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID 和标签，例如：/"+message.Command()+" 123456 老客户，或回复一条转发消息发送 /"+message.Command()+" 老客户"))
+			return
+		}
+		if message.Command() == "label" {
+			_, err = m.addUserLabel(token, userID, label)
+		} else {
+			err = m.removeUserLabel(token, userID, label)
+		}
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update labels")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已更新用户ID: %d 的标签", userID)))
+	case "labels":
+		userID, _, err := m.commandTarget(token, message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID，例如：/labels 123456，或回复一条转发消息发送 /labels"))
+			return
+		}
+		labels, err := m.getUserLabels(token, userID)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get labels")))
+			return
+		}
+		if len(labels) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 暂无标签", userID)))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 的标签：%s", userID, strings.Join(labels, ", "))))
+	}
+}
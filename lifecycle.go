@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 收到 SIGTERM 后最多等待多久完成已拉取的更新，可以通过 SHUTDOWN_GRACE_SECONDS 覆盖。
+// 需要短于容器或 systemd 的停止超时
+const defaultShutdownGrace = 25 * time.Second
+
+// 包装机器人的 HTTP 客户端，开始排空时取消进行中的长轮询，其他请求不受影响，只统计请求数。
+// 被取消的轮询没有确认任何更新，Telegram 会把它们交给下一个进程
+type pollClient struct {
+	tgbotapi.HTTPClient
+	ctx context.Context
+}
+
+func (c *pollClient) Do(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return c.HTTPClient.Do(req.WithContext(c.ctx))
+	}
+	// 长轮询不计入发送限制，其他请求统计到 /quota 和 forwardme_api_* 指标
+	resp, err := c.HTTPClient.Do(req)
+	recordAPIRequest(req, resp)
+	return resp, err
+}
+
+// 让机器人的长轮询请求随 ctx 一起取消
+func withPollContext(bot *tgbotapi.BotAPI, ctx context.Context) {
+	if c, ok := bot.Client.(*pollClient); ok {
+		bot.Client = &pollClient{HTTPClient: c.HTTPClient, ctx: ctx}
+	}
+}
+
+// 等待 d 或直到 ctx 取消
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// 向 systemd 报告状态，未由 systemd 以 Type=notify 启动时什么都不做
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// 以 @ 开头的是抽象命名空间的套接字
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
+
+// systemd 配置了 WatchdogSec 时按一半的间隔发送心跳。管理机器人持续轮询失败时停止发送，
+// 由 systemd 重启进程
+func (m *BotManager) runSystemdWatchdog() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if m.managerFailures.Load() < managerFailoverThreshold {
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
+
+// 收到 SIGTERM 或 SIGINT 时停止轮询，处理完已拉取的更新并写入缓冲的数据后退出
+func (m *BotManager) handleShutdownSignals(grace time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	log.Printf("Received %s, shutting down.", sig)
+	m.drain(grace)
+}
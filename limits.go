@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 超额排队的消息检查间隔
+const throttleDeliveryInterval = time.Minute
+
+// 创建者为单个用户设置的消息配额
+type userLimit struct {
+	UserID int64
+	Max    int
+	Period time.Duration
+	Queue  bool
+}
+
+func (l userLimit) String() string {
+	s := fmt.Sprintf("%d/%s", l.Max, periodName(l.Period))
+	if l.Queue {
+		s += " queue"
+	}
+	return s
+}
+
+func periodName(period time.Duration) string {
+	if period == time.Hour {
+		return "hour"
+	}
+	return "day"
+}
+
+func periodLabel(period time.Duration) string {
+	if period == time.Hour {
+		return "小时"
+	}
+	return "天"
+}
+
+// 解析 "5/day" 形式的配额
+func parseLimit(s string) (max int, period time.Duration, err error) {
+	count, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid limit %q", s)
+	}
+	max, err = strconv.Atoi(count)
+	if err != nil || max < 1 {
+		return 0, 0, fmt.Errorf("invalid limit count %q", count)
+	}
+	switch strings.ToLower(unit) {
+	case "hour", "h":
+		return max, time.Hour, nil
+	case "day", "d":
+		return max, 24 * time.Hour, nil
+	}
+	return 0, 0, fmt.Errorf("invalid limit period %q", unit)
+}
+
+func (m *BotManager) getUserLimit(token string, userID int64) (userLimit, bool) {
+	l := userLimit{UserID: userID}
+	var seconds int64
+	err := m.db.QueryRow("SELECT max_messages, period, queue FROM user_limits WHERE bot_token = ? AND user_id = ?", token, userID).
+		Scan(&l.Max, &seconds, &l.Queue)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get limit of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		}
+		return l, false
+	}
+	l.Period = time.Duration(seconds) * time.Second
+	return l, true
+}
+
+// 用户在配额周期内已转发的消息数
+func (m *BotManager) forwardedSince(token string, userID int64, since time.Time) int {
+	var count int
+	if err := m.db.QueryRow("SELECT COUNT(DISTINCT user_message_id) FROM message_map WHERE bot_token = ? AND user_id = ? AND created_at >= ?",
+		token, userID, since.Unix()).Scan(&count); err != nil {
+		log.Printf("Failed to count messages of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return count
+}
+
+// 超出配额的消息按设置排队或丢弃，并礼貌地告知用户。返回消息是否已被拦下
+func (m *BotManager) throttleUser(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	token, userID := bot.Token, message.From.ID
+	limit, ok := m.getUserLimit(token, userID)
+	if !ok || m.forwardedSince(token, userID, time.Now().Add(-limit.Period)) < limit.Max {
+		return false
+	}
+	metrics.inc("forwardme_messages_throttled_total", "bot", botIDFromToken(token))
+
+	if !limit.Queue {
+		bot.Send(tgbotapi.NewMessage(userID, fmt.Sprintf("你的消息较多，每%s最多转达 %d 条，请稍后再发送。", periodLabel(limit.Period), limit.Max)))
+		return true
+	}
+
+	var alreadyQueued bool
+	m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM throttled_messages WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&alreadyQueued)
+	_, err := m.db.Exec("INSERT INTO throttled_messages (bot_token, user_id, chat_id, message_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		token, userID, message.Chat.ID, message.MessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to queue throttled message of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	// 每段排队期间只提示一次
+	if !alreadyQueued {
+		bot.Send(tgbotapi.NewMessage(userID, fmt.Sprintf("你的消息较多，每%s最多转达 %d 条，超出的消息已收到，会在额度恢复后依次转交。", periodLabel(limit.Period), limit.Max)))
+	}
+	return true
+}
+
+// 额度恢复后依次转发排队的超额消息
+func (m *BotManager) deliverThrottled() {
+	rows, err := m.db.Query("SELECT id, bot_token, user_id, chat_id, message_id FROM throttled_messages ORDER BY id")
+	if err != nil {
+		log.Printf("Failed to load throttled messages: %v", err)
+		return
+	}
+	type throttledMessage struct {
+		id, userID, chatID int64
+		token              string
+		messageID          int
+	}
+	var queued []throttledMessage
+	for rows.Next() {
+		var q throttledMessage
+		if err := rows.Scan(&q.id, &q.token, &q.userID, &q.chatID, &q.messageID); err == nil {
+			queued = append(queued, q)
+		}
+	}
+	rows.Close()
+
+	for _, q := range queued {
+		m.mu.RLock()
+		bot, running := m.bots[q.token]
+		creatorID := m.creator[q.token]
+		m.mu.RUnlock()
+		if !running {
+			continue
+		}
+		// 配额被取消时直接投递
+		if limit, ok := m.getUserLimit(q.token, q.userID); ok && m.forwardedSince(q.token, q.userID, time.Now().Add(-limit.Period)) >= limit.Max {
+			continue
+		}
+		if !m.forwardUserMessage(bot, m.onDutyID(creatorID), q.chatID, q.userID, q.messageID) {
+			continue
+		}
+		if _, err := m.db.Exec("DELETE FROM throttled_messages WHERE id = ?", q.id); err != nil {
+			log.Printf("Failed to remove throttled message %d for bot %s: %v", q.id, botIDFromToken(q.token), err)
+		}
+	}
+}
+
+func (m *BotManager) runThrottleDelivery() {
+	ticker := time.NewTicker(throttleDeliveryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.deliverThrottled()
+	}
+}
+
+// 处理 /limit：/limit <ID> 5/day [queue] 设置配额，/limit <ID> off 取消，无参数时列出
+func (m *BotManager) handleLimitCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/limit 123456 5/day 限制该用户每天最多转达 5 条（也可用 /hour），加上 queue 则超出的消息排队到额度恢复后再转达，否则丢弃；/limit 123456 off 取消。也可以回复一条转发消息使用"
+
+	if strings.TrimSpace(message.CommandArguments()) == "" && message.ReplyToMessage == nil {
+		rows, err := m.db.Query("SELECT user_id, max_messages, period, queue FROM user_limits WHERE bot_token = ? ORDER BY created_at", token)
+		if err != nil {
+			log.Printf("Failed to list limits of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list limits")))
+			return
+		}
+		defer rows.Close()
+		var b strings.Builder
+		for rows.Next() {
+			var l userLimit
+			var seconds int64
+			if err := rows.Scan(&l.UserID, &l.Max, &seconds, &l.Queue); err != nil {
+				continue
+			}
+			l.Period = time.Duration(seconds) * time.Second
+			fmt.Fprintf(&b, "%d: %s\n", l.UserID, l)
+		}
+		if b.Len() == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无限流用户。\n"+usage))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "限流用户：\n"+b.String()))
+		return
+	}
+
+	userID, rest, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 1 && strings.EqualFold(fields[0], "off") {
+		if _, err := m.db.Exec("DELETE FROM user_limits WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+			log.Printf("Failed to remove limit of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to remove limit")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已取消用户ID: %d 的限流，排队中的消息将尽快转发", userID)))
+		return
+	}
+	if len(fields) == 0 || len(fields) > 2 || (len(fields) == 2 && !strings.EqualFold(fields[1], "queue")) {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	max, period, err := parseLimit(fields[0])
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	limit := userLimit{UserID: userID, Max: max, Period: period, Queue: len(fields) == 2}
+	_, err = m.db.Exec(`INSERT INTO user_limits (bot_token, user_id, max_messages, period, queue, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET max_messages = excluded.max_messages, period = excluded.period, queue = excluded.queue`,
+		token, userID, limit.Max, int64(limit.Period/time.Second), limit.Queue, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to set limit of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to set limit")))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已限流为 %s", userID, limit)))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 压测使用的机器人和创建者，数据写入临时数据库，不影响正式数据
+const (
+	loadTestToken     = "1000000:loadtest"
+	loadTestCreatorID = 1
+	loadTestMaxCount  = 20000
+)
+
+// 模拟 Telegram Bot API，所有请求都在本地应答，可以设置每次请求的延迟
+type fakeTelegram struct {
+	latency time.Duration
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	calls   map[string]int
+}
+
+func newFakeTelegram(latency time.Duration) *fakeTelegram {
+	return &fakeTelegram{latency: latency, calls: make(map[string]int)}
+}
+
+func (f *fakeTelegram) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	f.mu.Lock()
+	f.calls[method]++
+	f.mu.Unlock()
+	time.Sleep(f.latency)
+
+	var result string
+	switch {
+	case method == "getMe":
+		result = `{"id":1000000,"is_bot":true,"first_name":"Load test","username":"loadtest_bot"}`
+	case method == "getUserProfilePhotos":
+		result = `{"total_count":0,"photos":[]}`
+	case method == "getChat":
+		result = `{"id":1,"type":"private"}`
+	case strings.HasPrefix(method, "send"), strings.HasPrefix(method, "copy"), strings.HasPrefix(method, "forward"), strings.HasPrefix(method, "edit"):
+		result = fmt.Sprintf(`{"message_id":%d,"date":%d,"chat":{"id":1,"type":"private"}}`, f.nextID.Add(1), time.Now().Unix())
+	default:
+		result = "true"
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(`{"ok":true,"result":` + result + `}`)),
+		Request:    req,
+	}, nil
+}
+
+func (f *fakeTelegram) totalCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int
+	for _, c := range f.calls {
+		n += c
+	}
+	return n
+}
+
+type loadTestResult struct {
+	messages, users int
+	elapsed         time.Duration
+	latencies       []time.Duration
+	apiCalls        int
+	dbBytes         int64
+}
+
+func (r loadTestResult) String() string {
+	slices.Sort(r.latencies)
+	percentile := func(p float64) time.Duration {
+		if len(r.latencies) == 0 {
+			return 0
+		}
+		return r.latencies[int(float64(len(r.latencies)-1)*p)].Round(time.Microsecond)
+	}
+	return fmt.Sprintf("压测完成：%d 条消息，%d 个用户\n耗时：%s\n吞吐：%.0f 条/秒\n延迟 p50 %s，p95 %s，p99 %s\nBot API 调用：%d 次\n数据库大小：%d KB",
+		r.messages, r.users, r.elapsed.Round(time.Millisecond), float64(r.messages)/r.elapsed.Seconds(),
+		percentile(0.5), percentile(0.95), percentile(0.99), r.apiCalls, r.dbBytes>>10)
+}
+
+// 在临时数据库上用模拟的 Bot API 跑一遍完整的消息处理流程：队列、过滤、转发和写入
+func runLoadTest(messages, users int, latency time.Duration, workers, depth int) (loadTestResult, error) {
+	dir, err := os.MkdirTemp("", "forwardme-loadtest-")
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	defer os.RemoveAll(dir)
+	dbPath := filepath.Join(dir, "bots.db")
+	db, err := sql.Open("sqlite", dbPath+sqliteOptions)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	defer db.Close()
+	if err := initSchema(db); err != nil {
+		return loadTestResult{}, err
+	}
+	if _, err := db.Exec("INSERT INTO bots (token, creator_id) VALUES (?, ?)", loadTestToken, loadTestCreatorID); err != nil {
+		return loadTestResult{}, err
+	}
+
+	m := NewBotManager(db)
+	m.botWorkers, m.botQueueDepth = workers, depth
+	telegram := newFakeTelegram(latency)
+	bot, err := tgbotapi.NewBotAPIWithClient(loadTestToken, tgbotapi.APIEndpoint, telegram)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	m.bots[loadTestToken] = bot
+	m.creator[loadTestToken] = loadTestCreatorID
+
+	flushDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(userWriteFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.flushUserWrites()
+			case <-flushDone:
+				return
+			}
+		}
+	}()
+
+	updates := make(chan botUpdate, depth)
+	appeals := &appealWaitlist{users: make(map[int64]bool)}
+	latencies := make([]time.Duration, messages)
+	var wg sync.WaitGroup
+	wg.Add(messages)
+
+	start := time.Now()
+	go func() {
+		for i := 0; i < messages; i++ {
+			userID := int64(100000 + i%users)
+			update := botUpdate{Update: tgbotapi.Update{
+				UpdateID: i + 1,
+				Message: &tgbotapi.Message{
+					MessageID: i + 1,
+					From:      &tgbotapi.User{ID: userID, FirstName: "User", UserName: "user" + strconv.FormatInt(userID, 10)},
+					Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+					Date:      int(time.Now().Unix()),
+					Text:      fmt.Sprintf("压测消息 %d", i),
+				},
+			}}
+			updates <- update
+		}
+		close(updates)
+	}()
+	m.dispatchUpdates(bot, updates, func(update botUpdate) {
+		defer wg.Done()
+		received := time.Now()
+		m.handleBotUpdate(bot, loadTestCreatorID, update, appeals)
+		latencies[update.UpdateID-1] = time.Since(received)
+	})
+	wg.Wait()
+	close(flushDone)
+	m.flushUserWrites()
+	elapsed := time.Since(start)
+
+	result := loadTestResult{messages: messages, users: users, elapsed: elapsed, latencies: latencies, apiCalls: telegram.totalCalls()}
+	if info, err := os.Stat(dbPath); err == nil {
+		result.dbBytes = info.Size()
+	}
+	return result, nil
+}
+
+// 解析 [消息数] [用户数] [每次 API 调用的延迟]
+func parseLoadTestArgs(args []string) (messages, users int, latency time.Duration, err error) {
+	messages, users = 1000, 100
+	if len(args) > 0 {
+		if messages, err = strconv.Atoi(args[0]); err != nil || messages < 1 || messages > loadTestMaxCount {
+			return 0, 0, 0, fmt.Errorf("消息数需要在 1 到 %d 之间", loadTestMaxCount)
+		}
+	}
+	if len(args) > 1 {
+		if users, err = strconv.Atoi(args[1]); err != nil || users < 1 {
+			return 0, 0, 0, fmt.Errorf("用户数需要大于 0")
+		}
+	}
+	if len(args) > 2 {
+		if latency, err = time.ParseDuration(args[2]); err != nil || latency < 0 {
+			return 0, 0, 0, fmt.Errorf("无效的延迟 %q，例如 20ms", args[2])
+		}
+	}
+	return messages, users, latency, nil
+}
+
+// 命令行压测模式：forwardme loadtest [消息数] [用户数] [延迟]，输出结果后退出
+func runLoadTestCLI(args []string) {
+	messages, users, latency, err := parseLoadTestArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "usage: forwardme loadtest [messages] [users] [api latency]:", err)
+		os.Exit(2)
+	}
+	log.SetOutput(io.Discard)
+	result, err := runLoadTest(messages, users, latency, defaultBotWorkers, defaultBotQueueDepth)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load test failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println(result)
+}
+
+// 处理运营者的 /loadtest [消息数] [用户数] [延迟]，用于预发布环境
+func (m *BotManager) handleLoadTestCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	messages, users, latency, err := parseLoadTestArgs(strings.Fields(message.CommandArguments()))
+	if err != nil {
+		managerBot.Send(tgbotapi.NewMessage(chatID, err.Error()+"\n用法：/loadtest [消息数] [用户数] [每次 API 调用的延迟]，例如：/loadtest 5000 200 20ms"))
+		return
+	}
+	managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("开始压测：%d 条消息，%d 个用户，API 延迟 %s。使用临时数据库和模拟的 Bot API，不影响正式数据", messages, users, latency)))
+	go func() {
+		log.Printf("Load test started by user ID: %d (%d messages, %d users, %s latency)", message.From.ID, messages, users, latency)
+		result, err := runLoadTest(messages, users, latency, m.botWorkers, m.botQueueDepth)
+		if err != nil {
+			log.Printf("Load test failed: %v", err)
+			managerBot.Send(tgbotapi.NewMessage(chatID, "Load test failed: "+err.Error()))
+			return
+		}
+		log.Printf("Load test finished in %s.", result.elapsed)
+		managerBot.Send(tgbotapi.NewMessage(chatID, result.String()))
+	}()
+}
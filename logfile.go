@@ -0,0 +1,168 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志文件的默认大小上限和保留的旧文件数
+const (
+	defaultLogMaxMB      = 100
+	defaultLogMaxBackups = 7
+)
+
+// 按大小和日期轮转的日志文件。轮转出的旧文件名带时间戳，可以压缩为 .gz，超过保留数量的最旧文件被删除
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	daily      bool
+	maxBackups int
+	compress   bool
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, maxBytes int64, daily bool, maxBackups int, compress bool) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, maxBytes: maxBytes, daily: daily, maxBackups: maxBackups, compress: compress}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), info.ModTime()
+	if f.size == 0 {
+		f.opened = time.Now()
+	}
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxBytes || (f.daily && now.Format("20060102") != f.opened.Format("20060102"))) {
+		if err := f.rotate(now); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file %s: %v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// 调用时须持有锁
+func (f *rotatingFile) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	backup := f.path + "." + now.Format("20060102-150405.000")
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.cleanup(backup)
+	return nil
+}
+
+// 压缩刚轮转出的文件并删除多余的旧文件
+func (f *rotatingFile) cleanup(backup string) {
+	if f.compress {
+		if err := gzipFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compress log file %s: %v\n", backup, err)
+		}
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil || len(backups) <= f.maxBackups {
+		return
+	}
+	// 时间戳格式保证按文件名排序即按时间排序
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(old)
+	}
+}
+
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// 设置了 LOG_FILE 时日志同时写入标准错误和该文件
+func setupLogFile() {
+	path := os.Getenv("LOG_FILE")
+	if path == "" {
+		return
+	}
+	maxMB := int64(defaultLogMaxMB)
+	if mb, err := strconv.ParseInt(os.Getenv("LOG_MAX_MB"), 10, 64); err == nil && mb > 0 {
+		maxMB = mb
+	}
+	maxBackups := defaultLogMaxBackups
+	if n, err := strconv.Atoi(os.Getenv("LOG_MAX_BACKUPS")); err == nil && n > 0 {
+		maxBackups = n
+	}
+	daily := !strings.EqualFold(os.Getenv("LOG_ROTATE"), "size")
+	compress := os.Getenv("LOG_COMPRESS") != "false"
+
+	file, err := openRotatingFile(path, maxMB<<20, daily, maxBackups, compress)
+	if err != nil {
+		log.Fatalf("Failed to open log file %s: %v", path, err)
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	rotation := fmt.Sprintf("at %d MB", maxMB)
+	if daily {
+		rotation += " or daily"
+	}
+	log.Printf("Logging to %s (rotate %s, keep %d).", path, rotation, maxBackups)
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	_ "modernc.org/sqlite"
@@ -17,66 +21,196 @@ import (
 type BotManager struct {
 	bots    map[string]*tgbotapi.BotAPI
 	creator map[string]int64
-	mu      sync.RWMutex
-	db      *sql.DB
+	// 回收站中的机器人，已停止轮询，保留下来用于按用户名查找和恢复
+	deleted map[string]*tgbotapi.BotAPI
+	// 正在由 AddBot 启动的机器人，避免并发添加同一个 token 时重复轮询
+	starting map[string]bool
+	// 每个机器人的轮询，删除机器人时取消
+	botPollers map[string]*botPoller
+	mu         sync.RWMutex
+	db         *sql.DB
+	operators  []int64
+	// 实例级只读审计员
+	auditors []int64
+
+	// 服务条款版本与文本，版本为空时不要求同意
+	tosVersion  string
+	tosText     string
+	pendingBots map[int64]string
+
+	// 添加机器人时发现 webhook 是否自动删除
+	deleteWebhook bool
+	// 是否按机器人的活跃程度调整长轮询超时
+	adaptivePolling bool
+	// 每个机器人的处理协程数和每个协程的队列长度
+	botWorkers    int
+	botQueueDepth int
+	queues        map[string]*updateQueue
+	// 合并写入的用户资料和消息数
+	userWrites *userWriteBuffer
+	// 计费用量，定期写入
+	usage *usageMeter
+	// 等待凑齐后一起转交的相册
+	albums *albumBuffer
+	// 交接给新进程或退出时置位并取消 drainCtx，轮询随即停止；pollers 等待所有轮询和处理结束
+	draining    atomic.Bool
+	drainCtx    context.Context
+	stopPolling context.CancelFunc
+	pollers     sync.WaitGroup
+	// 本地 Bot API 服务器地址，格式同 tgbotapi.APIEndpoint，为空时使用官方服务器
+	apiEndpoint string
+
+	// 用于给运营者和创建者发送平台通知，可为 nil
+	managerBot *tgbotapi.BotAPI
+	// 主管理机器人轮询持续失败时接管的备用管理机器人，可为 nil
+	backupManagerBot *tgbotapi.BotAPI
+	managerFailures  atomic.Int32
+	// 白标品牌的管理机器人
+	brands []*brand
+
+	// 每个机器人最近的轮询状态，由看门狗检查。每次轮询都会更新，因此使用单独的锁，
+	// 可以在持有 m.mu 时获取 healthMu，反之不行
+	healthMu sync.Mutex
+	health   map[string]*botHealth
+
+	// 各处理步骤的超时，未配置的步骤使用 defaultStageTimeout
+	stageTimeouts map[string]time.Duration
+
+	// 拥有 admin 权限的管理 API token，其他 token 由运营者通过 /apitoken 管理
+	apiToken string
+	// 幂等键的保留时间
+	idempotencyWindow time.Duration
+	// 发布对话记录使用的 Telegraph 账号
+	telegraph telegraphAccount
+	// 控制台的外部地址，用于转发工具按钮中的链接，为空时不显示控制台按钮
+	dashboardURL string
+	// 未单独设置套餐的创建者使用的套餐
+	defaultPlan string
+	// 订阅套餐每 30 天的 Telegram Stars 价格，为 0 时不开放订阅
+	subscriptionStars int
+	// 每个机器人存档时持有的锁，保证存档按顺序发送
+	archiveLocks sync.Map
 }
 
 func NewBotManager(db *sql.DB) *BotManager {
+	drainCtx, stopPolling := context.WithCancel(context.Background())
 	return &BotManager{
-		bots:    make(map[string]*tgbotapi.BotAPI),
-		creator: make(map[string]int64),
-		db:      db,
+		drainCtx:      drainCtx,
+		stopPolling:   stopPolling,
+		bots:          make(map[string]*tgbotapi.BotAPI),
+		creator:       make(map[string]int64),
+		deleted:       make(map[string]*tgbotapi.BotAPI),
+		starting:      make(map[string]bool),
+		botPollers:    make(map[string]*botPoller),
+		db:            db,
+		pendingBots:   make(map[int64]string),
+		health:        make(map[string]*botHealth),
+		queues:        make(map[string]*updateQueue),
+		userWrites:    newUserWriteBuffer(),
+		usage:         newUsageMeter(),
+		albums:        newAlbumBuffer(),
+		defaultPlan:   planPro,
+		botWorkers:    defaultBotWorkers,
+		botQueueDepth: defaultBotQueueDepth,
 	}
 }
 
+// 机器人已由其他创建者添加
+var errBotOwnedByOther = errors.New("this bot is already registered by another creator")
+
+// 添加并启动机器人。可以安全地重复调用：同一创建者再次添加正在运行的机器人时直接返回，
+// 不会再启动一个轮询；属于其他创建者或在回收站中的机器人拒绝添加
 func (m *BotManager) AddBot(token string, creatorID int64) error {
-	log.Printf("Attempting to add bot with token: %s, creator ID: %d", token, creatorID)
-	bot, err := tgbotapi.NewBotAPI(token)
-	if err != nil {
-		log.Printf("Failed to create bot API for token %s: %v", token, err)
-		return err
-	}
-	log.Printf("Bot API created successfully for token: %s", token)
+	log.Printf("Attempting to add bot %s, creator ID: %d", botIDFromToken(token), creatorID)
 
 	m.mu.Lock()
-	m.bots[token] = bot
-	m.creator[token] = creatorID
+	_, running := m.bots[token]
+	_, deleted := m.deleted[token]
+	owner, starting := m.creator[token], m.starting[token]
+	if !running && !deleted && !starting {
+		m.starting[token] = true
+	}
 	m.mu.Unlock()
-	log.Printf("Bot %s added to the manager's in-memory storage.", token)
-
-	go m.startBot(bot, creatorID)
-	log.Printf("Bot %s started.", token)
+	switch {
+	case deleted:
+		return fmt.Errorf("this bot is deleted; restore it with /restorebot")
+	case (running || starting) && owner != 0 && owner != creatorID:
+		return errBotOwnedByOther
+	case running || starting:
+		log.Printf("Bot %s is already running, not starting it again.", botIDFromToken(token))
+		return nil
+	}
+	defer func() {
+		m.mu.Lock()
+		delete(m.starting, token)
+		m.mu.Unlock()
+	}()
 
 	// 检查bot是否已存在
-	var exists bool
-	err = m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM bots WHERE token = ?)", token).Scan(&exists)
-	if err != nil {
-		log.Printf("Failed to check bot existence for token %s: %v", token, err)
+	var owned int64
+	err := m.db.QueryRow("SELECT creator_id FROM bots WHERE token = ?", token).Scan(&owned)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to check bot existence for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
-
-	if exists {
-		log.Printf("Bot with token %s already exists in the database.", token)
-		return nil // 早期返回，无需重新插入
+	if exists && owned != creatorID {
+		return errBotOwnedByOther
 	}
 
-	// 插入新bot到数据库中
-	_, err = m.db.Exec("INSERT INTO bots (token, creator_id) VALUES (?, ?)", token, creatorID)
+	bot, err := m.newBotAPI(token)
 	if err != nil {
-		log.Printf("Failed to insert bot with token %s into database: %v", token, err)
+		log.Printf("Failed to create bot API for bot %s: %v", botIDFromToken(token), err)
+		return err
+	}
+	log.Printf("Bot API created successfully for bot %s", botIDFromToken(token))
+
+	if err := m.ensurePolling(bot, creatorID); err != nil {
 		return err
 	}
-	log.Printf("Bot with token %s added to the database successfully.", token)
 
+	// 先写入数据库再启动，写入失败时不会留下没有记录的轮询
+	if !exists {
+		_, err = m.db.Exec("INSERT INTO bots (token, creator_id) VALUES (?, ?)", token, creatorID)
+		if err != nil {
+			log.Printf("Failed to insert bot %s into database: %v", botIDFromToken(token), err)
+			return err
+		}
+		log.Printf("Bot %s added to the database successfully.", botIDFromToken(token))
+	}
+
+	ctx, cancel := context.WithCancel(m.drainCtx)
+	withPollContext(bot, ctx)
+	poller := &botPoller{cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	m.bots[token] = bot
+	m.creator[token] = creatorID
+	m.botPollers[token] = poller
+	m.mu.Unlock()
+	log.Printf("Bot %s added to the manager's in-memory storage.", botIDFromToken(token))
+
+	go func() {
+		defer close(poller.done)
+		m.startBot(ctx, bot, creatorID)
+	}()
+	log.Printf("Bot %s started.", botIDFromToken(token))
 	return nil
 }
 
+// 正在运行（或正在启动）的机器人
+func (m *BotManager) isBotRunning(token string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, running := m.bots[token]
+	return running || m.starting[token]
+}
+
 // 获取用户的申诉次数
 func (m *BotManager) getAppealCount(token string, userID int64) int {
 	var appealCountsStr string
 	err := m.db.QueryRow("SELECT appeal_counts FROM bots WHERE token = ?", token).Scan(&appealCountsStr)
 	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Failed to get appeal counts for bot %s: %v", token, err)
+		log.Printf("Failed to get appeal counts for bot %s: %v", botIDFromToken(token), err)
 		return 0
 	}
 
@@ -98,7 +232,7 @@ func (m *BotManager) incrementAppealCount(token string, userID int64) error {
 	var appealCountsStr string
 	err := m.db.QueryRow("SELECT appeal_counts FROM bots WHERE token = ?", token).Scan(&appealCountsStr)
 	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Failed to get appeal counts for bot %s: %v", token, err)
+		log.Printf("Failed to get appeal counts for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
 
@@ -121,7 +255,7 @@ func (m *BotManager) incrementAppealCount(token string, userID int64) error {
 
 	_, err = m.db.Exec("UPDATE bots SET appeal_counts = ? WHERE token = ?", string(updatedAppealCounts), token)
 	if err != nil {
-		log.Printf("Failed to update appeal counts for bot %s: %v", token, err)
+		log.Printf("Failed to update appeal counts for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
 
@@ -129,100 +263,50 @@ func (m *BotManager) incrementAppealCount(token string, userID int64) error {
 }
 
 func (m *BotManager) isUserBlocked(token string, userID int64) bool {
-	var blockedUsers string
-	err := m.db.QueryRow("SELECT blocked_users FROM bots WHERE token = ?", token).Scan(&blockedUsers)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Failed to get blocked users for bot %s: %v", token, err)
+	var blocked bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM bans WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&blocked)
+	if err != nil {
+		log.Printf("Failed to get blocked users for bot %s: %v", botIDFromToken(token), err)
 		return false
 	}
-
-	if blockedUsers == "" {
-		return false // No blocked users for this bot
-	}
-
-	blockedList := strings.Split(blockedUsers, ",")
-	for _, idStr := range blockedList {
-		id, err := strconv.ParseInt(idStr, 10, 64)
-		if err == nil && id == userID {
-			return true // User is blocked
-		}
-	}
-	return false // User is not blocked
+	return blocked
 }
 
 // 在 BotManager 结构体中添加一个方法，用于添加用户到黑名单
-func (m *BotManager) blockUser(token string, userID int64) error {
-	var blockedUsers string
-	err := m.db.QueryRow("SELECT blocked_users FROM bots WHERE token = ?", token).Scan(&blockedUsers)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Failed to get blocked users for bot %s: %v", token, err)
-		return err
-	}
-
-	blockedList := strings.Split(blockedUsers, ",")
-	for _, idStr := range blockedList {
-		id, err := strconv.ParseInt(idStr, 10, 64)
-		if err == nil && id == userID {
-			log.Printf("User ID: %d is already in the block list for bot %s.", userID, token)
-			return nil // User already blocked
-		}
-	}
-
-	if blockedUsers != "" {
-		blockedList = append(blockedList, strconv.FormatInt(userID, 10))
-	} else {
-		blockedList = []string{strconv.FormatInt(userID, 10)}
-	}
-
-	newBlockedUsers := strings.Join(blockedList, ",")
-
-	_, err = m.db.Exec("UPDATE bots SET blocked_users = ? WHERE token = ?", newBlockedUsers, token)
+func (m *BotManager) blockUser(token string, userID int64, reason string) error {
+	res, err := m.db.Exec("INSERT OR IGNORE INTO bans (bot_token, user_id, reason, banned_at) VALUES (?, ?, ?, ?)",
+		token, userID, reason, time.Now().Unix())
 	if err != nil {
-		log.Printf("Failed to add user to block list for bot %s: %v", token, err)
+		log.Printf("Failed to add user to block list for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
-	log.Printf("User ID: %d added to the block list for bot %s.", userID, token)
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("User ID: %d is already in the block list for bot %s.", userID, botIDFromToken(token))
+		return nil // User already blocked
+	}
+	metrics.inc("forwardme_bans_total", "bot", botIDFromToken(token))
+	log.Printf("User ID: %d added to the block list for bot %s.", userID, botIDFromToken(token))
 	return nil
 }
 
 func (m *BotManager) unblockUser(token string, userID int64) error {
-	var blockedUsers string
-	err := m.db.QueryRow("SELECT blocked_users FROM bots WHERE token = ?", token).Scan(&blockedUsers)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Failed to get blocked users for bot %s: %v", token, err)
-		return err
-	}
-
-	if blockedUsers == "" {
-		log.Printf("No blocked users found for bot %s", token)
-		return nil
-	}
-
-	blockedList := strings.Split(blockedUsers, ",")
-	newBlockedList := []string{}
-	for _, idStr := range blockedList {
-		id, err := strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			continue
-		}
-		if id != userID {
-			newBlockedList = append(newBlockedList, idStr)
-		}
-	}
-
-	newBlockedUsers := strings.Join(newBlockedList, ",")
-
-	_, err = m.db.Exec("UPDATE bots SET blocked_users = ? WHERE token = ?", newBlockedUsers, token)
+	res, err := m.db.Exec("DELETE FROM bans WHERE bot_token = ? AND user_id = ?", token, userID)
 	if err != nil {
-		log.Printf("Failed to remove user from block list for bot %s: %v", token, err)
+		log.Printf("Failed to remove user from block list for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("User ID: %d is not in the block list for bot %s", userID, botIDFromToken(token))
+	} else {
+		metrics.inc("forwardme_unbans_total", "bot", botIDFromToken(token))
+		m.resolveAppeals(token, userID, appealApproved)
+	}
 
 	// Reset the appeal count when unbanning user
 	var appealCountsStr string
 	err = m.db.QueryRow("SELECT appeal_counts FROM bots WHERE token = ?", token).Scan(&appealCountsStr)
 	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Failed to get appeal counts for bot %s: %v", token, err)
+		log.Printf("Failed to get appeal counts for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
 
@@ -243,10 +327,10 @@ func (m *BotManager) unblockUser(token string, userID int64) error {
 	}
 	_, err = m.db.Exec("UPDATE bots SET appeal_counts = ? WHERE token = ?", string(updatedAppealCounts), token)
 	if err != nil {
-		log.Printf("Failed to update appeal counts for bot %s: %v", token, err)
+		log.Printf("Failed to update appeal counts for bot %s: %v", botIDFromToken(token), err)
 		return err
 	}
-	log.Printf("User ID: %d removed from the block list and appeal count reset for bot %s.", userID, token)
+	log.Printf("User ID: %d removed from the block list and appeal count reset for bot %s.", userID, botIDFromToken(token))
 
 	return nil
 }
@@ -263,14 +347,22 @@ func (m *BotManager) handleBotCommands(bot *tgbotapi.BotAPI, update *tgbotapi.Up
 		if userName == " " {
 			userName = update.Message.From.FirstName
 		}
+		if m.isGloballyBlocked(m.creatorOf(botToken), userID) {
+			log.Printf("User ID: %d is on the global blacklist, not notifying creator about /start.", userID)
+			return
+		}
+		if source := strings.TrimSpace(update.Message.CommandArguments()); source != "" {
+			m.recordUserSource(botToken, userID, source)
+		}
+		m.sendMenu(bot, update.Message.Chat.ID)
 
 		startMessage := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户 %s (ID: %d) 发起了 /start 命令。\n\n选择操作:", userName, userID))
 
 		// 创建封禁按钮
-		banButton := tgbotapi.NewInlineKeyboardButtonData("封禁", fmt.Sprintf("ban_%d", userID))
+		banButton := tgbotapi.NewInlineKeyboardButtonData("封禁", signCallback(botToken, cbBan, userID))
 
 		// 创建解禁按钮
-		unbanButton := tgbotapi.NewInlineKeyboardButtonData("解禁", fmt.Sprintf("unban_%d", userID))
+		unbanButton := tgbotapi.NewInlineKeyboardButtonData("解禁", signCallback(botToken, cbUnban, userID))
 
 		// 将按钮添加到键盘中
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -278,215 +370,608 @@ func (m *BotManager) handleBotCommands(bot *tgbotapi.BotAPI, update *tgbotapi.Up
 		)
 		startMessage.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(startMessage); err != nil {
+		if sent, err := bot.Send(startMessage); err != nil {
 			log.Printf("Failed to send /start message to creator: %v", err)
 		} else {
+			m.saveMessageMapping(botToken, sent.MessageID, userID, update.Message.MessageID)
 			log.Printf("Sent /start message to creator for user ID: %d", userID)
 		}
 		return // Skip forwarding for /start command
 	}
 
+	if m.answerCustomCommand(bot, update.Message) {
+		return
+	}
+
+	// 其余命令是管理命令，按发送者在此机器人上的角色判断权限，普通用户的命令交给 handleUserCommand
+	from := update.Message.From.ID
+	senderRole := m.botRole(botToken, from)
+	if senderRole == "" {
+		m.handleUserCommand(bot, update.Message, creatorID)
+		return
+	}
+	if !roleAllows(senderRole, botCommandPermission(update.Message.Command())) {
+		bot.Send(tgbotapi.NewMessage(from, "你没有权限使用该命令"))
+		return
+	}
+	// 创建者以外的角色，命令结果回复给发送者本人
+	if senderRole != roleCreator {
+		creatorID = from
+	}
+
 	switch update.Message.Command() {
+	case "role", "roles":
+		m.handleRoleCommand(bot, update.Message, creatorID)
+		return
+	case "auditlog":
+		m.sendEventExport(bot, creatorID, botToken)
+		return
+	case "retention":
+		m.handleRetentionCommand(bot, update.Message, creatorID)
+		return
+	case "service":
+		m.handleServiceCommand(bot, update.Message, creatorID)
+		return
+	case "forwardbuttons":
+		m.handleForwardButtonsCommand(bot, update.Message, creatorID)
+		return
+	case "relaymode":
+		m.handleRelayModeCommand(bot, update.Message, creatorID)
+		return
+	case "forum":
+		m.handleForumCommand(bot, update.Message, creatorID)
+		return
+	case "setdestination":
+		m.handleSetDestinationCommand(bot, update.Message, creatorID)
+		return
+	case "archive":
+		m.handleArchiveCommand(bot, update.Message, creatorID)
+		return
+	case "reaction":
+		m.handleReactionCommand(bot, update.Message, creatorID)
+		return
+	case "addadmin", "removeadmin":
+		m.handleAdminCommand(bot, update.Message, creatorID)
+		return
+	case "pin", "unpin":
+		m.handlePinCommand(bot, update.Message, creatorID)
+		return
+	case "pending":
+		m.handlePendingCommand(bot, update.Message, creatorID)
+		return
+	case "away", "back":
+		m.handleAwayCommand(bot, update.Message, creatorID)
+		return
+	case "sendat":
+		m.handleSendAtCommand(bot, update.Message, creatorID)
+		return
+	case "usertz":
+		m.handleUserTZCommand(bot, update.Message, creatorID)
+		return
+	case "asktimezone":
+		m.handleAskTimeZoneCommand(bot, update.Message, creatorID)
+		return
+	case "save":
+		m.handleSaveSnippetCommand(bot, update.Message, creatorID)
+		return
+	case "delsnippet":
+		m.handleDeleteSnippetCommand(bot, update.Message, creatorID)
+		return
+	case "snippets":
+		m.handleSnippetsCommand(bot, update.Message, creatorID)
+		return
+	case "r":
+		m.handleSnippetReplyCommand(bot, update.Message, creatorID)
+		return
+	case "privacy":
+		m.handlePrivacyCommand(bot, update.Message, creatorID)
+		return
+	case "forgetuser":
+		m.handleForgetUserCommand(bot, update.Message, creatorID)
+		return
 	case "getbans":
 		// Handle /getbans command
-		var blockedUsers string
-		err := m.db.QueryRow("SELECT blocked_users FROM bots WHERE token = ?", botToken).Scan(&blockedUsers)
-		if err != nil && err != sql.ErrNoRows {
-			log.Printf("Failed to get blocked users for bot %s: %v", botToken, err)
-			bot.Send(tgbotapi.NewMessage(creatorID, "Failed to get blocked users."))
-			return
-		}
-
-		if blockedUsers == "" {
-			bot.Send(tgbotapi.NewMessage(creatorID, "当前没有封禁用户"))
-			return
-		}
-		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("封禁列表: %s", blockedUsers)))
+		m.sendBanList(bot, creatorID, 0)
 		return
 
 	case "ban":
-		// Handle /ban command
-		args := update.Message.CommandArguments()
-		if args == "" {
-			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要封禁的 Telegram ID，例如：/ban 123456"))
-			return
-		}
-		userID, err := strconv.ParseInt(args, 10, 64)
+		// Handle /ban command, either with an ID or as a reply to a forwarded message
+		userID, reason, err := m.commandTarget(botToken, update.Message)
 		if err != nil {
-			bot.Send(tgbotapi.NewMessage(creatorID, "无效的 Telegram ID"))
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要封禁的 Telegram ID，例如：/ban 123456 广告，或回复一条转发消息发送 /ban 广告"))
 			return
 		}
-		if err := m.blockUser(botToken, userID); err != nil {
+		if err := m.blockUser(botToken, userID, reason); err != nil {
 			log.Printf("Failed to block user using /ban command: %v", err)
-			bot.Send(tgbotapi.NewMessage(creatorID, "Failed to block user"))
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to block user")))
 			return
 		}
+		m.logEvent(botToken, from, eventBan, userID, reason)
 		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被封禁", userID)))
 		return
+	case "banchat", "unbanchat", "chatbans":
+		m.handleChatBanCommand(bot, update.Message, creatorID)
+		return
 	case "unban":
 		// Handle /unban command
-		args := update.Message.CommandArguments()
-		if args == "" {
-			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要解封的 Telegram ID，例如：/unban 123456"))
-			return
-		}
-		userID, err := strconv.ParseInt(args, 10, 64)
+		userID, _, err := m.commandTarget(botToken, update.Message)
 		if err != nil {
-			bot.Send(tgbotapi.NewMessage(creatorID, "无效的 Telegram ID"))
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要解封的 Telegram ID，例如：/unban 123456，或回复一条转发消息发送 /unban"))
 			return
 		}
 		if err := m.unblockUser(botToken, userID); err != nil {
 			log.Printf("Failed to unblock user using /unban command: %v", err)
-			bot.Send(tgbotapi.NewMessage(creatorID, "Failed to unblock user"))
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to unblock user")))
 			return
 		}
+		m.logEvent(botToken, from, eventUnban, userID, "")
 		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被解封", userID)))
 		return
+	case "banmany":
+		m.handleBulkModeration(bot, update.Message, creatorID, update.Message.CommandArguments(), true)
+		return
+	case "unbanmany":
+		m.handleBulkModeration(bot, update.Message, creatorID, update.Message.CommandArguments(), false)
+		return
+	case "hours", "vip", "unvip", "urgent":
+		m.handleBusinessHoursCommand(bot, update.Message, creatorID)
+		return
+	case "rules", "label", "unlabel", "labels":
+		m.handleLabelCommand(bot, update.Message, creatorID)
+		return
+	case "setvar", "delvar", "vars":
+		m.handleVarCommand(bot, update.Message, creatorID)
+		return
+	case "alias", "unalias":
+		m.handleAliasCommand(bot, update.Message, creatorID)
+		return
+	case "addcommand", "delcommand", "commands":
+		m.handleCustomCommandAdmin(bot, update.Message, creatorID)
+		return
+	case "codes":
+		m.handleCodesCommand(bot, update.Message, creatorID, update.Message.CommandArguments())
+		return
+	case "poll":
+		m.handlePollCommand(bot, update.Message, creatorID)
+		return
+	case "topics":
+		m.handleTopicsCommand(bot, update.Message, creatorID)
+		return
+	case "broadcast":
+		m.handleBroadcastCommand(bot, update.Message, creatorID)
+		return
+	case "feeds":
+		m.handleFeedsCommand(bot, update.Message, creatorID)
+		return
+	case "schedules":
+		m.handleSchedulesCommand(bot, update.Message, creatorID)
+		return
+	case "limit":
+		m.handleLimitCommand(bot, update.Message, creatorID)
+		return
+	case "approval":
+		m.handleApprovalCommand(bot, update.Message, creatorID)
+		return
+	case "quarantine":
+		m.handleQuarantineCommand(bot, creatorID)
+		return
+	case "risk":
+		m.handleRiskCommand(bot, update.Message, creatorID)
+		return
+	case "webapp":
+		m.handleWebAppCommand(bot, update.Message, creatorID)
+		return
+	case "setmenu":
+		m.handleMenuCommand(bot, update.Message, creatorID)
+		return
+	case "faq":
+		m.handleFAQCommand(bot, update.Message, creatorID)
+		return
+	case "form":
+		m.handleFormCommand(bot, update.Message, creatorID)
+		return
+	case "sentiment":
+		m.handleSentimentCommand(bot, update.Message, creatorID)
+		return
+	case "urgentcontact":
+		m.handleUrgentContactCommand(bot, update.Message, creatorID)
+		return
+	case "mute":
+		// Handle /mute command: stop forwarding without telling the user
+		userID, _, err := m.commandTarget(botToken, update.Message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要静音的 Telegram ID，例如：/mute 123456，或回复一条转发消息发送 /mute"))
+			return
+		}
+		if err := m.muteUser(botToken, userID); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to mute user")))
+			return
+		}
+		m.logEvent(botToken, from, eventMute, userID, "")
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被静音，其消息将不再转发", userID)))
+		return
+	case "unmute":
+		// Handle /unmute command
+		userID, _, err := m.commandTarget(botToken, update.Message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供要取消静音的 Telegram ID，例如：/unmute 123456，或回复一条转发消息发送 /unmute"))
+			return
+		}
+		if err := m.unmuteUser(botToken, userID); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to unmute user")))
+			return
+		}
+		m.logEvent(botToken, from, eventUnmute, userID, "")
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已取消静音", userID)))
+		return
+	case "snoozeuser":
+		m.handleSnoozeCommand(bot, update.Message, creatorID)
+		return
+	case "transcript":
+		m.handleTranscriptCommand(bot, update.Message, creatorID)
+		return
+	case "handled":
+		m.handleHandledCommand(bot, update.Message, creatorID)
+		return
+	case "digest":
+		m.handleDigestCommand(bot, update.Message, creatorID)
+		return
+	case "share":
+		m.handleShareCommand(bot, update.Message, creatorID)
+		return
+	case "info":
+		m.handleInfoCommand(bot, update.Message, creatorID)
+		return
+	case "exporttemplate":
+		m.handleExportTemplateCommand(bot, update.Message, creatorID)
+		return
+	case "applytemplate":
+		m.handleApplyTemplateCommand(bot, update.Message, creatorID, update.Message.CommandArguments())
+		return
+	case "note":
+		// Handle /note command: add a note, or list notes when no text is given
+		userID, text, err := m.commandTarget(botToken, update.Message)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "请提供 Telegram ID 和备注内容，例如：/note 123456 老客户，或回复一条转发消息发送 /note 老客户"))
+			return
+		}
+		if text == "" {
+			notes, err := m.getUserNotes(botToken, userID)
+			if err != nil {
+				bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get notes")))
+				return
+			}
+			bot.Send(tgbotapi.NewMessage(creatorID, formatUserNotes(userID, notes)))
+			return
+		}
+		if err := m.addUserNote(botToken, userID, text); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add note")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已为用户ID: %d 添加备注", userID)))
+		return
+	case "del":
+		m.handleDeleteReplyCommand(bot, update.Message, creatorID)
+		return
+	case "signature":
+		// Handle /signature command: set or clear the signature appended to replies
+		signature := strings.TrimSpace(update.Message.CommandArguments())
+		if signature == "" {
+			current := m.replySignature(botToken, update.Message.From.ID)
+			if current == "" {
+				bot.Send(tgbotapi.NewMessage(creatorID, "当前未设置署名。用法：/signature 客服小王，/signature off 取消署名"))
+			} else {
+				bot.Send(tgbotapi.NewMessage(creatorID, "当前署名：— "+current+"\n发送 /signature off 取消署名"))
+			}
+			return
+		}
+		if strings.EqualFold(signature, "off") {
+			signature = ""
+		}
+		if err := m.setReplySignature(botToken, update.Message.From.ID, signature); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update signature")))
+			return
+		}
+		if signature == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "已取消署名"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "回复将附上署名：— "+signature))
+		}
+		return
 	}
 }
 
-func (m *BotManager) startBot(bot *tgbotapi.BotAPI, creatorID int64) {
-	botToken := bot.Token // Get the bot token here
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	log.Printf("Starting bot with creator ID: %d", creatorID)
-	updates := bot.GetUpdatesChan(u)
+func (m *BotManager) startBot(ctx context.Context, bot *tgbotapi.BotAPI, ownerID int64) {
+	m.pollers.Add(1)
+	defer m.pollers.Done()
+	log.Printf("Starting bot with creator ID: %d", ownerID)
+	updates := m.pollUpdates(ctx, bot)
+
+	appeals := &appealWaitlist{users: make(map[int64]bool)}
+	next := m.dispatchUpdates(bot, updates, func(update botUpdate) {
+		m.handleBotUpdate(bot, ownerID, update, appeals)
+	})
+	// 已拉取的更新全部处理完才保存偏移。交接超时退出时仍在处理的机器人不会走到这里，
+	// 下一个进程从上次保存的偏移继续
+	if next > 0 {
+		m.saveOffset(bot.Token, next)
+	}
+}
+
+// 处理子机器人收到的一条更新，由该机器人的处理协程调用
+func (m *BotManager) handleBotUpdate(bot *tgbotapi.BotAPI, ownerID int64, update botUpdate, appeals *appealWaitlist) {
+	botToken := bot.Token
+	// 创建者休假期间由代理人接收消息和管理机器人
+	creatorID := m.onDutyID(ownerID)
+
+	if update.PollAnswer != nil {
+		m.recordPollAnswer(botToken, update.PollAnswer)
+		return
+	}
+
+	// 因无法联系创建者而暂停的机器人，创建者再次发来消息即说明已解除屏蔽
+	if update.Message != nil && update.Message.From != nil && update.Message.From.ID == ownerID && m.isCreatorUnreachable(botToken) {
+		m.reactivateForCreator(bot, update.Message.From.ID)
+	}
 
-	appeals := make(map[int64]bool)
-	for update := range updates {
+	if m.isBotSuspended(botToken) || m.isBotDeleted(botToken) {
 		if update.Message != nil {
-			log.Printf("Received a message from user ID: %d in chat ID: %d, text: %s", update.Message.From.ID, update.Message.Chat.ID, update.Message.Text)
-
-			userID := update.Message.From.ID
-			if appeals[userID] {
-				appealText := update.Message.Text
-				appealForward := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户 %d 发起申诉: %s", userID, appealText))
-				if _, err := bot.Send(appealForward); err != nil {
-					log.Printf("Failed to send appeal message to creator: %v", err)
-				}
-				log.Printf("Received appeal message from user ID: %d, forwarding to creator.", userID)
-				delete(appeals, userID) // Clear the flag
+			if _, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "服务已暂停")); err != nil {
+				log.Printf("Failed to send suspension notice for bot %s: %v", botIDFromToken(botToken), err)
+			}
+		}
+		return
+	}
 
-				// 增加申诉次数
-				if err := m.incrementAppealCount(botToken, userID); err != nil {
-					log.Printf("Failed to increment appeal count for user %d of bot %s : %v", userID, botToken, err)
-				}
+	if update.MessageReaction != nil {
+		m.handleReaction(bot, ownerID, creatorID, update.MessageReaction)
+		return
+	}
 
-				// 获取申诉次数
-				appealCount := m.getAppealCount(botToken, userID)
-				if appealCount >= 3 {
-					if err := m.blockUser(botToken, userID); err != nil {
-						log.Printf("Failed to block user using /ban command: %v", err)
-					}
-					noAppealMsg := tgbotapi.NewMessage(userID, "你的申诉次数已达上限，已被永久封禁。")
-					if _, err := bot.Send(noAppealMsg); err != nil {
-						log.Printf("Failed to send no appeal message to user %d of bot %s : %v", userID, botToken, err)
-					}
-				}
+	// 论坛群组中的消息不是用户消息，只处理管理员在话题中的回复
+	if forumID := m.forumChatID(botToken); forumID != 0 {
+		if update.Message != nil && update.Message.Chat.ID == forumID {
+			m.handleForumMessage(bot, update.Message, update.MessageThreadID, update.TopicService)
+			return
+		}
+		if update.EditedMessage != nil && update.EditedMessage.Chat.ID == forumID {
+			return
+		}
+	}
+	// 转交群组中成员的回复交给用户，编辑回复时同步修改
+	if groupID := m.destinationChatID(botToken); groupID != 0 {
+		if update.Message != nil && update.Message.Chat.ID == groupID {
+			m.handleDestinationMessage(bot, update.Message)
+			return
+		}
+		if update.EditedMessage != nil && update.EditedMessage.Chat.ID == groupID {
+			m.syncEditedReply(bot, update.EditedMessage)
+			return
+		}
+	}
 
-				continue
+	if update.EditedMessage != nil {
+		m.handleEditedMessage(bot, update.EditedMessage, ownerID, creatorID)
+		return
+	}
+
+	if update.Message != nil && m.fromBlockedChat(botToken, update.Message) {
+		log.Printf("Chat ID: %d is blocked for bot %s, not forwarding message.", update.Message.Chat.ID, botIDFromToken(botToken))
+		return
+	}
+
+	if update.Message != nil && m.filterServiceMessage(bot, update.Message, creatorID) {
+		return
+	}
+
+	if update.Message != nil && isChatSender(update.Message) {
+		m.handleChatSenderMessage(bot, update.Message, creatorID)
+		return
+	}
+
+	if update.Message != nil {
+		log.Printf("Received a message from user ID: %d in chat ID: %d, text: %s", update.Message.From.ID, update.Message.Chat.ID, update.Message.Text)
+
+		userID := update.Message.From.ID
+		isAdmin := userID == ownerID || userID == creatorID
+		// 通过 /addadmin 添加的管理员和创建者一样直接回复用户，管理命令仍按角色判断权限
+		isBotAdmin := !isAdmin && m.isBotAdmin(botToken, userID)
+		if !isAdmin && !isBotAdmin {
+			m.recordUser(botToken, update.Message.From)
+		}
+		if appeals.take(userID) {
+			appealText := update.Message.Text
+			appealForward := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户 %d 发起申诉: %s", userID, appealText))
+			if sent, err := bot.Send(appealForward); err != nil {
+				log.Printf("Failed to send appeal message to creator: %v", err)
+			} else {
+				m.saveMessageMapping(botToken, sent.MessageID, userID, update.Message.MessageID)
 			}
+			log.Printf("Received appeal message from user ID: %d, forwarding to creator.", userID)
+			m.recordAppeal(botToken, userID, appealText)
 
-			if update.Message.IsCommand() && update.Message.From.ID == creatorID {
-				m.handleBotCommands(bot, &update, creatorID)
-				continue
-			} else if update.Message.IsCommand() {
-				m.handleBotCommands(bot, &update, creatorID)
-				continue
+			// 增加申诉次数
+			if err := m.incrementAppealCount(botToken, userID); err != nil {
+				log.Printf("Failed to increment appeal count for user %d of bot %s : %v", userID, botIDFromToken(botToken), err)
 			}
 
-			if update.Message.From.ID == creatorID {
-				m.handleReplyMessage(bot, update.Message)
-			} else {
-				m.handleIncomingMessage(bot, update.Message, creatorID, bot, botToken)
+			// 获取申诉次数
+			appealCount := m.getAppealCount(botToken, userID)
+			if appealCount >= 3 {
+				if err := m.blockUser(botToken, userID, "申诉次数已达上限"); err != nil {
+					log.Printf("Failed to block user using /ban command: %v", err)
+				} else {
+					m.logEvent(botToken, 0, eventBan, userID, "申诉次数已达上限")
+				}
+				m.resolveAppeals(botToken, userID, appealRejected)
+				noAppealMsg := tgbotapi.NewMessage(userID, "你的申诉次数已达上限，已被永久封禁。")
+				if _, err := bot.Send(noAppealMsg); err != nil {
+					log.Printf("Failed to send no appeal message to user %d of bot %s : %v", userID, botIDFromToken(botToken), err)
+				}
+			}
+
+			return
+		}
+
+		if update.WebAppData != nil && !isAdmin {
+			m.handleWebAppData(bot, update.Message, update.WebAppData, creatorID)
+			return
+		}
+
+		m.resolveCommandAlias(botToken, update.Message)
+
+		if command, args, ok := bulkCaptionCommand(update.Message); ok && (userID == ownerID || m.botCan(botToken, userID, botCommandPermission(command))) {
+			replyTo := creatorID
+			if !isAdmin {
+				replyTo = userID
 			}
-		} else if update.CallbackQuery != nil {
-			// Handle button clicks
-			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
-			if _, err := bot.Request(callback); err != nil {
-				log.Printf("Error processing callback: %v", err)
-				continue
+			if command == "codes" {
+				m.handleCodesCommand(bot, update.Message, replyTo, args)
+			} else if command == "applytemplate" {
+				m.handleApplyTemplateCommand(bot, update.Message, replyTo, args)
+			} else {
+				m.handleBulkModeration(bot, update.Message, replyTo, args, command == "banmany")
 			}
+			return
+		}
 
-			callbackData := update.CallbackQuery.Data
-			log.Printf("Received a callback query with data: %s", callbackData)
+		if update.Message.IsCommand() && isAdmin {
+			m.handleBotCommands(bot, &update.Update, creatorID)
+			return
+		} else if update.Message.IsCommand() {
+			m.handleBotCommands(bot, &update.Update, creatorID)
+			return
+		}
 
-			if strings.HasPrefix(callbackData, "appeal_") {
-				userIDStr := strings.TrimPrefix(callbackData, "appeal_")
-				userID, err := strconv.ParseInt(userIDStr, 10, 64)
-				if err != nil {
-					log.Printf("Invalid userID in callback: %v", err)
-					continue
-				}
+		if isAdmin || isBotAdmin {
+			m.handleReplyMessage(bot, update.Message)
+		} else {
+			m.handleIncomingMessage(bot, update.Message, creatorID, bot, botToken)
+		}
+	} else if update.CallbackQuery != nil {
+		// Handle button clicks
+		log.Printf("Received a callback query with data: %s", update.CallbackQuery.Data)
+		cb, ok := parseCallback(botToken, update.CallbackQuery.Data, callbackSentAt(update.CallbackQuery))
+		if !ok {
+			log.Printf("Rejected callback query with invalid data from user ID: %d for bot %s", update.CallbackQuery.From.ID, botIDFromToken(botToken))
+			bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+			return
+		}
+		if !m.callbackAllowed(botToken, update.CallbackQuery.From.ID, cb) {
+			log.Printf("Denied callback %s from user ID: %d for bot %s", cb.Action, update.CallbackQuery.From.ID, botIDFromToken(botToken))
+			bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "无权限"))
+			return
+		}
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
+		if _, err := bot.Request(callback); err != nil {
+			log.Printf("Error processing callback: %v", err)
+			return
+		}
 
-				if m.getAppealCount(botToken, userID) >= 3 {
-					noAppealMsg := tgbotapi.NewMessage(userID, "你的申诉次数已达上限，已被永久封禁。")
-					if _, err := bot.Send(noAppealMsg); err != nil {
-						log.Printf("Failed to send no appeal message to user %d of bot %s : %v", userID, botToken, err)
-					}
-					continue
-				}
+		if m.handleBanListCallback(bot, update.CallbackQuery, cb) {
+			return
+		}
+		if m.handleConfirmCallback(bot, update.CallbackQuery, cb) {
+			return
+		}
+		if m.handleChatBanCallback(bot, update.CallbackQuery, cb) {
+			return
+		}
+		if m.handleTopicCallback(bot, update.CallbackQuery, cb) {
+			return
+		}
+		if m.handleFormCallback(bot, update.CallbackQuery, cb, creatorID) {
+			return
+		}
+		if m.handleFAQCallback(bot, update.CallbackQuery, cb, creatorID) {
+			return
+		}
+		if m.handleQuarantineCallback(bot, update.CallbackQuery, cb, creatorID) {
+			return
+		}
+		if m.handleApprovalCallback(bot, update.CallbackQuery, cb, creatorID) {
+			return
+		}
+
+		if cb.Action == cbAppeal {
+			userID := update.CallbackQuery.From.ID
 
-				// Send a message asking for appeal information
-				appealMsg := tgbotapi.NewMessage(userID, "请在此输入你的申诉信息：")
-				if _, err := bot.Send(appealMsg); err != nil {
-					log.Printf("Failed to send appeal message to user: %v", err)
-					continue
+			if m.getAppealCount(botToken, userID) >= 3 {
+				noAppealMsg := tgbotapi.NewMessage(userID, "你的申诉次数已达上限，已被永久封禁。")
+				if _, err := bot.Send(noAppealMsg); err != nil {
+					log.Printf("Failed to send no appeal message to user %d of bot %s : %v", userID, botIDFromToken(botToken), err)
 				}
-				appeals[userID] = true
+				return
+			}
 
-				continue
+			// Send a message asking for appeal information
+			appealMsg := tgbotapi.NewMessage(userID, "请在此输入你的申诉信息：")
+			if _, err := bot.Send(appealMsg); err != nil {
+				log.Printf("Failed to send appeal message to user: %v", err)
+				return
 			}
+			appeals.add(userID)
 
-			if strings.HasPrefix(callbackData, "ban_") {
-				userIDStr := strings.TrimPrefix(callbackData, "ban_")
-				userID, err := strconv.ParseInt(userIDStr, 10, 64)
-				if err != nil {
-					log.Printf("Invalid userID in callback: %v", err)
-					continue
-				}
-				log.Printf("Creator requested to ban user ID: %d for bot %s", userID, botToken)
+			return
+		}
 
-				// 将用户添加到黑名单
-				if err := m.blockUser(botToken, userID); err != nil {
-					log.Printf("Failed to block user: %v", err)
-					continue
-				}
+		if cb.Action == cbBan {
+			userID, ok := cb.int(0)
+			if !ok {
+				log.Printf("Invalid userID in callback: %s", update.CallbackQuery.Data)
+				return
+			}
+			log.Printf("Creator requested to ban user ID: %d for bot %s", userID, botIDFromToken(botToken))
 
-				banMsg := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被封禁", userID))
-				if _, err := bot.Send(banMsg); err != nil {
-					log.Printf("Failed to send ban confirmation message to creator: %v", err)
-				}
-			} else if strings.HasPrefix(callbackData, "unban_") {
-				userIDStr := strings.TrimPrefix(callbackData, "unban_")
-				userID, err := strconv.ParseInt(userIDStr, 10, 64)
-				if err != nil {
-					log.Printf("Invalid userID in callback: %v", err)
-					continue
-				}
-				log.Printf("Creator requested to unban user ID: %d for bot %s", userID, botToken)
-				// 将用户从黑名单删除
-				if err := m.unblockUser(botToken, userID); err != nil {
-					log.Printf("Failed to unblock user: %v", err)
-					continue
-				}
-				unbanMsg := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被解禁", userID))
-				if _, err := bot.Send(unbanMsg); err != nil {
-					log.Printf("Failed to send unban confirmation message to creator: %v", err)
-				}
+			// 将用户添加到黑名单
+			if err := m.blockUser(botToken, userID, ""); err != nil {
+				log.Printf("Failed to block user: %v", err)
+				return
+			}
+			m.logEvent(botToken, update.CallbackQuery.From.ID, eventBan, userID, "")
+
+			banMsg := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被封禁", userID))
+			if _, err := bot.Send(banMsg); err != nil {
+				log.Printf("Failed to send ban confirmation message to creator: %v", err)
+			}
+		} else if cb.Action == cbUnban {
+			userID, ok := cb.int(0)
+			if !ok {
+				log.Printf("Invalid userID in callback: %s", update.CallbackQuery.Data)
+				return
+			}
+			log.Printf("Creator requested to unban user ID: %d for bot %s", userID, botIDFromToken(botToken))
+			// 将用户从黑名单删除
+			if err := m.unblockUser(botToken, userID); err != nil {
+				log.Printf("Failed to unblock user: %v", err)
+				return
+			}
+			m.logEvent(botToken, update.CallbackQuery.From.ID, eventUnban, userID, "")
+			unbanMsg := tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已被解禁", userID))
+			if _, err := bot.Send(unbanMsg); err != nil {
+				log.Printf("Failed to send unban confirmation message to creator: %v", err)
 			}
 		}
 	}
 }
 
 func (m *BotManager) handleIncomingMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64, botAPI *tgbotapi.BotAPI, botToken string) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	// 评分、自动回答等步骤可能需要访问网络，处理较慢时让用户知道机器人仍在工作
+	defer m.chatActionHeartbeat(bot, message.Chat.ID)()
 
 	userID := message.From.ID
 
+	if m.isGloballyBlocked(m.creatorOf(botToken), userID) {
+		log.Printf("User ID: %d is on the global blacklist, not forwarding message for bot %s.", userID, botIDFromToken(botToken))
+		blockedMsg := tgbotapi.NewMessage(userID, "你已被封禁，无法发送消息。")
+		if _, err := botAPI.Send(blockedMsg); err != nil {
+			log.Printf("Failed to send blocked message to user: %v", err)
+		}
+		return
+	}
+
 	if m.isUserBlocked(botToken, userID) {
-		log.Printf("User ID: %d is blocked for bot %s, not forwarding message.", userID, botToken)
+		log.Printf("User ID: %d is blocked for bot %s, not forwarding message.", userID, botIDFromToken(botToken))
 
 		if m.getAppealCount(botToken, userID) >= 3 {
 			blockedMsg := tgbotapi.NewMessage(userID, "你已被永久封禁，无法发送消息。")
@@ -497,7 +982,7 @@ func (m *BotManager) handleIncomingMessage(bot *tgbotapi.BotAPI, message *tgbota
 		}
 
 		// Create inline keyboard for appeal
-		appealButton := tgbotapi.NewInlineKeyboardButtonData("误伤了？申诉一下", fmt.Sprintf("appeal_%d", userID))
+		appealButton := tgbotapi.NewInlineKeyboardButtonData("误伤了？申诉一下", signCallback(botToken, cbAppeal, userID))
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(appealButton))
 
 		blockedMsg := tgbotapi.NewMessage(userID, "你已被封禁，无法发送消息。")
@@ -509,88 +994,448 @@ func (m *BotManager) handleIncomingMessage(bot *tgbotapi.BotAPI, message *tgbota
 		return
 	}
 
-	log.Printf("Forwarding message from user ID: %d to creator ID: %d", message.From.ID, creatorID)
+	if m.isUserMuted(botToken, userID) {
+		log.Printf("User ID: %d is muted for bot %s, not forwarding message.", userID, botIDFromToken(botToken))
+		return
+	}
+
+	if m.isOptedOut(botToken, userID) {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, optedOutNotice))
+		return
+	}
+
+	m.logConversation(botToken, userID, true, message)
+
+	if m.routeMenuIntent(bot, message) {
+		return
+	}
+
+	if m.handleFormMessage(bot, message, creatorID) {
+		return
+	}
+
+	m.applyLabelRules(bot, creatorID, message)
+
+	if m.answerFAQ(bot, message) {
+		return
+	}
+
+	if m.snoozeMessage(bot, message) {
+		return
+	}
+
+	if m.holdForApproval(bot, creatorID, message) {
+		return
+	}
+
+	if m.throttleUser(bot, message) {
+		return
+	}
+
+	if m.queueOutsideHours(bot, message) {
+		return
+	}
+
+	type riskResult struct {
+		score   int
+		reasons []string
+	}
+	var timedOut []string
+	risk, ok := runStage(m, botToken, stageRisk, func() riskResult {
+		score, reasons := m.riskScore(bot, message)
+		return riskResult{score, reasons}
+	})
+	if !ok {
+		timedOut = append(timedOut, stageRisk)
+	}
+	score, reasons := risk.score, risk.reasons
+	if m.quarantineRisky(bot, message, score, reasons) {
+		return
+	}
+
+	if keyword, urgent := matchKeyword(message.Text+" "+message.Caption, m.getUrgentKeywords(botToken)); urgent {
+		if headerID := m.escalateUrgent(bot, creatorID, message, keyword); headerID != 0 {
+			m.saveMessageMapping(botToken, headerID, userID, message.MessageID)
+		}
+	}
+
+	m.sendAwayReply(bot, message)
+	m.askTimeZone(bot, message)
+
+	// 论坛模式下转交到群组，附加的标注都回复在转交的消息上，因此落在用户的话题中
+	dest := m.relayChat(botToken, creatorID)
+	log.Printf("Forwarding message from user ID: %d to chat ID: %d", message.From.ID, dest)
+	if message.MediaGroupID != "" {
+		m.bufferAlbum(bot, dest, message)
+		return
+	}
 	// Forward message to creator
-	msg := tgbotapi.NewForward(creatorID, message.Chat.ID, message.MessageID)
-	if _, err := bot.Send(msg); err != nil {
+	sentID, err := m.relayToCreator(bot, dest, message.Chat.ID, message.MessageID, message.From)
+	if ownerID := m.creatorOf(botToken); dest > 0 && dest != ownerID {
+		if m.recordSubstituteDelivery(bot, ownerID, dest, err) {
+			dest = ownerID
+			sentID, err = m.relayToCreator(bot, dest, message.Chat.ID, message.MessageID, message.From)
+			m.recordCreatorDelivery(bot, dest, err)
+		}
+	} else {
+		m.recordCreatorDelivery(bot, dest, err)
+	}
+	if err != nil {
 		log.Printf("Error forwarding message: %v", err)
 	} else {
+		m.saveMessageMapping(botToken, sentID, userID, message.MessageID)
+		metrics.inc("forwardme_messages_forwarded_total", "bot", botIDFromToken(botToken))
+		m.meter(botToken, usageRelayed, 1)
 		log.Println("Message forwarded successfully.")
+		m.archiveIncoming(bot, message.From, message.Chat.ID, message.MessageID)
+		if m.sentimentEnabled(botToken) {
+			m.tagSentiment(bot, dest, sentID, message)
+		}
+		m.tagRisk(bot, dest, sentID, message, score, reasons)
+		m.annotateTimeouts(bot, dest, sentID, message, timedOut)
+		m.attachForwardTools(bot, dest, sentID, userID, message.MessageID)
+		m.relayToAdmins(bot, dest, message.From, message.Chat.ID, message.MessageID)
 	}
 }
 
 func (m *BotManager) handleReplyMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
-	// Confirm ReplyToMessage and its properties are available
-	if message.ReplyToMessage != nil && message.ReplyToMessage.ForwardFrom != nil {
-		originalSenderID := message.ReplyToMessage.ForwardFrom.ID
+	// 用户开启了转发隐私时 ForwardFrom 为空，先按映射表查找原始用户
+	if originalSenderID, ok := m.resolveReplyTarget(bot.Token, message); ok {
 		log.Printf("Attempting to reply to user ID: %d", originalSenderID)
-
-		// Send reply
-		replyMsg := tgbotapi.NewMessage(originalSenderID, message.Text)
-		if _, err := bot.Send(replyMsg); err != nil {
-			log.Printf("Error sending reply message: %v", err)
-		} else {
-			log.Printf("Reply sent successfully to user ID: %d", originalSenderID)
+		// 管理员私聊中的消息 ID 会与创建者的重复，他们的回复不支持撤回和同步编辑
+		creatorMessageID := message.MessageID
+		if m.isBotAdmin(bot.Token, message.From.ID) {
+			creatorMessageID = 0
 		}
+		m.deliverReply(bot, message, originalSenderID, creatorMessageID)
+	} else if message.ReplyToMessage != nil && message.ReplyToMessage.ForwardFromChat != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "这条消息来自频道或匿名管理员，无法回复"))
 	} else {
 		log.Println("Message is a reply but no forward information is available.")
 	}
 }
 
-func (m *BotManager) DeleteBot(token string) {
-	log.Printf("Attempting to delete bot with token: %s", token)
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	delete(m.bots, token)
-	delete(m.creator, token)
-	log.Printf("Bot with token %s removed from manager's in-memory storage.", token)
+// 把创建者或管理员的一条消息作为回复发给用户。creatorMessageID 记录在回复日志中，
+// 用于撤回和同步编辑，为 0 时不支持
+func (m *BotManager) deliverReply(bot *tgbotapi.BotAPI, message *tgbotapi.Message, userID int64, creatorMessageID int) {
+	signature := m.replySignature(bot.Token, message.From.ID)
+	replyMsg := replyConfig(userID, message, func(text string) string {
+		return signReply(m.expandUserVars(bot.Token, userID, text), signature)
+	})
+	m.sendReply(bot, message, replyMsg, userID, creatorMessageID)
+}
 
-	_, err := m.db.Exec("DELETE FROM bots WHERE token = ?", token)
+// 发送已生成的回复，记录投递结果、回复日志、存档、对话记录和审计日志。
+// message 是创建者一侧的消息，失败时提示回复在它上面
+func (m *BotManager) sendReply(bot *tgbotapi.BotAPI, message *tgbotapi.Message, replyMsg tgbotapi.Chattable, userID int64, creatorMessageID int) {
+	// 用户当地正值深夜时不发出提醒
+	if m.userAsleep(bot.Token, userID, time.Now()) {
+		replyMsg = silenced(replyMsg)
+	}
+	sent, err := bot.Send(replyMsg)
+	if isFileIDError(err) {
+		log.Printf("File of reply to user %d was rejected for bot %s, uploading it instead: %v", userID, botIDFromToken(bot.Token), err)
+		sent, err = m.resendWithUpload(bot, replyMsg, messageFileName(message))
+	}
+	if m.recordDelivery(bot.Token, userID, err) {
+		m.notifyUnreachable(bot, m.creatorOf(bot.Token), userID)
+	}
 	if err != nil {
-		log.Printf("Failed to delete bot with token %s from database: %v", token, err)
+		log.Printf("Error sending reply message: %v", err)
+		errMsg := tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to send reply"))
+		errMsg.ReplyToMessageID = message.MessageID
+		errMsg.AllowSendingWithoutReply = true
+		bot.Send(errMsg)
+		return
+	}
+	m.recordReply(bot.Token, userID, message.From.ID, sent.MessageID, creatorMessageID)
+	m.archiveOutgoing(bot, message.From, userID, sent.MessageID)
+	m.logConversation(bot.Token, userID, false, message)
+	m.logEvent(bot.Token, message.From.ID, eventReply, userID, m.storedPreview(bot.Token, message))
+	metrics.inc("forwardme_replies_sent_total", "bot", botIDFromToken(bot.Token))
+	m.meter(bot.Token, usageRelayed, 1)
+	log.Printf("Reply sent successfully to user ID: %d", userID)
+}
+
+// 处理 /newbot，创建者即发送命令的聊天
+func (m *BotManager) registerBot(managerBot *tgbotapi.BotAPI, chatID, fromID int64, token string) {
+	if m.botDeletedAt(token) > 0 {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "该机器人已被删除，创建者可以在 7 天内发送 /restorebot 恢复"))
+		return
+	}
+	brandName := m.brandName(managerBot)
+	if m.creatorOf(token) != 0 && m.botBrand(token) != brandName {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "该机器人已通过其他管理机器人添加"))
+		return
+	}
+	if err := m.checkBotLimit(chatID, token); err != nil {
+		managerBot.Send(tgbotapi.NewMessage(chatID, planLimitMessage(err, "Failed to create new bot: "+err.Error())))
+		return
+	}
+	if m.isBotRunning(token) && m.creatorOf(token) == chatID {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "该机器人已在运行，无需重新添加"))
+		return
+	}
+	if err := m.AddBot(token, chatID); err == errBotOwnedByOther {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "该机器人已由其他创建者添加"))
+	} else if err != nil {
+		log.Printf("Failed to create new bot using command from user ID: %d, error: %v", fromID, err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, "Failed to create new bot: "+err.Error()))
 	} else {
-		log.Printf("Bot with token %s deleted from the database successfully.", token)
+		if _, err := m.db.Exec("UPDATE bots SET brand = ? WHERE token = ?", brandName, token); err != nil {
+			log.Printf("Failed to record brand of bot %s: %v", botIDFromToken(token), err)
+		}
+		managerBot.Send(tgbotapi.NewMessage(chatID, "New bot created successfully!"))
+		log.Printf("New bot created successfully using command from user ID: %d", fromID)
+	}
+}
+
+// 处理 /deletebot，只有创建者和运营者可以删除，需要输入机器人用户名确认
+func (m *BotManager) confirmDeleteBot(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message, ref string) {
+	chatID, fromID := message.Chat.ID, message.From.ID
+	token, ok := m.findBotToken(ref)
+	if !ok || m.botDeletedAt(token) > 0 || !m.inBrand(managerBot, token, fromID) {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "未找到该机器人，请提供 token、机器人 ID 或 @用户名，例如：/deletebot @example_bot"))
+		return
+	}
+	var creatorID int64
+	m.db.QueryRow("SELECT creator_id FROM bots WHERE token = ?", token).Scan(&creatorID)
+	if creatorID != fromID && !m.instanceCan(fromID, permManage) {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "无权限"))
+		return
+	}
+
+	name := m.botUsername(token)
+	prompt := "即将删除 " + name + "，机器人会立即停止服务。7 天内可以用 /restorebot 恢复，之后全部数据（封禁列表、用户、消息记录和设置）会被彻底删除。"
+	m.askTypedConfirmation(managerBot, chatID, fromID, prompt, name, func() {
+		if err := m.DeleteBot(token); err != nil {
+			log.Printf("Failed to delete bot %s: %v", botIDFromToken(token), err)
+			managerBot.Send(tgbotapi.NewMessage(chatID, "Failed to delete bot: "+err.Error()))
+			return
+		}
+		m.logEvent("", fromID, eventDeleteBot, 0, botIDFromToken(token))
+		managerBot.Send(tgbotapi.NewMessage(chatID, "Bot deleted successfully! 7 天内发送 /restorebot "+name+" 可以恢复。"))
+		log.Printf("Bot deleted successfully using command from user ID: %d", fromID)
+	})
+}
+
+// 处理管理机器人收到的一条更新
+func (m *BotManager) handleManagerUpdate(managerBot *tgbotapi.BotAPI, update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		cb, ok := parseCallback(m.managerCallbackKey(), update.CallbackQuery.Data, callbackSentAt(update.CallbackQuery))
+		if !ok {
+			log.Printf("Rejected callback query with invalid data from user ID: %d for the manager bot", update.CallbackQuery.From.ID)
+			managerBot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+			return
+		}
+		if !m.callbackAllowed("", update.CallbackQuery.From.ID, cb) {
+			log.Printf("Denied callback %s from user ID: %d for the manager bot", cb.Action, update.CallbackQuery.From.ID)
+			managerBot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "无权限"))
+			return
+		}
+		if !m.handleReportCallback(managerBot, update.CallbackQuery, cb) {
+			m.handleTosCallback(managerBot, update.CallbackQuery, cb)
+		}
+		return
+	}
+	if update.PreCheckoutQuery != nil {
+		m.handlePreCheckout(managerBot, update.PreCheckoutQuery)
+		return
+	}
+	if update.Message != nil && update.Message.SuccessfulPayment != nil {
+		m.handleSuccessfulPayment(managerBot, update.Message)
+		return
+	}
+	if update.Message != nil && !update.Message.IsCommand() && m.handleTypedConfirmation(managerBot, update.Message) {
+		return
+	}
+	if update.Message != nil && update.Message.IsCommand() {
+		log.Printf("Received a command: %s from user ID: %d in chat ID: %d", update.Message.Command(), update.Message.From.ID, update.Message.Chat.ID)
+		args := update.Message.CommandArguments()
+		switch update.Message.Command() {
+		case "newbot":
+			if m.needsTosAcceptance(managerBot, update.Message.From.ID) {
+				m.promptTos(managerBot, update.Message.Chat.ID, update.Message.From.ID, args)
+				return
+			}
+			m.registerBot(managerBot, update.Message.Chat.ID, update.Message.From.ID, args)
+		case "deletebot":
+			m.confirmDeleteBot(managerBot, update.Message, args)
+		case "restorebot":
+			m.handleRestoreBot(managerBot, update.Message, args)
+		case "globalblacklist":
+			// 创建者可以选择不使用运营者维护的全局黑名单
+			var optOut bool
+			switch strings.ToLower(strings.TrimSpace(args)) {
+			case "on":
+				optOut = false
+			case "off":
+				optOut = true
+			default:
+				managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "用法：/globalblacklist on 或 /globalblacklist off"))
+				return
+			}
+			if err := m.setGlobalBlacklistOptOut(update.Message.From.ID, optOut); err != nil {
+				managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, friendlyError(err, "Failed to update preference.")))
+				return
+			}
+			if optOut {
+				managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "你的机器人将不再使用全局黑名单"))
+			} else {
+				managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "你的机器人将使用全局黑名单"))
+			}
+		case "vacation":
+			m.handleVacationCommand(managerBot, update.Message)
+		case "subscribe":
+			m.handlePlanSubscribeCommand(managerBot, update.Message)
+		case "unsubscribe":
+			m.handlePlanUnsubscribeCommand(managerBot, update.Message)
+		default:
+			m.handleOperatorCommand(managerBot, update.Message)
+		}
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		runLoadTestCLI(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "e2e" {
+		runE2ECLI()
+		return
+	}
+	setupLogFile()
+
 	// err := godotenv.Load()
 	// if err != nil {
 	// 	log.Fatalf("Error loading .env file: %v", err)
 	// }
 
-	managerToken := os.Getenv("MANAGER_BOT_TOKEN")
-	managerBot, err := tgbotapi.NewBotAPI(managerToken)
-	if err != nil {
-		log.Fatalf("Failed to create manager bot: %s", err)
-	}
-	log.Println("Manager bot created successfully.")
-
-	db, err := sql.Open("sqlite", "data/bots.db")
+	db, err := sql.Open("sqlite", "data/bots.db"+sqliteOptions)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 	log.Println("Database connection established.")
+	logStartupBanner()
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS bots (
-	token TEXT PRIMARY KEY,
-	creator_id INTEGER,
-	blocked_users TEXT DEFAULT "",
-	appeal_counts TEXT DEFAULT ""
-   )`)
-	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+	if err := initSchema(db); err != nil {
+		log.Fatalf("Failed to create tables: %v", err)
 	}
-	log.Println("Database table 'bots' created or already exists.")
+	integrityReport := startupIntegrityCheck(db, os.Getenv("INTEGRITY_REPAIR") == "true")
 
 	manager := NewBotManager(db)
-	log.Println("Bot manager initialized.")
+	manager.operators = parseIDEnv(os.Getenv("OPERATOR_IDS"))
+	manager.auditors = parseIDEnv(os.Getenv("AUDITOR_IDS"))
+	manager.tosVersion = os.Getenv("TOS_VERSION")
+	manager.tosText = os.Getenv("TOS_TEXT")
+	manager.deleteWebhook = os.Getenv("DELETE_WEBHOOK") != "false"
+	manager.adaptivePolling = os.Getenv("ADAPTIVE_POLLING") != "false"
+	if n, err := strconv.Atoi(os.Getenv("BOT_WORKERS")); err == nil && n > 0 {
+		manager.botWorkers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BOT_QUEUE_DEPTH")); err == nil && n > 0 {
+		manager.botQueueDepth = n
+	}
+	manager.apiEndpoint = os.Getenv("BOT_API_ENDPOINT")
+	manager.telegraph.token = os.Getenv("TELEGRAPH_TOKEN")
+	manager.dashboardURL = strings.TrimSuffix(os.Getenv("DASHBOARD_URL"), "/")
+	if plan := os.Getenv("DEFAULT_PLAN"); plan != "" {
+		if _, ok := plans[plan]; !ok {
+			log.Fatalf("Unknown DEFAULT_PLAN %q", plan)
+		}
+		manager.defaultPlan = plan
+	}
+	if stars, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_STARS")); err == nil && stars > 0 {
+		manager.subscriptionStars = stars
+	}
+	manager.stageTimeouts = parseStageTimeouts(os.Getenv("STAGE_TIMEOUTS"))
+	manager.apiToken = os.Getenv("API_TOKEN")
+	manager.idempotencyWindow = defaultIdempotencyWindow
+	if hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_HOURS")); err == nil && hours > 0 {
+		manager.idempotencyWindow = time.Duration(hours) * time.Hour
+	}
+	legacyDays := defaultLegacyCallbackDays
+	if days, err := strconv.Atoi(os.Getenv("LEGACY_CALLBACK_DAYS")); err == nil && days >= 0 {
+		legacyDays = days
+	}
+	if legacyCallbacks, err = loadLegacyCallbackWindow(db, legacyDays, time.Now()); err != nil {
+		log.Printf("Failed to load the legacy callback window, rejecting unsigned buttons: %v", err)
+	}
+
+	log.Printf("Bot manager initialized with %d operator(s).", len(manager.operators))
+
+	// 旧进程仍在运行时等它交接，再开始轮询和后台任务
+	waitForHandoff(db)
+	if err := claimInstance(db); err != nil {
+		log.Printf("Failed to register instance: %v", err)
+	}
+	go manager.runHandoffWatch()
+
+	shutdownGrace := defaultShutdownGrace
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_GRACE_SECONDS")); err == nil && seconds > 0 {
+		shutdownGrace = time.Duration(seconds) * time.Second
+	}
+	go manager.handleShutdownSignals(shutdownGrace)
+	go manager.runSystemdWatchdog()
+
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		go manager.startHTTPServer(addr)
+		go manager.runIdempotencyCleanup()
+	}
+
+	alertAfter := defaultBotAlertAfter
+	if minutes, err := strconv.Atoi(os.Getenv("BOT_ALERT_MINUTES")); err == nil && minutes > 0 {
+		alertAfter = time.Duration(minutes) * time.Minute
+	}
+	go manager.runHealthWatchdog(alertAfter)
+	go manager.runQueueDelivery()
+	go manager.runThrottleDelivery()
+	go manager.runScheduler()
+	go manager.runRetentionPurge()
+	go manager.runTrashCleanup()
+	go manager.runUserWriteFlush()
+	go manager.runUsageFlush()
+	go manager.runSubscriptionExpiry()
+
+	if botToken := os.Getenv("BOT_TOKEN"); botToken != "" {
+		if err := runStandalone(manager, botToken, os.Getenv("OWNER_ID")); err != nil {
+			log.Fatalf("Failed to start standalone bot: %v", err)
+		}
+		return
+	}
+
+	managerToken := os.Getenv("MANAGER_BOT_TOKEN")
+	managerBot, err := manager.newBotAPI(managerToken)
+	if err != nil {
+		log.Fatalf("Failed to create manager bot: %s", err)
+	}
+	manager.managerBot = managerBot
+	log.Println("Manager bot created successfully.")
+
+	var backupBot *tgbotapi.BotAPI
+	if backupToken := os.Getenv("BACKUP_MANAGER_BOT_TOKEN"); backupToken != "" {
+		backupBot, err = manager.newBotAPI(backupToken)
+		if err != nil {
+			log.Fatalf("Failed to create backup manager bot: %s", err)
+		}
+		manager.backupManagerBot = backupBot
+		log.Println("Backup manager bot created successfully.")
+	}
+	if err := manager.loadBrands(); err != nil {
+		log.Fatalf("Failed to create brand manager bot: %s", err)
+	}
+	if integrityReport != "" {
+		manager.notifyOperators(integrityReport, nil)
+	}
+	if os.Getenv("RELEASE_CHECK") == "true" {
+		go manager.runReleaseCheck()
+	}
 
 	// Load existing bots from database
 	log.Println("Loading existing bots from the database...")
-	rows, err := db.Query("SELECT token, creator_id FROM bots")
+	rows, err := db.Query("SELECT token, creator_id FROM bots WHERE deleted_at = 0")
 	if err != nil {
 		log.Fatalf("Failed to load bots: %v", err)
 	}
@@ -605,35 +1450,22 @@ func main() {
 		if err := manager.AddBot(token, creatorID); err != nil {
 			log.Printf("Failed to add bot from database: %v", err)
 		} else {
-			log.Printf("Bot with token %s loaded from database and added to the manager.", token)
+			log.Printf("Bot %s loaded from database and added to the manager.", botIDFromToken(token))
 		}
 	}
 	log.Println("Existing bots loaded from database.")
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := managerBot.GetUpdatesChan(u)
-	log.Println("Manager bot started listening for updates.")
-
-	for update := range updates {
-		if update.Message != nil && update.Message.IsCommand() {
-			log.Printf("Received a command: %s from user ID: %d in chat ID: %d", update.Message.Command(), update.Message.From.ID, update.Message.Chat.ID)
-			args := update.Message.CommandArguments()
-			switch update.Message.Command() {
-			case "newbot":
-				if err := manager.AddBot(args, update.Message.Chat.ID); err != nil {
-					log.Printf("Failed to create new bot using command from user ID: %d, error: %v", update.Message.From.ID, err)
-					managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "Failed to create new bot: "+err.Error()))
-				} else {
-					managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "New bot created successfully!"))
-					log.Printf("New bot created successfully using command from user ID: %d", update.Message.From.ID)
-				}
-			case "deletebot":
-				manager.DeleteBot(args)
-				managerBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "Bot deleted successfully!"))
-				log.Printf("Bot deleted successfully using command from user ID: %d", update.Message.From.ID)
-			}
-		}
+	go manager.runVacationExpiry()
+	go manager.runSnoozeExpiry()
+	go manager.runDigests()
+	go manager.pollManagerBot(managerBot, true)
+	if backupBot != nil {
+		go manager.pollManagerBot(backupBot, false)
+	}
+	for _, b := range manager.brands {
+		go manager.pollManagerBot(b.bot, false)
 	}
+	log.Println("Manager bot started listening for updates.")
+	sdNotify("READY=1")
+	select {}
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 主管理机器人连续轮询失败达到该次数后，由备用管理机器人接管
+const managerFailoverThreshold = 5
+
+// 备用管理机器人是否正在接管
+func (m *BotManager) backupActive() bool {
+	return m.backupManagerBot != nil && m.managerFailures.Load() >= managerFailoverThreshold
+}
+
+// 当前用于发送平台通知的管理机器人
+func (m *BotManager) activeManagerBot() *tgbotapi.BotAPI {
+	if m.backupActive() {
+		return m.backupManagerBot
+	}
+	return m.managerBot
+}
+
+// 轮询管理机器人的更新。主管理机器人记录连续失败次数，
+// 备用管理机器人只在主管理机器人不可用时处理命令，品牌的管理机器人始终处理命令，它们共用同一个数据库
+func (m *BotManager) pollManagerBot(bot *tgbotapi.BotAPI, primary bool) {
+	m.pollers.Add(1)
+	defer m.pollers.Done()
+	u := tgbotapi.NewUpdate(m.savedOffset(bot.Token))
+	u.Timeout = 60
+	u.AllowedUpdates = managerAllowedUpdates
+
+	var failures int
+	for {
+		if m.draining.Load() {
+			m.saveOffset(bot.Token, u.Offset)
+			return
+		}
+		updates, err := bot.GetUpdates(u)
+		if err != nil && m.draining.Load() {
+			continue
+		}
+		if err != nil {
+			failures++
+			delay := pollBackoff(failures)
+			log.Printf("Failed to get updates for manager bot @%s, retrying in %s: %v", bot.Self.UserName, delay, err)
+			metrics.inc("forwardme_poll_errors_total", "bot", botIDFromToken(bot.Token))
+			if primary {
+				m.recordManagerFailure()
+			}
+			time.Sleep(delay)
+			continue
+		}
+		if failures > 0 {
+			log.Printf("Manager bot @%s reconnected after %d failed polls.", bot.Self.UserName, failures)
+			metrics.inc("forwardme_poll_reconnects_total", "bot", botIDFromToken(bot.Token))
+			failures = 0
+		}
+		if primary {
+			m.recordManagerSuccess()
+		}
+
+		for _, update := range updates {
+			if update.UpdateID >= u.Offset {
+				u.Offset = update.UpdateID + 1
+			}
+			if !primary && m.brandOf(bot) == nil && !m.backupActive() {
+				if update.Message != nil {
+					bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "请使用主管理机器人 @"+m.managerBot.Self.UserName))
+				}
+				continue
+			}
+			m.handleManagerUpdate(bot, update)
+		}
+	}
+}
+
+func (m *BotManager) recordManagerFailure() {
+	if m.managerFailures.Add(1) == managerFailoverThreshold && m.backupManagerBot != nil {
+		log.Printf("Primary manager bot failed %d times in a row, backup manager bot @%s takes over.", managerFailoverThreshold, m.backupManagerBot.Self.UserName)
+		m.notifyOperators("主管理机器人连续轮询失败，备用管理机器人 @"+m.backupManagerBot.Self.UserName+" 已接管", nil)
+	}
+}
+
+func (m *BotManager) recordManagerSuccess() {
+	if m.managerFailures.Swap(0) >= managerFailoverThreshold && m.backupManagerBot != nil {
+		log.Println("Primary manager bot recovered, backup manager bot stands down.")
+		m.notifyOperators("主管理机器人已恢复", nil)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 记录创建者一侧的消息与原始用户消息的对应关系
+func (m *BotManager) saveMessageMapping(token string, creatorMessageID int, userID int64, userMessageID int) {
+	_, err := m.db.Exec(`INSERT OR REPLACE INTO message_map (bot_token, creator_message_id, user_id, user_message_id, created_at)
+		VALUES (?, ?, ?, ?, ?)`, token, creatorMessageID, userID, userMessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to save message mapping for bot %s, creator message %d: %v", botIDFromToken(token), creatorMessageID, err)
+	}
+}
+
+// 根据创建者一侧的消息 ID 查找原始用户
+func (m *BotManager) lookupMessageMapping(token string, creatorMessageID int) (userID int64, userMessageID int, ok bool) {
+	err := m.db.QueryRow("SELECT user_id, user_message_id FROM message_map WHERE bot_token = ? AND creator_message_id = ?",
+		token, creatorMessageID).Scan(&userID, &userMessageID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up message mapping for bot %s, creator message %d: %v", botIDFromToken(token), creatorMessageID, err)
+		}
+		return 0, 0, false
+	}
+	return userID, userMessageID, true
+}
+
+// 用户消息最近一次交给创建者后在创建者一侧的消息 ID
+func (m *BotManager) lookupRelayedMessage(token string, userID int64, userMessageID int) (int, bool) {
+	var creatorMessageID int
+	err := m.db.QueryRow(`SELECT creator_message_id FROM message_map WHERE bot_token = ? AND user_id = ? AND user_message_id = ?
+		ORDER BY creator_message_id DESC LIMIT 1`, token, userID, userMessageID).Scan(&creatorMessageID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up relayed message for bot %s, user %d message %d: %v", botIDFromToken(token), userID, userMessageID, err)
+		}
+		return 0, false
+	}
+	return creatorMessageID, true
+}
+
+// 解析创建者回复的是哪个用户的消息，优先使用映射表，其次使用转发来源
+func (m *BotManager) resolveReplyTarget(token string, message *tgbotapi.Message) (int64, bool) {
+	if message.ReplyToMessage == nil {
+		return 0, false
+	}
+	if userID, ok := m.lookupChatMapping(token, message.Chat.ID, message.ReplyToMessage.MessageID); ok {
+		return userID, true
+	}
+	if message.ReplyToMessage.ForwardFrom != nil {
+		return message.ReplyToMessage.ForwardFrom.ID, true
+	}
+	return 0, false
+}
+
+// 把用户的一条消息转发给创建者并记录映射
+func (m *BotManager) forwardUserMessage(bot *tgbotapi.BotAPI, creatorID, chatID, userID int64, messageID int) bool {
+	creatorID = m.relayChat(bot.Token, creatorID)
+	user := m.knownUser(bot.Token, userID)
+	sentID, err := m.relayToCreator(bot, creatorID, chatID, messageID, user)
+	m.recordCreatorDelivery(bot, creatorID, err)
+	if err != nil {
+		log.Printf("Failed to forward message %d of user %d for bot %s: %v", messageID, userID, botIDFromToken(bot.Token), err)
+		return false
+	}
+	m.saveMessageMapping(bot.Token, sentID, userID, messageID)
+	m.relayToAdmins(bot, creatorID, user, chatID, messageID)
+	metrics.inc("forwardme_messages_forwarded_total", "bot", botIDFromToken(bot.Token))
+	m.meter(bot.Token, usageRelayed, 1)
+	m.archiveIncoming(bot, user, chatID, messageID)
+	m.attachForwardTools(bot, creatorID, sentID, userID, messageID)
+	return true
+}
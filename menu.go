@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 菜单按钮的动作：转人工、列出常见问题，其余为固定文字回复
+const (
+	menuActionHuman = "human"
+	menuActionFAQ   = "faq"
+)
+
+// 回复键盘每行的按钮数
+const menuButtonsPerRow = 2
+
+type menuItem struct {
+	Label  string
+	Action string
+}
+
+func (m *BotManager) getMenu(token string) ([]menuItem, error) {
+	rows, err := m.db.Query("SELECT label, action FROM menu_items WHERE bot_token = ? ORDER BY position", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []menuItem
+	for rows.Next() {
+		var item menuItem
+		if err := rows.Scan(&item.Label, &item.Action); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// 解析每行一个的 "按钮文字 = 动作"
+func parseMenu(text string) ([]menuItem, error) {
+	var items []menuItem
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		label, action, ok := strings.Cut(line, "=")
+		label, action = strings.TrimSpace(label), strings.TrimSpace(action)
+		if !ok || label == "" || action == "" {
+			return nil, fmt.Errorf("invalid menu line %q", line)
+		}
+		items = append(items, menuItem{Label: label, Action: action})
+	}
+	return items, nil
+}
+
+func (m *BotManager) saveMenu(token string, items []menuItem) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM menu_items WHERE bot_token = ?", token); err != nil {
+		return err
+	}
+	for i, item := range items {
+		if _, err := tx.Exec("INSERT INTO menu_items (bot_token, position, label, action) VALUES (?, ?, ?, ?)", token, i, item.Label, item.Action); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func menuKeyboard(items []menuItem) tgbotapi.ReplyKeyboardMarkup {
+	var rows [][]tgbotapi.KeyboardButton
+	for i := 0; i < len(items); i += menuButtonsPerRow {
+		var row []tgbotapi.KeyboardButton
+		for _, item := range items[i:min(i+menuButtonsPerRow, len(items))] {
+			row = append(row, tgbotapi.NewKeyboardButton(item.Label))
+		}
+		rows = append(rows, row)
+	}
+	return tgbotapi.NewReplyKeyboard(rows...)
+}
+
+// 用户 /start 时发送菜单键盘，配置了 Mini App 联系表单时一并附上
+func (m *BotManager) sendMenu(bot *tgbotapi.BotAPI, chatID int64) {
+	items, err := m.getMenu(bot.Token)
+	if err != nil {
+		log.Printf("Failed to get menu of bot %s: %v", botIDFromToken(bot.Token), err)
+		return
+	}
+	label, webAppURL, _ := m.getStartWebApp(bot.Token)
+	if len(items) == 0 && webAppURL == "" {
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, "请选择：")
+	msg.ReplyMarkup = startKeyboard(items, label, webAppURL)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send menu to user %d: %v", chatID, err)
+	}
+}
+
+// 用户按下菜单按钮时执行对应动作，返回消息是否已处理；转人工的按钮继续正常转发
+func (m *BotManager) routeMenuIntent(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	if message.Text == "" {
+		return false
+	}
+	items, err := m.getMenu(bot.Token)
+	if err != nil {
+		log.Printf("Failed to get menu of bot %s: %v", botIDFromToken(bot.Token), err)
+		return false
+	}
+	for _, item := range items {
+		if item.Label != message.Text {
+			continue
+		}
+		switch item.Action {
+		case menuActionHuman:
+			return false
+		case menuActionFAQ:
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, m.formatFAQList(bot.Token)))
+		default:
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, item.Action))
+		}
+		metrics.inc("forwardme_menu_intents_total", "bot", botIDFromToken(bot.Token))
+		return true
+	}
+	return false
+}
+
+// 给用户看的常见问题列表
+func (m *BotManager) formatFAQList(token string) string {
+	faqs, err := m.getFAQs(token)
+	if err != nil || len(faqs) == 0 {
+		return "暂无常见问题，请直接发送你的问题。"
+	}
+	var b strings.Builder
+	b.WriteString("常见问题:\n\n")
+	for _, f := range faqs {
+		fmt.Fprintf(&b, "• %s\n%s\n\n", f.Keywords[0], f.Answer)
+	}
+	return b.String()
+}
+
+// 设置机器人对所有用户显示的菜单按钮，url 为空时恢复默认的命令菜单
+func setWebAppMenuButton(bot *tgbotapi.BotAPI, label, webAppURL string) error {
+	params := tgbotapi.Params{}
+	var button interface{} = map[string]string{"type": "default"}
+	if webAppURL != "" {
+		button = map[string]interface{}{"type": "web_app", "text": label, "web_app": map[string]string{"url": webAppURL}}
+	}
+	if err := params.AddInterface("menu_button", button); err != nil {
+		return err
+	}
+	_, err := bot.MakeRequest("setChatMenuButton", params)
+	return err
+}
+
+func (m *BotManager) getMenuWebApp(token string) string {
+	var value string
+	err := m.db.QueryRow("SELECT menu_webapp FROM bots WHERE token = ?", token).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get menu web app of bot %s: %v", botIDFromToken(token), err)
+	}
+	return value
+}
+
+// 处理 /setmenu
+func (m *BotManager) handleMenuCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	args := strings.TrimSpace(message.CommandArguments())
+	usage := "用法（每行一个按钮，动作为 human 转人工、faq 列出常见问题，其他内容作为自动回复）：\n/setmenu\n价格 = 基础版 99 元/月\n常见问题 = faq\n联系人工 = human\n\n/setmenu off 清除菜单\n/setmenu webapp <按钮文字> <https 链接> 设置菜单按钮，/setmenu webapp off 恢复默认"
+
+	if fields := strings.Fields(args); len(fields) > 0 && fields[0] == "webapp" {
+		var label, webAppURL string
+		switch {
+		case len(fields) == 2 && fields[1] == "off":
+		case len(fields) >= 3:
+			webAppURL = fields[len(fields)-1]
+			label = strings.Join(fields[1:len(fields)-1], " ")
+			if u, err := url.Parse(webAppURL); err != nil || u.Scheme != "https" || u.Host == "" {
+				bot.Send(tgbotapi.NewMessage(creatorID, "Web App 链接必须是 https 地址"))
+				return
+			}
+		default:
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		if err := setWebAppMenuButton(bot, label, webAppURL); err != nil {
+			log.Printf("Failed to set menu button of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, "设置菜单按钮失败: "+err.Error()))
+			return
+		}
+		value := ""
+		if webAppURL != "" {
+			value = label + " " + webAppURL
+		}
+		if _, err := m.db.Exec("UPDATE bots SET menu_webapp = ? WHERE token = ?", value, token); err != nil {
+			log.Printf("Failed to save menu web app of bot %s: %v", botIDFromToken(token), err)
+		}
+		if webAppURL == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "已恢复默认菜单按钮"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "菜单按钮已设置为 "+label))
+		}
+		return
+	}
+
+	switch args {
+	case "":
+		items, err := m.getMenu(token)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get menu")))
+			return
+		}
+		if len(items) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "未设置菜单。\n"+usage))
+			return
+		}
+		var b strings.Builder
+		b.WriteString("当前菜单:\n")
+		for _, item := range items {
+			fmt.Fprintf(&b, "%s = %s\n", item.Label, item.Action)
+		}
+		if webApp := m.getMenuWebApp(token); webApp != "" {
+			fmt.Fprintf(&b, "\n菜单按钮: %s\n", webApp)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+		return
+	case "off":
+		if err := m.saveMenu(token, nil); err != nil {
+			log.Printf("Failed to clear menu of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to clear menu")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已清除菜单"))
+		return
+	}
+
+	items, err := parseMenu(args)
+	if err != nil || len(items) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if err := m.saveMenu(token, items); err != nil {
+		log.Printf("Failed to save menu of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to save menu")))
+		return
+	}
+	msg := tgbotapi.NewMessage(creatorID, "菜单已保存，用户发送 /start 后会看到以下键盘：")
+	msg.ReplyMarkup = menuKeyboard(items)
+	bot.Send(msg)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 计费用量的写入间隔
+const usageFlushInterval = time.Minute
+
+// 计费事件
+const (
+	usageRelayed   = "messages_relayed"
+	usageBroadcast = "broadcast_messages"
+	// 保存的对话文字字节数，导出时按当前数据计算，不按月累加
+	usageStorage = "storage_bytes"
+)
+
+type usageKey struct {
+	token  string
+	period string
+	metric string
+}
+
+// 按创建者、机器人、月份和事件累加用量，定期写入 usage_records。
+// 记录的是机器人 ID 而不是 token，机器人删除后用量仍然保留
+type usageMeter struct {
+	mu      sync.Mutex
+	pending map[usageKey]int64
+}
+
+func newUsageMeter() *usageMeter {
+	return &usageMeter{pending: make(map[usageKey]int64)}
+}
+
+func usagePeriod(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// 记录机器人产生的 n 次计费事件。调用方可能持有 m.mu 的读锁，创建者在写入时再查找
+func (m *BotManager) meter(token, metric string, n int) {
+	if n <= 0 {
+		return
+	}
+	key := usageKey{token, usagePeriod(time.Now()), metric}
+	m.usage.mu.Lock()
+	m.usage.pending[key] += int64(n)
+	m.usage.mu.Unlock()
+}
+
+func (m *BotManager) flushUsage() {
+	m.usage.mu.Lock()
+	pending := m.usage.pending
+	m.usage.pending = make(map[usageKey]int64)
+	m.usage.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		log.Printf("Failed to flush usage records: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	for key, amount := range pending {
+		creatorID := m.creatorOf(key.token)
+		if creatorID == 0 {
+			tx.QueryRow("SELECT creator_id FROM bots WHERE token = ?", key.token).Scan(&creatorID)
+		}
+		_, err := tx.Exec(`INSERT INTO usage_records (creator_id, bot_id, period, metric, amount) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (creator_id, bot_id, period, metric) DO UPDATE SET amount = amount + excluded.amount`,
+			creatorID, botIDFromToken(key.token), key.period, key.metric, amount)
+		if err != nil {
+			log.Printf("Failed to flush usage records: %v", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to flush usage records: %v", err)
+	}
+}
+
+func (m *BotManager) runUsageFlush() {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.flushUsage()
+	}
+}
+
+type usageRecord struct {
+	CreatorID int64  `json:"creator_id"`
+	BotID     string `json:"bot_id"`
+	Period    string `json:"period"`
+	Metric    string `json:"metric"`
+	Amount    int64  `json:"amount"`
+}
+
+// 一个月的用量，creatorID 为 0 时包含所有创建者。当月的数据加上机器人当前的存储量
+func (m *BotManager) loadUsage(period string, creatorID int64) ([]usageRecord, error) {
+	m.flushUsage()
+	rows, err := m.db.Query(`SELECT creator_id, bot_id, period, metric, amount FROM usage_records
+		WHERE period = ?1 AND (?2 = 0 OR creator_id = ?2)
+		UNION ALL
+		SELECT b.creator_id, substr(b.token, 1, instr(b.token, ':') - 1), ?1, ?3, SUM(LENGTH(t.text))
+		FROM bots b JOIN transcript_entries t ON t.bot_token = b.token
+		WHERE ?1 = ?4 AND b.deleted_at = 0 AND (?2 = 0 OR b.creator_id = ?2)
+		GROUP BY b.token
+		ORDER BY 1, 2, 4`, period, creatorID, usageStorage, usagePeriod(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []usageRecord
+	for rows.Next() {
+		var r usageRecord
+		if err := rows.Scan(&r.CreatorID, &r.BotID, &r.Period, &r.Metric, &r.Amount); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func usageCSV(records []usageRecord) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"creator_id", "bot_id", "period", "metric", "amount"})
+	for _, r := range records {
+		w.Write([]string{strconv.FormatInt(r.CreatorID, 10), r.BotID, r.Period, r.Metric, strconv.FormatInt(r.Amount, 10)})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// 解析 YYYY-MM，为空时是当月
+func parseUsagePeriod(value string) (string, bool) {
+	if value == "" {
+		return usagePeriod(time.Now()), true
+	}
+	t, err := time.Parse("2006-01", value)
+	if err != nil {
+		return "", false
+	}
+	return usagePeriod(t), true
+}
+
+// 处理运营者的 /usage [YYYY-MM] [创建者ID]，导出 CSV 格式的用量
+func (m *BotManager) handleUsageCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	usage := "用法：/usage [YYYY-MM] [创建者ID]，默认导出当月所有创建者的用量"
+	fields := strings.Fields(message.CommandArguments())
+	var periodArg string
+	var creatorID int64
+	for _, field := range fields {
+		if id, err := strconv.ParseInt(field, 10, 64); err == nil {
+			creatorID = id
+		} else {
+			periodArg = field
+		}
+	}
+	period, ok := parseUsagePeriod(periodArg)
+	if !ok || len(fields) > 2 {
+		managerBot.Send(tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+
+	records, err := m.loadUsage(period, creatorID)
+	if err != nil {
+		log.Printf("Failed to load usage of %s: %v", period, err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to export usage.")))
+		return
+	}
+	if len(records) == 0 {
+		managerBot.Send(tgbotapi.NewMessage(chatID, period+" 没有用量记录"))
+		return
+	}
+	totals := make(map[string]int64)
+	creators := make(map[int64]bool)
+	for _, r := range records {
+		totals[r.Metric] += r.Amount
+		creators[r.CreatorID] = true
+	}
+	caption := fmt.Sprintf("%s 用量，%d 位创建者：转发和回复 %d 条，群发 %d 条，存储 %d 字节", period, len(creators),
+		totals[usageRelayed], totals[usageBroadcast], totals[usageStorage])
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "usage-" + period + ".csv", Bytes: usageCSV(records)})
+	doc.Caption = caption
+	if _, err := managerBot.Send(doc); err != nil {
+		log.Printf("Failed to send usage export: %v", err)
+	}
+}
+
+// GET /api/usage?period=YYYY-MM&creator_id=，两个参数都可以省略
+func (m *BotManager) apiUsage(r *http.Request) apiResponse {
+	period, ok := parseUsagePeriod(r.URL.Query().Get("period"))
+	if !ok {
+		return apiError(http.StatusBadRequest, "period must be YYYY-MM")
+	}
+	var creatorID int64
+	if value := r.URL.Query().Get("creator_id"); value != "" {
+		var err error
+		if creatorID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return apiError(http.StatusBadRequest, "invalid creator_id")
+		}
+	}
+	records, err := m.loadUsage(period, creatorID)
+	if err != nil {
+		log.Printf("Failed to load usage of %s: %v", period, err)
+		return apiError(http.StatusInternalServerError, "failed to load usage")
+	}
+	if records == nil {
+		records = []usageRecord{}
+	}
+	return apiResponse{http.StatusOK, map[string][]usageRecord{"usage": records}}
+}
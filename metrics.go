@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 进程内计数器，以 Prometheus 文本格式对外暴露
+type metricsRegistry struct {
+	mu       sync.Mutex
+	help     map[string]string
+	counters map[string]map[string]int64
+}
+
+var metrics = newMetricsRegistry()
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		help: map[string]string{
+			"forwardme_messages_forwarded_total":   "Messages forwarded from users to creators.",
+			"forwardme_edits_relayed_total":        "Edited user messages relayed to creators again.",
+			"forwardme_archive_failures_total":     "Messages that could not be copied to a bot's archive channel.",
+			"forwardme_replies_sent_total":         "Creator replies delivered to users.",
+			"forwardme_bans_total":                 "Users added to a bot's block list.",
+			"forwardme_unbans_total":               "Users removed from a bot's block list.",
+			"forwardme_appeals_total":              "Appeals submitted by banned users.",
+			"forwardme_urgent_messages_total":      "Messages matching an urgent keyword.",
+			"forwardme_faq_answers_total":          "Messages answered automatically from the FAQ list.",
+			"forwardme_faq_escalations_total":      "FAQ answers escalated to the creator by the user.",
+			"forwardme_menu_intents_total":         "Menu button presses answered without forwarding.",
+			"forwardme_webapp_submissions_total":   "Mini App submissions forwarded to creators.",
+			"forwardme_approvals_requested_total":  "First messages from new users held for creator approval.",
+			"forwardme_messages_throttled_total":   "Messages over a per-user quota, dropped or queued.",
+			"forwardme_messages_quarantined_total": "Messages moved to quarantine because of a high risk score.",
+			"forwardme_codes_claimed_total":        "Promo codes handed out to users.",
+			"forwardme_broadcast_messages_total":   "Messages delivered by broadcasts and scheduled sends.",
+			"forwardme_users_unreachable_total":    "Users marked unreachable after repeated failed sends.",
+			"forwardme_plan_limit_hits_total":      "Actions refused because they exceed the creator's plan.",
+			"forwardme_stage_timeouts_total":       "Message processing stages skipped after exceeding their timeout.",
+			"forwardme_breaker_trips_total":        "Circuit breakers opened after repeated failures of an external integration.",
+			"forwardme_retention_purged_total":     "Rows deleted or blanked by per-bot retention policies.",
+			"forwardme_poll_errors_total":          "Failed getUpdates calls.",
+			"forwardme_poll_reconnects_total":      "Successful polls after one or more failures.",
+			"forwardme_updates_deferred_total":     "Updates that waited for room in a full per-bot queue, pausing polling.",
+			"forwardme_updates_shed_total":         "Updates dropped because a per-bot queue stayed full.",
+			"forwardme_write_flushes_total":        "Transactions writing buffered user profile and activity updates.",
+			"forwardme_batched_writes_total":       "User rows updated by buffered writes instead of one write per message.",
+			"forwardme_polls_total":                "getUpdates calls by polling mode.",
+			"forwardme_api_requests_total":         "Bot API requests other than getUpdates, by bot and method.",
+			"forwardme_api_throttled_total":        "Bot API requests rejected with 429 Too Many Requests, by bot and method.",
+			"forwardme_legacy_callbacks_total":     "Unsigned buttons from before signed button data, accepted during the transition, by action.",
+		},
+		counters: make(map[string]map[string]int64),
+	}
+}
+
+// labels 以 key, value 成对传入
+func (r *metricsRegistry) inc(name string, labels ...string) {
+	r.add(name, 1, labels...)
+}
+
+func (r *metricsRegistry) add(name string, delta int64, labels ...string) {
+	key := formatLabels(labels...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series, ok := r.counters[name]
+	if !ok {
+		series = make(map[string]int64)
+		r.counters[name] = series
+	}
+	series[key] += delta
+}
+
+// 返回某个计数器所有标签组合的总和
+func (r *metricsRegistry) total(name string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sum int64
+	for _, v := range r.counters[name] {
+		sum += v
+	}
+	return sum
+}
+
+func (r *metricsRegistry) writeTo(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.counters))
+	for name := range r.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if help, ok := r.help[name]; ok {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(w, "# TYPE %s counter\n", name)
+		series := r.counters[name]
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s%s %d\n", name, key, series[key])
+		}
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value int64, labels ...string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s%s %d\n", name, help, name, name, formatLabels(labels...), value)
+}
+
+func formatLabels(labels ...string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
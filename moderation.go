@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 解析管理命令的目标用户：作为回复使用时取被回复消息对应的用户，
+// 否则取参数中的第一个 Telegram ID。rest 为剩余的参数文本。
+func (m *BotManager) commandTarget(token string, message *tgbotapi.Message) (userID int64, rest string, err error) {
+	args := strings.TrimSpace(message.CommandArguments())
+	if target, ok := m.resolveReplyTarget(token, message); ok {
+		return target, args, nil
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return 0, "", fmt.Errorf("missing user ID")
+	}
+	userID, err = strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid user ID %q: %w", fields[0], err)
+	}
+	return userID, strings.TrimSpace(strings.TrimPrefix(args, fields[0])), nil
+}
+
+func (m *BotManager) isUserMuted(token string, userID int64) bool {
+	var exists bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM muted_users WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&exists)
+	if err != nil {
+		log.Printf("Failed to check mute state of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	return exists
+}
+
+// 静音用户：消息不再转发给创建者，但不会通知用户
+func (m *BotManager) muteUser(token string, userID int64) error {
+	_, err := m.db.Exec("INSERT OR IGNORE INTO muted_users (bot_token, user_id, created_at) VALUES (?, ?, ?)", token, userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to mute user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return err
+	}
+	log.Printf("User ID: %d muted for bot %s.", userID, botIDFromToken(token))
+	return nil
+}
+
+func (m *BotManager) unmuteUser(token string, userID int64) error {
+	_, err := m.db.Exec("DELETE FROM muted_users WHERE bot_token = ? AND user_id = ?", token, userID)
+	if err != nil {
+		log.Printf("Failed to unmute user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return err
+	}
+	log.Printf("User ID: %d unmuted for bot %s.", userID, botIDFromToken(token))
+	return nil
+}
+
+func (m *BotManager) addUserNote(token string, userID int64, note string) error {
+	_, err := m.db.Exec("INSERT INTO user_notes (bot_token, user_id, note, created_at) VALUES (?, ?, ?, ?)", token, userID, note, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to add note for user %d of bot %s: %v", userID, botIDFromToken(token), err)
+		return err
+	}
+	return nil
+}
+
+type userNote struct {
+	Note      string
+	CreatedAt time.Time
+}
+
+func (m *BotManager) getUserNotes(token string, userID int64) ([]userNote, error) {
+	rows, err := m.db.Query("SELECT note, created_at FROM user_notes WHERE bot_token = ? AND user_id = ? ORDER BY id", token, userID)
+	if err != nil {
+		log.Printf("Failed to get notes for user %d of bot %s: %v", userID, botIDFromToken(token), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []userNote
+	for rows.Next() {
+		var note string
+		var createdAt int64
+		if err := rows.Scan(&note, &createdAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, userNote{Note: note, CreatedAt: time.Unix(createdAt, 0)})
+	}
+	return notes, rows.Err()
+}
+
+func formatUserNotes(userID int64, notes []userNote) string {
+	if len(notes) == 0 {
+		return fmt.Sprintf("用户ID: %d 暂无备注", userID)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "用户ID: %d 的备注:\n", userID)
+	for i, n := range notes {
+		fmt.Fprintf(&b, "%d. [%s] %s\n", i+1, n.CreatedAt.Format("2006-01-02 15:04"), n.Note)
+	}
+	return b.String()
+}
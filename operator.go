@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 封禁数超过全体平均值的倍数且不少于最小值时视为异常
+const (
+	abuseBanFactor   = 3
+	abuseMinBanCount = 20
+)
+
+// 解析逗号分隔的 Telegram ID 列表，例如 OPERATOR_IDS
+func parseIDEnv(value string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring invalid Telegram ID %q: %v", part, err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// 管理机器人中运营者命令所需的权限，实例审计员可以使用只读命令
+var operatorCommandPermissions = map[string]string{
+	"stats":        permRead,
+	"gbans":        permRead,
+	"reports":      permRead,
+	"auditlog":     permRead,
+	"integrity":    permRead,
+	"version":      permRead,
+	"gban":         permModerate,
+	"ungban":       permModerate,
+	"suspendbot":   permModerate,
+	"unsuspendbot": permModerate,
+	"apitoken":     permManage,
+	"loadtest":     permManage,
+	"plan":         permManage,
+	"usage":        permRead,
+	"quota":        permRead,
+}
+
+// 处理实例运营者在管理机器人中的命令，返回是否已处理
+func (m *BotManager) handleOperatorCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	perm, ok := operatorCommandPermissions[message.Command()]
+	if !ok {
+		return false
+	}
+
+	if !m.instanceCan(message.From.ID, perm) {
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, "无权限"))
+		return true
+	}
+
+	switch message.Command() {
+	case "stats":
+		report, err := m.buildStatsReport()
+		if err != nil {
+			log.Printf("Failed to build stats report: %v", err)
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to build stats report.")))
+			return true
+		}
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, report))
+	case "gban":
+		fields := strings.Fields(message.CommandArguments())
+		if len(fields) == 0 {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, "请提供要加入全局黑名单的 Telegram ID，例如：/gban 123456 垃圾广告"))
+			return true
+		}
+		userID, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, "无效的 Telegram ID"))
+			return true
+		}
+		reason := strings.Join(fields[1:], " ")
+		if err := m.addGlobalBlacklist(userID, message.From.ID, reason); err != nil {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to update global blacklist.")))
+			return true
+		}
+		m.logEvent("", message.From.ID, eventGlobalBan, userID, reason)
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("用户ID: %d 已加入全局黑名单", userID)))
+	case "ungban":
+		userID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+		if err != nil {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, "请提供要移出全局黑名单的 Telegram ID，例如：/ungban 123456"))
+			return true
+		}
+		removed, err := m.removeGlobalBlacklist(userID)
+		if err != nil {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to update global blacklist.")))
+			return true
+		}
+		if !removed {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("用户ID: %d 不在全局黑名单中", userID)))
+			return true
+		}
+		m.logEvent("", message.From.ID, eventGlobalUnban, userID, "")
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("用户ID: %d 已移出全局黑名单", userID)))
+	case "gbans":
+		text, err := m.formatGlobalBlacklist()
+		if err != nil {
+			log.Printf("Failed to list global blacklist: %v", err)
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to get global blacklist.")))
+			return true
+		}
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+	case "reports":
+		m.sendReportQueue(managerBot, message.Chat.ID)
+	case "auditlog":
+		m.sendEventExport(managerBot, message.Chat.ID, "")
+	case "apitoken":
+		m.handleAPITokenCommand(managerBot, message)
+	case "integrity":
+		m.handleIntegrityCommand(managerBot, message)
+	case "loadtest":
+		m.handleLoadTestCommand(managerBot, message)
+	case "plan":
+		m.handlePlanCommand(managerBot, message)
+	case "usage":
+		m.handleUsageCommand(managerBot, message)
+	case "quota":
+		m.handleQuotaCommand(managerBot, message)
+	case "version":
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, versionReport()))
+	case "suspendbot", "unsuspendbot":
+		suspend := message.Command() == "suspendbot"
+		token, ok := m.findBotToken(message.CommandArguments())
+		if !ok {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, "未找到该机器人，请提供 token、机器人 ID 或 @用户名，例如：/"+message.Command()+" @example_bot"))
+			return true
+		}
+		if err := m.suspendBot(token, suspend); err != nil {
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, friendlyError(err, "Failed to update bot.")))
+			return true
+		}
+		if suspend {
+			m.logEvent("", message.From.ID, eventSuspend, 0, botIDFromToken(token))
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, m.botUsername(token)+" 已暂停"))
+		} else {
+			m.logEvent("", message.From.ID, eventUnsuspend, 0, botIDFromToken(token))
+			managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, m.botUsername(token)+" 已恢复"))
+		}
+	}
+	return true
+}
+
+// 根据 token、机器人数字 ID 或 @用户名查找机器人
+func (m *BotManager) findBotToken(ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", false
+	}
+
+	m.mu.RLock()
+	for token, bot := range m.bots {
+		if token == ref || botIDFromToken(token) == ref || strings.EqualFold("@"+bot.Self.UserName, ref) || strings.EqualFold(bot.Self.UserName, ref) {
+			m.mu.RUnlock()
+			return token, true
+		}
+	}
+	m.mu.RUnlock()
+
+	// 未运行的机器人只能通过 token 或数字 ID 匹配
+	var token string
+	err := m.db.QueryRow("SELECT token FROM bots WHERE token = ? OR substr(token, 1, instr(token, ':') - 1) = ?", ref, ref).Scan(&token)
+	if err != nil {
+		return "", false
+	}
+	return token, true
+}
+
+type botBanCount struct {
+	Token     string
+	CreatorID int64
+	Bans      int
+	RecentBan int
+}
+
+func (m *BotManager) botBanCounts(since time.Time) ([]botBanCount, error) {
+	rows, err := m.db.Query(`SELECT b.token, b.creator_id, COUNT(n.user_id), COALESCE(SUM(n.banned_at >= ?), 0)
+		FROM bots b
+		LEFT JOIN bans n ON n.bot_token = b.token
+		WHERE b.deleted_at = 0
+		GROUP BY b.token, b.creator_id
+		ORDER BY COUNT(n.user_id) DESC`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []botBanCount
+	for rows.Next() {
+		var c botBanCount
+		if err := rows.Scan(&c.Token, &c.CreatorID, &c.Bans, &c.RecentBan); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// 找出封禁数明显高于平均水平的机器人，可能是创建者滥用或正遭受攻击
+func anomalousBanCounts(counts []botBanCount) []botBanCount {
+	if len(counts) == 0 {
+		return nil
+	}
+	var total int
+	for _, c := range counts {
+		total += c.Bans
+	}
+	avg := float64(total) / float64(len(counts))
+
+	var flagged []botBanCount
+	for _, c := range counts {
+		if c.Bans >= abuseMinBanCount && float64(c.Bans) >= avg*abuseBanFactor {
+			flagged = append(flagged, c)
+		}
+	}
+	return flagged
+}
+
+func (m *BotManager) botUsername(token string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if bot, ok := m.bots[token]; ok {
+		return "@" + bot.Self.UserName
+	}
+	return "bot " + botIDFromToken(token)
+}
+
+func (m *BotManager) buildStatsReport() (string, error) {
+	now := time.Now()
+	appeals, err := m.getAppealStats(now.AddDate(0, 0, -7))
+	if err != nil {
+		return "", err
+	}
+	counts, err := m.botBanCounts(now.Add(-24 * time.Hour))
+	if err != nil {
+		return "", err
+	}
+
+	var users, bans int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM bot_users").Scan(&users); err != nil {
+		return "", err
+	}
+	for _, c := range counts {
+		bans += c.Bans
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "实例统计\n\n机器人: %d\n用户: %d\n封禁: %d\n转发消息: %d（本次运行）\n\n", len(counts), users, bans, metrics.total("forwardme_messages_forwarded_total"))
+	fmt.Fprintf(&b, "申诉: 共 %d，近 7 天 %d\n待处理: %d\n通过: %d\n驳回: %d\n通过率: %.1f%%\n",
+		appeals.Total, appeals.Recent, appeals.Pending, appeals.Approved, appeals.Rejected, appeals.approvalRate())
+
+	if sentiments, err := m.getSentimentStats("", now.AddDate(0, 0, -7)); err == nil {
+		fmt.Fprintf(&b, "\n消息情绪（近 7 天）: %s\n", sentiments)
+	}
+
+	flagged := anomalousBanCounts(counts)
+	if len(flagged) == 0 {
+		b.WriteString("\n未发现封禁数异常的机器人")
+	} else {
+		b.WriteString("\n封禁数异常的机器人:\n")
+		for _, c := range flagged {
+			fmt.Fprintf(&b, "%s（创建者 %d）封禁 %d，近 24 小时 %d\n", m.botUsername(c.Token), c.CreatorID, c.Bans, c.RecentBan)
+		}
+	}
+	return b.String(), nil
+}
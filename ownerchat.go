@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 记录一次转交给创建者的结果。创建者注销了账号或屏蔽了自己的机器人时转交会一直失败，
+// 连续失败达到 unreachableThreshold 次后暂停机器人，并通过管理机器人通知创建者，通知不到时通知运营者
+func (m *BotManager) recordCreatorDelivery(bot *tgbotapi.BotAPI, creatorID int64, err error) {
+	token := bot.Token
+	// 用户消息已删除等与创建者无关的失败不计入，转交到论坛群组时不检测
+	if creatorID < 0 || err != nil && !creatorChatGone(err) {
+		return
+	}
+	if !m.recordDelivery(token, creatorID, err) {
+		return
+	}
+	if _, err := m.db.Exec("UPDATE bots SET creator_unreachable = 1 WHERE token = ?", token); err != nil {
+		log.Printf("Failed to pause bot %s with unreachable creator: %v", botIDFromToken(token), err)
+		return
+	}
+	log.Printf("Bot %s paused: creator %d is unreachable.", botIDFromToken(token), creatorID)
+
+	name := "@" + bot.Self.UserName
+	text := fmt.Sprintf("⚠️ %s 连续 %d 次无法把消息转交给你，可能是你屏蔽了该机器人或删除了与它的对话，机器人已暂停服务。\n解除屏蔽后向 %s 发送 /start 即可恢复。",
+		name, unreachableThreshold, name)
+	if managerBot := m.managerBotFor(token); managerBot != nil {
+		if _, err := managerBot.Send(tgbotapi.NewMessage(creatorID, text)); err == nil {
+			return
+		} else {
+			log.Printf("Failed to notify creator %d of paused bot %s: %v", creatorID, botIDFromToken(token), err)
+		}
+	}
+	m.notifyOperators(fmt.Sprintf("%s（创建者 %d）无法联系创建者，已暂停服务，创建者向机器人发送 /start 后自动恢复。", name, creatorID), nil)
+}
+
+// 记录一次转交给休假代理人的结果，返回是否需要改为转交给创建者本人。
+// 代理人无法接收不会暂停机器人，连续失败达到 unreachableThreshold 次时告诉创建者
+func (m *BotManager) recordSubstituteDelivery(bot *tgbotapi.BotAPI, ownerID, substituteID int64, err error) bool {
+	if m.recordDelivery(bot.Token, substituteID, err) {
+		name := "@" + bot.Self.UserName
+		text := fmt.Sprintf("⚠️ 休假代理人 %d 连续 %d 次无法接收 %s 的消息，可能屏蔽了该机器人或还没有向它发送 /start，消息已改为转交给你。",
+			substituteID, unreachableThreshold, name)
+		if _, err := bot.Send(tgbotapi.NewMessage(ownerID, text)); err != nil {
+			log.Printf("Failed to tell creator %d that substitute %d of bot %s is unreachable: %v", ownerID, substituteID, botIDFromToken(bot.Token), err)
+		}
+	}
+	return err != nil && creatorChatGone(err)
+}
+
+// 错误是否说明机器人已无法私聊创建者
+func creatorChatGone(err error) bool {
+	class, ok := classifyError(err)
+	if !ok {
+		return false
+	}
+	switch class.code {
+	case "TG-BLOCKED", "TG-DEACTIVATED", "TG-NO-CHAT":
+		return true
+	}
+	return false
+}
+
+// 机器人是否因无法联系创建者而暂停
+func (m *BotManager) isCreatorUnreachable(token string) bool {
+	var unreachable bool
+	err := m.db.QueryRow("SELECT creator_unreachable FROM bots WHERE token = ?", token).Scan(&unreachable)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get creator reachability of bot %s: %v", botIDFromToken(token), err)
+	}
+	return unreachable
+}
+
+// 创建者重新向机器人发送消息，说明已解除屏蔽，恢复服务
+func (m *BotManager) reactivateForCreator(bot *tgbotapi.BotAPI, creatorID int64) {
+	token := bot.Token
+	if _, err := m.db.Exec("UPDATE bots SET creator_unreachable = 0 WHERE token = ?", token); err != nil {
+		log.Printf("Failed to resume bot %s: %v", botIDFromToken(token), err)
+		return
+	}
+	m.recordDelivery(token, creatorID, nil)
+	log.Printf("Bot %s resumed: creator %d is reachable again.", botIDFromToken(token), creatorID)
+	bot.Send(tgbotapi.NewMessage(creatorID, "机器人已恢复服务，用户的消息会继续转交给你"))
+}
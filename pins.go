@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 置顶对话的用户，转交时带 📌 标记，在 /pending、摘要和控制台中排在最前
+func (m *BotManager) isPinned(token string, userID int64) bool {
+	var exists bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM pinned_users WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&exists)
+	if err != nil {
+		log.Printf("Failed to check pin state of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	return exists
+}
+
+// 转交消息前的来源说明，置顶的用户带 📌 前缀，与对方有时差时附上对方当地时间
+func (m *BotManager) userHeader(token string, user *tgbotapi.User) string {
+	header := relayHeader(user)
+	if m.isPinned(token, user.ID) {
+		header = "📌 " + header
+	}
+	if note := m.localTimeNote(token, user.ID, time.Now()); note != "" {
+		header += " · " + note
+	}
+	return header
+}
+
+// 转发模式原本没有来源说明，置顶的对话或需要标注对方当地时间时单独发送一条
+func (m *BotManager) forwardNeedsHeader(token string, userID int64) bool {
+	return m.isPinned(token, userID) || m.localTimeNote(token, userID, time.Now()) != ""
+}
+
+// 发送一条不提醒的来源说明并记录映射，回复它同样可以回答用户
+func (m *BotManager) sendRelayHeader(bot *tgbotapi.BotAPI, chatID int64, user *tgbotapi.User, userMessageID int) (int, error) {
+	header := tgbotapi.NewMessage(chatID, m.userHeader(bot.Token, user))
+	header.DisableNotification = true
+	sent, err := bot.Send(header)
+	if err != nil {
+		return 0, err
+	}
+	m.saveChatMapping(bot.Token, chatID, sent.MessageID, user.ID, userMessageID)
+	return sent.MessageID, nil
+}
+
+// 论坛模式下按置顶状态重新命名用户已有的话题，还没有话题时不处理
+func (m *BotManager) renameUserTopic(bot *tgbotapi.BotAPI, userID int64, pinned bool) {
+	token := bot.Token
+	forumID := m.forumChatID(token)
+	if forumID == 0 {
+		return
+	}
+	var threadID int
+	if m.db.QueryRow("SELECT thread_id FROM user_topics WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&threadID) != nil {
+		return
+	}
+	_, err := bot.MakeRequest("editForumTopic", tgbotapi.Params{
+		"chat_id":           strconv.FormatInt(forumID, 10),
+		"message_thread_id": strconv.Itoa(threadID),
+		"name":              topicName(m.knownUser(token, userID), pinned),
+	})
+	if err != nil {
+		log.Printf("Failed to rename topic %d of user %d for bot %s: %v", threadID, userID, botIDFromToken(token), err)
+	}
+}
+
+// 处理 /pin <ID> 和 /unpin <ID>，也可以回复一条转交的消息发送
+func (m *BotManager) handlePinCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	command := message.Command()
+	userID, _, err := m.commandTarget(token, message)
+	if err != nil {
+		if command == "pin" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/pin <ID>，或回复一条转交的消息发送 /pin。置顶的对话转交时带 📌 标记，并在 /pending 和控制台中排在最前。/unpin <ID> 取消置顶"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/unpin <ID>，或回复一条转交的消息发送 /unpin"))
+		}
+		return
+	}
+
+	pinned := command == "pin"
+	if pinned {
+		_, err = m.db.Exec("INSERT OR IGNORE INTO pinned_users (bot_token, user_id, created_at) VALUES (?, ?, ?)", token, userID, time.Now().Unix())
+	} else {
+		_, err = m.db.Exec("DELETE FROM pinned_users WHERE bot_token = ? AND user_id = ?", token, userID)
+	}
+	if err != nil {
+		log.Printf("Failed to update pin state of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update pinned conversation")))
+		return
+	}
+	m.renameUserTopic(bot, userID, pinned)
+	if pinned {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已置顶与用户ID: %d 的对话", userID)))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已取消置顶与用户ID: %d 的对话", userID)))
+	}
+}
+
+// 处理 /pending：列出等待回复的用户，置顶的对话在最前
+func (m *BotManager) handlePendingCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	users, err := m.awaitingUsers(token)
+	if err != nil {
+		log.Printf("Failed to list awaiting users of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list pending conversations")))
+		return
+	}
+	if len(users) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "没有等待回复的用户"))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, formatPending(users)))
+}
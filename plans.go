@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 套餐对创建者的限制，0 表示不限制
+type planLimits struct {
+	// 同时拥有的机器人数量（不含回收站中的）
+	Bots int `json:"bots"`
+	// 一次群发的收件人数
+	BroadcastSize int `json:"broadcast_size"`
+	// 数据最多保留的天数，没有设置保留策略的类别也按此清理
+	RetentionDays int `json:"retention_days"`
+}
+
+const (
+	planFree = "free"
+	planPro  = "pro"
+)
+
+var plans = map[string]planLimits{
+	planFree: {Bots: 1, BroadcastSize: 1000, RetentionDays: 90},
+	planPro:  {},
+}
+
+// 超出套餐限制，message 是发给创建者的说明
+type planLimitError struct {
+	Plan  string
+	What  string
+	Limit int
+}
+
+func (e *planLimitError) Error() string {
+	return fmt.Sprintf("%s plan allows at most %d %s", e.Plan, e.Limit, e.What)
+}
+
+func (e *planLimitError) message() string {
+	names := map[string]string{"bots": "个机器人", "recipients": "位群发收件人"}
+	return fmt.Sprintf("当前套餐（%s）最多允许 %d %s，请联系运营者升级套餐", e.Plan, e.Limit, names[e.What])
+}
+
+// 超出限制时发给创建者的说明，其他错误返回 fallback
+func planLimitMessage(err error, fallback string) string {
+	var limitErr *planLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.message()
+	}
+	return fallback
+}
+
+// 创建者的套餐，未单独设置时使用 DEFAULT_PLAN
+func (m *BotManager) creatorPlan(creatorID int64) string {
+	var plan string
+	err := m.db.QueryRow("SELECT plan FROM creators WHERE creator_id = ?", creatorID).Scan(&plan)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get plan of creator %d: %v", creatorID, err)
+	}
+	if _, ok := plans[plan]; !ok {
+		return m.defaultPlan
+	}
+	return plan
+}
+
+// 设置创建者的套餐，plan 为空时使用默认套餐。返回因超出新套餐而暂停的机器人数量
+func (m *BotManager) setCreatorPlan(creatorID int64, plan string) (int, error) {
+	_, err := m.db.Exec(`INSERT INTO creators (creator_id, plan) VALUES (?, ?)
+		ON CONFLICT (creator_id) DO UPDATE SET plan = excluded.plan`, creatorID, plan)
+	if err != nil {
+		return 0, err
+	}
+	return m.enforcePlanBots(creatorID)
+}
+
+func (m *BotManager) planOf(token string) (string, planLimits) {
+	plan := m.creatorPlan(m.creatorOf(token))
+	return plan, plans[plan]
+}
+
+// 创建者能否再添加或恢复一个机器人，已经登记过的 token 不重复计算
+func (m *BotManager) checkBotLimit(creatorID int64, token string) error {
+	plan := m.creatorPlan(creatorID)
+	limit := plans[plan].Bots
+	if limit == 0 {
+		return nil
+	}
+	var count int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM bots WHERE creator_id = ? AND deleted_at = 0 AND token != ?", creatorID, token).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		metrics.inc("forwardme_plan_limit_hits_total", "limit", "bots")
+		return &planLimitError{Plan: plan, What: "bots", Limit: limit}
+	}
+	return nil
+}
+
+func (m *BotManager) checkBroadcastLimit(token string, recipients int) error {
+	plan, limits := m.planOf(token)
+	if limits.BroadcastSize == 0 || recipients <= limits.BroadcastSize {
+		return nil
+	}
+	metrics.inc("forwardme_plan_limit_hits_total", "limit", "broadcast")
+	return &planLimitError{Plan: plan, What: "recipients", Limit: limits.BroadcastSize}
+}
+
+func formatPlanLimits(plan string) string {
+	limits := plans[plan]
+	describe := func(n int, unit string) string {
+		if n == 0 {
+			return "不限"
+		}
+		return strconv.Itoa(n) + unit
+	}
+	return fmt.Sprintf("%s：机器人 %s，单次群发 %s，数据保留 %s", plan,
+		describe(limits.Bots, " 个"), describe(limits.BroadcastSize, " 人"), describe(limits.RetentionDays, " 天"))
+}
+
+// 处理运营者的 /plan <创建者ID> [free|pro]，无参数时列出套餐和单独设置过套餐的创建者
+func (m *BotManager) handlePlanCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	fields := strings.Fields(message.CommandArguments())
+	if len(fields) == 0 {
+		var b strings.Builder
+		b.WriteString("套餐：\n")
+		for _, name := range []string{planFree, planPro} {
+			b.WriteString(formatPlanLimits(name) + "\n")
+		}
+		fmt.Fprintf(&b, "未单独设置的创建者使用 %s\n", m.defaultPlan)
+		entries, err := m.queryStrings("SELECT creator_id || '：' || plan FROM creators WHERE plan != '' ORDER BY creator_id")
+		if err != nil {
+			log.Printf("Failed to list creator plans: %v", err)
+		} else if len(entries) > 0 {
+			b.WriteString("\n" + strings.Join(entries, "\n") + "\n")
+		}
+		b.WriteString("\n用法：/plan <创建者ID> [free|pro]")
+		managerBot.Send(tgbotapi.NewMessage(chatID, b.String()))
+		return
+	}
+
+	creatorID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || len(fields) > 2 {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "用法：/plan <创建者ID> [free|pro]"))
+		return
+	}
+	if len(fields) == 1 {
+		plan := m.creatorPlan(creatorID)
+		managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("创建者 %d 的套餐：%s", creatorID, formatPlanLimits(plan))))
+		return
+	}
+	plan := strings.ToLower(fields[1])
+	if _, ok := plans[plan]; !ok {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "未知的套餐，可选：free、pro"))
+		return
+	}
+	paused, err := m.setCreatorPlan(creatorID, plan)
+	if err != nil {
+		log.Printf("Failed to set plan of creator %d: %v", creatorID, err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to update plan.")))
+		return
+	}
+	m.logEvent("", message.From.ID, eventPlan, creatorID, plan)
+	text := fmt.Sprintf("创建者 %d 的套餐已设置为 %s", creatorID, formatPlanLimits(plan))
+	if paused > 0 {
+		text += fmt.Sprintf("\n超出套餐的 %d 个机器人已暂停服务", paused)
+	}
+	managerBot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+type apiPlan struct {
+	CreatorID int64      `json:"creator_id"`
+	Plan      string     `json:"plan"`
+	Limits    planLimits `json:"limits"`
+}
+
+func (m *BotManager) apiGetPlan(r *http.Request) apiResponse {
+	creatorID, err := strconv.ParseInt(r.PathValue("creator"), 10, 64)
+	if err != nil {
+		return apiError(http.StatusBadRequest, "invalid creator id")
+	}
+	plan := m.creatorPlan(creatorID)
+	return apiResponse{http.StatusOK, apiPlan{creatorID, plan, plans[plan]}}
+}
+
+func (m *BotManager) apiSetPlan(r *http.Request) apiResponse {
+	creatorID, err := strconv.ParseInt(r.PathValue("creator"), 10, 64)
+	if err != nil {
+		return apiError(http.StatusBadRequest, "invalid creator id")
+	}
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return apiError(http.StatusBadRequest, "plan is required")
+	}
+	if _, ok := plans[req.Plan]; !ok {
+		return apiError(http.StatusBadRequest, "unknown plan")
+	}
+	if _, err := m.setCreatorPlan(creatorID, req.Plan); err != nil {
+		log.Printf("Failed to set plan of creator %d: %v", creatorID, err)
+		return apiError(http.StatusInternalServerError, "failed to update plan")
+	}
+	m.logEvent("", 0, eventPlan, creatorID, "api: "+req.Plan)
+	return apiResponse{http.StatusOK, apiPlan{creatorID, req.Plan, plans[req.Plan]}}
+}
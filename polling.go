@@ -0,0 +1,70 @@
+package main
+
+import (
+	"time"
+)
+
+// 按最近一次收到更新的时间调整长轮询：活跃的机器人缩短超时，尽快发现断开的连接；
+// 一天没有消息的机器人延长超时并在空轮询后暂停，减少对 Telegram 的请求
+const (
+	pollActiveWithin = time.Hour
+	pollIdleAfter    = 24 * time.Hour
+)
+
+type pollMode struct {
+	name string
+	// getUpdates 的长轮询超时，单位秒
+	timeout int
+	// 空轮询后再等待多久发起下一次轮询
+	pause time.Duration
+}
+
+var (
+	pollModeActive = pollMode{"active", 25, 0}
+	pollModeNormal = pollMode{"normal", 60, 0}
+	pollModeIdle   = pollMode{"idle", 120, 30 * time.Second}
+)
+
+func choosePollMode(lastUpdate, now time.Time) pollMode {
+	switch idle := now.Sub(lastUpdate); {
+	case idle < pollActiveWithin:
+		return pollModeActive
+	case idle < pollIdleAfter:
+		return pollModeNormal
+	default:
+		return pollModeIdle
+	}
+}
+
+// 启动时用用户最近一次使用的时间作为机器人最近的活动时间
+func (m *BotManager) lastActivity(token string) time.Time {
+	var lastSeen int64
+	m.db.QueryRow("SELECT COALESCE(MAX(last_seen), 0) FROM bot_users WHERE bot_token = ?", token).Scan(&lastSeen)
+	return time.Unix(lastSeen, 0)
+}
+
+func (m *BotManager) recordPollMode(token string, mode pollMode) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	h, ok := m.health[token]
+	if !ok {
+		h = &botHealth{}
+		m.health[token] = h
+	}
+	h.PollMode = mode.name
+}
+
+// 各轮询方式下的机器人数量
+func (m *BotManager) pollModeCounts() map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	counts := make(map[string]int64)
+	for token, h := range m.health {
+		if _, running := m.bots[token]; running && h.PollMode != "" {
+			counts[h.PollMode]++
+		}
+	}
+	return counts
+}
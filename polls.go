@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram 投票的选项数量限制
+const (
+	minPollOptions = 2
+	maxPollOptions = 10
+)
+
+type survey struct {
+	ID        int64
+	Question  string
+	Options   []string
+	Target    audience
+	CreatedAt time.Time
+}
+
+// 解析 "问题 | 选项1 | 选项2"
+func parseSurvey(text string) (question string, options []string, err error) {
+	parts := strings.Split(text, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	if len(parts) < minPollOptions+1 || parts[0] == "" {
+		return "", nil, fmt.Errorf("need a question and at least %d options", minPollOptions)
+	}
+	if len(parts) > maxPollOptions+1 {
+		return "", nil, fmt.Errorf("at most %d options", maxPollOptions)
+	}
+	for _, o := range parts[1:] {
+		if o == "" {
+			return "", nil, fmt.Errorf("empty option")
+		}
+	}
+	return parts[0], parts[1:], nil
+}
+
+// 每个用户收到的投票 ID 不同，逐个记录到所属的调查
+func (m *BotManager) sendSurvey(bot *tgbotapi.BotAPI, s survey, recipients []int64) (sent, failed int) {
+	return m.broadcast(bot, recipients, func(userID int64) error {
+		poll := tgbotapi.NewPoll(userID, s.Question, s.Options...)
+		poll.IsAnonymous = false
+		msg, err := bot.Send(poll)
+		if err != nil {
+			return err
+		}
+		if msg.Poll != nil {
+			if _, err := m.db.Exec("INSERT OR IGNORE INTO survey_polls (poll_id, survey_id, bot_token) VALUES (?, ?, ?)", msg.Poll.ID, s.ID, bot.Token); err != nil {
+				log.Printf("Failed to record poll %s of survey #%d: %v", msg.Poll.ID, s.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// 记录用户的投票，撤回投票时删除
+func (m *BotManager) recordPollAnswer(token string, answer *tgbotapi.PollAnswer) {
+	var surveyID int64
+	err := m.db.QueryRow("SELECT survey_id FROM survey_polls WHERE poll_id = ? AND bot_token = ?", answer.PollID, token).Scan(&surveyID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up poll %s for bot %s: %v", answer.PollID, botIDFromToken(token), err)
+		}
+		return
+	}
+
+	if len(answer.OptionIDs) == 0 {
+		_, err = m.db.Exec("DELETE FROM survey_answers WHERE survey_id = ? AND user_id = ?", surveyID, answer.User.ID)
+	} else {
+		_, err = m.db.Exec(`INSERT INTO survey_answers (survey_id, user_id, option_id, answered_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (survey_id, user_id) DO UPDATE SET option_id = excluded.option_id, answered_at = excluded.answered_at`,
+			surveyID, answer.User.ID, answer.OptionIDs[0], time.Now().Unix())
+	}
+	if err != nil {
+		log.Printf("Failed to record answer of user %d to survey #%d: %v", answer.User.ID, surveyID, err)
+	}
+}
+
+func (m *BotManager) getSurvey(token string, id int64) (survey, error) {
+	s := survey{ID: id}
+	var options string
+	var createdAt int64
+	err := m.db.QueryRow("SELECT question, options, label, topic, created_at FROM surveys WHERE bot_token = ? AND id = ?", token, id).
+		Scan(&s.Question, &options, &s.Target.Label, &s.Target.Topic, &createdAt)
+	s.Options = strings.Split(options, "\n")
+	s.CreatedAt = time.Unix(createdAt, 0)
+	return s, err
+}
+
+// 调查结果：每个选项的票数和占比
+func (m *BotManager) surveyResults(s survey) (string, error) {
+	counts := make([]int, len(s.Options))
+	rows, err := m.db.Query("SELECT option_id, COUNT(*) FROM survey_answers WHERE survey_id = ? GROUP BY option_id", s.ID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var total int
+	for rows.Next() {
+		var option, count int
+		if err := rows.Scan(&option, &count); err != nil {
+			return "", err
+		}
+		if option >= 0 && option < len(counts) {
+			counts[option] = count
+			total += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	var sentTo int
+	m.db.QueryRow("SELECT COUNT(*) FROM survey_polls WHERE survey_id = ?", s.ID).Scan(&sentTo)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 #%d %s\n发送给 %s 的 %d 位用户，%d 人已投票\n\n", s.ID, s.Question, s.Target, sentTo, total)
+	for i, option := range s.Options {
+		percent := 0
+		if total > 0 {
+			percent = counts[i] * 100 / total
+		}
+		fmt.Fprintf(&b, "%s：%d 票（%d%%）\n", option, counts[i], percent)
+	}
+	return b.String(), nil
+}
+
+// 处理 /poll
+func (m *BotManager) handlePollCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	args := strings.TrimSpace(message.CommandArguments())
+	usage := "用法：\n/poll [#标签|topic:话题] 问题 | 选项1 | 选项2 发送投票\n/poll <编号> 查看结果\n/poll 查看最近的投票"
+
+	if args == "" {
+		rows, err := m.db.Query("SELECT id, question, created_at FROM surveys WHERE bot_token = ? ORDER BY id DESC LIMIT 10", token)
+		if err != nil {
+			log.Printf("Failed to list surveys of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list polls")))
+			return
+		}
+		defer rows.Close()
+		var b strings.Builder
+		for rows.Next() {
+			var id, createdAt int64
+			var question string
+			if err := rows.Scan(&id, &question, &createdAt); err == nil {
+				fmt.Fprintf(&b, "#%d %s（%s）\n", id, question, time.Unix(createdAt, 0).Format("01-02 15:04"))
+			}
+		}
+		if b.Len() == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无投票。\n"+usage))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()+"\n发送 /poll <编号> 查看结果"))
+		return
+	}
+
+	if id, err := strconv.ParseInt(args, 10, 64); err == nil {
+		s, err := m.getSurvey(token, id)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("投票 #%d 不存在", id)))
+			return
+		}
+		results, err := m.surveyResults(s)
+		if err != nil {
+			log.Printf("Failed to get results of survey #%d: %v", id, err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get poll results")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, results))
+		return
+	}
+
+	target, text := parseAudience(args)
+	question, options, err := parseSurvey(text)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "无法解析："+err.Error()+"\n"+usage))
+		return
+	}
+	recipients, err := m.broadcastRecipients(token, target)
+	if err != nil {
+		log.Printf("Failed to load poll recipients of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to load recipients")))
+		return
+	}
+	if len(recipients) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "没有符合条件的用户："+target.String()))
+		return
+	}
+	res, err := m.db.Exec("INSERT INTO surveys (bot_token, question, options, label, topic, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token, question, strings.Join(options, "\n"), target.Label, target.Topic, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to create survey for bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to create poll")))
+		return
+	}
+	s := survey{Question: question, Options: options, Target: target}
+	s.ID, _ = res.LastInsertId()
+
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("开始向 %s 的 %d 位用户发送投票 #%d", target, len(recipients), s.ID)))
+	go func() {
+		sent, failed := m.sendSurvey(bot, s, recipients)
+		m.logEvent(bot.Token, message.From.ID, eventBroadcast, 0, fmt.Sprintf("投票 #%d %s，成功 %d，失败 %d: %s", s.ID, target, sent, failed, s.Question))
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("投票 #%d 发送完成：成功 %d，失败 %d。发送 /poll %d 查看结果", s.ID, sent, failed, s.ID)))
+	}()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const optedOutNotice = "你已停止转发，消息不会发送给对方。发送 /stopforwarding off 恢复转发。"
+
+func (m *BotManager) isOptedOut(token string, userID int64) bool {
+	var exists bool
+	if err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM opted_out_users WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&exists); err != nil {
+		log.Printf("Failed to check opt-out of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return exists
+}
+
+// 处理用户的 /stopforwarding [off]
+func (m *BotManager) handleStopForwardingCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token, userID := bot.Token, message.From.ID
+	if strings.EqualFold(strings.TrimSpace(message.CommandArguments()), "off") {
+		if _, err := m.db.Exec("DELETE FROM opted_out_users WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+			log.Printf("Failed to clear opt-out of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "操作失败，请稍后再试。"))
+			return
+		}
+		log.Printf("User ID: %d resumed forwarding for bot %s.", userID, botIDFromToken(token))
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "已恢复转发，你的消息会再次发送给对方。"))
+		return
+	}
+
+	_, err := m.db.Exec("INSERT OR IGNORE INTO opted_out_users (bot_token, user_id, created_at) VALUES (?, ?, ?)", token, userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to opt out user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "操作失败，请稍后再试。"))
+		return
+	}
+	log.Printf("User ID: %d stopped forwarding for bot %s.", userID, botIDFromToken(token))
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, "已停止转发，之后你发送的消息不会再发送给对方。发送 /stopforwarding off 恢复转发。"))
+}
+
+// 处理用户的 /mydata，列出机器人保存的该用户的数据。创建者的内部备注不包含在内
+func (m *BotManager) handleMyDataCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token, userID := bot.Token, message.From.ID
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 保存的关于你（%d）的数据：\n\n", m.botUsername(token), userID)
+
+	var username, firstName, lastName, source string
+	var firstSeen, lastSeen, messages int64
+	err := m.db.QueryRow("SELECT username, first_name, last_name, source, first_seen, last_seen, message_count FROM bot_users WHERE bot_token = ? AND user_id = ?", token, userID).
+		Scan(&username, &firstName, &lastName, &source, &firstSeen, &lastSeen, &messages)
+	if err == nil {
+		fmt.Fprintf(&b, "资料：%s\n首次使用：%s\n最近使用：%s\n发送的消息：%d\n", displayName(username, firstName, lastName),
+			time.Unix(firstSeen, 0).Format("2006-01-02 15:04"), time.Unix(lastSeen, 0).Format("2006-01-02 15:04"), messages)
+		if source != "" {
+			fmt.Fprintf(&b, "来源：%s\n", source)
+		}
+	}
+
+	counts := []struct {
+		label string
+		query string
+	}{
+		{"已转发的消息", "SELECT COUNT(*) FROM message_map WHERE bot_token = ? AND user_id = ?"},
+		{"收到的回复", "SELECT COUNT(*) FROM reply_log WHERE bot_token = ? AND user_id = ?"},
+		{"对话记录", "SELECT COUNT(*) FROM transcript_entries WHERE bot_token = ? AND user_id = ?"},
+		{"申诉", "SELECT COUNT(*) FROM appeals WHERE bot_token = ? AND user_id = ?"},
+		{"举报", "SELECT COUNT(*) FROM reports WHERE bot_token = ? AND reporter_id = ?"},
+		{"投票记录", "SELECT COUNT(*) FROM survey_answers WHERE survey_id IN (SELECT id FROM surveys WHERE bot_token = ?) AND user_id = ?"},
+		{"领取的兑换码", "SELECT COUNT(*) FROM promo_codes WHERE bot_token = ? AND user_id = ?"},
+		{"待投递的消息", `SELECT (SELECT COUNT(*) FROM queued_messages WHERE bot_token = ?1 AND user_id = ?2)
+			+ (SELECT COUNT(*) FROM throttled_messages WHERE bot_token = ?1 AND user_id = ?2)
+			+ (SELECT COUNT(*) FROM snoozed_messages WHERE bot_token = ?1 AND user_id = ?2)
+			+ (SELECT COUNT(*) FROM pending_approvals WHERE bot_token = ?1 AND user_id = ?2)`},
+	}
+	for _, c := range counts {
+		var n int
+		if err := m.db.QueryRow(c.query, token, userID).Scan(&n); err != nil {
+			log.Printf("Failed to count %s of user %d for bot %s: %v", c.label, userID, botIDFromToken(token), err)
+			continue
+		}
+		fmt.Fprintf(&b, "%s：%d\n", c.label, n)
+	}
+
+	lists := []struct {
+		label string
+		query string
+	}{
+		{"标签", "SELECT label FROM user_labels WHERE bot_token = ? AND user_id = ? ORDER BY label"},
+		{"变量", "SELECT name || ' = ' || value FROM user_vars WHERE bot_token = ? AND user_id = ? ORDER BY name"},
+		{"订阅的话题", `SELECT t.name FROM topic_subscriptions s JOIN topics t ON t.id = s.topic_id
+			WHERE t.bot_token = ? AND s.user_id = ? ORDER BY t.name`},
+		{"封禁原因", "SELECT CASE reason WHEN '' THEN '已封禁' ELSE reason END FROM bans WHERE bot_token = ? AND user_id = ?"},
+	}
+	for _, l := range lists {
+		values, err := m.queryStrings(l.query, token, userID)
+		if err != nil {
+			log.Printf("Failed to list %s of user %d for bot %s: %v", l.label, userID, botIDFromToken(token), err)
+			continue
+		}
+		if len(values) > 0 {
+			fmt.Fprintf(&b, "%s：%s\n", l.label, strings.Join(values, "，"))
+		}
+	}
+
+	flags := []struct {
+		label string
+		set   bool
+	}{
+		{"订阅了 RSS 推送", m.existsFor("feed_subscribers", token, userID)},
+		{"VIP 用户", m.isVIP(token, userID)},
+		{"已通过首条消息审核", m.existsFor("approved_users", token, userID)},
+		{"已停止转发", m.isOptedOut(token, userID)},
+	}
+	for _, f := range flags {
+		if f.set {
+			b.WriteString(f.label + "\n")
+		}
+	}
+
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, b.String()))
+}
+
+func (m *BotManager) queryStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// table 须是按 (bot_token, user_id) 保存的表
+func (m *BotManager) existsFor(table, token string, userID int64) bool {
+	var exists bool
+	m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE bot_token = ? AND user_id = ?)", token, userID).Scan(&exists)
+	return exists
+}
+
+// 按用户保存的表，/forgetuser 会删除其中该用户的全部记录。兑换码的领取记录保留，以免同一个码被再次发放
+var userScopedTables = []string{
+	"message_map", "muted_users", "user_notes", "bot_users", "appeals", "reply_log", "queued_messages",
+	"vip_users", "message_sentiments", "user_labels", "user_vars", "form_progress", "quarantined_messages",
+	"approved_users", "pending_approvals", "user_limits", "throttled_messages", "feed_subscribers",
+	"topic_subscriptions", "opted_out_users", "delivery_failures", "snoozed_users", "snoozed_messages", "transcript_entries", "handled_marks",
+	"admin_message_map", "pinned_users", "away_replies", "delayed_replies", "user_topics",
+}
+
+// 删除机器人保存的某个用户的全部数据，包括封禁记录。审计日志只能追加，不受影响
+func (m *BotManager) forgetUser(token string, userID int64) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range userScopedTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+			return fmt.Errorf("delete from %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM survey_answers WHERE survey_id IN (SELECT id FROM surveys WHERE bot_token = ?) AND user_id = ?", token, userID); err != nil {
+		return fmt.Errorf("delete from survey_answers: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.userWrites.forget(token, userID)
+	// 封禁列表和申诉次数还保存在 bots 表中，交给 unblockUser 一并清理
+	return m.unblockUser(token, userID)
+}
+
+// 处理创建者的 /forgetuser <ID>，确认后删除该用户的全部数据
+func (m *BotManager) handleForgetUserCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	userID, _, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "请提供要删除数据的 Telegram ID，例如：/forgetuser 123456，或回复一条转发消息发送 /forgetuser"))
+		return
+	}
+	actorID := message.From.ID
+	prompt := fmt.Sprintf("确认删除用户 %d 的全部数据？包括资料、消息记录、标签、变量、备注、订阅和封禁记录，此操作不可恢复。", userID)
+	m.askConfirmation(bot, creatorID, actorID, prompt, "确认删除", func() {
+		if err := m.forgetUser(token, userID); err != nil {
+			log.Printf("Failed to forget user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete user data")))
+			return
+		}
+		log.Printf("User %d deleted all data of user %d for bot %s.", actorID, userID, botIDFromToken(token))
+		m.logEvent(token, actorID, eventForget, userID, "")
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已删除用户 %d 的全部数据", userID)))
+	})
+}
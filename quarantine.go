@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /quarantine 一次列出的条数
+const quarantineListSize = 10
+
+type quarantinedMessage struct {
+	ID        int64
+	UserID    int64
+	ChatID    int64
+	MessageID int
+	Score     int
+	Reasons   string
+	Preview   string
+	Name      string
+}
+
+func (q quarantinedMessage) String() string {
+	name := q.Name
+	if name == "" {
+		name = "未知用户"
+	}
+	return fmt.Sprintf("#%d %s (ID: %d)\n风险分 %d：%s\n\n%s", q.ID, name, q.UserID, q.Score, q.Reasons, q.Preview)
+}
+
+// 消息的简短预览，非文本消息显示类型
+func messagePreview(message *tgbotapi.Message) string {
+	text := message.Text
+	if text == "" {
+		text = "[" + messageType(message) + "] " + message.Caption
+	}
+	return truncateText(text, 200)
+}
+
+func truncateText(text string, limit int) string {
+	if r := []rune(text); len(r) > limit {
+		return string(r[:limit]) + "…"
+	}
+	return text
+}
+
+// 风险分达到阈值的消息进入隔离区，不转发给创建者
+func (m *BotManager) quarantineRisky(bot *tgbotapi.BotAPI, message *tgbotapi.Message, score int, reasons []string) bool {
+	threshold := m.riskThreshold(bot.Token)
+	if threshold == 0 || score < threshold {
+		return false
+	}
+	_, err := m.db.Exec(`INSERT INTO quarantined_messages (bot_token, user_id, chat_id, message_id, score, reasons, preview, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		bot.Token, message.From.ID, message.Chat.ID, message.MessageID, score, strings.Join(reasons, "、"), m.storedPreview(bot.Token, message), time.Now().Unix())
+	if err != nil {
+		// 隔离失败时照常转发，避免丢消息
+		log.Printf("Failed to quarantine message from user %d for bot %s: %v", message.From.ID, botIDFromToken(bot.Token), err)
+		return false
+	}
+	log.Printf("Quarantined message from user %d for bot %s, risk score %d", message.From.ID, botIDFromToken(bot.Token), score)
+	metrics.inc("forwardme_messages_quarantined_total", "bot", botIDFromToken(bot.Token))
+	return true
+}
+
+func (m *BotManager) listQuarantine(token string) (entries []quarantinedMessage, total int, err error) {
+	if err = m.db.QueryRow("SELECT COUNT(*) FROM quarantined_messages WHERE bot_token = ?", token).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := m.db.Query(`SELECT q.id, q.user_id, q.chat_id, q.message_id, q.score, q.reasons, q.preview,
+			COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, '')
+		FROM quarantined_messages q
+		LEFT JOIN bot_users u ON u.bot_token = q.bot_token AND u.user_id = q.user_id
+		WHERE q.bot_token = ? ORDER BY q.id LIMIT ?`, token, quarantineListSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var q quarantinedMessage
+		var username, firstName, lastName string
+		if err := rows.Scan(&q.ID, &q.UserID, &q.ChatID, &q.MessageID, &q.Score, &q.Reasons, &q.Preview, &username, &firstName, &lastName); err != nil {
+			return nil, 0, err
+		}
+		q.Name = displayName(username, firstName, lastName)
+		entries = append(entries, q)
+	}
+	return entries, total, rows.Err()
+}
+
+func (m *BotManager) getQuarantined(token string, id int64) (q quarantinedMessage, err error) {
+	err = m.db.QueryRow("SELECT id, user_id, chat_id, message_id, score, reasons, preview FROM quarantined_messages WHERE bot_token = ? AND id = ?",
+		token, id).Scan(&q.ID, &q.UserID, &q.ChatID, &q.MessageID, &q.Score, &q.Reasons, &q.Preview)
+	return q, err
+}
+
+// 处理 /quarantine，每条隔离的消息附带放行和封禁按钮
+func (m *BotManager) handleQuarantineCommand(bot *tgbotapi.BotAPI, creatorID int64) {
+	entries, total, err := m.listQuarantine(bot.Token)
+	if err != nil {
+		log.Printf("Failed to list quarantine of bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list quarantine")))
+		return
+	}
+	if total == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "隔离区为空。使用 /risk <分数> 设置自动隔离阈值"))
+		return
+	}
+	header := fmt.Sprintf("隔离区共 %d 条消息", total)
+	if total > len(entries) {
+		header += fmt.Sprintf("，以下是最早的 %d 条", len(entries))
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, header))
+
+	for _, q := range entries {
+		msg := tgbotapi.NewMessage(creatorID, q.String())
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("放行", signCallback(bot.Token, cbQuarantineOK, q.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("封禁", signCallback(bot.Token, cbQuarantineBan, q.ID)),
+		))
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("Failed to send quarantined message #%d for bot %s: %v", q.ID, botIDFromToken(bot.Token), err)
+		}
+	}
+}
+
+// 处理隔离区的放行和封禁按钮，返回是否已处理
+func (m *BotManager) handleQuarantineCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData, creatorID int64) bool {
+	if cb.Action != cbQuarantineOK && cb.Action != cbQuarantineBan {
+		return false
+	}
+	if query.Message == nil {
+		return true
+	}
+	id, ok := cb.int(0)
+	if !ok {
+		log.Printf("Invalid quarantine callback: %s", query.Data)
+		return true
+	}
+	q, err := m.getQuarantined(bot.Token, id)
+	if err != nil {
+		bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\n已处理"))
+		return true
+	}
+
+	var status string
+	if cb.Action == cbQuarantineOK {
+		if !m.forwardUserMessage(bot, creatorID, q.ChatID, q.UserID, q.MessageID) {
+			bot.Send(tgbotapi.NewMessage(creatorID, "Failed to release message"))
+			return true
+		}
+		_, err = m.db.Exec("DELETE FROM quarantined_messages WHERE bot_token = ? AND id = ?", bot.Token, id)
+		status = "✅ 已放行"
+	} else {
+		if err := m.blockUser(bot.Token, q.UserID, "隔离区封禁"); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to block user")))
+			return true
+		}
+		m.logEvent(bot.Token, query.From.ID, eventBan, q.UserID, "隔离区封禁")
+		// 封禁后该用户的其他隔离消息也不再需要处理
+		_, err = m.db.Exec("DELETE FROM quarantined_messages WHERE bot_token = ? AND user_id = ?", bot.Token, q.UserID)
+		status = "⛔ 已封禁"
+	}
+	if err != nil {
+		log.Printf("Failed to remove quarantined message #%d for bot %s: %v", id, botIDFromToken(bot.Token), err)
+	}
+	bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\n"+status))
+	return true
+}
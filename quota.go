@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /quota 统计最近多少分钟的请求，按分钟分桶
+const quotaWindowMinutes = 60
+
+// 一分钟内的请求数达到该值时提示有被限流的风险。Telegram 对单个机器人的发送限制约为每秒 30 条
+const quotaRiskPerMinute = 1200
+
+type quotaBucket struct {
+	minute    int64
+	requests  int64
+	throttled int64
+	methods   map[string]int64
+}
+
+// 每个机器人最近一段时间的 Bot API 请求数和 429 次数，只保存在内存中
+type apiQuotaTracker struct {
+	mu   sync.Mutex
+	bots map[string]*[quotaWindowMinutes]quotaBucket
+}
+
+var apiQuota = &apiQuotaTracker{bots: make(map[string]*[quotaWindowMinutes]quotaBucket)}
+
+func (t *apiQuotaTracker) record(botID, method string, throttled bool, now time.Time) {
+	minute := now.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	buckets, ok := t.bots[botID]
+	if !ok {
+		buckets = new([quotaWindowMinutes]quotaBucket)
+		t.bots[botID] = buckets
+	}
+	b := &buckets[minute%quotaWindowMinutes]
+	if b.minute != minute {
+		*b = quotaBucket{minute: minute, methods: make(map[string]int64)}
+	}
+	b.requests++
+	b.methods[method]++
+	if throttled {
+		b.throttled++
+	}
+}
+
+// 一个机器人在统计窗口内的用量
+type botQuota struct {
+	BotID      string
+	LastMinute int64
+	PeakMinute int64
+	Requests   int64
+	Throttled  int64
+	Methods    map[string]int64
+}
+
+func (q botQuota) atRisk() bool {
+	return q.Throttled > 0 || q.PeakMinute >= quotaRiskPerMinute
+}
+
+// 统计窗口内有请求的机器人，被限流或峰值高的排在前面
+func (t *apiQuotaTracker) snapshot(now time.Time) []botQuota {
+	current := now.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var list []botQuota
+	for botID, buckets := range t.bots {
+		q := botQuota{BotID: botID, Methods: make(map[string]int64)}
+		for _, b := range buckets {
+			if b.minute <= current-quotaWindowMinutes || b.requests == 0 {
+				continue
+			}
+			q.Requests += b.requests
+			q.Throttled += b.throttled
+			q.PeakMinute = max(q.PeakMinute, b.requests)
+			if b.minute == current {
+				q.LastMinute = b.requests
+			}
+			for method, n := range b.methods {
+				q.Methods[method] += n
+			}
+		}
+		if q.Requests > 0 {
+			list = append(list, q)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Throttled != list[j].Throttled {
+			return list[i].Throttled > list[j].Throttled
+		}
+		if list[i].PeakMinute != list[j].PeakMinute {
+			return list[i].PeakMinute > list[j].PeakMinute
+		}
+		return list[i].BotID < list[j].BotID
+	})
+	return list
+}
+
+// 记录一次 Bot API 请求。地址的最后两段是 bot<token> 和方法名，本地 Bot API 服务器相同
+func recordAPIRequest(req *http.Request, resp *http.Response) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) < 2 || !strings.HasPrefix(parts[len(parts)-2], "bot") {
+		return
+	}
+	botID := botIDFromToken(strings.TrimPrefix(parts[len(parts)-2], "bot"))
+	method := parts[len(parts)-1]
+	throttled := resp != nil && resp.StatusCode == http.StatusTooManyRequests
+	metrics.inc("forwardme_api_requests_total", "bot", botID, "method", method)
+	if throttled {
+		metrics.inc("forwardme_api_throttled_total", "bot", botID, "method", method)
+	}
+	apiQuota.record(botID, method, throttled, time.Now())
+}
+
+// 机器人 ID 对应的显示名称，管理机器人也可能出现在统计中
+func (m *BotManager) quotaBotName(botID string) string {
+	if bot, ok := m.botByID(botID); ok {
+		return "@" + bot.Self.UserName
+	}
+	if m.managerBot != nil && botIDFromToken(m.managerBot.Token) == botID {
+		return "管理机器人 @" + m.managerBot.Self.UserName
+	}
+	return botID
+}
+
+// 请求最多的几个方法
+func topMethods(methods map[string]int64, n int) string {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if methods[names[i]] != methods[names[j]] {
+			return methods[names[i]] > methods[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	var parts []string
+	for _, name := range names[:min(n, len(names))] {
+		parts = append(parts, fmt.Sprintf("%s %d", name, methods[name]))
+	}
+	return strings.Join(parts, "、")
+}
+
+// 处理运营者的 /quota：各机器人最近一小时的 Bot API 请求数和被限流次数，群发前检查哪些机器人有被限流的风险
+func (m *BotManager) handleQuotaCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	list := apiQuota.snapshot(time.Now())
+	if len(list) == 0 {
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("最近 %d 分钟没有 Bot API 请求", quotaWindowMinutes)))
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "最近 %d 分钟的 Bot API 用量（不含 getUpdates）：\n\n", quotaWindowMinutes)
+	for i, q := range list {
+		if i == digestMaxUsers {
+			fmt.Fprintf(&b, "……另有 %d 个机器人\n", len(list)-digestMaxUsers)
+			break
+		}
+		mark := ""
+		if q.atRisk() {
+			mark = "⚠️ "
+		}
+		fmt.Fprintf(&b, "%s%s：最近 1 分钟 %d 次，峰值每分钟 %d 次，共 %d 次", mark, m.quotaBotName(q.BotID), q.LastMinute, q.PeakMinute, q.Requests)
+		if q.Throttled > 0 {
+			fmt.Fprintf(&b, "，被限流（429）%d 次（%.1f%%）", q.Throttled, float64(q.Throttled)*100/float64(q.Requests))
+		}
+		fmt.Fprintf(&b, "；%s\n", topMethods(q.Methods, 3))
+	}
+	fmt.Fprintf(&b, "\n⚠️ 表示最近被限流或每分钟请求达到 %d 次，接近 Telegram 约每秒 30 条的发送限制，群发前请留意", quotaRiskPerMinute)
+	managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, b.String()))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 权限，同时也是 API token 的权限范围：admin 包含全部权限，其他权限都包含 read
+const (
+	permRead     = "read"
+	permModerate = "moderation"
+	permMessage  = "messaging"
+	permManage   = "admin"
+)
+
+// 统一的角色模型，管理机器人命令、子机器人管理命令、API 和控制台都按角色判断权限
+type role string
+
+const (
+	// 实例运营者（OPERATOR_IDS），对所有机器人拥有全部权限
+	roleOperator role = "operator"
+	// 机器人的创建者，以及创建者休假期间的代理人
+	roleCreator role = "creator"
+	// 创建者通过 /role 授权的机器人管理员，可以查看、审核和群发，不能修改设置
+	roleBotOperator role = "bot_operator"
+	// 创建者通过 /addadmin 添加的管理员，权限同上，另外和创建者一样接收用户消息并直接回复
+	roleBotAdmin role = "bot_admin"
+	// 只读审计员，可以是实例级（AUDITOR_IDS）或由创建者针对单个机器人授权
+	roleAuditor role = "auditor"
+)
+
+var rolePermissions = map[role][]string{
+	roleOperator:    {permManage},
+	roleCreator:     {permManage},
+	roleBotOperator: {permModerate, permMessage},
+	roleBotAdmin:    {permModerate, permMessage},
+	roleAuditor:     {permRead},
+}
+
+func permissionAllows(have, need string) bool {
+	return have == permManage || have == need || need == permRead
+}
+
+func roleAllows(r role, need string) bool {
+	for _, have := range rolePermissions[r] {
+		if permissionAllows(have, need) {
+			return true
+		}
+	}
+	return false
+}
+
+// 子机器人管理命令所需的权限，未列出的命令需要 admin
+var botCommandPermissions = map[string]string{
+	"getbans":    permRead,
+	"labels":     permRead,
+	"vars":       permRead,
+	"commands":   permRead,
+	"roles":      permRead,
+	"auditlog":   permRead,
+	"info":       permRead,
+	"chatbans":   permRead,
+	"pending":    permRead,
+	"ban":        permModerate,
+	"unban":      permModerate,
+	"banchat":    permModerate,
+	"unbanchat":  permModerate,
+	"banmany":    permModerate,
+	"unbanmany":  permModerate,
+	"mute":       permModerate,
+	"unmute":     permModerate,
+	"snoozeuser": permModerate,
+	"handled":    permModerate,
+	"pin":        permModerate,
+	"unpin":      permModerate,
+	"note":       permModerate,
+	"vip":        permModerate,
+	"unvip":      permModerate,
+	"limit":      permModerate,
+	"quarantine": permModerate,
+	"del":        permMessage,
+	"sendat":     permMessage,
+	"usertz":     permMessage,
+	"save":       permMessage,
+	"delsnippet": permMessage,
+	"snippets":   permMessage,
+	"r":          permMessage,
+	"broadcast":  permMessage,
+	"poll":       permMessage,
+	"schedules":  permMessage,
+}
+
+func botCommandPermission(command string) string {
+	if perm, ok := botCommandPermissions[command]; ok {
+		return perm
+	}
+	return permManage
+}
+
+func containsID(ids []int64, userID int64) bool {
+	for _, id := range ids {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户在整个实例上的角色，没有时返回空字符串
+func (m *BotManager) instanceRole(userID int64) role {
+	switch {
+	case containsID(m.operators, userID):
+		return roleOperator
+	case containsID(m.auditors, userID):
+		return roleAuditor
+	}
+	return ""
+}
+
+// 用户在某个机器人上的角色，实例角色也会生效，没有时返回空字符串。
+// 会获取 m.mu 的读锁，不能在持有锁时调用
+func (m *BotManager) botRole(token string, userID int64) role {
+	if m.instanceRole(userID) == roleOperator {
+		return roleOperator
+	}
+	owner := m.creatorOf(token)
+	if userID == owner {
+		return roleCreator
+	}
+	// 休假代理人只代为接收和处理消息，不能修改机器人的设置
+	if userID == m.onDutyID(owner) {
+		return roleBotAdmin
+	}
+	var granted string
+	err := m.db.QueryRow("SELECT role FROM bot_roles WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&granted)
+	if err == nil {
+		return role(granted)
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Failed to get role of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return m.instanceRole(userID)
+}
+
+func (m *BotManager) botCan(token string, userID int64, perm string) bool {
+	return roleAllows(m.botRole(token, userID), perm)
+}
+
+func (m *BotManager) instanceCan(userID int64, perm string) bool {
+	return roleAllows(m.instanceRole(userID), perm)
+}
+
+var roleNames = map[role]string{
+	roleOperator:    "运营者",
+	roleCreator:     "创建者",
+	roleBotOperator: "管理员",
+	roleBotAdmin:    "接收消息的管理员",
+	roleAuditor:     "审计员",
+}
+
+// 授予用户在机器人上的角色，已有角色时替换
+func (m *BotManager) grantBotRole(token string, userID int64, granted role, grantedBy int64) error {
+	_, err := m.db.Exec(`INSERT INTO bot_roles (bot_token, user_id, role, granted_by, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(bot_token, user_id) DO UPDATE SET role = excluded.role, granted_by = excluded.granted_by`,
+		token, userID, string(granted), grantedBy, time.Now().Unix())
+	return err
+}
+
+// 处理创建者的 /role <ID> operator|auditor|off 和 /roles
+func (m *BotManager) handleRoleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	if message.Command() == "roles" {
+		rows, err := m.db.Query(`SELECT r.user_id, r.role,
+				COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, '')
+			FROM bot_roles r LEFT JOIN bot_users u ON u.bot_token = r.bot_token AND u.user_id = r.user_id
+			WHERE r.bot_token = ? ORDER BY r.created_at`, token)
+		if err != nil {
+			log.Printf("Failed to list roles of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list roles.")))
+			return
+		}
+		defer rows.Close()
+		var b strings.Builder
+		for rows.Next() {
+			var userID int64
+			var r, username, firstName, lastName string
+			if err := rows.Scan(&userID, &r, &username, &firstName, &lastName); err != nil {
+				continue
+			}
+			fmt.Fprintf(&b, "%d %s：%s\n", userID, displayName(username, firstName, lastName), roleNames[role(r)])
+		}
+		if b.Len() == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂未授权其他人管理此机器人，使用 /role <ID> operator|auditor 授权"))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+		return
+	}
+
+	usage := "用法：/role <ID> operator|auditor|off\noperator 可以查看、封禁和群发，auditor 只能查看"
+	fields := strings.Fields(message.CommandArguments())
+	if len(fields) != 2 {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	userID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || userID == m.creatorOf(token) {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+
+	var granted role
+	switch fields[1] {
+	case "operator":
+		granted = roleBotOperator
+	case "auditor":
+		granted = roleAuditor
+	case "off":
+		if _, err := m.db.Exec("DELETE FROM bot_roles WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+			log.Printf("Failed to revoke role of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to revoke role.")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已取消 %d 的授权", userID)))
+		return
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+
+	if err := m.grantBotRole(token, userID, granted, message.From.ID); err != nil {
+		log.Printf("Failed to grant role to user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to grant role.")))
+		return
+	}
+	log.Printf("User %d granted role %s on bot %s to user %d.", message.From.ID, granted, botIDFromToken(token), userID)
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已将 %d 设为%s", userID, roleNames[granted])))
+	// 对方可能还没有启动过机器人，通知失败时忽略
+	bot.Send(tgbotapi.NewMessage(userID, fmt.Sprintf("你已被设为 @%s 的%s，发送管理命令即可使用", bot.Self.UserName, roleNames[granted])))
+}
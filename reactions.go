@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 表情回应可以触发的操作，名称与对应的命令相同，权限也按命令判断
+var reactionActions = map[string]string{
+	"ban":     "封禁",
+	"mute":    "静音",
+	"handled": "标记为已处理",
+	"vip":     "设为 VIP",
+}
+
+// 机器人设置的表情回应快捷操作，emoji 到操作
+func (m *BotManager) reactionShortcuts(token string) (map[string]string, error) {
+	rows, err := m.db.Query("SELECT emoji, action FROM reaction_actions WHERE bot_token = ?", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shortcuts := make(map[string]string)
+	for rows.Next() {
+		var emoji, action string
+		if err := rows.Scan(&emoji, &action); err != nil {
+			return nil, err
+		}
+		shortcuts[emoji] = action
+	}
+	return shortcuts, rows.Err()
+}
+
+// 对转交的消息加上表情回应时，按设置对发送者执行对应的操作，并安静地回复一条确认。
+// 只处理转交聊天中有权限的人新加上的回应
+func (m *BotManager) handleReaction(bot *tgbotapi.BotAPI, ownerID, creatorID int64, reaction *messageReaction) {
+	token := bot.Token
+	if reaction.User == nil || reaction.Chat.ID != m.relayChat(token, creatorID) && reaction.Chat.ID != ownerID && !m.isBotAdmin(token, reaction.Chat.ID) {
+		return
+	}
+	added := reaction.added()
+	if len(added) == 0 {
+		return
+	}
+	shortcuts, err := m.reactionShortcuts(token)
+	if err != nil {
+		log.Printf("Failed to get reaction shortcuts of bot %s: %v", botIDFromToken(token), err)
+		return
+	}
+	userID, ok := m.lookupChatMapping(token, reaction.Chat.ID, reaction.MessageID)
+	if !ok {
+		return
+	}
+
+	operatorID := reaction.User.ID
+	for _, emoji := range added {
+		action, ok := shortcuts[emoji]
+		if !ok {
+			continue
+		}
+		if !m.botCan(token, operatorID, botCommandPermission(action)) {
+			log.Printf("Denied reaction %s of user %d for bot %s", action, operatorID, botIDFromToken(token))
+			continue
+		}
+		if err := m.runReactionAction(token, operatorID, action, userID); err != nil {
+			log.Printf("Failed to run reaction %s on user %d for bot %s: %v", action, userID, botIDFromToken(token), err)
+			continue
+		}
+		log.Printf("Reaction %s by %d ran %s on user %d for bot %s.", emoji, operatorID, action, userID, botIDFromToken(token))
+		confirm := tgbotapi.NewMessage(reaction.Chat.ID, fmt.Sprintf("%s 用户ID: %d 已%s", emoji, userID, reactionActions[action]))
+		confirm.ReplyToMessageID = reaction.MessageID
+		confirm.AllowSendingWithoutReply = true
+		confirm.DisableNotification = true
+		bot.Send(confirm)
+	}
+}
+
+func (m *BotManager) runReactionAction(token string, operatorID int64, action string, userID int64) error {
+	switch action {
+	case "ban":
+		if err := m.blockUser(token, userID, ""); err != nil {
+			return err
+		}
+		m.logEvent(token, operatorID, eventBan, userID, "")
+	case "mute":
+		if err := m.muteUser(token, userID); err != nil {
+			return err
+		}
+		m.logEvent(token, operatorID, eventMute, userID, "")
+	case "handled":
+		return m.markHandled(token, userID)
+	case "vip":
+		return m.setVIP(token, userID, true)
+	}
+	return nil
+}
+
+// 处理 /reaction [<emoji> <操作>|<emoji> off]
+func (m *BotManager) handleReactionCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/reaction <emoji> <操作> 设置快捷操作，对转交的消息加上该表情回应即可对发送者执行，例如 /reaction 🚫 ban、/reaction ✅ handled、/reaction ⭐ vip；" +
+		"可用的操作：ban（封禁）、mute（静音）、handled（标记已处理）、vip（设为 VIP）。/reaction <emoji> off 取消"
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		shortcuts, err := m.reactionShortcuts(token)
+		if err != nil {
+			log.Printf("Failed to get reaction shortcuts of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list reaction shortcuts")))
+			return
+		}
+		if len(shortcuts) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "未设置表情回应快捷操作。\n"+usage))
+			return
+		}
+		emojis := make([]string, 0, len(shortcuts))
+		for emoji := range shortcuts {
+			emojis = append(emojis, emoji)
+		}
+		sort.Strings(emojis)
+		var b strings.Builder
+		b.WriteString("表情回应快捷操作：\n")
+		for _, emoji := range emojis {
+			fmt.Fprintf(&b, "%s → %s\n", emoji, reactionActions[shortcuts[emoji]])
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+		return
+	}
+	if len(args) != 2 || utf8.RuneCountInString(args[0]) > 4 {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+
+	emoji, action := args[0], strings.ToLower(args[1])
+	var err error
+	if action == "off" {
+		_, err = m.db.Exec("DELETE FROM reaction_actions WHERE bot_token = ? AND emoji = ?", token, emoji)
+	} else if _, ok := reactionActions[action]; ok {
+		_, err = m.db.Exec("INSERT OR REPLACE INTO reaction_actions (bot_token, emoji, action) VALUES (?, ?, ?)", token, emoji, action)
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update reaction shortcut of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update reaction shortcut")))
+		return
+	}
+	if action == "off" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已取消 "+emoji+" 的快捷操作"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已设置：对转交的消息加上 %s 回应即可把发送者%s", emoji, reactionActions[action])))
+	}
+}
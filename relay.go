@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 机器人是否以复制的方式转交用户消息，默认使用转发
+func (m *BotManager) relaysByCopy(token string) bool {
+	var enabled bool
+	err := m.db.QueryRow("SELECT relay_copy FROM bots WHERE token = ?", token).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get relay mode of bot %s: %v", botIDFromToken(token), err)
+	}
+	return enabled
+}
+
+// 复制模式下消息前的来源说明：名字、ID 和用户名
+func relayHeader(user *tgbotapi.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	header := fmt.Sprintf("👤 %s（%d）", name, user.ID)
+	if user.UserName != "" {
+		header += " @" + user.UserName
+	}
+	return header
+}
+
+// 机器人记录的用户资料，用于稍后转交的消息
+func (m *BotManager) knownUser(token string, userID int64) *tgbotapi.User {
+	user := &tgbotapi.User{ID: userID}
+	err := m.db.QueryRow("SELECT COALESCE(username, ''), COALESCE(first_name, ''), COALESCE(last_name, '') FROM bot_users WHERE bot_token = ? AND user_id = ?",
+		token, userID).Scan(&user.UserName, &user.FirstName, &user.LastName)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get profile of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	return user
+}
+
+// 把用户消息交给创建者，返回创建者一侧的消息 ID。
+// 复制模式先发送一条来源说明，再把消息复制为对它的回复，两条消息都记录映射，
+// 这样没有"转发自"标记，用户开启了转发隐私也能回复。creatorID 是论坛群组时发到用户的话题
+func (m *BotManager) relayToCreator(bot *tgbotapi.BotAPI, creatorID, chatID int64, messageID int, user *tgbotapi.User) (int, error) {
+	token := bot.Token
+	if forumID := m.forumChatID(token); forumID != 0 && creatorID == forumID {
+		return m.relayToTopic(bot, forumID, chatID, messageID, user)
+	}
+	if !m.relaysByCopy(token) {
+		if m.forwardNeedsHeader(token, user.ID) {
+			if _, err := m.sendRelayHeader(bot, creatorID, user, messageID); err != nil {
+				return 0, err
+			}
+		}
+		sent, err := bot.Send(tgbotapi.NewForward(creatorID, chatID, messageID))
+		return sent.MessageID, err
+	}
+
+	headerID, err := m.sendRelayHeader(bot, creatorID, user, messageID)
+	if err != nil {
+		return 0, err
+	}
+
+	copyConfig := tgbotapi.NewCopyMessage(creatorID, chatID, messageID)
+	copyConfig.ReplyToMessageID = headerID
+	copyConfig.AllowSendingWithoutReply = true
+	copied, err := bot.CopyMessage(copyConfig)
+	if err != nil {
+		return 0, err
+	}
+	return copied.MessageID, nil
+}
+
+// 处理 /relaymode forward|copy
+func (m *BotManager) handleRelayModeCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/relaymode copy 把用户消息复制给你并在前面附上用户的名字、ID 和用户名，不显示\"转发自\"，用户开启转发隐私时也能直接回复；/relaymode forward 恢复为转发"
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "转发"
+		if m.relaysByCopy(token) {
+			state = "复制"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "消息转交方式："+state+"\n"+usage))
+		return
+	}
+	if arg != "copy" && arg != "forward" {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if _, err := m.db.Exec("UPDATE bots SET relay_copy = ? WHERE token = ?", arg == "copy", token); err != nil {
+		log.Printf("Failed to update relay mode of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update relay mode")))
+		return
+	}
+	if arg == "copy" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用户消息将以复制的方式转交，并附上来源说明"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用户消息将以转发的方式转交"))
+	}
+}
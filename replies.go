@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram 只允许机器人删除 48 小时内发出的消息
+const replyDeleteWindow = 48 * time.Hour
+
+// 回复总是以机器人的身份发出，不会向用户透露是谁回复的。
+// 这里在内部记录实际回复的人，便于事后追查；creatorMessageID 是创建者一侧的原消息，用于 /del 撤回
+func (m *BotManager) recordReply(token string, userID, operatorID int64, messageID, creatorMessageID int) {
+	_, err := m.db.Exec("INSERT INTO reply_log (bot_token, user_id, operator_id, message_id, creator_message_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token, userID, operatorID, messageID, creatorMessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to record reply of operator %d to user %d for bot %s: %v", operatorID, userID, botIDFromToken(token), err)
+	}
+}
+
+// 回复者在该机器人上设置的署名，未设置时为空
+func (m *BotManager) replySignature(token string, operatorID int64) string {
+	var signature string
+	err := m.db.QueryRow("SELECT signature FROM reply_signatures WHERE bot_token = ? AND operator_id = ?", token, operatorID).Scan(&signature)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get reply signature of %d for bot %s: %v", operatorID, botIDFromToken(token), err)
+	}
+	return signature
+}
+
+// 设置署名，signature 为空时删除
+func (m *BotManager) setReplySignature(token string, operatorID int64, signature string) error {
+	var err error
+	if signature == "" {
+		_, err = m.db.Exec("DELETE FROM reply_signatures WHERE bot_token = ? AND operator_id = ?", token, operatorID)
+	} else {
+		_, err = m.db.Exec(`INSERT INTO reply_signatures (bot_token, operator_id, signature) VALUES (?, ?, ?)
+			ON CONFLICT (bot_token, operator_id) DO UPDATE SET signature = excluded.signature`, token, operatorID, signature)
+	}
+	if err != nil {
+		log.Printf("Failed to update reply signature of %d for bot %s: %v", operatorID, botIDFromToken(token), err)
+	}
+	return err
+}
+
+// 处理 /del：回复自己发出的一条回复并发送，删除已送达用户的那条消息
+func (m *BotManager) handleDeleteReplyCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	if message.ReplyToMessage == nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "请回复一条你发给用户的回复并发送 /del，撤回已送达的消息"))
+		return
+	}
+
+	var id, userID, createdAt int64
+	var messageID int
+	err := m.db.QueryRow("SELECT id, user_id, message_id, created_at FROM reply_log WHERE bot_token = ? AND creator_message_id = ?",
+		token, message.ReplyToMessage.MessageID).Scan(&id, &userID, &messageID, &createdAt)
+	if err == sql.ErrNoRows {
+		bot.Send(tgbotapi.NewMessage(creatorID, "这条消息不是已送达用户的回复，无法撤回"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up reply to message %d for bot %s: %v", message.ReplyToMessage.MessageID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to retract reply")))
+		return
+	}
+	if time.Since(time.Unix(createdAt, 0)) > replyDeleteWindow {
+		bot.Send(tgbotapi.NewMessage(creatorID, "这条回复已发出超过 48 小时，Telegram 不允许撤回"))
+		return
+	}
+
+	if _, err := bot.Request(tgbotapi.NewDeleteMessage(userID, messageID)); err != nil {
+		log.Printf("Failed to delete reply %d to user %d for bot %s: %v", messageID, userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to retract reply")))
+		return
+	}
+	// 已删除的消息无法再转发，不再出现在 /share 和 /transcript 中
+	if _, err := m.db.Exec("DELETE FROM reply_log WHERE id = ?", id); err != nil {
+		log.Printf("Failed to remove retracted reply %d from reply log of bot %s: %v", id, botIDFromToken(token), err)
+	}
+	m.logEvent(token, message.From.ID, eventRetract, userID, "")
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已撤回发给用户ID: %d 的回复", userID)))
+}
+
+// 在回复末尾附上署名
+func signReply(text, signature string) string {
+	if signature == "" {
+		return text
+	}
+	return text + "\n\n— " + signature
+}
+
+// 创建者回复的内容。文字消息按文字发送，媒体使用对应的发送方法，说明文字经 render 处理后一并发送；
+// 贴纸和圆形视频没有说明文字。其他类型的消息（位置、联系人等）原样复制
+func replyConfig(chatID int64, message *tgbotapi.Message, render func(string) string) tgbotapi.Chattable {
+	caption := strings.TrimSpace(render(message.Caption))
+	switch {
+	case message.Text != "":
+		return tgbotapi.NewMessage(chatID, render(message.Text))
+	case message.Photo != nil:
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(message.Photo[len(message.Photo)-1].FileID))
+		photo.Caption = caption
+		return photo
+	case message.Video != nil:
+		video := tgbotapi.NewVideo(chatID, tgbotapi.FileID(message.Video.FileID))
+		video.Caption = caption
+		return video
+	case message.Animation != nil:
+		animation := tgbotapi.NewAnimation(chatID, tgbotapi.FileID(message.Animation.FileID))
+		animation.Caption = caption
+		return animation
+	case message.Document != nil:
+		document := tgbotapi.NewDocument(chatID, tgbotapi.FileID(message.Document.FileID))
+		document.Caption = caption
+		return document
+	case message.Voice != nil:
+		voice := tgbotapi.NewVoice(chatID, tgbotapi.FileID(message.Voice.FileID))
+		voice.Caption = caption
+		return voice
+	case message.Audio != nil:
+		audio := tgbotapi.NewAudio(chatID, tgbotapi.FileID(message.Audio.FileID))
+		audio.Caption = caption
+		return audio
+	case message.Sticker != nil:
+		return tgbotapi.NewSticker(chatID, tgbotapi.FileID(message.Sticker.FileID))
+	case message.VideoNote != nil:
+		return tgbotapi.NewVideoNote(chatID, message.VideoNote.Length, tgbotapi.FileID(message.VideoNote.FileID))
+	}
+	return tgbotapi.NewCopyMessage(chatID, message.Chat.ID, message.MessageID)
+}
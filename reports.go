@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 举报状态
+const (
+	reportOpen      = "open"
+	reportDismissed = "dismissed"
+	reportSuspended = "suspended"
+)
+
+// /reports 一次最多列出的待处理举报数
+const reportQueueLimit = 20
+
+type abuseReport struct {
+	ID         int64
+	BotToken   string
+	ReporterID int64
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// 处理普通用户在子机器人中发送的命令
+func (m *BotManager) handleUserCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	switch message.Command() {
+	case "report":
+		reason := strings.TrimSpace(message.CommandArguments())
+		if reason == "" {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "请说明举报原因，例如：/report 该机器人发送诈骗信息"))
+			return
+		}
+		report, err := m.fileReport(bot.Token, message.From.ID, reason)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "举报提交失败，请稍后再试。"))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "举报已提交给平台运营者，感谢你的反馈。"))
+		m.notifyOperatorsOfReport(report, creatorID)
+	case "subscribe", "unsubscribe":
+		m.handleSubscribeCommand(bot, message)
+	case "topics":
+		m.sendTopicPicker(bot, message)
+	case "getcode":
+		m.handleGetCodeCommand(bot, message)
+	case "mydata":
+		m.handleMyDataCommand(bot, message)
+	case "stopforwarding":
+		m.handleStopForwardingCommand(bot, message)
+	case "timezone":
+		m.handleTimeZoneCommand(bot, message)
+	}
+}
+
+func (m *BotManager) fileReport(token string, reporterID int64, reason string) (abuseReport, error) {
+	now := time.Now()
+	res, err := m.db.Exec("INSERT INTO reports (bot_token, reporter_id, reason, status, created_at) VALUES (?, ?, ?, ?, ?)",
+		token, reporterID, reason, reportOpen, now.Unix())
+	if err != nil {
+		log.Printf("Failed to file report from user %d against bot %s: %v", reporterID, botIDFromToken(token), err)
+		return abuseReport{}, err
+	}
+	id, _ := res.LastInsertId()
+	log.Printf("User ID: %d filed report %d against bot %s.", reporterID, id, botIDFromToken(token))
+	return abuseReport{ID: id, BotToken: token, ReporterID: reporterID, Reason: reason, CreatedAt: now}, nil
+}
+
+func (m *BotManager) reportKeyboard(id int64) tgbotapi.InlineKeyboardMarkup {
+	token := m.managerCallbackKey()
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("暂停该机器人", signCallback(token, cbReportSuspend, id)),
+		tgbotapi.NewInlineKeyboardButtonData("忽略", signCallback(token, cbReportDismiss, id)),
+	))
+}
+
+func (m *BotManager) formatReport(r abuseReport, creatorID int64) string {
+	return fmt.Sprintf("举报 #%d\n机器人: %s（创建者 %d）\n举报人: %d\n时间: %s\n原因: %s",
+		r.ID, m.botUsername(r.BotToken), creatorID, r.ReporterID, r.CreatedAt.Format("2006-01-02 15:04"), r.Reason)
+}
+
+// 通过管理机器人通知所有运营者
+func (m *BotManager) notifyOperators(text string, markup interface{}) {
+	managerBot := m.activeManagerBot()
+	if managerBot == nil {
+		return
+	}
+	for _, id := range m.operators {
+		msg := tgbotapi.NewMessage(id, text)
+		if markup != nil {
+			msg.ReplyMarkup = markup
+		}
+		if _, err := managerBot.Send(msg); err != nil {
+			log.Printf("Failed to notify operator %d: %v", id, err)
+		}
+	}
+}
+
+func (m *BotManager) notifyOperatorsOfReport(r abuseReport, creatorID int64) {
+	m.notifyOperators(m.formatReport(r, creatorID), m.reportKeyboard(r.ID))
+}
+
+func (m *BotManager) openReports() ([]abuseReport, error) {
+	rows, err := m.db.Query("SELECT id, bot_token, reporter_id, reason, created_at FROM reports WHERE status = ? ORDER BY id LIMIT ?", reportOpen, reportQueueLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []abuseReport
+	for rows.Next() {
+		var r abuseReport
+		var createdAt int64
+		if err := rows.Scan(&r.ID, &r.BotToken, &r.ReporterID, &r.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.Unix(createdAt, 0)
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// 发送待处理举报队列，每条举报一条消息，附带处理按钮
+func (m *BotManager) sendReportQueue(managerBot *tgbotapi.BotAPI, chatID int64) {
+	reports, err := m.openReports()
+	if err != nil {
+		log.Printf("Failed to load open reports: %v", err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to load reports.")))
+		return
+	}
+	if len(reports) == 0 {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "没有待处理的举报"))
+		return
+	}
+	for _, r := range reports {
+		msg := tgbotapi.NewMessage(chatID, m.formatReport(r, m.creatorOf(r.BotToken)))
+		msg.ReplyMarkup = m.reportKeyboard(r.ID)
+		managerBot.Send(msg)
+	}
+}
+
+func (m *BotManager) creatorOf(token string) int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.creator[token]
+}
+
+// 处理举报消息上的按钮，返回是否已处理
+func (m *BotManager) handleReportCallback(managerBot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData) bool {
+	var status string
+	switch cb.Action {
+	case cbReportSuspend:
+		status = reportSuspended
+	case cbReportDismiss:
+		status = reportDismissed
+	default:
+		return false
+	}
+
+	managerBot.Request(tgbotapi.NewCallback(query.ID, ""))
+
+	id, ok := cb.int(0)
+	if !ok {
+		log.Printf("Invalid report ID in callback: %s", query.Data)
+		return true
+	}
+
+	var token, currentStatus string
+	err := m.db.QueryRow("SELECT bot_token, status FROM reports WHERE id = ?", id).Scan(&token, &currentStatus)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to load report %d: %v", id, err)
+		}
+		return true
+	}
+
+	result := fmt.Sprintf("举报 #%d 已忽略", id)
+	if status == reportSuspended {
+		if err := m.suspendBot(token, true); err != nil {
+			managerBot.Send(tgbotapi.NewMessage(query.From.ID, friendlyError(err, "Failed to suspend bot.")))
+			return true
+		}
+		m.logEvent("", query.From.ID, eventSuspend, 0, fmt.Sprintf("%s（举报 #%d）", botIDFromToken(token), id))
+		result = fmt.Sprintf("举报 #%d 已处理，%s 已暂停", id, m.botUsername(token))
+	}
+
+	if currentStatus == reportOpen {
+		_, err = m.db.Exec("UPDATE reports SET status = ?, resolved_by = ?, resolved_at = ? WHERE id = ?", status, query.From.ID, time.Now().Unix(), id)
+		if err != nil {
+			log.Printf("Failed to update report %d: %v", id, err)
+		}
+	}
+
+	if query.Message != nil {
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text+"\n\n"+result)
+		if _, err := managerBot.Send(edit); err != nil {
+			log.Printf("Failed to update report message: %v", err)
+		}
+	}
+	return true
+}
+
+func (m *BotManager) isBotSuspended(token string) bool {
+	var suspended bool
+	// 超出套餐或无法联系创建者而暂停的机器人同样停止服务
+	err := m.db.QueryRow("SELECT suspended OR over_plan OR creator_unreachable FROM bots WHERE token = ?", token).Scan(&suspended)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get suspension state of bot %s: %v", botIDFromToken(token), err)
+	}
+	return suspended
+}
+
+// 暂停或恢复机器人，数据保留不变，并通知创建者
+func (m *BotManager) suspendBot(token string, suspended bool) error {
+	if _, err := m.db.Exec("UPDATE bots SET suspended = ? WHERE token = ?", suspended, token); err != nil {
+		log.Printf("Failed to update suspension state of bot %s: %v", botIDFromToken(token), err)
+		return err
+	}
+	log.Printf("Bot %s suspended: %v", botIDFromToken(token), suspended)
+
+	m.mu.RLock()
+	bot, ok := m.bots[token]
+	creatorID := m.creator[token]
+	m.mu.RUnlock()
+	if ok {
+		text := "你的机器人已被平台运营者暂停服务。"
+		if !suspended {
+			text = "你的机器人已恢复服务。"
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(creatorID, text)); err != nil {
+			log.Printf("Failed to notify creator of bot %s about suspension: %v", botIDFromToken(token), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 保留策略的执行间隔
+const retentionInterval = time.Hour
+
+// 可以设置保留期的数据类别。每条语句的参数依次是机器人 token 和截止时间。
+// 审计日志只能追加，不在任何类别中
+type retentionClass struct {
+	name       string
+	label      string
+	statements []string
+}
+
+var retentionClasses = []retentionClass{
+	{"bodies", "消息内容", []string{
+		`UPDATE appeals SET message = '' WHERE bot_token = ? AND created_at < ? AND message != ''`,
+		`DELETE FROM quarantined_messages WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM transcript_entries WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM form_progress WHERE bot_token = ? AND completed = 1 AND updated_at < ?`,
+	}},
+	{"metadata", "元数据", []string{
+		`DELETE FROM message_map WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM admin_message_map WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM reply_log WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM message_sentiments WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM survey_answers WHERE survey_id IN (SELECT id FROM surveys WHERE bot_token = ?) AND answered_at < ?`,
+	}},
+	// 等待投递或审核的消息会在之后原样复制给创建者，包括其中的图片和文件
+	{"media", "待投递的媒体和消息", []string{
+		`DELETE FROM queued_messages WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM throttled_messages WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM snoozed_messages WHERE bot_token = ? AND created_at < ?`,
+		`DELETE FROM pending_approvals WHERE bot_token = ? AND created_at < ?`,
+	}},
+}
+
+func findRetentionClass(name string) (retentionClass, bool) {
+	for _, c := range retentionClasses {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return retentionClass{}, false
+}
+
+// 机器人各数据类别的保留天数，未设置的类别不清理。套餐限制了保留天数时，
+// 所有类别最多保留该天数
+func (m *BotManager) retentionPolicies(token string) (map[string]int, error) {
+	rows, err := m.db.Query("SELECT data_class, days FROM retention_policies WHERE bot_token = ?", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := make(map[string]int)
+	for rows.Next() {
+		var class string
+		var days int
+		if err := rows.Scan(&class, &days); err != nil {
+			return nil, err
+		}
+		policies[class] = days
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if _, limits := m.planOf(token); limits.RetentionDays > 0 {
+		for _, c := range retentionClasses {
+			if days, ok := policies[c.name]; !ok || days > limits.RetentionDays {
+				policies[c.name] = limits.RetentionDays
+			}
+		}
+	}
+	return policies, nil
+}
+
+// 按保留策略删除一个机器人的过期数据，返回各类别删除的条数
+func (m *BotManager) purgeExpiredData(token string, policies map[string]int, now time.Time) map[string]int64 {
+	purged := make(map[string]int64)
+	for _, c := range retentionClasses {
+		days, ok := policies[c.name]
+		if !ok {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -days).Unix()
+		for _, stmt := range c.statements {
+			res, err := m.db.Exec(stmt, token, cutoff)
+			if err != nil {
+				log.Printf("Failed to purge %s of bot %s: %v", c.name, botIDFromToken(token), err)
+				continue
+			}
+			n, _ := res.RowsAffected()
+			purged[c.name] += n
+		}
+	}
+	return purged
+}
+
+func (m *BotManager) runRetentionPurge() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rows, err := m.db.Query("SELECT token FROM bots WHERE deleted_at = 0")
+		if err != nil {
+			log.Printf("Failed to load bots for retention purge: %v", err)
+			continue
+		}
+		var tokens []string
+		for rows.Next() {
+			var token string
+			if err := rows.Scan(&token); err == nil {
+				tokens = append(tokens, token)
+			}
+		}
+		rows.Close()
+
+		for _, token := range tokens {
+			policies, err := m.retentionPolicies(token)
+			if err != nil {
+				log.Printf("Failed to load retention policies of bot %s: %v", botIDFromToken(token), err)
+				continue
+			}
+			m.reportPurge(token, m.purgeExpiredData(token, policies, time.Now()))
+		}
+	}
+}
+
+// 把清理结果记入审计日志和指标，并告知创建者
+func (m *BotManager) reportPurge(token string, purged map[string]int64) {
+	var parts []string
+	for _, c := range retentionClasses {
+		if n := purged[c.name]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d 条", c.label, n))
+			metrics.add("forwardme_retention_purged_total", n, "bot", botIDFromToken(token), "class", c.name)
+		}
+	}
+	if len(parts) == 0 {
+		return
+	}
+	summary := strings.Join(parts, "，")
+	log.Printf("Retention purge for bot %s: %v", botIDFromToken(token), purged)
+	m.logEvent(token, 0, eventPurge, 0, summary)
+
+	m.mu.RLock()
+	bot, ok := m.bots[token]
+	creatorID := m.creator[token]
+	m.mu.RUnlock()
+	if ok {
+		bot.Send(tgbotapi.NewMessage(creatorID, "🧹 已按保留策略删除过期数据："+summary))
+	}
+}
+
+// 处理 /retention [类别 天数|off]
+func (m *BotManager) handleRetentionCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	fields := strings.Fields(message.CommandArguments())
+	usage := "用法：/retention <类别> <天数>|off\n类别：bodies 消息内容，metadata 元数据，media 待投递的媒体和消息\n例如：/retention bodies 30"
+
+	if len(fields) == 0 {
+		policies, err := m.retentionPolicies(token)
+		if err != nil {
+			log.Printf("Failed to load retention policies of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to load retention policies.")))
+			return
+		}
+		var b strings.Builder
+		for _, c := range retentionClasses {
+			if days, ok := policies[c.name]; ok {
+				fmt.Fprintf(&b, "%s（%s）：保留 %d 天\n", c.label, c.name, days)
+			} else {
+				fmt.Fprintf(&b, "%s（%s）：永久保留\n", c.label, c.name)
+			}
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()+"\n"+usage))
+		return
+	}
+
+	c, ok := findRetentionClass(fields[0])
+	if !ok || len(fields) != 2 {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	plan, limits := m.planOf(token)
+	if fields[1] == "off" {
+		if _, err := m.db.Exec("DELETE FROM retention_policies WHERE bot_token = ? AND data_class = ?", token, c.name); err != nil {
+			log.Printf("Failed to clear retention policy %s of bot %s: %v", c.name, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update retention policy.")))
+			return
+		}
+		if limits.RetentionDays > 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("%s将按当前套餐（%s）保留 %d 天", c.label, plan, limits.RetentionDays)))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, c.label+"将永久保留"))
+		return
+	}
+	days, err := strconv.Atoi(fields[1])
+	if err != nil || days < 1 || days > 3650 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "天数需要在 1 到 3650 之间\n"+usage))
+		return
+	}
+	if limits.RetentionDays > 0 && days > limits.RetentionDays {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("当前套餐（%s）最多保留 %d 天，请联系运营者升级套餐", plan, limits.RetentionDays)))
+		return
+	}
+	_, err = m.db.Exec(`INSERT INTO retention_policies (bot_token, data_class, days, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(bot_token, data_class) DO UPDATE SET days = excluded.days, updated_at = excluded.updated_at`,
+		token, c.name, days, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to set retention policy %s of bot %s: %v", c.name, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update retention policy.")))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("%s将保留 %d 天，过期数据每小时清理一次", c.label, days)))
+}
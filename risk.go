@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 风险评分各项信号的分值，总分 0~100
+const (
+	riskNoUsername = 20
+	riskNoPhoto    = 25
+	riskNewUser    = 15
+	riskBurst      = 30
+	riskNoSource   = 10
+
+	// 首次出现在此时间内视为新用户
+	riskNewUserWindow = 10 * time.Minute
+	// 一分钟内超过这么多条消息视为刷屏
+	riskBurstMessages = 5
+	// 分数达到此值时在转发的消息下附上评分
+	riskTagScore = 30
+)
+
+// 用户是否有头像：-1 未知，0 没有，1 有
+func (m *BotManager) userHasPhoto(bot *tgbotapi.BotAPI, userID int64) bool {
+	var hasPhoto int
+	err := m.db.QueryRow("SELECT has_photo FROM bot_users WHERE bot_token = ? AND user_id = ?", bot.Token, userID).Scan(&hasPhoto)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get photo flag of user %d for bot %s: %v", userID, botIDFromToken(bot.Token), err)
+	}
+	if err == nil && hasPhoto >= 0 {
+		return hasPhoto == 1
+	}
+
+	photos, err := bot.GetUserProfilePhotos(tgbotapi.UserProfilePhotosConfig{UserID: userID, Limit: 1})
+	if err != nil {
+		log.Printf("Failed to get profile photos of user %d for bot %s: %v", userID, botIDFromToken(bot.Token), err)
+		return true
+	}
+	hasPhoto = 0
+	if photos.TotalCount > 0 {
+		hasPhoto = 1
+	}
+	if _, err := m.db.Exec("UPDATE bot_users SET has_photo = ? WHERE bot_token = ? AND user_id = ?", hasPhoto, bot.Token, userID); err != nil {
+		log.Printf("Failed to save photo flag of user %d for bot %s: %v", userID, botIDFromToken(bot.Token), err)
+	}
+	return hasPhoto == 1
+}
+
+// 根据 Telegram 提供的用户资料和发送频率给消息打分，不打扰用户
+func (m *BotManager) riskScore(bot *tgbotapi.BotAPI, message *tgbotapi.Message) (score int, reasons []string) {
+	token, userID := bot.Token, message.From.ID
+
+	if message.From.UserName == "" {
+		score += riskNoUsername
+		reasons = append(reasons, "无用户名")
+	}
+	if !m.userHasPhoto(bot, userID) {
+		score += riskNoPhoto
+		reasons = append(reasons, "无头像")
+	}
+
+	var firstSeen int64
+	var source string
+	m.db.QueryRow("SELECT first_seen, source FROM bot_users WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&firstSeen, &source)
+	if time.Since(time.Unix(firstSeen, 0)) < riskNewUserWindow {
+		score += riskNewUser
+		reasons = append(reasons, "新用户")
+	}
+	if source == "" {
+		score += riskNoSource
+		reasons = append(reasons, "无来源")
+	}
+
+	var recent int
+	m.db.QueryRow("SELECT COUNT(DISTINCT user_message_id) FROM message_map WHERE bot_token = ? AND user_id = ? AND created_at >= ?",
+		token, userID, time.Now().Add(-time.Minute).Unix()).Scan(&recent)
+	if recent >= riskBurstMessages {
+		score += riskBurst
+		reasons = append(reasons, "发送频繁")
+	}
+	return score, reasons
+}
+
+func riskLabel(score int, reasons []string) string {
+	return fmt.Sprintf("🛡 风险分 %d：%s", score, strings.Join(reasons, "、"))
+}
+
+// 自动隔离的风险分阈值，0 表示不隔离
+func (m *BotManager) riskThreshold(token string) int {
+	var threshold int
+	err := m.db.QueryRow("SELECT risk_threshold FROM bots WHERE token = ?", token).Scan(&threshold)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get risk threshold of bot %s: %v", botIDFromToken(token), err)
+	}
+	return threshold
+}
+
+// 在转发的消息下附上风险分，分数较低时不打扰创建者
+func (m *BotManager) tagRisk(bot *tgbotapi.BotAPI, creatorID int64, forwarded int, message *tgbotapi.Message, score int, reasons []string) {
+	if score < riskTagScore {
+		return
+	}
+	tag := tgbotapi.NewMessage(creatorID, riskLabel(score, reasons))
+	tag.ReplyToMessageID = forwarded
+	tag.DisableNotification = true
+	if sent, err := bot.Send(tag); err != nil {
+		log.Printf("Failed to send risk tag for bot %s: %v", botIDFromToken(bot.Token), err)
+	} else {
+		m.saveMessageMapping(bot.Token, sent.MessageID, message.From.ID, message.MessageID)
+	}
+}
+
+// 处理 /risk：无参数时显示当前阈值，/risk <分数> 设置自动隔离阈值，/risk off 关闭
+func (m *BotManager) handleRiskCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "关闭"
+		if threshold := m.riskThreshold(bot.Token); threshold > 0 {
+			state = strconv.Itoa(threshold)
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("自动隔离阈值：%s\n风险分由无用户名(%d)、无头像(%d)、新用户(%d)、发送频繁(%d)、无深链接来源(%d)累加，达到 %d 分时附在转发的消息下。\n用法：/risk <1-100> 或 /risk off",
+			state, riskNoUsername, riskNoPhoto, riskNewUser, riskBurst, riskNoSource, riskTagScore)))
+		return
+	}
+
+	threshold := 0
+	if arg != "off" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > 100 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/risk <1-100> 或 /risk off"))
+			return
+		}
+		threshold = n
+	}
+	if _, err := m.db.Exec("UPDATE bots SET risk_threshold = ? WHERE token = ?", threshold, bot.Token); err != nil {
+		log.Printf("Failed to update risk threshold of bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update risk threshold")))
+		return
+	}
+	if threshold == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已关闭自动隔离"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("风险分达到 %d 的消息将进入隔离区，使用 /quarantine 查看", threshold)))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 检查到期定时消息的间隔
+const schedulerInterval = time.Minute
+
+type scheduledMessage struct {
+	ID      int64
+	Token   string
+	Cron    cronSchedule
+	Target  audience
+	Text    string
+	NextRun time.Time
+}
+
+func (s scheduledMessage) String() string {
+	return fmt.Sprintf("#%d [%s] → %s，下次 %s\n%s", s.ID, s.Cron, s.Target, s.NextRun.Format("01-02 15:04"), s.Text)
+}
+
+// 解析 "<分 时 日 月 周> [#标签|topic:话题] <文本>"
+func parseScheduledMessage(args string) (scheduledMessage, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 6 {
+		return scheduledMessage{}, fmt.Errorf("missing cron expression or text")
+	}
+	cron, err := parseCron(strings.Join(fields[:5], " "))
+	if err != nil {
+		return scheduledMessage{}, err
+	}
+	s := scheduledMessage{Cron: cron}
+	// 保留文本中的换行
+	for _, f := range fields[:5] {
+		args = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args), f))
+	}
+	s.Target, s.Text = parseAudience(args)
+	if s.Text == "" {
+		return scheduledMessage{}, fmt.Errorf("missing text")
+	}
+	s.NextRun = cron.next(time.Now())
+	if s.NextRun.IsZero() {
+		return scheduledMessage{}, fmt.Errorf("cron expression %q never fires", cron)
+	}
+	return s, nil
+}
+
+func (m *BotManager) listScheduledMessages(token string) ([]scheduledMessage, error) {
+	rows, err := m.db.Query("SELECT id, bot_token, cron, label, topic, text, next_run FROM scheduled_messages WHERE bot_token = ? ORDER BY id", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanScheduledMessages(rows)
+}
+
+func scanScheduledMessages(rows *sql.Rows) ([]scheduledMessage, error) {
+	var list []scheduledMessage
+	for rows.Next() {
+		var s scheduledMessage
+		var expr string
+		var nextRun int64
+		if err := rows.Scan(&s.ID, &s.Token, &expr, &s.Target.Label, &s.Target.Topic, &s.Text, &nextRun); err != nil {
+			return nil, err
+		}
+		cron, err := parseCron(expr)
+		if err != nil {
+			log.Printf("Skipping scheduled message #%d with invalid cron %q: %v", s.ID, expr, err)
+			continue
+		}
+		s.Cron = cron
+		s.NextRun = time.Unix(nextRun, 0)
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// 发送到期的定时消息，并计算下一次运行时间
+func (m *BotManager) runDueSchedules() {
+	rows, err := m.db.Query("SELECT id, bot_token, cron, label, topic, text, next_run FROM scheduled_messages WHERE next_run <= ? ORDER BY next_run", time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to load due scheduled messages: %v", err)
+		return
+	}
+	due, err := scanScheduledMessages(rows)
+	rows.Close()
+	if err != nil {
+		log.Printf("Failed to load due scheduled messages: %v", err)
+		return
+	}
+
+	for _, s := range due {
+		// 先推进下一次运行时间，避免发送期间重复触发
+		next := s.Cron.next(time.Now())
+		if _, err := m.db.Exec("UPDATE scheduled_messages SET next_run = ? WHERE id = ?", next.Unix(), s.ID); err != nil {
+			log.Printf("Failed to update scheduled message #%d: %v", s.ID, err)
+			continue
+		}
+
+		m.mu.RLock()
+		bot, running := m.bots[s.Token]
+		m.mu.RUnlock()
+		if !running {
+			continue
+		}
+		recipients, err := m.broadcastRecipients(s.Token, s.Target)
+		if err != nil {
+			log.Printf("Failed to load recipients of scheduled message #%d: %v", s.ID, err)
+			continue
+		}
+		sent, failed := m.broadcastText(bot, recipients, s.Text)
+		m.logEvent(s.Token, 0, eventBroadcast, 0, fmt.Sprintf("定时消息 #%d %s，成功 %d，失败 %d: %s", s.ID, s.Target, sent, failed, truncateText(s.Text, 200)))
+		log.Printf("Scheduled message #%d for bot %s sent to %d users, %d failed.", s.ID, botIDFromToken(s.Token), sent, failed)
+	}
+}
+
+func (m *BotManager) runScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.runDueSchedules()
+		m.sendDueReplies()
+		m.pollFeeds()
+	}
+}
+
+// 处理 /schedules
+func (m *BotManager) handleSchedulesCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	action, rest, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	rest = strings.TrimSpace(rest)
+	usage := "用法：\n/schedules add 0 9 * * 1 #vip 早上好 {{name}}，本周有什么需要帮忙的吗？\n（分 时 日 月 周，按服务器时区；#标签 或 topic:话题 可省略，省略时发给全部用户）\n/schedules del <编号>\n/schedules 查看列表"
+
+	switch action {
+	case "":
+		list, err := m.listScheduledMessages(token)
+		if err != nil {
+			log.Printf("Failed to list scheduled messages of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list scheduled messages")))
+			return
+		}
+		if len(list) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无定时消息。\n"+usage))
+			return
+		}
+		var b strings.Builder
+		for _, s := range list {
+			b.WriteString(s.String() + "\n\n")
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+	case "add":
+		s, err := parseScheduledMessage(rest)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "无法解析："+err.Error()+"\n"+usage))
+			return
+		}
+		res, err := m.db.Exec("INSERT INTO scheduled_messages (bot_token, cron, label, topic, text, next_run, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			token, s.Cron.String(), s.Target.Label, s.Target.Topic, s.Text, s.NextRun.Unix(), time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to add scheduled message for bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add scheduled message")))
+			return
+		}
+		s.ID, _ = res.LastInsertId()
+		bot.Send(tgbotapi.NewMessage(creatorID, "已添加定时消息：\n"+s.String()))
+	case "del":
+		id, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		res, err := m.db.Exec("DELETE FROM scheduled_messages WHERE bot_token = ? AND id = ?", token, id)
+		if err != nil {
+			log.Printf("Failed to delete scheduled message #%d of bot %s: %v", id, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete scheduled message")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("定时消息 #%d 不存在", id)))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已删除定时消息 #%d", id)))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
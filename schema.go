@@ -0,0 +1,704 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 数据库表结构，按顺序执行，均可重复执行
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS bots (
+	token TEXT PRIMARY KEY,
+	creator_id INTEGER,
+	blocked_users TEXT DEFAULT "",
+	appeal_counts TEXT DEFAULT ""
+   )`,
+	`CREATE TABLE IF NOT EXISTS message_map (
+	bot_token TEXT NOT NULL,
+	creator_message_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	user_message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, creator_message_id)
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_message_map_user ON message_map (bot_token, user_id, user_message_id)`,
+	`CREATE TABLE IF NOT EXISTS muted_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS user_notes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	note TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_user_notes_user ON user_notes (bot_token, user_id)`,
+	`CREATE TABLE IF NOT EXISTS bans (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	reason TEXT NOT NULL DEFAULT "",
+	banned_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS bot_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	username TEXT NOT NULL DEFAULT "",
+	first_name TEXT NOT NULL DEFAULT "",
+	last_name TEXT NOT NULL DEFAULT "",
+	first_seen INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS appeals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	message TEXT NOT NULL DEFAULT "",
+	outcome TEXT NOT NULL DEFAULT "",
+	created_at INTEGER NOT NULL,
+	resolved_at INTEGER
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_appeals_user ON appeals (bot_token, user_id)`,
+	`CREATE TABLE IF NOT EXISTS global_blacklist (
+	user_id INTEGER PRIMARY KEY,
+	reason TEXT NOT NULL DEFAULT "",
+	added_by INTEGER NOT NULL,
+	added_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS creators (
+	creator_id INTEGER PRIMARY KEY,
+	global_blacklist_optout INTEGER NOT NULL DEFAULT 0
+   )`,
+	`CREATE TABLE IF NOT EXISTS reports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	reporter_id INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	resolved_by INTEGER,
+	resolved_at INTEGER
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_reports_status ON reports (status)`,
+	`CREATE TABLE IF NOT EXISTS reply_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	operator_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_reply_log_user ON reply_log (bot_token, user_id)`,
+	`CREATE TABLE IF NOT EXISTS vacations (
+	creator_id INTEGER PRIMARY KEY,
+	substitute_id INTEGER NOT NULL,
+	until INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS queued_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_queued_messages_bot ON queued_messages (bot_token)`,
+	`CREATE TABLE IF NOT EXISTS vip_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS message_sentiments (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	sentiment TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_message_sentiments_bot ON message_sentiments (bot_token, created_at)`,
+	`CREATE TABLE IF NOT EXISTS quarantined_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	score INTEGER NOT NULL,
+	reasons TEXT NOT NULL,
+	preview TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_quarantined_messages_bot ON quarantined_messages (bot_token)`,
+	`CREATE TABLE IF NOT EXISTS approved_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	approved_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS user_limits (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	max_messages INTEGER NOT NULL,
+	period INTEGER NOT NULL,
+	queue INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS throttled_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS scheduled_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	cron TEXT NOT NULL,
+	label TEXT NOT NULL DEFAULT "",
+	text TEXT NOT NULL,
+	next_run INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_scheduled_messages_next_run ON scheduled_messages (next_run)`,
+	`CREATE TABLE IF NOT EXISTS feeds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	url TEXT NOT NULL,
+	title TEXT NOT NULL,
+	next_check INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS feed_items (
+	feed_id INTEGER NOT NULL,
+	guid TEXT NOT NULL,
+	seen_at INTEGER NOT NULL,
+	PRIMARY KEY (feed_id, guid)
+   )`,
+	`CREATE TABLE IF NOT EXISTS feed_subscribers (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS topics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	name TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	UNIQUE (bot_token, name)
+   )`,
+	`CREATE TABLE IF NOT EXISTS topic_subscriptions (
+	bot_token TEXT NOT NULL,
+	topic_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (topic_id, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS surveys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	question TEXT NOT NULL,
+	options TEXT NOT NULL,
+	label TEXT NOT NULL DEFAULT "",
+	topic TEXT NOT NULL DEFAULT "",
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS survey_polls (
+	poll_id TEXT PRIMARY KEY,
+	survey_id INTEGER NOT NULL,
+	bot_token TEXT NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_survey_polls_survey ON survey_polls (survey_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_survey_polls_bot ON survey_polls (bot_token)`,
+	`CREATE TABLE IF NOT EXISTS survey_answers (
+	survey_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	option_id INTEGER NOT NULL,
+	answered_at INTEGER NOT NULL,
+	PRIMARY KEY (survey_id, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS promo_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	code TEXT NOT NULL,
+	user_id INTEGER NOT NULL DEFAULT 0,
+	claimed_at INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	UNIQUE (bot_token, code)
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_promo_codes_user ON promo_codes (bot_token, user_id)`,
+	`CREATE TABLE IF NOT EXISTS custom_commands (
+	bot_token TEXT NOT NULL,
+	name TEXT NOT NULL,
+	response TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, name)
+   )`,
+	`CREATE TABLE IF NOT EXISTS command_aliases (
+	bot_token TEXT NOT NULL,
+	alias TEXT NOT NULL,
+	command TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, alias)
+   )`,
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	status INTEGER NOT NULL,
+	response TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scope TEXT NOT NULL,
+	created_by INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	last_used_at INTEGER NOT NULL DEFAULT 0,
+	revoked_at INTEGER NOT NULL DEFAULT 0
+   )`,
+	`CREATE TABLE IF NOT EXISTS bot_roles (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	role TEXT NOT NULL,
+	granted_by INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS event_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	actor_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	subject_id INTEGER NOT NULL,
+	detail TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	prev_hash TEXT NOT NULL,
+	hash TEXT NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_event_log_bot ON event_log (bot_token, id)`,
+	// 审计日志只能追加，删除机器人时也保留
+	`CREATE TRIGGER IF NOT EXISTS event_log_no_update BEFORE UPDATE ON event_log
+	BEGIN SELECT RAISE(ABORT, 'event_log is append-only'); END`,
+	`CREATE TRIGGER IF NOT EXISTS event_log_no_delete BEFORE DELETE ON event_log
+	BEGIN SELECT RAISE(ABORT, 'event_log is append-only'); END`,
+	`CREATE TABLE IF NOT EXISTS retention_policies (
+	bot_token TEXT NOT NULL,
+	data_class TEXT NOT NULL,
+	days INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, data_class)
+   )`,
+	`CREATE TABLE IF NOT EXISTS opted_out_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS poll_offsets (
+	bot_token TEXT PRIMARY KEY,
+	next_offset INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS instance_handoff (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	owner TEXT NOT NULL DEFAULT '',
+	heartbeat_at INTEGER NOT NULL DEFAULT 0,
+	requested_by TEXT NOT NULL DEFAULT '',
+	requested_at INTEGER NOT NULL DEFAULT 0,
+	ready_at INTEGER NOT NULL DEFAULT 0
+   )`,
+	`CREATE TABLE IF NOT EXISTS transcript_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	from_user INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_transcript_entries_user ON transcript_entries (bot_token, user_id)`,
+	`CREATE TABLE IF NOT EXISTS handled_marks (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	handled_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS snoozed_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	until INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS snoozed_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS blocked_chats (
+	bot_token TEXT NOT NULL,
+	chat_id INTEGER NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	banned_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, chat_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS delivery_failures (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	failures INTEGER NOT NULL,
+	last_error TEXT NOT NULL,
+	last_failed_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS usage_records (
+	creator_id INTEGER NOT NULL,
+	bot_id TEXT NOT NULL,
+	period TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	PRIMARY KEY (creator_id, bot_id, period, metric)
+   )`,
+	`CREATE TABLE IF NOT EXISTS subscriptions (
+	creator_id INTEGER PRIMARY KEY,
+	plan TEXT NOT NULL,
+	charge_id TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	canceled INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS brand_tos (
+	creator_id INTEGER NOT NULL,
+	brand TEXT NOT NULL,
+	tos_version TEXT NOT NULL,
+	tos_accepted_at INTEGER NOT NULL,
+	PRIMARY KEY (creator_id, brand)
+   )`,
+	`CREATE TABLE IF NOT EXISTS pending_approvals (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS user_labels (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	label TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id, label)
+   )`,
+	`CREATE TABLE IF NOT EXISTS label_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	label TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS user_vars (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	value TEXT NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id, name)
+   )`,
+	`CREATE TABLE IF NOT EXISTS form_questions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	question TEXT NOT NULL,
+	options TEXT NOT NULL DEFAULT ""
+   )`,
+	`CREATE TABLE IF NOT EXISTS form_progress (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	step INTEGER NOT NULL,
+	answers TEXT NOT NULL,
+	first_message_id INTEGER NOT NULL,
+	completed INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS faqs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	keywords TEXT NOT NULL,
+	answer TEXT NOT NULL
+   )`,
+	`CREATE TABLE IF NOT EXISTS menu_items (
+	bot_token TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	label TEXT NOT NULL,
+	action TEXT NOT NULL,
+	PRIMARY KEY (bot_token, position)
+   )`,
+	`CREATE TABLE IF NOT EXISTS reply_signatures (
+	bot_token TEXT NOT NULL,
+	operator_id INTEGER NOT NULL,
+	signature TEXT NOT NULL,
+	PRIMARY KEY (bot_token, operator_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS user_topics (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	thread_id INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_user_topics_thread ON user_topics (bot_token, thread_id)`,
+	`CREATE TABLE IF NOT EXISTS admin_message_map (
+	bot_token TEXT NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	user_message_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, chat_id, message_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS away_replies (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	sent_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS delayed_replies (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	created_by INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	send_at INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+   )`,
+	`CREATE INDEX IF NOT EXISTS idx_delayed_replies_send_at ON delayed_replies (send_at)`,
+	`CREATE TABLE IF NOT EXISTS snippets (
+	bot_token TEXT NOT NULL,
+	name TEXT NOT NULL,
+	text TEXT NOT NULL,
+	html TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, name)
+   )`,
+	`CREATE TABLE IF NOT EXISTS pinned_users (
+	bot_token TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_token, user_id)
+   )`,
+	`CREATE TABLE IF NOT EXISTS reaction_actions (
+	bot_token TEXT NOT NULL,
+	emoji TEXT NOT NULL,
+	action TEXT NOT NULL,
+	PRIMARY KEY (bot_token, emoji)
+   )`,
+	`CREATE TABLE IF NOT EXISTS migrations (
+	name TEXT PRIMARY KEY,
+	applied_at INTEGER NOT NULL
+   )`,
+}
+
+// 后续版本给已有表新增的列，启动时缺失则补上
+var schemaColumns = []struct {
+	table, column, definition string
+}{
+	{"bots", "suspended", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "deleted_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"creators", "tos_version", `TEXT NOT NULL DEFAULT ""`},
+	{"creators", "tos_accepted_at", "INTEGER"},
+	{"bots", "business_hours", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "urgent_keywords", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "urgent_contact", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "sentiment", "INTEGER NOT NULL DEFAULT 0"},
+	{"bot_users", "source", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "menu_webapp", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "start_webapp", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "risk_threshold", "INTEGER NOT NULL DEFAULT 0"},
+	{"bot_users", "has_photo", "INTEGER NOT NULL DEFAULT -1"},
+	{"bot_users", "message_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "approval_mode", "INTEGER NOT NULL DEFAULT 0"},
+	{"scheduled_messages", "topic", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "log_text", "INTEGER NOT NULL DEFAULT 1"},
+	{"bots", "service_summary", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "forward_tools", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "digest", "INTEGER NOT NULL DEFAULT 1"},
+	{"bots", "digest_sent_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"creators", "plan", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "over_plan", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "brand", `TEXT NOT NULL DEFAULT ""`},
+	{"bots", "relay_copy", "INTEGER NOT NULL DEFAULT 0"},
+	{"reply_log", "creator_message_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "creator_unreachable", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "forum_chat_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "destination_chat_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "archive_chat_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "away_text", `TEXT NOT NULL DEFAULT ""`},
+	{"bot_users", "language_code", `TEXT NOT NULL DEFAULT ""`},
+	{"bot_users", "time_zone", `TEXT NOT NULL DEFAULT ""`},
+	{"bot_users", "time_zone_asked", "INTEGER NOT NULL DEFAULT 0"},
+	{"bots", "ask_time_zone", "INTEGER NOT NULL DEFAULT 0"},
+	{"idempotency_keys", "request_hash", `TEXT NOT NULL DEFAULT ""`},
+}
+
+// 按 bot_token 归属于单个机器人的表，删除机器人时一并清理
+var botScopedTables = []string{
+	"message_map",
+	"bot_roles",
+	"retention_policies",
+	"opted_out_users",
+	"delivery_failures",
+	"muted_users",
+	"snoozed_users",
+	"snoozed_messages",
+	"user_notes",
+	"bans",
+	"blocked_chats",
+	"bot_users",
+	"appeals",
+	"reports",
+	"reply_log",
+	"transcript_entries",
+	"handled_marks",
+	"reply_signatures",
+	"queued_messages",
+	"vip_users",
+	"message_sentiments",
+	"user_labels",
+	"label_rules",
+	"user_vars",
+	"form_questions",
+	"form_progress",
+	"faqs",
+	"menu_items",
+	"quarantined_messages",
+	"approved_users",
+	"pending_approvals",
+	"user_limits",
+	"throttled_messages",
+	"scheduled_messages",
+	"feeds",
+	"feed_subscribers",
+	"topics",
+	"topic_subscriptions",
+	"survey_polls",
+	"surveys",
+	"promo_codes",
+	"custom_commands",
+	"command_aliases",
+	"user_topics",
+	"reaction_actions",
+	"admin_message_map",
+	"pinned_users",
+	"away_replies",
+	"delayed_replies",
+	"snippets",
+}
+
+// 并发处理更新和交接时两个进程会同时写入，等待锁释放而不是立即返回 SQLITE_BUSY
+const sqliteOptions = "?_pragma=busy_timeout(5000)"
+
+func initSchema(db *sql.DB) error {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to execute schema statement: %w", err)
+		}
+	}
+	for _, c := range schemaColumns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	log.Println("Database schema created or already exists.")
+	return migrateLegacyBlockedUsers(db)
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	log.Printf("Added column %s to table %s.", column, table)
+	return nil
+}
+
+// 旧版本把封禁列表以逗号分隔的字符串保存在 bots.blocked_users 中，迁移到 bans 表
+func migrateLegacyBlockedUsers(db *sql.DB) error {
+	rows, err := db.Query(`SELECT token, blocked_users FROM bots WHERE blocked_users != ""`)
+	if err != nil {
+		return fmt.Errorf("failed to load legacy block lists: %w", err)
+	}
+	legacy := make(map[string]string)
+	for rows.Next() {
+		var token, blockedUsers string
+		if err := rows.Scan(&token, &blockedUsers); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy[token] = blockedUsers
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for token, blockedUsers := range legacy {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, idStr := range strings.Split(blockedUsers, ",") {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, err := tx.Exec("INSERT OR IGNORE INTO bans (bot_token, user_id, reason, banned_at) VALUES (?, ?, '', ?)", token, id, now); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to migrate block list for bot %s: %w", token, err)
+			}
+		}
+		if _, err := tx.Exec(`UPDATE bots SET blocked_users = "" WHERE token = ?`, token); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Migrated legacy block list of bot %s to the bans table.", botIDFromToken(token))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// loc 时区中 now 之后第一次到达 clock（15:04）的时间
+func nextClock(clock string, loc *time.Location, now time.Time) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now = now.In(loc)
+	at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
+
+type delayedReply struct {
+	ID     int64
+	Token  string
+	UserID int64
+	ChatID int64
+	From   int64
+	Text   string
+	SendAt time.Time
+}
+
+// 发送到期的延时回复。先删除记录再发送，多个实例或重复触发时只发送一次；机器人未运行或已暂停时留待下次
+func (m *BotManager) sendDueReplies() {
+	rows, err := m.db.Query("SELECT id, bot_token, user_id, chat_id, created_by, text, send_at FROM delayed_replies WHERE send_at <= ? ORDER BY send_at",
+		time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to load due delayed replies: %v", err)
+		return
+	}
+	var due []delayedReply
+	for rows.Next() {
+		var r delayedReply
+		var sendAt int64
+		if err := rows.Scan(&r.ID, &r.Token, &r.UserID, &r.ChatID, &r.From, &r.Text, &sendAt); err != nil {
+			log.Printf("Failed to load due delayed replies: %v", err)
+			continue
+		}
+		r.SendAt = time.Unix(sendAt, 0)
+		due = append(due, r)
+	}
+	rows.Close()
+
+	for _, r := range due {
+		m.mu.RLock()
+		bot, running := m.bots[r.Token]
+		m.mu.RUnlock()
+		if !running || m.isBotSuspended(r.Token) {
+			continue
+		}
+		res, err := m.db.Exec("DELETE FROM delayed_replies WHERE id = ?", r.ID)
+		if err != nil {
+			log.Printf("Failed to claim delayed reply #%d: %v", r.ID, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		// 按一条普通的文字回复发送，署名、变量、回复日志和存档与直接回复相同，发送失败时提示到安排回复的聊天
+		message := &tgbotapi.Message{
+			From: &tgbotapi.User{ID: r.From},
+			Chat: &tgbotapi.Chat{ID: r.ChatID},
+			Text: r.Text,
+		}
+		log.Printf("Sending delayed reply #%d to user %d for bot %s.", r.ID, r.UserID, botIDFromToken(r.Token))
+		m.deliverReply(bot, message, r.UserID, 0)
+	}
+}
+
+func (m *BotManager) listDelayedReplies(token string) ([]delayedReply, error) {
+	rows, err := m.db.Query("SELECT id, user_id, text, send_at FROM delayed_replies WHERE bot_token = ? ORDER BY send_at", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []delayedReply
+	for rows.Next() {
+		var r delayedReply
+		var sendAt int64
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Text, &sendAt); err != nil {
+			return nil, err
+		}
+		r.SendAt = time.Unix(sendAt, 0)
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// 处理 /sendat：回复一条转交的消息发送 /sendat 09:00 <回复>，在用户时区的 09:00 把回复发给用户；
+// 也可以用 /sendat <ID> 09:00 <回复>。/sendat 列出待发送的回复，/sendat cancel <编号> 取消
+func (m *BotManager) handleSendAtCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：回复一条转交的消息发送 /sendat 09:00 <回复>，在用户所在时区的 09:00 把回复发给用户，也可以发送 /sendat <ID> 09:00 <回复>。" +
+		"用户可以用 /timezone 告知自己的时区，你也可以用 /usertz 设置，都没有时按用户的语言推断。/sendat 列出待发送的回复，/sendat cancel <编号> 取消"
+	args := strings.Fields(message.CommandArguments())
+
+	if len(args) == 0 && message.ReplyToMessage == nil {
+		list, err := m.listDelayedReplies(token)
+		if err != nil {
+			log.Printf("Failed to list delayed replies of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list delayed replies")))
+			return
+		}
+		if len(list) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "没有待发送的回复\n"+usage))
+			return
+		}
+		var b strings.Builder
+		b.WriteString("待发送的回复（服务器时间）：\n")
+		for _, r := range list {
+			fmt.Fprintf(&b, "#%d %s → %d：%s\n", r.ID, r.SendAt.Format("01-02 15:04"), r.UserID, truncateText(r.Text, 50))
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+		return
+	}
+
+	if len(args) > 0 && args[0] == "cancel" {
+		id, err := strconv.ParseInt(strings.Join(args[1:], ""), 10, 64)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/sendat cancel <编号>，编号见 /sendat"))
+			return
+		}
+		res, err := m.db.Exec("DELETE FROM delayed_replies WHERE id = ? AND bot_token = ?", id, token)
+		if err != nil {
+			log.Printf("Failed to cancel delayed reply #%d of bot %s: %v", id, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to cancel delayed reply")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("没有找到待发送的回复 #%d", id)))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已取消回复 #%d", id)))
+		return
+	}
+
+	userID, rest, err := m.commandTarget(token, message)
+	fields := strings.Fields(rest)
+	if err != nil || len(fields) < 2 {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	loc, source := m.userLocation(token, userID)
+	sendAt, err := nextClock(fields[0], loc, time.Now())
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
+
+	res, err := m.db.Exec(`INSERT INTO delayed_replies (bot_token, user_id, chat_id, created_by, text, send_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, token, userID, message.Chat.ID, message.From.ID, text, sendAt.Unix(), time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to schedule reply to user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to schedule reply")))
+		return
+	}
+	id, _ := res.LastInsertId()
+	log.Printf("User %d scheduled reply #%d to user %d at %s for bot %s.", message.From.ID, id, userID, sendAt.Format(time.RFC3339), botIDFromToken(token))
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("回复 #%d 将在用户时间 %s（%s，%s）发给用户ID: %d，即服务器时间 %s。发送 /sendat cancel %d 取消",
+		id, sendAt.Format("01-02 15:04"), loc, source, userID, sendAt.In(time.Local).Format("01-02 15:04"), id)))
+}
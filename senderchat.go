@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 以频道身份发言或匿名管理员发送的消息，From 只是 Telegram 的占位账号，
+// 多个频道会共用同一个 ID，不能当作普通用户处理
+func isChatSender(message *tgbotapi.Message) bool {
+	return message.From == nil || message.SenderChat != nil
+}
+
+// 消息发送者的说明，用于转发前提示创建者
+func chatSenderLabel(message *tgbotapi.Message) string {
+	sender := message.SenderChat
+	if sender == nil {
+		return fmt.Sprintf("聊天 %d 中来源不明的消息", message.Chat.ID)
+	}
+	name := sender.Title
+	if sender.UserName != "" {
+		name += " @" + sender.UserName
+	}
+	if sender.ID == message.Chat.ID {
+		return fmt.Sprintf("👤 群组「%s」（%d）的匿名管理员", name, sender.ID)
+	}
+	return fmt.Sprintf("📢 频道「%s」（%d）", name, sender.ID)
+}
+
+// 转发频道或匿名管理员的消息。发送者不是具体的用户，不记录用户资料，
+// 也不经过按用户的封禁、申诉、限额和审核，命令一律忽略。可以用 /banchat 封禁整个聊天
+func (m *BotManager) handleChatSenderMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	label := chatSenderLabel(message)
+	log.Printf("Received a message from %s in chat ID: %d for bot %s", label, message.Chat.ID, botIDFromToken(bot.Token))
+	if message.IsCommand() {
+		return
+	}
+
+	header := tgbotapi.NewMessage(creatorID, label+" 发来消息，无法直接回复：")
+	if message.SenderChat != nil {
+		header.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("封禁该聊天", signCallback(bot.Token, cbBanChat, message.SenderChat.ID)),
+		))
+	}
+	if _, err := bot.Send(header); err != nil {
+		log.Printf("Failed to send chat sender header to creator: %v", err)
+		return
+	}
+	if _, err := bot.Send(tgbotapi.NewForward(creatorID, message.Chat.ID, message.MessageID)); err != nil {
+		log.Printf("Error forwarding message from chat sender: %v", err)
+		return
+	}
+	metrics.inc("forwardme_messages_forwarded_total", "bot", botIDFromToken(bot.Token))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 情绪分类
+const (
+	sentimentNegative = "negative"
+	sentimentNeutral  = "neutral"
+	sentimentPositive = "positive"
+)
+
+// 简单的情绪词典，命中一个词计一分，不区分大小写
+var (
+	negativeWords = []string{
+		"生气", "愤怒", "垃圾", "骗子", "骗人", "退款", "投诉", "差评", "失望", "太差", "恶心", "坑", "滚", "举报", "无语", "气死", "烂", "不满",
+		"angry", "terrible", "awful", "worst", "scam", "refund", "hate", "useless", "disappointed", "ridiculous", "wtf",
+	}
+	positiveWords = []string{
+		"谢谢", "感谢", "好评", "满意", "喜欢", "太好了", "棒", "赞", "辛苦", "厉害", "不错", "开心",
+		"thanks", "thank you", "great", "awesome", "love", "perfect", "excellent", "nice", "appreciate",
+	}
+)
+
+func sentimentEmoji(sentiment string) string {
+	switch sentiment {
+	case sentimentNegative:
+		return "😡"
+	case sentimentPositive:
+		return "🙂"
+	}
+	return "😐"
+}
+
+// 基于词典判断消息情绪，连续的感叹号加重已有倾向
+func classifySentiment(text string) string {
+	lower := strings.ToLower(text)
+	var score int
+	for _, w := range negativeWords {
+		score -= strings.Count(lower, w)
+	}
+	for _, w := range positiveWords {
+		score += strings.Count(lower, w)
+	}
+	if score < 0 && (strings.Contains(text, "!!") || strings.Contains(text, "！！")) {
+		score--
+	}
+	switch {
+	case score < 0:
+		return sentimentNegative
+	case score > 0:
+		return sentimentPositive
+	}
+	return sentimentNeutral
+}
+
+func (m *BotManager) sentimentEnabled(token string) bool {
+	var enabled bool
+	err := m.db.QueryRow("SELECT sentiment FROM bots WHERE token = ?", token).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get sentiment setting of bot %s: %v", botIDFromToken(token), err)
+	}
+	return enabled
+}
+
+// 记录消息情绪，并以回复的形式给转发出的消息打上表情标记
+func (m *BotManager) tagSentiment(bot *tgbotapi.BotAPI, creatorID int64, forwarded int, message *tgbotapi.Message) {
+	text := message.Text + " " + message.Caption
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	sentiment := classifySentiment(text)
+	if _, err := m.db.Exec("INSERT INTO message_sentiments (bot_token, user_id, sentiment, created_at) VALUES (?, ?, ?, ?)",
+		bot.Token, message.From.ID, sentiment, time.Now().Unix()); err != nil {
+		log.Printf("Failed to record sentiment for bot %s: %v", botIDFromToken(bot.Token), err)
+	}
+
+	tag := tgbotapi.NewMessage(creatorID, sentimentEmoji(sentiment))
+	tag.ReplyToMessageID = forwarded
+	tag.DisableNotification = sentiment != sentimentNegative
+	if sent, err := bot.Send(tag); err != nil {
+		log.Printf("Failed to send sentiment tag for bot %s: %v", botIDFromToken(bot.Token), err)
+	} else {
+		m.saveMessageMapping(bot.Token, sent.MessageID, message.From.ID, message.MessageID)
+	}
+}
+
+type sentimentStats struct {
+	Negative, Neutral, Positive int
+}
+
+func (s sentimentStats) String() string {
+	return fmt.Sprintf("😡 %d  😐 %d  🙂 %d", s.Negative, s.Neutral, s.Positive)
+}
+
+// token 为空时统计所有机器人
+func (m *BotManager) getSentimentStats(token string, since time.Time) (sentimentStats, error) {
+	var s sentimentStats
+	err := m.db.QueryRow(`SELECT
+			COALESCE(SUM(sentiment = ?), 0),
+			COALESCE(SUM(sentiment = ?), 0),
+			COALESCE(SUM(sentiment = ?), 0)
+		FROM message_sentiments WHERE (? = '' OR bot_token = ?) AND created_at >= ?`,
+		sentimentNegative, sentimentNeutral, sentimentPositive, token, token, since.Unix()).
+		Scan(&s.Negative, &s.Neutral, &s.Positive)
+	return s, err
+}
+
+// 处理 /sentiment：on/off 开关，无参数时显示近 7 天的统计
+func (m *BotManager) handleSentimentCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "on", "off":
+		enabled := strings.EqualFold(strings.TrimSpace(message.CommandArguments()), "on")
+		if _, err := m.db.Exec("UPDATE bots SET sentiment = ? WHERE token = ?", enabled, bot.Token); err != nil {
+			log.Printf("Failed to update sentiment setting of bot %s: %v", botIDFromToken(bot.Token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update sentiment setting")))
+			return
+		}
+		if enabled {
+			bot.Send(tgbotapi.NewMessage(creatorID, "已开启情绪标记，转发的消息将附上 😡/😐/🙂"))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "已关闭情绪标记"))
+		}
+	case "":
+		stats, err := m.getSentimentStats(bot.Token, time.Now().AddDate(0, 0, -7))
+		if err != nil {
+			log.Printf("Failed to get sentiment stats of bot %s: %v", botIDFromToken(bot.Token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get sentiment stats")))
+			return
+		}
+		state := "关闭"
+		if m.sentimentEnabled(bot.Token) {
+			state = "开启"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "情绪标记："+state+"\n近 7 天："+stats.String()+"\n用法：/sentiment on 或 /sentiment off"))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, "用法：/sentiment on 或 /sentiment off"))
+	}
+}
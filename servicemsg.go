@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func userDisplayName(u *tgbotapi.User) string {
+	if u == nil {
+		return "有人"
+	}
+	return displayName(u.UserName, u.FirstName, u.LastName)
+}
+
+// 识别入群、退群、置顶等服务消息，返回一句说明。普通消息返回 false。
+// 服务消息无法被转发，只能丢弃或改为发送说明
+func describeServiceMessage(message *tgbotapi.Message) (string, bool) {
+	actor := userDisplayName(message.From)
+	switch {
+	case len(message.NewChatMembers) > 0:
+		names := make([]string, 0, len(message.NewChatMembers))
+		for i := range message.NewChatMembers {
+			names = append(names, userDisplayName(&message.NewChatMembers[i]))
+		}
+		return strings.Join(names, "、") + " 加入了群组", true
+	case message.LeftChatMember != nil:
+		return userDisplayName(message.LeftChatMember) + " 离开了群组", true
+	case message.PinnedMessage != nil:
+		return actor + " 置顶了一条消息", true
+	case message.NewChatTitle != "":
+		return actor + " 将群组名称改为「" + message.NewChatTitle + "」", true
+	case message.NewChatPhoto != nil:
+		return actor + " 更换了群组头像", true
+	case message.DeleteChatPhoto:
+		return actor + " 删除了群组头像", true
+	case message.GroupChatCreated, message.SuperGroupChatCreated, message.ChannelChatCreated:
+		return actor + " 创建了群组", true
+	case message.MigrateToChatID != 0, message.MigrateFromChatID != 0:
+		return "群组已升级为超级群组", true
+	case message.MessageAutoDeleteTimerChanged != nil:
+		return actor + " 更改了消息自动删除时间", true
+	case message.VoiceChatScheduled != nil:
+		return actor + " 预约了语音聊天", true
+	case message.VoiceChatStarted != nil:
+		return "语音聊天已开始", true
+	case message.VoiceChatEnded != nil:
+		return "语音聊天已结束", true
+	case message.VoiceChatParticipantsInvited != nil:
+		return actor + " 邀请成员加入语音聊天", true
+	case message.ProximityAlertTriggered != nil:
+		return "触发了位置接近提醒", true
+	}
+	return "", false
+}
+
+// 机器人是否把服务消息汇总为说明发送给创建者，默认直接丢弃
+func (m *BotManager) summarizesServiceMessages(token string) bool {
+	var enabled bool
+	err := m.db.QueryRow("SELECT service_summary FROM bots WHERE token = ?", token).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get service message setting of bot %s: %v", botIDFromToken(token), err)
+	}
+	return enabled
+}
+
+// 过滤服务消息，返回是否已处理
+func (m *BotManager) filterServiceMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) bool {
+	summary, ok := describeServiceMessage(message)
+	if !ok {
+		return false
+	}
+	metrics.inc("forwardme_service_messages_total", "bot", botIDFromToken(bot.Token))
+	if !m.summarizesServiceMessages(bot.Token) {
+		return true
+	}
+	where := "私聊"
+	if message.Chat.Title != "" {
+		where = "群组「" + message.Chat.Title + "」"
+	}
+	if _, err := bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("ℹ️ %s：%s", where, summary))); err != nil {
+		log.Printf("Failed to send service message summary to creator: %v", err)
+	}
+	return true
+}
+
+// 处理 /service [drop|summary]
+func (m *BotManager) handleServiceCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/service drop 丢弃入群、退群、置顶等服务消息，/service summary 改为发送一句说明"
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "":
+		state := "丢弃"
+		if m.summarizesServiceMessages(token) {
+			state = "发送说明"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "服务消息："+state+"\n"+usage))
+	case "drop":
+		if _, err := m.db.Exec("UPDATE bots SET service_summary = 0 WHERE token = ?", token); err != nil {
+			log.Printf("Failed to update service message setting of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update service message setting")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "服务消息将被丢弃"))
+	case "summary":
+		if _, err := m.db.Exec("UPDATE bots SET service_summary = 1 WHERE token = ?", token); err != nil {
+			log.Printf("Failed to update service message setting of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update service message setting")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "服务消息将汇总为一句说明发送给你"))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
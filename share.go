@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /share 默认分享最近的消息条数和上限
+const (
+	shareDefaultCount = 50
+	shareMaxCount     = 200
+)
+
+// 对话中的一条消息，chatID 是消息所在的聊天，即用户与机器人的私聊
+type conversationMessage struct {
+	chatID    int64
+	messageID int
+	createdAt int64
+}
+
+// 用户与机器人的最近 limit 条对话，按时间顺序排列。用户发送的消息取自转发记录，
+// 回复取自回复记录，都仍保存在用户的私聊中，可以直接转发
+func (m *BotManager) loadConversation(token string, userID int64, limit int) ([]conversationMessage, error) {
+	rows, err := m.db.Query(`SELECT message_id, created_at FROM (
+			SELECT user_message_id AS message_id, MIN(created_at) AS created_at FROM message_map
+				WHERE bot_token = ?1 AND user_id = ?2 GROUP BY user_message_id
+			UNION ALL
+			SELECT message_id, created_at FROM reply_log WHERE bot_token = ?1 AND user_id = ?2
+		) ORDER BY created_at DESC, message_id DESC LIMIT ?3`, token, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []conversationMessage
+	for rows.Next() {
+		c := conversationMessage{chatID: userID}
+		if err := rows.Scan(&c.messageID, &c.createdAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, c)
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, rows.Err()
+}
+
+// 处理 /share <用户ID> <目标聊天> [条数]，把与该用户的对话副本转发给另一位管理员或审核群。
+// 目标须已与机器人对话过，或机器人已加入该群组
+func (m *BotManager) handleShareCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := fmt.Sprintf("用法：/share <用户ID> <目标聊天ID> [条数]，把与该用户最近的对话转发到目标聊天，默认 %d 条，最多 %d 条。也可以回复一条转发消息发送 /share <目标聊天ID>", shareDefaultCount, shareMaxCount)
+	userID, rest, err := m.commandTarget(token, message)
+	fields := strings.Fields(rest)
+	if err != nil || len(fields) == 0 || len(fields) > 2 {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	targetID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	count := shareDefaultCount
+	if len(fields) == 2 {
+		if count, err = strconv.Atoi(fields[1]); err != nil || count < 1 || count > shareMaxCount {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+	}
+
+	messages, err := m.loadConversation(token, userID, count)
+	if err != nil {
+		log.Printf("Failed to load conversation with user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to load conversation")))
+		return
+	}
+	if len(messages) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("没有与用户ID: %d 的对话记录", userID)))
+		return
+	}
+
+	actorID := message.From.ID
+	header := fmt.Sprintf("📤 %s 与用户ID: %d 的最近 %d 条对话，由 %d 分享", m.botUsername(token), userID, len(messages), actorID)
+	if _, err := bot.Send(tgbotapi.NewMessage(targetID, header)); err != nil {
+		log.Printf("Failed to share conversation with user %d to chat %d for bot %s: %v", userID, targetID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, "无法发送到目标聊天，请确认对方已与机器人对话过，或机器人已加入该群组"))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("开始向 %d 分享 %d 条消息", targetID, len(messages))))
+
+	go func() {
+		sent, failed := 0, 0
+		for _, c := range messages {
+			if _, err := bot.Send(tgbotapi.NewForward(targetID, c.chatID, c.messageID)); err != nil {
+				// 用户删除了消息或删除了与机器人的对话时无法再转发
+				log.Printf("Failed to share message %d of user %d for bot %s: %v", c.messageID, userID, botIDFromToken(token), err)
+				failed++
+			} else {
+				sent++
+			}
+			time.Sleep(broadcastInterval)
+		}
+		m.logEvent(token, actorID, eventShare, userID, fmt.Sprintf("分享到 %d，成功 %d，失败 %d", targetID, sent, failed))
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("分享完成：成功 %d，失败 %d", sent, failed)))
+	}()
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 常用回复。Text 是纯文字，用于列表和对话记录；HTML 保留了保存时的格式，发送时使用
+type snippet struct {
+	Name, Text, HTML string
+}
+
+// 把带格式的文字转换为 Telegram 支持的 HTML。entities 的位置按 UTF-16 计算，
+// 提及、链接、话题标签等客户端会自动识别的实体不需要保留
+func entitiesToHTML(text string, entities []tgbotapi.MessageEntity) string {
+	type tag struct {
+		open, close string
+		start, end  int
+	}
+	var tags []tag
+	for _, e := range entities {
+		t := tag{start: e.Offset, end: e.Offset + e.Length}
+		switch e.Type {
+		case "bold":
+			t.open, t.close = "<b>", "</b>"
+		case "italic":
+			t.open, t.close = "<i>", "</i>"
+		case "underline":
+			t.open, t.close = "<u>", "</u>"
+		case "strikethrough":
+			t.open, t.close = "<s>", "</s>"
+		case "spoiler":
+			t.open, t.close = "<tg-spoiler>", "</tg-spoiler>"
+		case "code":
+			t.open, t.close = "<code>", "</code>"
+		case "pre":
+			t.open, t.close = "<pre>", "</pre>"
+			if e.Language != "" {
+				t.open, t.close = `<pre><code class="language-`+html.EscapeString(e.Language)+`">`, "</code></pre>"
+			}
+		case "text_link":
+			t.open, t.close = `<a href="`+html.EscapeString(e.URL)+`">`, "</a>"
+		case "text_mention":
+			if e.User == nil {
+				continue
+			}
+			t.open, t.close = fmt.Sprintf(`<a href="tg://user?id=%d">`, e.User.ID), "</a>"
+		case "blockquote":
+			t.open, t.close = "<blockquote>", "</blockquote>"
+		default:
+			continue
+		}
+		tags = append(tags, t)
+	}
+	// 同一位置先打开范围大的，嵌套的格式才能正确闭合
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].start != tags[j].start {
+			return tags[i].start < tags[j].start
+		}
+		return tags[i].end > tags[j].end
+	})
+
+	var b strings.Builder
+	var open []tag
+	next := 0
+	emit := func(pos int) {
+		for len(open) > 0 && open[len(open)-1].end <= pos {
+			b.WriteString(open[len(open)-1].close)
+			open = open[:len(open)-1]
+		}
+		for next < len(tags) && tags[next].start <= pos {
+			b.WriteString(tags[next].open)
+			open = append(open, tags[next])
+			next++
+		}
+	}
+	pos := 0
+	for _, r := range text {
+		emit(pos)
+		b.WriteString(html.EscapeString(string(r)))
+		pos += len(utf16.Encode([]rune{r}))
+	}
+	emit(pos)
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString(open[i].close)
+	}
+	return b.String()
+}
+
+// 文字在 UTF-16 中的长度，与实体的位置单位一致
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// 截取 text 中从 start 字节开始、长 length 字节的部分及其中的实体，实体位置改为相对于截取后的文字
+func sliceEntities(text string, entities []tgbotapi.MessageEntity, start, length int) []tgbotapi.MessageEntity {
+	from := utf16Len(text[:start])
+	to := from + utf16Len(text[start:start+length])
+	var sliced []tgbotapi.MessageEntity
+	for _, e := range entities {
+		s, end := max(e.Offset, from), min(e.Offset+e.Length, to)
+		if s >= end {
+			continue
+		}
+		e.Offset, e.Length = s-from, end-s
+		sliced = append(sliced, e)
+	}
+	return sliced
+}
+
+func (m *BotManager) getSnippet(token, name string) (snippet, error) {
+	s := snippet{Name: name}
+	err := m.db.QueryRow("SELECT text, html FROM snippets WHERE bot_token = ? AND name = ?", token, name).Scan(&s.Text, &s.HTML)
+	return s, err
+}
+
+func (m *BotManager) listSnippets(token string) ([]snippet, error) {
+	rows, err := m.db.Query("SELECT name, text, html FROM snippets WHERE bot_token = ? ORDER BY name", token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []snippet
+	for rows.Next() {
+		var s snippet
+		if err := rows.Scan(&s.Name, &s.Text, &s.HTML); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// 处理 /save <名称> <内容>，或回复一条消息发送 /save <名称> 保存那条消息的文字，格式一并保存
+func (m *BotManager) handleSaveSnippetCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/save <名称> <内容> 保存一条常用回复，内容可以使用粗体、链接等格式和 {{变量名}}；也可以回复一条消息发送 /save <名称> 保存那条消息。" +
+		"回复转交的消息发送 /r <名称> 即可发给用户。名称只能包含小写字母、数字和下划线"
+	args := strings.TrimLeftFunc(message.CommandArguments(), unicode.IsSpace)
+	nameEnd := strings.IndexFunc(args, unicode.IsSpace)
+	if nameEnd < 0 {
+		nameEnd = len(args)
+	}
+	name := strings.ToLower(args[:nameEnd])
+	if !commandNamePattern.MatchString(name) {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+
+	// 内容在原消息中的位置，用于截取对应的格式
+	source, entities := message.Text, message.Entities
+	body := strings.TrimSpace(args[nameEnd:])
+	start := len(source) - len(strings.TrimLeftFunc(args[nameEnd:], unicode.IsSpace))
+	if body == "" {
+		reply := message.ReplyToMessage
+		if reply == nil || reply.Text == "" && reply.Caption == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		source, entities = reply.Text, reply.Entities
+		if source == "" {
+			source, entities = reply.Caption, reply.CaptionEntities
+		}
+		body = strings.TrimSpace(source)
+		start = strings.Index(source, body)
+	}
+	formatted := entitiesToHTML(body, sliceEntities(source, entities, start, len(body)))
+
+	_, err := m.db.Exec(`INSERT INTO snippets (bot_token, name, text, html, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (bot_token, name) DO UPDATE SET text = excluded.text, html = excluded.html`, token, name, body, formatted, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to save snippet %s for bot %s: %v", name, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to save snippet")))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已保存常用回复 %s，回复转交的消息发送 /r %s 即可发给用户", name, name)))
+}
+
+// 处理 /delsnippet <名称>
+func (m *BotManager) handleDeleteSnippetCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	name := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if name == "" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用法：/delsnippet <名称>"))
+		return
+	}
+	res, err := m.db.Exec("DELETE FROM snippets WHERE bot_token = ? AND name = ?", token, name)
+	if err != nil {
+		log.Printf("Failed to delete snippet %s of bot %s: %v", name, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete snippet")))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "常用回复不存在："+name))
+		return
+	}
+	bot.Send(tgbotapi.NewMessage(creatorID, "已删除常用回复 "+name))
+}
+
+// 处理 /snippets
+func (m *BotManager) handleSnippetsCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	list, err := m.listSnippets(token)
+	if err != nil {
+		log.Printf("Failed to list snippets of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list snippets")))
+		return
+	}
+	if len(list) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "暂无常用回复。用法：/save <名称> <内容>，/delsnippet <名称>"))
+		return
+	}
+	var b strings.Builder
+	for _, s := range list {
+		line, _, _ := strings.Cut(s.Text, "\n")
+		fmt.Fprintf(&b, "%s：%s\n", s.Name, truncateText(line, 50))
+	}
+	b.WriteString("\n回复转交的消息发送 /r <名称> 发给用户")
+	bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+}
+
+// 处理 /r <名称>：作为对转交消息的回复，把常用回复按保存时的格式发给用户，也可以用 /r <ID> <名称>。
+// 变量和署名与直接回复相同
+func (m *BotManager) handleSnippetReplyCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	userID, rest, err := m.commandTarget(token, message)
+	name := strings.ToLower(strings.TrimSpace(rest))
+	if err != nil || name == "" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用法：回复一条转交的消息发送 /r <名称>，或发送 /r <ID> <名称>。/snippets 查看常用回复"))
+		return
+	}
+	s, err := m.getSnippet(token, name)
+	if err == sql.ErrNoRows {
+		bot.Send(tgbotapi.NewMessage(creatorID, "常用回复不存在："+name+"，/snippets 查看全部"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get snippet %s of bot %s: %v", name, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get snippet")))
+		return
+	}
+
+	signature := m.replySignature(token, message.From.ID)
+	reply := tgbotapi.NewMessage(userID, signReply(m.expandUserVarsWith(token, userID, s.HTML, html.EscapeString), html.EscapeString(signature)))
+	reply.ParseMode = tgbotapi.ModeHTML
+	// 对话记录和审计日志记录常用回复的文字而不是命令。命令消息不对应用户收到的内容，不支持同步编辑
+	sent := *message
+	sent.Text, sent.Entities = m.expandUserVars(token, userID, s.Text), nil
+	m.sendReply(bot, &sent, reply, userID, 0)
+}
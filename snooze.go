@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 检查静默是否结束的间隔
+const snoozeCheckInterval = time.Minute
+
+// 解析静默结束时间：today 表示到今天结束，其余格式与 /vacation 相同
+func parseSnoozeUntil(value string, now time.Time) (time.Time, error) {
+	if strings.EqualFold(value, "today") {
+		y, mo, d := now.Date()
+		return time.Date(y, mo, d+1, 0, 0, 0, 0, now.Location()), nil
+	}
+	return parseVacationUntil(value, now)
+}
+
+// 用户的静默结束时间，未静默时返回 false
+func (m *BotManager) snoozedUntil(token string, userID int64) (time.Time, bool) {
+	var until int64
+	err := m.db.QueryRow("SELECT until FROM snoozed_users WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&until)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get snooze of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		}
+		return time.Time{}, false
+	}
+	return time.Unix(until, 0), time.Now().Unix() < until
+}
+
+// 静默期间的消息不转发也不提示用户，暂存到静默结束后汇总投递。返回消息是否已被拦下
+func (m *BotManager) snoozeMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	token, userID := bot.Token, message.From.ID
+	if _, ok := m.snoozedUntil(token, userID); !ok {
+		return false
+	}
+	_, err := m.db.Exec("INSERT INTO snoozed_messages (bot_token, user_id, chat_id, message_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		token, userID, message.Chat.ID, message.MessageID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to hold snoozed message of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return false
+	}
+	log.Printf("User ID: %d is snoozed for bot %s, holding message.", userID, botIDFromToken(token))
+	return true
+}
+
+// 投递一个已结束的静默：先发一条汇总，再依次转发期间收到的消息。
+// 机器人未运行或转发失败时保留，下次检查时重试
+func (m *BotManager) deliverSnoozed(token string, userID int64) {
+	m.mu.RLock()
+	bot, running := m.bots[token]
+	creatorID := m.creator[token]
+	m.mu.RUnlock()
+	if !running {
+		return
+	}
+	creatorID = m.onDutyID(creatorID)
+
+	rows, err := m.db.Query("SELECT id, chat_id, message_id FROM snoozed_messages WHERE bot_token = ? AND user_id = ? ORDER BY id", token, userID)
+	if err != nil {
+		log.Printf("Failed to load snoozed messages of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return
+	}
+	type snoozedMessage struct {
+		id, chatID int64
+		messageID  int
+	}
+	var held []snoozedMessage
+	for rows.Next() {
+		var s snoozedMessage
+		if err := rows.Scan(&s.id, &s.chatID, &s.messageID); err == nil {
+			held = append(held, s)
+		}
+	}
+	rows.Close()
+
+	if len(held) > 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("💤 用户ID: %d 的静默已结束，期间收到 %d 条消息：", userID, len(held))))
+	}
+	for _, s := range held {
+		if !m.forwardUserMessage(bot, creatorID, s.chatID, userID, s.messageID) {
+			return
+		}
+		if _, err := m.db.Exec("DELETE FROM snoozed_messages WHERE id = ?", s.id); err != nil {
+			log.Printf("Failed to remove snoozed message %d for bot %s: %v", s.id, botIDFromToken(token), err)
+		}
+	}
+	if _, err := m.db.Exec("DELETE FROM snoozed_users WHERE bot_token = ? AND user_id = ?", token, userID); err != nil {
+		log.Printf("Failed to end snooze of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+func (m *BotManager) runSnoozeExpiry() {
+	ticker := time.NewTicker(snoozeCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rows, err := m.db.Query("SELECT bot_token, user_id FROM snoozed_users WHERE until <= ?", time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to load expired snoozes: %v", err)
+			continue
+		}
+		type snooze struct {
+			token  string
+			userID int64
+		}
+		var expired []snooze
+		for rows.Next() {
+			var s snooze
+			if err := rows.Scan(&s.token, &s.userID); err == nil {
+				expired = append(expired, s)
+			}
+		}
+		rows.Close()
+
+		for _, s := range expired {
+			m.deliverSnoozed(s.token, s.userID)
+		}
+	}
+}
+
+// 处理 /snoozeuser <ID> <时长>|off，或回复一条转发消息使用。无参数时列出静默中的用户
+func (m *BotManager) handleSnoozeCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/snoozeuser <ID> <时长>，时长可以是 today、12h、3d 或结束日期 2026-10-20，期间该用户的消息暂存不转发，结束后汇总送达；/snoozeuser <ID> off 立即结束。也可以回复一条转发消息使用"
+
+	if strings.TrimSpace(message.CommandArguments()) == "" && message.ReplyToMessage == nil {
+		entries, err := m.queryStrings(`SELECT user_id || '：至 ' || strftime('%Y-%m-%d %H:%M', until, 'unixepoch', 'localtime')
+			FROM snoozed_users WHERE bot_token = ? AND until > ? ORDER BY until`, token, time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to list snoozed users of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list snoozed users")))
+			return
+		}
+		if len(entries) == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "没有静默中的用户。"+usage))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "静默中的用户：\n"+strings.Join(entries, "\n")))
+		return
+	}
+
+	userID, rest, err := m.commandTarget(token, message)
+	if err != nil || rest == "" {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	from := message.From.ID
+
+	if strings.EqualFold(rest, "off") {
+		res, err := m.db.Exec("UPDATE snoozed_users SET until = ? WHERE bot_token = ? AND user_id = ?", time.Now().Unix(), token, userID)
+		if err != nil {
+			log.Printf("Failed to end snooze of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to end snooze")))
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 没有被静默", userID)))
+			return
+		}
+		m.logEvent(token, from, eventUnsnooze, userID, "")
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 的静默已结束", userID)))
+		m.deliverSnoozed(token, userID)
+		return
+	}
+
+	until, err := parseSnoozeUntil(rest, time.Now())
+	if err != nil || !until.After(time.Now()) {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	_, err = m.db.Exec(`INSERT INTO snoozed_users (bot_token, user_id, until, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (bot_token, user_id) DO UPDATE SET until = excluded.until`, token, userID, until.Unix(), time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to snooze user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to snooze user")))
+		return
+	}
+	m.logEvent(token, from, eventSnooze, userID, until.Format("2006-01-02 15:04"))
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 已静默至 %s，期间的消息会在结束后汇总送达", userID, until.Format("2006-01-02 15:04"))))
+}
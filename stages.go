@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 未单独配置时每个处理步骤的超时
+const defaultStageTimeout = 3 * time.Second
+
+// 处理步骤，超时时在转发的消息下注明。目前只有风险评分需要请求 Bot API（查询用户头像），FAQ、表单、情绪等步骤只读写本地数据库
+const stageRisk = "risk"
+
+var stageNames = map[string]string{
+	stageRisk: "风险评分",
+}
+
+// 解析 "risk=2s"，未知的步骤和无效的条目会被忽略
+func parseStageTimeouts(value string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, part := range strings.Split(value, ",") {
+		stage, d, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		stage = strings.TrimSpace(stage)
+		if _, known := stageNames[stage]; !known {
+			log.Printf("Ignoring timeout of unknown stage %q, known stages: %s", stage, strings.Join(slices.Sorted(maps.Keys(stageNames)), ", "))
+			continue
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || timeout <= 0 {
+			log.Printf("Ignoring invalid stage timeout %q: %v", part, err)
+			continue
+		}
+		timeouts[stage] = timeout
+	}
+	return timeouts
+}
+
+func (m *BotManager) stageTimeout(stage string) time.Duration {
+	if timeout, ok := m.stageTimeouts[stage]; ok {
+		return timeout
+	}
+	return defaultStageTimeout
+}
+
+// 在超时限制内运行一个处理步骤。超时后不再等待（步骤在后台自行结束），
+// 返回 ok 为 false，调用方跳过该步骤继续转发，避免外部服务拖住消息投递
+func runStage[T any](m *BotManager, token, stage string, fn func() T) (result T, ok bool) {
+	done := make(chan T, 1)
+	go func() { done <- fn() }()
+
+	timer := time.NewTimer(m.stageTimeout(stage))
+	defer timer.Stop()
+	select {
+	case result = <-done:
+		return result, true
+	case <-timer.C:
+		log.Printf("Stage %s timed out for bot %s, skipping.", stage, botIDFromToken(token))
+		metrics.inc("forwardme_stage_timeouts_total", "bot", botIDFromToken(token), "stage", stage)
+		return result, false
+	}
+}
+
+// 在转发的消息下注明超时跳过的步骤，例如"⏱ 风险评分超时"
+func (m *BotManager) annotateTimeouts(bot *tgbotapi.BotAPI, creatorID int64, forwarded int, message *tgbotapi.Message, stages []string) {
+	if len(stages) == 0 {
+		return
+	}
+	var names []string
+	for _, stage := range stages {
+		name := stageNames[stage]
+		if name == "" {
+			name = stage
+		}
+		names = append(names, name+"超时")
+	}
+	note := tgbotapi.NewMessage(creatorID, "⏱ "+strings.Join(names, "、"))
+	note.ReplyToMessageID = forwarded
+	note.DisableNotification = true
+	if sent, err := bot.Send(note); err != nil {
+		log.Printf("Failed to send timeout note for bot %s: %v", botIDFromToken(bot.Token), err)
+	} else {
+		m.saveMessageMapping(bot.Token, sent.MessageID, message.From.ID, message.MessageID)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// 单机器人模式：不启动管理机器人，直接以 BOT_TOKEN 运行一个转发机器人，
+// OWNER_ID 即该机器人的创建者，其余审核功能与托管模式一致
+func runStandalone(manager *BotManager, token, ownerIDStr string) error {
+	ownerID, err := strconv.ParseInt(strings.TrimSpace(ownerIDStr), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid OWNER_ID %q: %w", ownerIDStr, err)
+	}
+	// OWNER_ID 以环境变量为准，更换后沿用原有的数据
+	if _, err := manager.db.Exec("UPDATE bots SET creator_id = ? WHERE token = ?", ownerID, token); err != nil {
+		return err
+	}
+	if err := manager.AddBot(token, ownerID); err != nil {
+		return err
+	}
+	log.Printf("Running in standalone mode for bot %s, owner ID: %d", botIDFromToken(token), ownerID)
+
+	sdNotify("READY=1")
+	// 转发在 AddBot 启动的 goroutine 中进行，这里一直阻塞
+	select {}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Telegram Stars 订阅的周期，目前只支持 30 天
+	subscriptionPeriod = 30 * 24 * time.Hour
+	// 到期后等待自动续费付款的时间
+	subscriptionGrace         = 24 * time.Hour
+	subscriptionCheckInterval = time.Hour
+	// 订阅购买的套餐
+	subscriptionPlan    = planPro
+	subscriptionPayload = "plan:" + subscriptionPlan
+)
+
+// 创建者当前的订阅，没有订阅时返回 false
+func (m *BotManager) subscription(creatorID int64) (expiresAt time.Time, canceled bool, ok bool) {
+	var at int64
+	err := m.db.QueryRow("SELECT expires_at, canceled FROM subscriptions WHERE creator_id = ?", creatorID).Scan(&at, &canceled)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get subscription of creator %d: %v", creatorID, err)
+		}
+		return time.Time{}, false, false
+	}
+	return time.Unix(at, 0), canceled, true
+}
+
+// 按套餐允许的数量暂停创建者多出的机器人，保留最早添加的，返回暂停的数量。
+// 套餐放宽后恢复被暂停的机器人
+func (m *BotManager) enforcePlanBots(creatorID int64) (int, error) {
+	tokens, err := m.queryStrings("SELECT token FROM bots WHERE creator_id = ? AND deleted_at = 0 ORDER BY rowid", creatorID)
+	if err != nil {
+		return 0, err
+	}
+	limit := plans[m.creatorPlan(creatorID)].Bots
+	paused := 0
+	for i, token := range tokens {
+		over := limit > 0 && i >= limit
+		if over {
+			paused++
+		}
+		if _, err := m.db.Exec("UPDATE bots SET over_plan = ? WHERE token = ?", over, token); err != nil {
+			return paused, err
+		}
+	}
+	return paused, nil
+}
+
+// 处理创建者在管理机器人中的 /subscribe，发送 Telegram Stars 订阅链接
+func (m *BotManager) handlePlanSubscribeCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID, creatorID := message.Chat.ID, message.From.ID
+	if m.subscriptionStars == 0 {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "本实例没有开放订阅"))
+		return
+	}
+	if expiresAt, canceled, ok := m.subscription(creatorID); ok {
+		text := fmt.Sprintf("你已订阅 %s 套餐，有效期至 %s，到期自动续费。发送 /unsubscribe 取消自动续费", subscriptionPlan, expiresAt.Format("2006-01-02 15:04"))
+		if canceled {
+			text = fmt.Sprintf("你的 %s 套餐有效期至 %s，已取消自动续费，到期后恢复为 %s 套餐", subscriptionPlan, expiresAt.Format("2006-01-02 15:04"), m.defaultPlan)
+		}
+		managerBot.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	params := tgbotapi.Params{
+		"title":               m.brandTitle(managerBot) + " " + subscriptionPlan,
+		"description":         formatPlanLimits(subscriptionPlan),
+		"payload":             subscriptionPayload,
+		"currency":            "XTR",
+		"subscription_period": strconv.Itoa(int(subscriptionPeriod.Seconds())),
+	}
+	if err := params.AddInterface("prices", []tgbotapi.LabeledPrice{{Label: subscriptionPlan + " 30 天", Amount: m.subscriptionStars}}); err != nil {
+		log.Printf("Failed to build subscription invoice: %v", err)
+		return
+	}
+	resp, err := managerBot.MakeRequest("createInvoiceLink", params)
+	if err != nil {
+		log.Printf("Failed to create subscription invoice for creator %d: %v", creatorID, err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to create invoice.")))
+		return
+	}
+	var link string
+	if err := json.Unmarshal(resp.Result, &link); err != nil {
+		log.Printf("Failed to read subscription invoice link: %v", err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to create invoice.")))
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("%s 套餐每 30 天 %d ⭐️，自动续费，可随时取消。\n%s", subscriptionPlan, m.subscriptionStars, formatPlanLimits(subscriptionPlan)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("订阅", link)))
+	managerBot.Send(msg)
+}
+
+// 付款前确认订单仍然有效，价格变化后旧链接会被拒绝
+func (m *BotManager) handlePreCheckout(managerBot *tgbotapi.BotAPI, query *tgbotapi.PreCheckoutQuery) {
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: true}
+	if m.subscriptionStars == 0 || query.InvoicePayload != subscriptionPayload || query.Currency != "XTR" || query.TotalAmount != m.subscriptionStars {
+		answer = tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, ErrorMessage: "订阅价格已变化，请重新发送 /subscribe"}
+	}
+	if _, err := managerBot.Request(answer); err != nil {
+		log.Printf("Failed to answer pre-checkout query of user %d: %v", query.From.ID, err)
+	}
+}
+
+// 首次付款和每次自动续费都会收到一条付款成功的消息，把套餐延长一个周期
+func (m *BotManager) handleSuccessfulPayment(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	payment := message.SuccessfulPayment
+	creatorID := message.From.ID
+	if payment.InvoicePayload != subscriptionPayload {
+		log.Printf("Ignoring payment with unknown payload %q from user %d", payment.InvoicePayload, creatorID)
+		return
+	}
+	now := time.Now()
+	expiresAt := now.Add(subscriptionPeriod)
+	_, err := m.db.Exec(`INSERT INTO subscriptions (creator_id, plan, charge_id, amount, expires_at, canceled, updated_at) VALUES (?, ?, ?, ?, ?, 0, ?)
+		ON CONFLICT (creator_id) DO UPDATE SET plan = excluded.plan, charge_id = excluded.charge_id, amount = excluded.amount,
+			expires_at = excluded.expires_at, canceled = 0, updated_at = excluded.updated_at`,
+		creatorID, subscriptionPlan, payment.TelegramPaymentChargeID, payment.TotalAmount, expiresAt.Unix(), now.Unix())
+	if err != nil {
+		// 付款已完成，记录下来以便运营者手动处理
+		log.Printf("Failed to record subscription payment %s of creator %d: %v", payment.TelegramPaymentChargeID, creatorID, err)
+		managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, "付款已收到，但套餐更新失败，请联系运营者"))
+		return
+	}
+	if _, err := m.setCreatorPlan(creatorID, subscriptionPlan); err != nil {
+		log.Printf("Failed to set plan of creator %d: %v", creatorID, err)
+	}
+	m.logEvent("", creatorID, eventPlan, creatorID, fmt.Sprintf("%s: %d XTR, %s", subscriptionPlan, payment.TotalAmount, payment.TelegramPaymentChargeID))
+	log.Printf("Creator %d paid %d XTR for the %s plan until %s.", creatorID, payment.TotalAmount, subscriptionPlan, expiresAt.Format(time.RFC3339))
+	managerBot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("感谢订阅！%s 套餐有效期至 %s", subscriptionPlan, expiresAt.Format("2006-01-02 15:04"))))
+}
+
+// 处理 /unsubscribe，取消自动续费，已付款的周期内套餐不变
+func (m *BotManager) handlePlanUnsubscribeCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID, creatorID := message.Chat.ID, message.From.ID
+	var chargeID string
+	var expiresAt int64
+	err := m.db.QueryRow("SELECT charge_id, expires_at FROM subscriptions WHERE creator_id = ? AND canceled = 0", creatorID).Scan(&chargeID, &expiresAt)
+	if err != nil {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "你没有自动续费的订阅"))
+		return
+	}
+	params := tgbotapi.Params{"user_id": strconv.FormatInt(creatorID, 10), "telegram_payment_charge_id": chargeID, "is_canceled": "true"}
+	if _, err := managerBot.MakeRequest("editUserStarSubscription", params); err != nil {
+		log.Printf("Failed to cancel subscription of creator %d: %v", creatorID, err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to cancel subscription.")))
+		return
+	}
+	if _, err := m.db.Exec("UPDATE subscriptions SET canceled = 1, updated_at = ? WHERE creator_id = ?", time.Now().Unix(), creatorID); err != nil {
+		log.Printf("Failed to record canceled subscription of creator %d: %v", creatorID, err)
+	}
+	managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("已取消自动续费，%s 套餐保留至 %s", subscriptionPlan, time.Unix(expiresAt, 0).Format("2006-01-02 15:04"))))
+}
+
+// 订阅到期后恢复为默认套餐，暂停超出限制的机器人并通知创建者
+func (m *BotManager) lapseSubscription(creatorID int64) {
+	if _, err := m.db.Exec("DELETE FROM subscriptions WHERE creator_id = ?", creatorID); err != nil {
+		log.Printf("Failed to remove subscription of creator %d: %v", creatorID, err)
+		return
+	}
+	paused, err := m.setCreatorPlan(creatorID, "")
+	if err != nil {
+		log.Printf("Failed to reset plan of creator %d: %v", creatorID, err)
+	}
+	m.logEvent("", 0, eventPlan, creatorID, "subscription lapsed")
+	log.Printf("Subscription of creator %d lapsed, %d bots paused.", creatorID, paused)
+
+	text := fmt.Sprintf("你的 %s 订阅已到期，已恢复为 %s 套餐：%s", subscriptionPlan, m.creatorPlan(creatorID), formatPlanLimits(m.creatorPlan(creatorID)))
+	if paused > 0 {
+		text += fmt.Sprintf("\n超出套餐的 %d 个机器人已暂停服务，重新订阅后自动恢复", paused)
+	}
+	text += "\n发送 /subscribe 重新订阅"
+	if managerBot := m.managerBotForCreator(creatorID); managerBot != nil {
+		managerBot.Send(tgbotapi.NewMessage(creatorID, text))
+	}
+}
+
+func (m *BotManager) runSubscriptionExpiry() {
+	ticker := time.NewTicker(subscriptionCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ids, err := m.queryStrings("SELECT creator_id FROM subscriptions WHERE expires_at <= ?", time.Now().Add(-subscriptionGrace).Unix())
+		if err != nil {
+			log.Printf("Failed to load expired subscriptions: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			if creatorID, err := strconv.ParseInt(id, 10, 64); err == nil {
+				m.lapseSubscription(creatorID)
+			}
+		}
+	}
+}
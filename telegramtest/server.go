@@ -0,0 +1,270 @@
+// Package telegramtest 提供一个本地的模拟 Telegram Bot API 服务器，
+// 不需要真实的 token 就可以跑通机器人的完整流程，也可以供插件复用。
+//
+// 用 Endpoint 作为 API 地址创建 tgbotapi.BotAPI，用 Send 给机器人投递更新，
+// 再用 Expect 等待机器人发出的请求：
+//
+//	srv := telegramtest.NewServer()
+//	defer srv.Close()
+//	srv.AddBot("1000:abc", "example_bot")
+//	bot, _ := tgbotapi.NewBotAPIWithAPIEndpoint("1000:abc", srv.Endpoint())
+//	srv.Send("1000:abc", telegramtest.TextMessage(user, "hello"))
+//	req, err := srv.Expect(time.Second, telegramtest.Call("1000:abc", "forwardMessage"))
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 长轮询最多等待的时间，避免关闭服务器时等待过久
+const maxPollWait = 2 * time.Second
+
+// 机器人发出的一次 Bot API 请求
+type Request struct {
+	Token  string
+	Method string
+	Params url.Values
+}
+
+// 请求中的聊天 ID，没有时返回 0
+func (r Request) ChatID() int64 {
+	id, _ := strconv.ParseInt(r.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+type Server struct {
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	bots     map[string]tgbotapi.User
+	updates  map[string][]tgbotapi.Update
+	nextID   int
+	requests []Request
+	// Expect 已经检查到的位置
+	cursor int
+	// 有新更新或新请求时关闭并替换，用于唤醒等待者
+	changed chan struct{}
+}
+
+func NewServer() *Server {
+	s := &Server{
+		bots:    make(map[string]tgbotapi.User),
+		updates: make(map[string][]tgbotapi.Update),
+		changed: make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+// tgbotapi.NewBotAPIWithAPIEndpoint 使用的地址格式
+func (s *Server) Endpoint() string {
+	return s.srv.URL + "/bot%s/%s"
+}
+
+// 登记一个机器人，未登记的 token 会收到 401，和 Telegram 对无效 token 的应答一样
+func (s *Server) AddBot(token, username string) {
+	id, _ := strconv.ParseInt(strings.SplitN(token, ":", 2)[0], 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bots[token] = tgbotapi.User{ID: id, IsBot: true, FirstName: username, UserName: username}
+}
+
+// 投递一条更新，机器人下一次 getUpdates 时收到
+func (s *Server) Send(token string, update tgbotapi.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	update.UpdateID = s.nextID
+	s.updates[token] = append(s.updates[token], update)
+	s.notifyLocked()
+}
+
+// 目前收到的全部请求，不含 getUpdates
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// 等待上一次 Expect 之后第一个满足 match 的请求，超时返回错误
+func (s *Server) Expect(timeout time.Duration, match func(Request) bool) (Request, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for i := s.cursor; i < len(s.requests); i++ {
+			if match(s.requests[i]) {
+				s.cursor = i + 1
+				r := s.requests[i]
+				s.mu.Unlock()
+				return r, nil
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return Request{}, fmt.Errorf("no matching request within %s", timeout)
+		}
+	}
+}
+
+// 匹配某个机器人调用的某个方法
+func Call(token, method string) func(Request) bool {
+	return func(r Request) bool {
+		return r.Token == token && r.Method == method
+	}
+}
+
+// 匹配某个机器人发往 chatID、文字包含 text 的 sendMessage
+func SentText(token string, chatID int64, text string) func(Request) bool {
+	return func(r Request) bool {
+		return r.Token == token && r.Method == "sendMessage" && r.ChatID() == chatID && strings.Contains(r.Params.Get("text"), text)
+	}
+}
+
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	// 路径为 /bot<token>/<method>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/bot"), "/", 2)
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	token, method := parts[0], parts[1]
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	self, ok := s.bots[token]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, self)
+	case "getUpdates":
+		s.getUpdates(w, r, token)
+	default:
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Token: token, Method: method, Params: r.Form})
+		s.nextID++
+		messageID := s.nextID
+		s.notifyLocked()
+		s.mu.Unlock()
+		writeResult(w, methodResult(method, r.Form, messageID, self))
+	}
+}
+
+// 返回 offset 之后的更新，没有时等待新的更新或超时
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request, token string) {
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	wait, _ := strconv.Atoi(r.Form.Get("timeout"))
+	deadline := time.After(min(time.Duration(wait)*time.Second, maxPollWait))
+	for {
+		s.mu.Lock()
+		// offset 之前的更新视为已确认
+		pending := s.updates[token]
+		for len(pending) > 0 && pending[0].UpdateID < offset {
+			pending = pending[1:]
+		}
+		s.updates[token] = pending
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(pending) > 0 {
+			writeResult(w, pending)
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// 各方法的应答。发送类方法返回一条新消息，其余返回 true
+func methodResult(method string, params url.Values, messageID int, self tgbotapi.User) interface{} {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	switch {
+	case method == "getWebhookInfo":
+		return tgbotapi.WebhookInfo{}
+	case method == "getChat":
+		return tgbotapi.Chat{ID: chatID, Type: "private"}
+	case method == "getUserProfilePhotos":
+		return tgbotapi.UserProfilePhotos{Photos: [][]tgbotapi.PhotoSize{}}
+	case method == "getMyCommands":
+		return []tgbotapi.BotCommand{}
+	case method == "copyMessage":
+		return tgbotapi.MessageID{MessageID: messageID}
+	case method == "forwardMessages", method == "copyMessages":
+		// 批量方法按请求中的消息数返回连续的消息 ID
+		var ids []int
+		json.Unmarshal([]byte(params.Get("message_ids")), &ids)
+		result := make([]tgbotapi.MessageID, len(ids))
+		for i := range ids {
+			result[i] = tgbotapi.MessageID{MessageID: messageID*1000 + i}
+		}
+		return result
+	case method == "createInvoiceLink":
+		return "https://t.me/$invoice"
+	case method == "createForumTopic":
+		return map[string]interface{}{"message_thread_id": messageID, "name": params.Get("name"), "icon_color": 0}
+	case strings.HasPrefix(method, "send"), strings.HasPrefix(method, "forward"), strings.HasPrefix(method, "edit"):
+		return tgbotapi.Message{
+			MessageID: messageID,
+			From:      &self,
+			Date:      int(time.Now().Unix()),
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+			Text:      params.Get("text"),
+			Caption:   params.Get("caption"),
+		}
+	default:
+		return true
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func writeError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: false, ErrorCode: status, Description: description})
+}
@@ -0,0 +1,54 @@
+package telegramtest
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var lastMessageID atomic.Int64
+
+// 用户在私聊中发送的文字消息，以 / 开头时标记为命令
+func TextMessage(from tgbotapi.User, text string) tgbotapi.Update {
+	message := &tgbotapi.Message{
+		MessageID: int(lastMessageID.Add(1)),
+		From:      &from,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: from.ID, Type: "private", FirstName: from.FirstName, UserName: from.UserName},
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		length := len(text)
+		if i := strings.IndexByte(text, ' '); i > 0 {
+			length = i
+		}
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+	return tgbotapi.Update{Message: message}
+}
+
+// 用户编辑了之前发送的消息
+func EditedMessage(original *tgbotapi.Message, text string) tgbotapi.Update {
+	edited := *original
+	edited.Text = text
+	edited.EditDate = int(time.Now().Unix())
+	return tgbotapi.Update{EditedMessage: &edited}
+}
+
+// 用户在私聊中点击消息上的按钮
+func CallbackQuery(from tgbotapi.User, data string) tgbotapi.Update {
+	id := lastMessageID.Add(1)
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   strconv.FormatInt(id, 10),
+		From: &from,
+		Message: &tgbotapi.Message{
+			MessageID: int(id),
+			Date:      int(time.Now().Unix()),
+			Chat:      &tgbotapi.Chat{ID: from.ID, Type: "private"},
+		},
+		Data: data,
+	}}
+}
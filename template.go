@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const templateVersion = 1
+
+// 模板包含的 bots 表设置。紧急联系人是具体的人，不随模板复制
+var templateSettings = []string{
+	"business_hours", "urgent_keywords", "sentiment", "menu_webapp", "start_webapp", "risk_threshold",
+	"approval_mode", "log_text", "service_summary", "forward_tools", "digest", "relay_copy",
+}
+
+// 模板包含的配置表。应用时先清空目标机器人的数据再写入；话题已有用户订阅，只补上缺少的
+var templateTables = []struct {
+	table   string
+	columns []string
+	stamp   string
+	merge   bool
+}{
+	{"custom_commands", []string{"name", "response"}, "created_at", false},
+	{"command_aliases", []string{"alias", "command"}, "created_at", false},
+	{"faqs", []string{"keywords", "answer"}, "", false},
+	{"label_rules", []string{"label", "kind", "value"}, "", false},
+	{"menu_items", []string{"position", "label", "action"}, "", false},
+	{"form_questions", []string{"question", "options"}, "", false},
+	{"retention_policies", []string{"data_class", "days"}, "updated_at", false},
+	{"topics", []string{"name"}, "created_at", true},
+}
+
+type botTemplate struct {
+	Version  int                                 `json:"version"`
+	Bot      string                              `json:"bot"`
+	Settings map[string]interface{}              `json:"settings"`
+	Tables   map[string][]map[string]interface{} `json:"tables"`
+}
+
+func (m *BotManager) exportTemplate(token string) (botTemplate, error) {
+	t := botTemplate{Version: templateVersion, Bot: m.botUsername(token), Settings: make(map[string]interface{}), Tables: make(map[string][]map[string]interface{})}
+
+	values := make([]interface{}, len(templateSettings))
+	dest := make([]interface{}, len(templateSettings))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := m.db.QueryRow("SELECT "+strings.Join(templateSettings, ", ")+" FROM bots WHERE token = ?", token).Scan(dest...); err != nil {
+		return t, err
+	}
+	for i, column := range templateSettings {
+		t.Settings[column] = values[i]
+	}
+
+	for _, tt := range templateTables {
+		rows, err := m.db.Query("SELECT "+strings.Join(tt.columns, ", ")+" FROM "+tt.table+" WHERE bot_token = ? ORDER BY rowid", token)
+		if err != nil {
+			return t, err
+		}
+		entries := []map[string]interface{}{}
+		for rows.Next() {
+			values := make([]interface{}, len(tt.columns))
+			dest := make([]interface{}, len(tt.columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return t, err
+			}
+			entry := make(map[string]interface{}, len(tt.columns))
+			for i, column := range tt.columns {
+				entry[column] = values[i]
+			}
+			entries = append(entries, entry)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return t, err
+		}
+		t.Tables[tt.table] = entries
+	}
+	return t, nil
+}
+
+// 模板中的值。JSON 中的数字解码为 float64，写回整数列前转换
+func templateValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int64:
+		return v, nil
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, fmt.Errorf("non-integer number %v", v)
+		}
+		return int64(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// 在一个事务中把模板应用到机器人。只接受已知的列，模板中没有的部分保持不变
+func (m *BotManager) applyTemplate(token string, t botTemplate) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sets []string
+	var args []interface{}
+	for _, column := range templateSettings {
+		v, ok := t.Settings[column]
+		if !ok {
+			continue
+		}
+		value, err := templateValue(v)
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", column, err)
+		}
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	if len(sets) > 0 {
+		if _, err := tx.Exec("UPDATE bots SET "+strings.Join(sets, ", ")+" WHERE token = ?", append(args, token)...); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Unix()
+	for _, tt := range templateTables {
+		entries, ok := t.Tables[tt.table]
+		if !ok {
+			continue
+		}
+		if !tt.merge {
+			if _, err := tx.Exec("DELETE FROM "+tt.table+" WHERE bot_token = ?", token); err != nil {
+				return err
+			}
+		}
+		columns := append([]string{"bot_token"}, tt.columns...)
+		if tt.stamp != "" {
+			columns = append(columns, tt.stamp)
+		}
+		insert := "INSERT INTO "
+		if tt.merge {
+			insert = "INSERT OR IGNORE INTO "
+		}
+		query := insert + tt.table + " (" + strings.Join(columns, ", ") + ") VALUES (?" + strings.Repeat(", ?", len(columns)-1) + ")"
+		for i, entry := range entries {
+			values := []interface{}{token}
+			for _, column := range tt.columns {
+				value, err := templateValue(entry[column])
+				if err != nil {
+					return fmt.Errorf("%s #%d %s: %w", tt.table, i+1, column, err)
+				}
+				values = append(values, value)
+			}
+			if tt.stamp != "" {
+				values = append(values, now)
+			}
+			if _, err := tx.Exec(query, values...); err != nil {
+				return fmt.Errorf("%s #%d: %w", tt.table, i+1, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func templateSummary(t botTemplate) string {
+	names := map[string]string{
+		"custom_commands": "自定义命令", "command_aliases": "命令别名", "faqs": "常见问题", "label_rules": "标签规则",
+		"menu_items": "菜单按钮", "form_questions": "表单问题", "retention_policies": "保留策略", "topics": "话题",
+	}
+	var parts []string
+	for _, tt := range templateTables {
+		if entries, ok := t.Tables[tt.table]; ok {
+			parts = append(parts, fmt.Sprintf("%s %d 条", names[tt.table], len(entries)))
+		}
+	}
+	return fmt.Sprintf("%d 项设置，%s", len(t.Settings), strings.Join(parts, "，"))
+}
+
+// 处理 /exporttemplate，把机器人的设置导出为 JSON 模板文件
+func (m *BotManager) handleExportTemplateCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	t, err := m.exportTemplate(token)
+	if err != nil {
+		log.Printf("Failed to export template of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to export template")))
+		return
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode template of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to export template")))
+		return
+	}
+	doc := tgbotapi.NewDocument(creatorID, tgbotapi.FileBytes{Name: "template-" + botIDFromToken(token) + ".json", Bytes: data})
+	doc.Caption = "配置模板：" + templateSummary(t) + "\n把此文件发送给另一个机器人并在说明中写 /applytemplate，或在那个机器人中发送 /applytemplate " + m.botUsername(token)
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Failed to send template of bot %s: %v", botIDFromToken(token), err)
+	}
+}
+
+// 按用户名或机器人 ID 查找运行中的机器人
+func (m *BotManager) botByName(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "@")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for token, bot := range m.bots {
+		if strings.EqualFold(bot.Self.UserName, name) || botIDFromToken(token) == name {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// 处理 /applytemplate。模板来自上传的文件（作为说明文字或回复文件），或直接复制自己管理的另一个机器人：/applytemplate @机器人
+func (m *BotManager) handleApplyTemplateCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, replyTo int64, args string) {
+	token := bot.Token
+	from := message.From.ID
+	usage := "用法：在另一个机器人中发送 /exporttemplate 得到模板文件，把文件发送到这里并在说明中写 /applytemplate，或回复该文件发送 /applytemplate；也可以发送 /applytemplate @机器人 直接复制你管理的另一个机器人的设置"
+
+	var t botTemplate
+	var source string
+	if args != "" {
+		sourceToken, ok := m.botByName(args)
+		if !ok || !m.botCan(sourceToken, from, permManage) {
+			bot.Send(tgbotapi.NewMessage(replyTo, "找不到你管理的机器人 "+args))
+			return
+		}
+		if sourceToken == token {
+			bot.Send(tgbotapi.NewMessage(replyTo, "不能把机器人的设置应用到它自己"))
+			return
+		}
+		var err error
+		if t, err = m.exportTemplate(sourceToken); err != nil {
+			log.Printf("Failed to export template of bot %s: %v", botIDFromToken(sourceToken), err)
+			bot.Send(tgbotapi.NewMessage(replyTo, friendlyError(err, "Failed to read template")))
+			return
+		}
+		source = m.botUsername(sourceToken)
+	} else {
+		doc := message.Document
+		if doc == nil && message.ReplyToMessage != nil {
+			doc = message.ReplyToMessage.Document
+		}
+		if doc == nil {
+			bot.Send(tgbotapi.NewMessage(replyTo, usage))
+			return
+		}
+		text, err := m.downloadDocumentText(bot, doc)
+		if err != nil {
+			log.Printf("Failed to download template for bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(replyTo, friendlyError(err, "Failed to read template")))
+			return
+		}
+		if err := json.Unmarshal([]byte(text), &t); err != nil || t.Version != templateVersion {
+			bot.Send(tgbotapi.NewMessage(replyTo, "文件不是有效的配置模板。"+usage))
+			return
+		}
+		source = "文件 " + doc.FileName
+	}
+
+	prompt := fmt.Sprintf("确认把 %s 的配置模板（%s）应用到 %s？模板包含的设置和列表会替换当前的内容，已有的话题会保留。", source, templateSummary(t), m.botUsername(token))
+	m.askConfirmation(bot, replyTo, from, prompt, "确认应用", func() {
+		if err := m.applyTemplate(token, t); err != nil {
+			log.Printf("Failed to apply template to bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(replyTo, "Failed to apply template: "+err.Error()))
+			return
+		}
+		m.syncCommands(bot)
+		if v, ok := t.Settings["menu_webapp"].(string); ok {
+			label, webAppURL := "", ""
+			if i := strings.LastIndex(v, " "); i > 0 {
+				label, webAppURL = v[:i], v[i+1:]
+			}
+			if err := setWebAppMenuButton(bot, label, webAppURL); err != nil {
+				log.Printf("Failed to set menu button of bot %s: %v", botIDFromToken(token), err)
+			}
+		}
+		log.Printf("User %d applied a template from %s to bot %s.", from, source, botIDFromToken(token))
+		m.logEvent(token, from, eventTemplate, 0, source)
+		bot.Send(tgbotapi.NewMessage(replyTo, "已应用配置模板："+templateSummary(t)))
+	})
+}
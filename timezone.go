@@ -0,0 +1,314 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 用户当地时间在这段时间内时，回复不发出提醒，转交时标注 🌙
+const (
+	quietHoursStart = 22
+	quietHoursEnd   = 8
+)
+
+var utcOffsetPattern = regexp.MustCompile(`(?i)^(?:utc|gmt)?\s*([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// 没有设置时区的用户按 Telegram 客户端语言推断时区，只列出基本集中在一个时区的语言，
+// 英语、西班牙语等跨越多个时区的语言不推断
+var languageTimeZones = map[string]string{
+	"zh":      "Asia/Shanghai",
+	"zh-hans": "Asia/Shanghai",
+	"zh-hant": "Asia/Taipei",
+	"ja":      "Asia/Tokyo",
+	"ko":      "Asia/Seoul",
+	"ru":      "Europe/Moscow",
+	"uk":      "Europe/Kyiv",
+	"fa":      "Asia/Tehran",
+	"tr":      "Europe/Istanbul",
+	"de":      "Europe/Berlin",
+	"fr":      "Europe/Paris",
+	"it":      "Europe/Rome",
+	"pl":      "Europe/Warsaw",
+	"nl":      "Europe/Amsterdam",
+	"pt-br":   "America/Sao_Paulo",
+	"id":      "Asia/Jakarta",
+	"vi":      "Asia/Ho_Chi_Minh",
+	"th":      "Asia/Bangkok",
+	"hi":      "Asia/Kolkata",
+}
+
+// 解析 IANA 时区名称（Asia/Shanghai）或 UTC 偏移（UTC+8、+05:30），
+// 返回时区和保存时使用的规范写法
+func parseTimeZone(value string) (*time.Location, string, error) {
+	value = strings.TrimSpace(value)
+	if match := utcOffsetPattern.FindStringSubmatch(value); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes, _ := strconv.Atoi(match[3])
+		if hours > 14 || minutes >= 60 {
+			return nil, "", fmt.Errorf("invalid UTC offset %q", value)
+		}
+		name := fmt.Sprintf("UTC%s%02d:%02d", match[1], hours, minutes)
+		offset := (hours*60 + minutes) * 60
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), name, nil
+	}
+	if value == "" || strings.EqualFold(value, "local") {
+		return nil, "", fmt.Errorf("invalid time zone %q", value)
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return loc, loc.String(), nil
+}
+
+// 用户自己的时区：用户或管理员设置的时区，其次按语言推断，都没有时返回 false
+func (m *BotManager) knownUserLocation(token string, userID int64) (*time.Location, string, bool) {
+	var zone, language string
+	err := m.db.QueryRow("SELECT time_zone, language_code FROM bot_users WHERE bot_token = ? AND user_id = ?", token, userID).Scan(&zone, &language)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get time zone of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+	if zone != "" {
+		if loc, _, err := parseTimeZone(zone); err == nil {
+			return loc, "已设置", true
+		}
+	}
+	language = strings.ToLower(language)
+	for _, key := range []string{language, strings.SplitN(language, "-", 2)[0]} {
+		if zone, ok := languageTimeZones[key]; ok {
+			if loc, err := time.LoadLocation(zone); err == nil {
+				return loc, "按语言推断", true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// 机器人一侧的时区：工作时间的时区，没有设置工作时间时为服务器时区
+func (m *BotManager) botLocation(token string) (*time.Location, string) {
+	if hours, ok := m.getBusinessHours(token); ok {
+		return hours.Loc, "工作时间的时区"
+	}
+	return time.Local, "服务器时区"
+}
+
+// 用户所在的时区和来源说明，不知道用户的时区时使用机器人一侧的时区
+func (m *BotManager) userLocation(token string, userID int64) (*time.Location, string) {
+	if loc, source, ok := m.knownUserLocation(token, userID); ok {
+		return loc, source
+	}
+	return m.botLocation(token)
+}
+
+func inQuietHours(t time.Time) bool {
+	return t.Hour() >= quietHoursStart || t.Hour() < quietHoursEnd
+}
+
+// 已知用户的时区且当地正值深夜
+func (m *BotManager) userAsleep(token string, userID int64, now time.Time) bool {
+	loc, _, ok := m.knownUserLocation(token, userID)
+	return ok && inQuietHours(now.In(loc))
+}
+
+// 转交时附在来源说明后的对方当地时间。只在已知用户的时区、且与机器人一侧的时差不为零时显示
+func (m *BotManager) localTimeNote(token string, userID int64, now time.Time) string {
+	loc, _, ok := m.knownUserLocation(token, userID)
+	if !ok {
+		return ""
+	}
+	local := now.In(loc)
+	botLoc, _ := m.botLocation(token)
+	_, userOffset := local.Zone()
+	_, botOffset := now.In(botLoc).Zone()
+	if userOffset == botOffset {
+		return ""
+	}
+	note := "对方当地时间 " + local.Format("15:04")
+	if inQuietHours(local) {
+		note = "🌙 " + note
+	}
+	return note
+}
+
+// 回复的消息不发出提醒，用于用户当地的深夜
+func silenced(c tgbotapi.Chattable) tgbotapi.Chattable {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.PhotoConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.VideoConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.AnimationConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.DocumentConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.VoiceConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.AudioConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.StickerConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.VideoNoteConfig:
+		c.DisableNotification = true
+		return c
+	case tgbotapi.CopyMessageConfig:
+		c.DisableNotification = true
+		return c
+	}
+	return c
+}
+
+// 开启 /asktimezone 后，无法推断时区的用户第一次发消息时请对方告知时区，每位用户只询问一次
+func (m *BotManager) askTimeZone(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token := bot.Token
+	userID := message.From.ID
+	if !m.botFlag(token, "ask_time_zone") {
+		return
+	}
+	if _, _, ok := m.knownUserLocation(token, userID); ok {
+		return
+	}
+	res, err := m.db.Exec("UPDATE bot_users SET time_zone_asked = 1 WHERE bot_token = ? AND user_id = ? AND time_zone_asked = 0", token, userID)
+	if err != nil {
+		log.Printf("Failed to record time zone question to user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	prompt := tgbotapi.NewMessage(message.Chat.ID, "方便的话，请发送 /timezone 加上你所在的时区，例如 /timezone UTC+8 或 /timezone Europe/Berlin，这样我们可以在合适的时间回复你。不告知也不影响消息送达")
+	prompt.DisableNotification = true
+	if _, err := bot.Send(prompt); err != nil {
+		log.Printf("Failed to ask user %d for time zone for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+// 保存用户的时区，zone 为空时清除，恢复为按语言推断。用户还没有记录时返回 false
+func (m *BotManager) setUserTimeZone(token string, userID int64, zone string) (bool, error) {
+	res, err := m.db.Exec("UPDATE bot_users SET time_zone = ? WHERE bot_token = ? AND user_id = ?", zone, token, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// 用户发送的 /timezone [时区]|off
+func (m *BotManager) handleTimeZoneCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	token := bot.Token
+	userID := message.From.ID
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		text := "用法：/timezone <时区>，例如 /timezone UTC+8 或 /timezone Europe/Berlin，/timezone off 清除"
+		if loc, _, ok := m.knownUserLocation(token, userID); ok {
+			text = fmt.Sprintf("你的时区：%s，当地时间 %s\n", loc, time.Now().In(loc).Format("15:04")) + text
+		}
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+
+	var loc *time.Location
+	var zone string
+	if !strings.EqualFold(arg, "off") {
+		var err error
+		if loc, zone, err = parseTimeZone(arg); err != nil {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, "无法识别的时区，请使用 UTC+8 这样的时差或 Asia/Shanghai 这样的时区名称"))
+			return
+		}
+	}
+	if _, err := m.setUserTimeZone(token, userID, zone); err != nil {
+		log.Printf("Failed to set time zone of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "设置失败，请稍后再试。"))
+		return
+	}
+	if loc == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "已清除你的时区"))
+		return
+	}
+	log.Printf("User %d set time zone %s for bot %s.", userID, zone, botIDFromToken(token))
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("已设置你的时区：%s，当地时间 %s", zone, time.Now().In(loc).Format("15:04"))))
+}
+
+// 处理 /usertz <ID> <时区>|off，也可以回复一条转交的消息发送
+func (m *BotManager) handleUserTZCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	userID, rest, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "用法：/usertz <ID> <时区>，例如 /usertz 123456 Europe/Berlin 或 /usertz 123456 UTC+8，或回复一条转交的消息发送 /usertz Europe/Berlin。/usertz <ID> off 恢复为按语言推断"))
+		return
+	}
+	arg := strings.TrimSpace(rest)
+	if arg == "" {
+		loc, source := m.userLocation(token, userID)
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 的时区：%s（%s），当地时间 %s", userID, loc, source, time.Now().In(loc).Format("01-02 15:04"))))
+		return
+	}
+	var zone string
+	if !strings.EqualFold(arg, "off") {
+		if _, zone, err = parseTimeZone(arg); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "无法识别的时区，请使用 IANA 时区名称（例如 Asia/Shanghai、Europe/Berlin、America/New_York）或 UTC+8 这样的时差"))
+			return
+		}
+	}
+	found, err := m.setUserTimeZone(token, userID, zone)
+	if err != nil {
+		log.Printf("Failed to set time zone of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to set time zone")))
+		return
+	}
+	if !found {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 还没有与机器人交互过", userID)))
+		return
+	}
+	loc, source := m.userLocation(token, userID)
+	bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 的时区：%s（%s）", userID, loc, source)))
+}
+
+// 处理 /asktimezone on|off
+func (m *BotManager) handleAskTimeZoneCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := "用法：/asktimezone on|off。开启后，无法按语言推断时区的用户第一次发消息时，会被请求用 /timezone 告知所在时区（只问一次，可以不回答）。" +
+		"知道用户的时区后，转交的消息会标注对方当地时间，深夜发出的回复不会提醒对方，/sendat 按对方当地时间发送"
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		state := "关闭"
+		if m.botFlag(token, "ask_time_zone") {
+			state = "开启"
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "询问用户时区："+state+"\n"+usage))
+		return
+	}
+	if arg != "on" && arg != "off" {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	if _, err := m.db.Exec("UPDATE bots SET ask_time_zone = ? WHERE token = ?", arg == "on", token); err != nil {
+		log.Printf("Failed to update time zone question setting of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update setting")))
+		return
+	}
+	if arg == "on" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已开启，无法推断时区的新用户会被询问一次所在时区"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已关闭询问用户时区"))
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type topic struct {
+	ID         int64
+	Name       string
+	Subscribed bool
+}
+
+// 机器人的话题，userID 非 0 时标记该用户是否已订阅
+func (m *BotManager) listTopics(token string, userID int64) ([]topic, error) {
+	rows, err := m.db.Query(`SELECT t.id, t.name, EXISTS(SELECT 1 FROM topic_subscriptions s WHERE s.topic_id = t.id AND s.user_id = ?)
+		FROM topics t WHERE t.bot_token = ? ORDER BY t.id`, userID, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []topic
+	for rows.Next() {
+		var t topic
+		if err := rows.Scan(&t.ID, &t.Name, &t.Subscribed); err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// 用户选择话题的按钮，已订阅的话题前打勾
+func topicKeyboard(token string, topics []topic) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range topics {
+		label := t.Name
+		if t.Subscribed {
+			label = "✅ " + t.Name
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, signCallback(token, cbTopic, t.ID))))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// 用户发送 /topics 时列出可订阅的话题
+func (m *BotManager) sendTopicPicker(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	topics, err := m.listTopics(bot.Token, message.From.ID)
+	if err != nil {
+		log.Printf("Failed to list topics of bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "操作失败，请稍后再试。"))
+		return
+	}
+	if len(topics) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "暂无可订阅的话题。"))
+		return
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, "选择你感兴趣的话题，再点一次可取消：")
+	msg.ReplyMarkup = topicKeyboard(bot.Token, topics)
+	bot.Send(msg)
+}
+
+// 处理用户点击话题按钮，切换订阅状态，返回是否已处理
+func (m *BotManager) handleTopicCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData) bool {
+	if cb.Action != cbTopic {
+		return false
+	}
+	topicID, ok := cb.int(0)
+	if !ok || query.Message == nil {
+		log.Printf("Invalid topic callback: %s", query.Data)
+		return true
+	}
+	token, userID := bot.Token, query.From.ID
+
+	var exists bool
+	m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM topics WHERE bot_token = ? AND id = ?)", token, topicID).Scan(&exists)
+	if exists {
+		res, err := m.db.Exec("DELETE FROM topic_subscriptions WHERE topic_id = ? AND user_id = ?", topicID, userID)
+		if err == nil {
+			if n, _ := res.RowsAffected(); n == 0 {
+				_, err = m.db.Exec("INSERT INTO topic_subscriptions (bot_token, topic_id, user_id, created_at) VALUES (?, ?, ?, ?)",
+					token, topicID, userID, time.Now().Unix())
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to toggle topic #%d for user %d of bot %s: %v", topicID, userID, botIDFromToken(token), err)
+			return true
+		}
+	}
+
+	topics, err := m.listTopics(token, userID)
+	if err != nil {
+		log.Printf("Failed to list topics of bot %s: %v", botIDFromToken(token), err)
+		return true
+	}
+	bot.Send(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, topicKeyboard(bot.Token, topics)))
+	return true
+}
+
+// 处理创建者的 /topics
+func (m *BotManager) handleTopicsCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	action, name, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	name = strings.TrimSpace(name)
+	usage := "用法：\n/topics add <话题名>\n/topics del <话题名>\n/topics 查看列表\n用户发送 /topics 选择感兴趣的话题，群发时使用 /broadcast topic:<话题名> <内容> 只发给订阅者"
+
+	switch action {
+	case "":
+		rows, err := m.db.Query(`SELECT t.name, COUNT(s.user_id) FROM topics t
+			LEFT JOIN topic_subscriptions s ON s.topic_id = t.id
+			WHERE t.bot_token = ? GROUP BY t.id ORDER BY t.id`, token)
+		if err != nil {
+			log.Printf("Failed to list topics of bot %s: %v", botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to list topics")))
+			return
+		}
+		defer rows.Close()
+		var b strings.Builder
+		for rows.Next() {
+			var name string
+			var subscribers int
+			if err := rows.Scan(&name, &subscribers); err == nil {
+				fmt.Fprintf(&b, "%s：%d 人订阅\n", name, subscribers)
+			}
+		}
+		if b.Len() == 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, "暂无话题。\n"+usage))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, b.String()))
+	case "add":
+		if name == "" || strings.ContainsAny(name, " \n") {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+		if _, err := m.db.Exec("INSERT OR IGNORE INTO topics (bot_token, name, created_at) VALUES (?, ?, ?)", token, name, time.Now().Unix()); err != nil {
+			log.Printf("Failed to add topic %q for bot %s: %v", name, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to add topic")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已添加话题："+name))
+	case "del":
+		var id int64
+		err := m.db.QueryRow("SELECT id FROM topics WHERE bot_token = ? AND name = ?", token, name).Scan(&id)
+		if err == sql.ErrNoRows {
+			bot.Send(tgbotapi.NewMessage(creatorID, "话题不存在："+name))
+			return
+		}
+		if err == nil {
+			_, err = m.db.Exec("DELETE FROM topic_subscriptions WHERE topic_id = ?", id)
+		}
+		if err == nil {
+			_, err = m.db.Exec("DELETE FROM topics WHERE id = ?", id)
+		}
+		if err != nil {
+			log.Printf("Failed to delete topic %q of bot %s: %v", name, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete topic")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, "已删除话题："+name))
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 默认的服务条款文本，运营者可以通过 TOS_TEXT 或品牌的 BRAND_<名称>_TOS_TEXT 覆盖
+const defaultTosText = "使用本平台创建机器人即表示你同意：不得利用机器人发送垃圾信息、诈骗或违法内容；运营者有权在收到举报后暂停违规机器人。"
+
+// 管理机器人所属品牌的服务条款版本和文本
+func (m *BotManager) tosFor(managerBot *tgbotapi.BotAPI) (version, text string) {
+	version, text = m.tosVersion, m.tosText
+	if b := m.brandOf(managerBot); b != nil {
+		version, text = b.tosVersion, b.tosText
+	}
+	if text == "" {
+		text = defaultTosText
+	}
+	return version, text
+}
+
+// 创建者已同意的服务条款版本。主品牌记录在 creators 表，其他品牌记录在 brand_tos 表
+func (m *BotManager) acceptedTosVersion(brandName string, creatorID int64) string {
+	var version string
+	var err error
+	if brandName == "" {
+		err = m.db.QueryRow("SELECT tos_version FROM creators WHERE creator_id = ?", creatorID).Scan(&version)
+	} else {
+		err = m.db.QueryRow("SELECT tos_version FROM brand_tos WHERE creator_id = ? AND brand = ?", creatorID, brandName).Scan(&version)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get accepted terms version of creator %d: %v", creatorID, err)
+	}
+	return version
+}
+
+func (m *BotManager) needsTosAcceptance(managerBot *tgbotapi.BotAPI, creatorID int64) bool {
+	version, _ := m.tosFor(managerBot)
+	return version != "" && m.acceptedTosVersion(m.brandName(managerBot), creatorID) != version
+}
+
+func (m *BotManager) acceptTos(brandName string, creatorID int64, version string) error {
+	var err error
+	if brandName == "" {
+		_, err = m.db.Exec(`INSERT INTO creators (creator_id, tos_version, tos_accepted_at) VALUES (?, ?, ?)
+			ON CONFLICT (creator_id) DO UPDATE SET tos_version = excluded.tos_version, tos_accepted_at = excluded.tos_accepted_at`,
+			creatorID, version, time.Now().Unix())
+	} else {
+		_, err = m.db.Exec(`INSERT INTO brand_tos (creator_id, brand, tos_version, tos_accepted_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (creator_id, brand) DO UPDATE SET tos_version = excluded.tos_version, tos_accepted_at = excluded.tos_accepted_at`,
+			creatorID, brandName, version, time.Now().Unix())
+	}
+	if err != nil {
+		log.Printf("Failed to record terms acceptance of creator %d: %v", creatorID, err)
+		return err
+	}
+	log.Printf("Creator %d accepted terms version %s of brand %q.", creatorID, version, brandName)
+	return nil
+}
+
+// 发送服务条款并暂存待创建的机器人 token，同意后继续创建
+func (m *BotManager) promptTos(managerBot *tgbotapi.BotAPI, chatID, creatorID int64, pendingToken string) {
+	m.mu.Lock()
+	m.pendingBots[creatorID] = pendingToken
+	m.mu.Unlock()
+
+	version, text := m.tosFor(managerBot)
+	intro := "创建机器人前请阅读并同意 " + m.brandTitle(managerBot) + " 的服务条款"
+	if m.acceptedTosVersion(m.brandName(managerBot), creatorID) != "" {
+		intro = m.brandTitle(managerBot) + " 的服务条款已更新，请重新阅读并同意"
+	}
+	msg := tgbotapi.NewMessage(chatID, intro+"（版本 "+version+"）：\n\n"+text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("同意并继续", signCallback(m.managerCallbackKey(), cbTosAccept, version)),
+	))
+	if _, err := managerBot.Send(msg); err != nil {
+		log.Printf("Failed to send terms to creator %d: %v", creatorID, err)
+	}
+}
+
+// 处理同意服务条款的按钮，返回是否已处理
+func (m *BotManager) handleTosCallback(managerBot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, cb callbackData) bool {
+	if cb.Action != cbTosAccept {
+		return false
+	}
+	version := cb.arg(0)
+	if current, _ := m.tosFor(managerBot); version != current {
+		managerBot.Request(tgbotapi.NewCallback(query.ID, "条款已更新，请重新发送 /newbot"))
+		return true
+	}
+	if err := m.acceptTos(m.brandName(managerBot), query.From.ID, version); err != nil {
+		managerBot.Request(tgbotapi.NewCallback(query.ID, "操作失败，请稍后再试"))
+		return true
+	}
+	managerBot.Request(tgbotapi.NewCallback(query.ID, "已同意服务条款"))
+
+	if query.Message != nil {
+		managerBot.Send(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+	}
+
+	m.mu.Lock()
+	token, ok := m.pendingBots[query.From.ID]
+	delete(m.pendingBots, query.From.ID)
+	m.mu.Unlock()
+	if ok {
+		m.registerBot(managerBot, query.From.ID, query.From.ID, token)
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /transcript 默认包含的消息条数和上限
+const (
+	transcriptDefaultCount = 100
+	transcriptMaxCount     = 500
+)
+
+const telegraphAPI = "https://api.telegra.ph/"
+
+var telegraphClient = &http.Client{Timeout: 30 * time.Second}
+
+// 记录对话中的一条消息，用于生成对话记录。不保存消息文字时只记录消息类型
+func (m *BotManager) logConversation(token string, userID int64, fromUser bool, message *tgbotapi.Message) {
+	text := "[" + messageType(message) + "]"
+	if m.logsText(token) {
+		if message.Text != "" {
+			text = message.Text
+		} else if message.Caption != "" {
+			text += " " + message.Caption
+		}
+	}
+	_, err := m.db.Exec("INSERT INTO transcript_entries (bot_token, user_id, from_user, text, created_at) VALUES (?, ?, ?, ?, ?)",
+		token, userID, fromUser, text, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to log conversation of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+	}
+}
+
+type transcriptEntry struct {
+	FromUser  bool
+	Text      string
+	CreatedAt time.Time
+}
+
+// 与用户最近的 limit 条对话，按时间顺序排列。Telegraph 页面最大 64KB，每条最多保留 1000 个字符
+func (m *BotManager) loadTranscript(token string, userID int64, limit int) ([]transcriptEntry, error) {
+	rows, err := m.db.Query(`SELECT from_user, text, created_at FROM (
+			SELECT id, from_user, text, created_at FROM transcript_entries WHERE bot_token = ? AND user_id = ? ORDER BY id DESC LIMIT ?
+		) ORDER BY id`, token, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []transcriptEntry
+	for rows.Next() {
+		var e transcriptEntry
+		var createdAt int64
+		if err := rows.Scan(&e.FromUser, &e.Text, &createdAt); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = time.Unix(createdAt, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Telegraph 页面内容的节点，见 https://telegra.ph/api#Node
+type telegraphNode struct {
+	Tag      string        `json:"tag"`
+	Children []interface{} `json:"children,omitempty"`
+}
+
+func transcriptNodes(entries []transcriptEntry) []telegraphNode {
+	nodes := make([]telegraphNode, 0, len(entries))
+	for _, e := range entries {
+		speaker := "回复"
+		if e.FromUser {
+			speaker = "用户"
+		}
+		header := telegraphNode{Tag: "b", Children: []interface{}{e.CreatedAt.Format("2006-01-02 15:04") + " " + speaker + "："}}
+		nodes = append(nodes, telegraphNode{Tag: "p", Children: []interface{}{header, telegraphNode{Tag: "br"}, truncateText(e.Text, 1000)}})
+	}
+	return nodes
+}
+
+// 通过熔断器调用 Telegraph API，telegra.ph 持续出错时不再反复请求
+func telegraphCall(method string, params url.Values, result interface{}) error {
+	return breakers.get("telegraph").call(func() error {
+		return telegraphRequest(method, params, result)
+	})
+}
+
+func telegraphRequest(method string, params url.Values, result interface{}) error {
+	resp, err := telegraphClient.PostForm(telegraphAPI+method, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		OK     bool            `json:"ok"`
+		Error  string          `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if !body.OK {
+		return fmt.Errorf("telegraph %s: %s", method, body.Error)
+	}
+	return json.Unmarshal(body.Result, result)
+}
+
+// Telegraph 账号的 access token。未配置 TELEGRAPH_TOKEN 时在第一次发布前创建一个账号，进程内复用
+type telegraphAccount struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (a *telegraphAccount) accessToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" {
+		return a.token, nil
+	}
+	var account struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := telegraphCall("createAccount", url.Values{"short_name": {"forwardme"}}, &account); err != nil {
+		return "", err
+	}
+	if account.AccessToken == "" {
+		return "", errors.New("telegraph returned no access token")
+	}
+	a.token = account.AccessToken
+	return a.token, nil
+}
+
+// 发布为 Telegraph 页面，返回页面链接
+func (a *telegraphAccount) publish(title, author string, nodes []telegraphNode) (string, error) {
+	token, err := a.accessToken()
+	if err != nil {
+		return "", err
+	}
+	content, err := json.Marshal(nodes)
+	if err != nil {
+		return "", err
+	}
+	var page struct {
+		URL string `json:"url"`
+	}
+	params := url.Values{"access_token": {token}, "title": {title}, "author_name": {author}, "content": {string(content)}}
+	if err := telegraphCall("createPage", params, &page); err != nil {
+		return "", err
+	}
+	return page.URL, nil
+}
+
+// 处理 /transcript <ID> [条数]，确认后把与该用户的对话记录发布为只读的 Telegraph 页面
+func (m *BotManager) handleTranscriptCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	usage := fmt.Sprintf("用法：/transcript <用户ID> [条数]，把与该用户最近的对话发布为只读的 Telegraph 页面，默认 %d 条，最多 %d 条。也可以回复一条转发消息发送 /transcript", transcriptDefaultCount, transcriptMaxCount)
+	userID, rest, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, usage))
+		return
+	}
+	count := transcriptDefaultCount
+	if rest != "" {
+		if count, err = strconv.Atoi(rest); err != nil || count < 1 || count > transcriptMaxCount {
+			bot.Send(tgbotapi.NewMessage(creatorID, usage))
+			return
+		}
+	}
+
+	entries, err := m.loadTranscript(token, userID, count)
+	if err != nil {
+		log.Printf("Failed to load transcript of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to load transcript")))
+		return
+	}
+	if len(entries) == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("没有与用户ID: %d 的对话记录", userID)))
+		return
+	}
+
+	actorID := message.From.ID
+	prompt := fmt.Sprintf("确认把与用户 %d 的最近 %d 条对话发布到 telegra.ph？任何拿到链接的人都能查看，页面发布后无法撤回。", userID, len(entries))
+	m.askConfirmation(bot, creatorID, actorID, prompt, "确认发布", func() {
+		title := fmt.Sprintf("%s 与用户 %d 的对话", m.botUsername(token), userID)
+		pageURL, err := m.telegraph.publish(title, m.botUsername(token), transcriptNodes(entries))
+		if err != nil {
+			log.Printf("Failed to publish transcript of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to publish transcript")))
+			return
+		}
+		log.Printf("User %d published a transcript of user %d for bot %s.", actorID, userID, botIDFromToken(token))
+		m.logEvent(token, actorID, eventTranscript, userID, pageURL)
+		bot.Send(tgbotapi.NewMessage(creatorID, "对话记录已发布："+pageURL))
+	})
+}
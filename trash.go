@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 删除的机器人在此期间内可以用 /restorebot 恢复，之后数据会被彻底删除
+const botRestoreWindow = 7 * 24 * time.Hour
+
+// 已删除机器人的清理间隔
+const trashCleanupInterval = time.Hour
+
+// 删除机器人时最多等待其轮询和处理协程结束的时间
+const botStopTimeout = 10 * time.Second
+
+// 一个机器人的轮询，done 在轮询和处理都结束后关闭
+type botPoller struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// 把机器人移入回收站：停止轮询和处理消息，数据保留到恢复期结束
+func (m *BotManager) DeleteBot(token string) error {
+	log.Printf("Attempting to delete bot %s", botIDFromToken(token))
+	if _, err := m.db.Exec("UPDATE bots SET deleted_at = ? WHERE token = ?", time.Now().Unix(), token); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if bot, ok := m.bots[token]; ok {
+		m.deleted[token] = bot
+	}
+	delete(m.bots, token)
+	delete(m.creator, token)
+	m.mu.Unlock()
+	m.stopBot(token)
+	log.Printf("Bot %s moved to trash.", botIDFromToken(token))
+	return nil
+}
+
+// 停止机器人的轮询，等待已收到的更新处理完毕。不能在该机器人自己的处理协程中调用
+func (m *BotManager) stopBot(token string) {
+	m.mu.Lock()
+	poller, ok := m.botPollers[token]
+	delete(m.botPollers, token)
+	m.mu.Unlock()
+	// 不再轮询的机器人不需要看门狗告警
+	m.healthMu.Lock()
+	delete(m.health, token)
+	m.healthMu.Unlock()
+	if !ok {
+		return
+	}
+	poller.cancel()
+	select {
+	case <-poller.done:
+		log.Printf("Stopped polling bot %s.", botIDFromToken(token))
+	case <-time.After(botStopTimeout):
+		log.Printf("Bot %s did not stop within %s, leaving it to finish in the background.", botIDFromToken(token), botStopTimeout)
+	}
+}
+
+// 删除时间，未删除时为 0
+func (m *BotManager) botDeletedAt(token string) int64 {
+	var deletedAt int64
+	m.db.QueryRow("SELECT deleted_at FROM bots WHERE token = ?", token).Scan(&deletedAt)
+	return deletedAt
+}
+
+func (m *BotManager) isBotDeleted(token string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.deleted[token]
+	return ok
+}
+
+// 在回收站中按 token、数字 ID 或 @用户名查找机器人
+func (m *BotManager) findDeletedBot(ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	m.mu.RLock()
+	for token, bot := range m.deleted {
+		if token == ref || botIDFromToken(token) == ref || strings.EqualFold("@"+bot.Self.UserName, ref) || strings.EqualFold(bot.Self.UserName, ref) {
+			m.mu.RUnlock()
+			return token, true
+		}
+	}
+	m.mu.RUnlock()
+
+	token, ok := m.findBotToken(ref)
+	if !ok || m.botDeletedAt(token) == 0 {
+		return "", false
+	}
+	return token, true
+}
+
+// 从回收站恢复机器人
+func (m *BotManager) restoreBot(token string, creatorID int64) error {
+	if _, err := m.db.Exec("UPDATE bots SET deleted_at = 0 WHERE token = ?", token); err != nil {
+		return err
+	}
+
+	// 删除时已停止轮询，重新添加
+	m.mu.Lock()
+	delete(m.deleted, token)
+	m.mu.Unlock()
+	return m.AddBot(token, creatorID)
+}
+
+// 彻底删除机器人及其全部数据
+func (m *BotManager) purgeBot(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.bots, token)
+	delete(m.creator, token)
+	delete(m.deleted, token)
+	delete(m.queues, token)
+	m.userWrites.forgetBot(token)
+
+	_, err := m.db.Exec("DELETE FROM bots WHERE token = ?", token)
+	if err != nil {
+		log.Printf("Failed to delete bot %s from database: %v", botIDFromToken(token), err)
+	} else {
+		log.Printf("Bot %s deleted from the database successfully.", botIDFromToken(token))
+	}
+
+	if _, err := m.db.Exec("DELETE FROM feed_items WHERE feed_id IN (SELECT id FROM feeds WHERE bot_token = ?)", token); err != nil {
+		log.Printf("Failed to delete feed items for bot %s: %v", botIDFromToken(token), err)
+	}
+	if _, err := m.db.Exec("DELETE FROM survey_answers WHERE survey_id IN (SELECT id FROM surveys WHERE bot_token = ?)", token); err != nil {
+		log.Printf("Failed to delete survey answers for bot %s: %v", botIDFromToken(token), err)
+	}
+	// 管理机器人的偏移也保存在 poll_offsets 中，所以它不在 botScopedTables 里
+	if _, err := m.db.Exec("DELETE FROM poll_offsets WHERE bot_token = ?", token); err != nil {
+		log.Printf("Failed to delete polling offset for bot %s: %v", botIDFromToken(token), err)
+	}
+	for _, table := range botScopedTables {
+		if _, err := m.db.Exec("DELETE FROM "+table+" WHERE bot_token = ?", token); err != nil {
+			log.Printf("Failed to delete %s rows for bot %s: %v", table, botIDFromToken(token), err)
+		}
+	}
+}
+
+// 定期彻底删除恢复期已过的机器人
+func (m *BotManager) runTrashCleanup() {
+	ticker := time.NewTicker(trashCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-botRestoreWindow).Unix()
+		tokens, err := m.queryStrings("SELECT token FROM bots WHERE deleted_at > 0 AND deleted_at < ?", cutoff)
+		if err != nil {
+			log.Printf("Failed to load deleted bots: %v", err)
+			continue
+		}
+		for _, token := range tokens {
+			m.purgeBot(token)
+			m.logEvent("", 0, eventPurgeBot, 0, botIDFromToken(token))
+			log.Printf("Bot %s purged after the restore window.", botIDFromToken(token))
+		}
+	}
+}
+
+// 处理 /restorebot，只有创建者和运营者可以恢复
+func (m *BotManager) handleRestoreBot(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message, ref string) {
+	chatID, fromID := message.Chat.ID, message.From.ID
+	token, ok := m.findDeletedBot(ref)
+	if !ok || !m.inBrand(managerBot, token, fromID) {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "回收站中没有该机器人，请提供 token、机器人 ID 或 @用户名，例如：/restorebot @example_bot"))
+		return
+	}
+	var creatorID int64
+	m.db.QueryRow("SELECT creator_id FROM bots WHERE token = ?", token).Scan(&creatorID)
+	if creatorID != fromID && !m.instanceCan(fromID, permManage) {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "无权限"))
+		return
+	}
+
+	if err := m.checkBotLimit(creatorID, token); err != nil {
+		managerBot.Send(tgbotapi.NewMessage(chatID, planLimitMessage(err, "Failed to restore bot: "+err.Error())))
+		return
+	}
+	if err := m.restoreBot(token, creatorID); err != nil {
+		log.Printf("Failed to restore bot %s: %v", botIDFromToken(token), err)
+		managerBot.Send(tgbotapi.NewMessage(chatID, "Failed to restore bot: "+err.Error()))
+		return
+	}
+	m.logEvent("", fromID, eventRestoreBot, 0, botIDFromToken(token))
+	log.Printf("Bot %s restored by user ID: %d", botIDFromToken(token), fromID)
+	managerBot.Send(tgbotapi.NewMessage(chatID, "已恢复 "+m.botUsername(token)))
+}
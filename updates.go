@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 子机器人收到的更新，附带 tgbotapi 尚未支持的新版 Bot API 字段
+type botUpdate struct {
+	tgbotapi.Update
+	WebAppData *webAppData
+	// 论坛群组中消息所在的话题，不在话题中时为 0
+	MessageThreadID int
+	// 创建、修改、关闭或重新打开话题的服务消息
+	TopicService bool
+	// 消息的表情回应发生变化
+	MessageReaction *messageReaction
+}
+
+// 表情回应的变化，tgbotapi 尚不支持 message_reaction 更新
+type messageReaction struct {
+	Chat        tgbotapi.Chat  `json:"chat"`
+	MessageID   int            `json:"message_id"`
+	User        *tgbotapi.User `json:"user"`
+	OldReaction []reactionType `json:"old_reaction"`
+	NewReaction []reactionType `json:"new_reaction"`
+}
+
+type reactionType struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji"`
+}
+
+// 这次新加上的 emoji 回应
+func (r *messageReaction) added() []string {
+	old := make(map[string]bool, len(r.OldReaction))
+	for _, t := range r.OldReaction {
+		old[t.Emoji] = true
+	}
+	var added []string
+	for _, t := range r.NewReaction {
+		if t.Type == "emoji" && !old[t.Emoji] {
+			added = append(added, t.Emoji)
+		}
+	}
+	return added
+}
+
+// Mini App 通过 Telegram.WebApp.sendData 提交的数据
+type webAppData struct {
+	Data       string `json:"data"`
+	ButtonText string `json:"button_text"`
+}
+
+// 与 tgbotapi 的 GetUpdates 相同，另外解析出 tgbotapi 不认识的字段
+func getBotUpdates(bot *tgbotapi.BotAPI, config tgbotapi.UpdateConfig) ([]botUpdate, error) {
+	resp, err := bot.Request(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []tgbotapi.Update
+	if err := json.Unmarshal(resp.Result, &updates); err != nil {
+		return nil, err
+	}
+	var extras []struct {
+		MessageReaction *messageReaction `json:"message_reaction"`
+		Message         *struct {
+			WebAppData         *webAppData     `json:"web_app_data"`
+			MessageThreadID    int             `json:"message_thread_id"`
+			IsTopicMessage     bool            `json:"is_topic_message"`
+			ForumTopicCreated  json.RawMessage `json:"forum_topic_created"`
+			ForumTopicEdited   json.RawMessage `json:"forum_topic_edited"`
+			ForumTopicClosed   json.RawMessage `json:"forum_topic_closed"`
+			ForumTopicReopened json.RawMessage `json:"forum_topic_reopened"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(resp.Result, &extras); err != nil {
+		return nil, err
+	}
+
+	result := make([]botUpdate, len(updates))
+	for i, update := range updates {
+		result[i].Update = update
+		if i < len(extras) {
+			result[i].MessageReaction = extras[i].MessageReaction
+		}
+		if i < len(extras) && extras[i].Message != nil {
+			extra := extras[i].Message
+			result[i].WebAppData = extra.WebAppData
+			// 普通群组中回复消息也会带有 message_thread_id，只有论坛话题中的消息才算
+			if extra.IsTopicMessage {
+				result[i].MessageThreadID = extra.MessageThreadID
+			}
+			result[i].TopicService = extra.ForumTopicCreated != nil || extra.ForumTopicEdited != nil ||
+				extra.ForumTopicClosed != nil || extra.ForumTopicReopened != nil
+		}
+	}
+	return result, nil
+}
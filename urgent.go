@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 返回消息命中的第一个紧急关键词
+func matchKeyword(text string, keywords []string) (string, bool) {
+	lower := strings.ToLower(text)
+	for _, k := range keywords {
+		if strings.Contains(lower, strings.ToLower(k)) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// 紧急消息额外通知的联系人，未设置时为 0
+func (m *BotManager) getUrgentContact(token string) int64 {
+	var contact int64
+	err := m.db.QueryRow("SELECT urgent_contact FROM bots WHERE token = ?", token).Scan(&contact)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get urgent contact of bot %s: %v", botIDFromToken(token), err)
+	}
+	return contact
+}
+
+// 在转发前发送 🚨 提示；设置了紧急联系人时，同时把提示和消息发给该联系人。
+// 返回创建者一侧提示消息的 ID，发送失败时为 0
+func (m *BotManager) escalateUrgent(bot *tgbotapi.BotAPI, creatorID int64, message *tgbotapi.Message, keyword string) int {
+	text := fmt.Sprintf("🚨 紧急消息：用户 %s (ID: %d) 的以下消息包含关键词「%s」",
+		displayName(message.From.UserName, message.From.FirstName, message.From.LastName), message.From.ID, keyword)
+	metrics.inc("forwardme_urgent_messages_total", "bot", botIDFromToken(bot.Token))
+
+	var headerID int
+	if sent, err := bot.Send(tgbotapi.NewMessage(creatorID, text)); err != nil {
+		log.Printf("Failed to send urgent notice for bot %s: %v", botIDFromToken(bot.Token), err)
+	} else {
+		headerID = sent.MessageID
+	}
+
+	if contact := m.getUrgentContact(bot.Token); contact != 0 && contact != creatorID {
+		if _, err := bot.Send(tgbotapi.NewMessage(contact, text)); err != nil {
+			log.Printf("Failed to send urgent notice to contact %d for bot %s: %v", contact, botIDFromToken(bot.Token), err)
+		} else if _, err := bot.Send(tgbotapi.NewForward(contact, message.Chat.ID, message.MessageID)); err != nil {
+			log.Printf("Failed to forward urgent message to contact %d for bot %s: %v", contact, botIDFromToken(bot.Token), err)
+		}
+	}
+	return headerID
+}
+
+// 处理 /urgentcontact
+func (m *BotManager) handleUrgentContactCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	args := strings.TrimSpace(message.CommandArguments())
+	if args == "" {
+		if contact := m.getUrgentContact(bot.Token); contact != 0 {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("紧急联系人：%d\n发送 /urgentcontact off 取消", contact)))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "未设置紧急联系人。用法：/urgentcontact 123456，对方需要先在本机器人中发送 /start"))
+		}
+		return
+	}
+
+	var contact int64
+	if !strings.EqualFold(args, "off") {
+		var err error
+		contact, err = strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, "无效的 Telegram ID"))
+			return
+		}
+	}
+	if _, err := m.db.Exec("UPDATE bots SET urgent_contact = ? WHERE token = ?", contact, bot.Token); err != nil {
+		log.Printf("Failed to update urgent contact of bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update urgent contact")))
+		return
+	}
+	if contact == 0 {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已取消紧急联系人"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("紧急消息将同时发给 %d", contact)))
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 检查休假是否结束的间隔
+const vacationCheckInterval = time.Minute
+
+var vacationDurationPattern = regexp.MustCompile(`^(\d+)([dh])$`)
+
+type vacation struct {
+	SubstituteID int64
+	Until        time.Time
+}
+
+// 解析休假结束时间：日期（2006-01-02，当天零点结束）、日期时间（2006-01-02T15:04）或时长（7d、12h）
+func parseVacationUntil(value string, now time.Time) (time.Time, error) {
+	if match := vacationDurationPattern.FindStringSubmatch(value); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if match[2] == "d" {
+			return now.AddDate(0, 0, n), nil
+		}
+		return now.Add(time.Duration(n) * time.Hour), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid vacation end %q", value)
+}
+
+func (m *BotManager) getVacation(creatorID int64) (vacation, bool) {
+	var v vacation
+	var until int64
+	err := m.db.QueryRow("SELECT substitute_id, until FROM vacations WHERE creator_id = ?", creatorID).Scan(&v.SubstituteID, &until)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get vacation of creator %d: %v", creatorID, err)
+		}
+		return vacation{}, false
+	}
+	v.Until = time.Unix(until, 0)
+	return v, time.Now().Before(v.Until)
+}
+
+// 当前负责接收消息的人：创建者休假期间为代理人，否则为创建者本人
+func (m *BotManager) onDutyID(creatorID int64) int64 {
+	if v, ok := m.getVacation(creatorID); ok {
+		return v.SubstituteID
+	}
+	return creatorID
+}
+
+func (m *BotManager) setVacation(creatorID, substituteID int64, until time.Time) error {
+	_, err := m.db.Exec(`INSERT INTO vacations (creator_id, substitute_id, until, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (creator_id) DO UPDATE SET substitute_id = excluded.substitute_id, until = excluded.until, created_at = excluded.created_at`,
+		creatorID, substituteID, until.Unix(), time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to set vacation of creator %d: %v", creatorID, err)
+		return err
+	}
+	log.Printf("Creator %d is on vacation until %s, substitute: %d", creatorID, until.Format(time.RFC3339), substituteID)
+	return nil
+}
+
+func (m *BotManager) endVacation(creatorID int64) (bool, error) {
+	res, err := m.db.Exec("DELETE FROM vacations WHERE creator_id = ?", creatorID)
+	if err != nil {
+		log.Printf("Failed to end vacation of creator %d: %v", creatorID, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// 处理管理机器人中的 /vacation
+func (m *BotManager) handleVacationCommand(managerBot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	creatorID := message.From.ID
+	fields := strings.Fields(message.CommandArguments())
+
+	switch {
+	case len(fields) == 0:
+		if v, ok := m.getVacation(creatorID); ok {
+			managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("休假中，%s 前消息转给 %d。发送 /vacation off 提前结束", v.Until.Format("2006-01-02 15:04"), v.SubstituteID)))
+		} else {
+			managerBot.Send(tgbotapi.NewMessage(chatID, "用法：/vacation <结束时间> <代理人 Telegram ID>，结束时间可以是 2006-01-02、2006-01-02T15:04 或 7d、12h；/vacation off 结束休假"))
+		}
+		return
+	case len(fields) == 1 && strings.EqualFold(fields[0], "off"):
+		ended, err := m.endVacation(creatorID)
+		if err != nil {
+			managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to end vacation.")))
+			return
+		}
+		if ended {
+			managerBot.Send(tgbotapi.NewMessage(chatID, "休假已结束，消息将重新转发给你"))
+		} else {
+			managerBot.Send(tgbotapi.NewMessage(chatID, "你当前没有休假"))
+		}
+		return
+	case len(fields) != 2:
+		managerBot.Send(tgbotapi.NewMessage(chatID, "用法：/vacation <结束时间> <代理人 Telegram ID>，例如：/vacation 2026-10-20 123456"))
+		return
+	}
+
+	until, err := parseVacationUntil(fields[0], time.Now())
+	if err != nil || !until.After(time.Now()) {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "无效的结束时间，可以是 2006-01-02、2006-01-02T15:04 或 7d、12h，且必须晚于现在"))
+		return
+	}
+	substituteID, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || substituteID == creatorID {
+		managerBot.Send(tgbotapi.NewMessage(chatID, "无效的代理人 Telegram ID"))
+		return
+	}
+	if err := m.setVacation(creatorID, substituteID, until); err != nil {
+		managerBot.Send(tgbotapi.NewMessage(chatID, friendlyError(err, "Failed to set vacation.")))
+		return
+	}
+	managerBot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("休假已设置，%s 前你的机器人收到的消息将转给 %d，代理人需要先在每个机器人中发送 /start", until.Format("2006-01-02 15:04"), substituteID)))
+
+	notice := fmt.Sprintf("用户 %d 在 %s 前休假，指定你为代理人。其机器人收到的消息将转给你，你可以直接回复和使用管理命令：\n", creatorID, until.Format("2006-01-02 15:04"))
+	for _, token := range m.botsOf(creatorID) {
+		notice += m.botUsername(token) + "\n"
+	}
+	if _, err := managerBot.Send(tgbotapi.NewMessage(substituteID, notice)); err != nil {
+		log.Printf("Failed to notify substitute %d of creator %d: %v", substituteID, creatorID, err)
+	}
+}
+
+// 创建者名下正在运行的机器人
+func (m *BotManager) botsOf(creatorID int64) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var tokens []string
+	for token, id := range m.creator {
+		if id == creatorID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// 定期删除已到期的休假并通知创建者和代理人
+func (m *BotManager) runVacationExpiry() {
+	ticker := time.NewTicker(vacationCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rows, err := m.db.Query("SELECT creator_id, substitute_id FROM vacations WHERE until <= ?", time.Now().Unix())
+		if err != nil {
+			log.Printf("Failed to load expired vacations: %v", err)
+			continue
+		}
+		var expired [][2]int64
+		for rows.Next() {
+			var creatorID, substituteID int64
+			if err := rows.Scan(&creatorID, &substituteID); err == nil {
+				expired = append(expired, [2]int64{creatorID, substituteID})
+			}
+		}
+		rows.Close()
+
+		for _, e := range expired {
+			if ended, err := m.endVacation(e[0]); err != nil || !ended {
+				continue
+			}
+			log.Printf("Vacation of creator %d ended.", e[0])
+			if managerBot := m.managerBotForCreator(e[0]); managerBot != nil {
+				managerBot.Send(tgbotapi.NewMessage(e[0], "休假已结束，消息将重新转发给你"))
+				managerBot.Send(tgbotapi.NewMessage(e[1], fmt.Sprintf("用户 %d 的休假已结束，你不再代理其机器人", e[0])))
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 变量名只允许字母、数字和下划线，回复中以 {{name}} 引用
+var (
+	varNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	varTemplatePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+func (m *BotManager) getUserVars(token string, userID int64) (map[string]string, error) {
+	rows, err := m.db.Query("SELECT name, value FROM user_vars WHERE bot_token = ? AND user_id = ?", token, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vars := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		vars[name] = value
+	}
+	return vars, rows.Err()
+}
+
+func (m *BotManager) setUserVar(token string, userID int64, name, value string) error {
+	_, err := m.db.Exec(`INSERT INTO user_vars (bot_token, user_id, name, value, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (bot_token, user_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		token, userID, name, value, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to set variable %s of user %d for bot %s: %v", name, userID, botIDFromToken(token), err)
+	}
+	return err
+}
+
+func (m *BotManager) deleteUserVar(token string, userID int64, name string) (bool, error) {
+	res, err := m.db.Exec("DELETE FROM user_vars WHERE bot_token = ? AND user_id = ? AND name = ?", token, userID, name)
+	if err != nil {
+		log.Printf("Failed to delete variable %s of user %d for bot %s: %v", name, userID, botIDFromToken(token), err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// 把文本中的 {{name}} 替换为用户变量，未定义的变量保持原样
+func (m *BotManager) expandUserVars(token string, userID int64, text string) string {
+	return m.expandUserVarsWith(token, userID, text, func(value string) string { return value })
+}
+
+// 同 expandUserVars，变量的值经 escape 处理后再填入，用于 HTML 等带格式的文本
+func (m *BotManager) expandUserVarsWith(token string, userID int64, text string, escape func(string) string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	vars, err := m.getUserVars(token, userID)
+	if err != nil {
+		log.Printf("Failed to get variables of user %d for bot %s: %v", userID, botIDFromToken(token), err)
+		return text
+	}
+	return varTemplatePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := varTemplatePattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return escape(value)
+		}
+		return match
+	})
+}
+
+func formatUserVars(userID int64, vars map[string]string) string {
+	if len(vars) == 0 {
+		return fmt.Sprintf("用户ID: %d 暂无变量", userID)
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "用户ID: %d 的变量:\n", userID)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s = %s\n", name, vars[name])
+	}
+	return b.String()
+}
+
+// 处理 /setvar、/delvar 和 /vars
+func (m *BotManager) handleVarCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	userID, rest, err := m.commandTarget(token, message)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(creatorID, "请回复一条转发消息发送 /setvar order_id 12345，或提供 Telegram ID，例如：/setvar 123456 order_id 12345"))
+		return
+	}
+
+	switch message.Command() {
+	case "vars":
+		vars, err := m.getUserVars(token, userID)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to get variables")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, formatUserVars(userID, vars)))
+	case "setvar":
+		name, value, _ := strings.Cut(rest, " ")
+		value = strings.TrimSpace(value)
+		if !varNamePattern.MatchString(name) || value == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/setvar <变量名> <值>，变量名只能包含字母、数字和下划线"))
+			return
+		}
+		if err := m.setUserVar(token, userID, name, value); err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to set variable")))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已为用户ID: %d 设置 %s = %s，回复中可用 {{%s}} 引用", userID, name, value, name)))
+	case "delvar":
+		name := strings.TrimSpace(rest)
+		if name == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "用法：/delvar <变量名>"))
+			return
+		}
+		deleted, err := m.deleteUserVar(token, userID, name)
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to delete variable")))
+			return
+		}
+		if !deleted {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("用户ID: %d 没有变量 %s", userID, name)))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("已删除用户ID: %d 的变量 %s", userID, name)))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// 构建时通过 -ldflags "-X main.version=v1.2.3" 注入
+var version = "dev"
+
+const (
+	releaseURL           = "https://api.github.com/repos/SenLief/forwardme/releases/latest"
+	releaseCheckInterval = 24 * time.Hour
+)
+
+var releaseClient = &http.Client{Timeout: 30 * time.Second}
+
+// 构建时的 git 提交，go build 在 git 仓库中执行时会自动记录
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// 数据库结构的版本，由建表语句和迁移的列计算得出，结构变化时随之改变
+func schemaVersion() string {
+	h := sha256.New()
+	for _, stmt := range schemaStatements {
+		h.Write([]byte(stmt))
+	}
+	for _, c := range schemaColumns {
+		fmt.Fprintf(h, "%s.%s %s\n", c.table, c.column, c.definition)
+	}
+	return fmt.Sprintf("%d-%s", len(schemaStatements)+len(schemaColumns), hex.EncodeToString(h.Sum(nil))[:8])
+}
+
+// 由环境变量开启的功能
+func enabledFeatures() []string {
+	features := []struct {
+		name string
+		on   bool
+	}{
+		{"http", os.Getenv("HTTP_ADDR") != ""},
+		{"api-token", os.Getenv("API_TOKEN") != ""},
+		{"backup-manager", os.Getenv("BACKUP_MANAGER_BOT_TOKEN") != ""},
+		{"local-bot-api", os.Getenv("BOT_API_ENDPOINT") != ""},
+		{"tos", os.Getenv("TOS_VERSION") != ""},
+		{"auditors", os.Getenv("AUDITOR_IDS") != ""},
+		{"integrity-repair", os.Getenv("INTEGRITY_REPAIR") == "true"},
+		{"release-check", os.Getenv("RELEASE_CHECK") == "true"},
+		{"standalone", os.Getenv("BOT_TOKEN") != ""},
+	}
+	var names []string
+	for _, f := range features {
+		if f.on {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+func versionReport() string {
+	features := strings.Join(enabledFeatures(), ", ")
+	if features == "" {
+		features = "none"
+	}
+	return fmt.Sprintf("forwardme %s\ncommit: %s\nschema: %s\ngo: %s %s/%s\nfeatures: %s",
+		version, buildCommit(), schemaVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH, features)
+}
+
+func logStartupBanner() {
+	for _, line := range strings.Split(versionReport(), "\n") {
+		log.Println(line)
+	}
+}
+
+// 通过熔断器查询 GitHub 上最新发布的版本号
+func latestRelease() (latest string, err error) {
+	err = breakers.get("release").call(func() error {
+		latest, err = fetchLatestRelease()
+		return err
+	})
+	return latest, err
+}
+
+func fetchLatestRelease() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, releaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := releaseClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+// 每天检查一次是否有新版本，每个新版本只通知运营者一次。开发版本不检查
+func (m *BotManager) runReleaseCheck() {
+	if version == "dev" {
+		log.Println("Release check skipped for a development build.")
+		return
+	}
+	var notified string
+	for {
+		latest, err := latestRelease()
+		switch {
+		case err != nil:
+			log.Printf("Failed to check for a newer release: %v", err)
+		case latest != "" && latest != version && latest != notified:
+			log.Printf("A newer release is available: %s (running %s)", latest, version)
+			m.notifyOperators(fmt.Sprintf("forwardme 有新版本 %s，当前运行的是 %s", latest, version), nil)
+			notified = latest
+		}
+		time.Sleep(releaseCheckInterval)
+	}
+}
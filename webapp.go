@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// tgbotapi 的 KeyboardButton 不支持 web_app，这里自己定义回复键盘
+type webAppInfo struct {
+	URL string `json:"url"`
+}
+
+type startKeyboardButton struct {
+	Text   string      `json:"text"`
+	WebApp *webAppInfo `json:"web_app,omitempty"`
+}
+
+type startKeyboardMarkup struct {
+	Keyboard       [][]startKeyboardButton `json:"keyboard"`
+	ResizeKeyboard bool                    `json:"resize_keyboard"`
+}
+
+// 机器人配置的 Mini App 联系表单，格式为 "按钮文字 链接"
+func (m *BotManager) getStartWebApp(token string) (label, webAppURL string, ok bool) {
+	var value string
+	err := m.db.QueryRow("SELECT start_webapp FROM bots WHERE token = ?", token).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get start web app of bot %s: %v", botIDFromToken(token), err)
+	}
+	i := strings.LastIndex(value, " ")
+	if i < 0 {
+		return "", "", false
+	}
+	return value[:i], value[i+1:], true
+}
+
+// /start 时发给用户的键盘：Mini App 按钮在第一行，其后是菜单按钮
+func startKeyboard(items []menuItem, label, webAppURL string) startKeyboardMarkup {
+	markup := startKeyboardMarkup{ResizeKeyboard: true}
+	if webAppURL != "" {
+		markup.Keyboard = append(markup.Keyboard, []startKeyboardButton{{Text: label, WebApp: &webAppInfo{URL: webAppURL}}})
+	}
+	for i := 0; i < len(items); i += menuButtonsPerRow {
+		var row []startKeyboardButton
+		for _, item := range items[i:min(i+menuButtonsPerRow, len(items))] {
+			row = append(row, startKeyboardButton{Text: item.Label})
+		}
+		markup.Keyboard = append(markup.Keyboard, row)
+	}
+	return markup
+}
+
+// 把 Mini App 提交的数据整理成文本，JSON 对象按字段逐行列出
+func formatWebAppData(data string) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &fields); err != nil || len(fields) == 0 {
+		return data
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %v\n", key, fields[key])
+	}
+	return b.String()
+}
+
+// 把用户通过 Mini App 提交的表单作为卡片转给创建者，回复卡片即可回复用户
+func (m *BotManager) handleWebAppData(bot *tgbotapi.BotAPI, message *tgbotapi.Message, data *webAppData, creatorID int64) {
+	userID := message.From.ID
+	if m.isGloballyBlocked(m.creatorOf(bot.Token), userID) || m.isUserBlocked(bot.Token, userID) {
+		bot.Send(tgbotapi.NewMessage(userID, "你已被封禁，无法发送消息。"))
+		return
+	}
+	if m.isOptedOut(bot.Token, userID) {
+		bot.Send(tgbotapi.NewMessage(userID, optedOutNotice))
+		return
+	}
+
+	card := fmt.Sprintf("📝 用户 %s (ID: %d) 通过「%s」提交:\n\n%s",
+		displayName(message.From.UserName, message.From.FirstName, message.From.LastName), userID, data.ButtonText, formatWebAppData(data.Data))
+	sent, err := bot.Send(tgbotapi.NewMessage(creatorID, card))
+	if err != nil {
+		log.Printf("Failed to send web app submission for bot %s: %v", botIDFromToken(bot.Token), err)
+		bot.Send(tgbotapi.NewMessage(userID, "提交失败，请稍后再试。"))
+		return
+	}
+	m.saveMessageMapping(bot.Token, sent.MessageID, userID, message.MessageID)
+	metrics.inc("forwardme_webapp_submissions_total", "bot", botIDFromToken(bot.Token))
+	bot.Send(tgbotapi.NewMessage(userID, "已收到你提交的信息，请耐心等待回复。"))
+}
+
+// 处理 /webapp
+func (m *BotManager) handleWebAppCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, creatorID int64) {
+	token := bot.Token
+	fields := strings.Fields(message.CommandArguments())
+
+	var value string
+	switch {
+	case len(fields) == 0:
+		if label, webAppURL, ok := m.getStartWebApp(token); ok {
+			bot.Send(tgbotapi.NewMessage(creatorID, fmt.Sprintf("联系表单：%s %s\n发送 /webapp off 取消", label, webAppURL)))
+		} else {
+			bot.Send(tgbotapi.NewMessage(creatorID, "未设置联系表单。用法：/webapp <按钮文字> <https 链接>，用户发送 /start 后会看到打开该 Mini App 的按钮，Mini App 通过 Telegram.WebApp.sendData 提交的数据会转给你"))
+		}
+		return
+	case len(fields) == 1 && fields[0] == "off":
+	case len(fields) >= 2:
+		webAppURL := fields[len(fields)-1]
+		if u, err := url.Parse(webAppURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			bot.Send(tgbotapi.NewMessage(creatorID, "Mini App 链接必须是 https 地址"))
+			return
+		}
+		value = strings.Join(fields[:len(fields)-1], " ") + " " + webAppURL
+	default:
+		bot.Send(tgbotapi.NewMessage(creatorID, "用法：/webapp <按钮文字> <https 链接>，/webapp off 取消"))
+		return
+	}
+
+	if _, err := m.db.Exec("UPDATE bots SET start_webapp = ? WHERE token = ?", value, token); err != nil {
+		log.Printf("Failed to update start web app of bot %s: %v", botIDFromToken(token), err)
+		bot.Send(tgbotapi.NewMessage(creatorID, friendlyError(err, "Failed to update web app")))
+		return
+	}
+	if value == "" {
+		bot.Send(tgbotapi.NewMessage(creatorID, "已取消联系表单"))
+	} else {
+		bot.Send(tgbotapi.NewMessage(creatorID, "联系表单已设置，用户发送 /start 后即可打开"))
+	}
+}
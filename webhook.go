@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 设置了 webhook 的 token 无法使用 getUpdates 轮询，Telegram 会返回 409
+func isConflictError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// 确保机器人可以轮询：发现残留的 webhook 时按配置自动删除并通知创建者，
+// 不允许自动删除时返回错误
+func (m *BotManager) ensurePolling(bot *tgbotapi.BotAPI, creatorID int64) error {
+	info, err := bot.GetWebhookInfo()
+	if err != nil {
+		log.Printf("Failed to get webhook info for bot %s: %v", botIDFromToken(bot.Token), err)
+		return nil
+	}
+	if info.URL == "" {
+		return nil
+	}
+
+	if !m.deleteWebhook {
+		log.Printf("Bot %s has a webhook set to %s, polling will not work.", botIDFromToken(bot.Token), info.URL)
+		return fmt.Errorf("this bot has a webhook set (%s); remove it with deleteWebhook before adding the bot", info.URL)
+	}
+
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Printf("Failed to delete webhook of bot %s: %v", botIDFromToken(bot.Token), err)
+		return fmt.Errorf("failed to delete the webhook of this bot: %w", err)
+	}
+	log.Printf("Deleted webhook %s of bot %s to allow polling.", info.URL, botIDFromToken(bot.Token))
+
+	notice := fmt.Sprintf("你的机器人之前设置了 webhook（%s），与本平台的轮询冲突，已自动删除。如果该 webhook 仍被其他服务使用，请停止那个服务。", info.URL)
+	if _, err := bot.Send(tgbotapi.NewMessage(creatorID, notice)); err != nil {
+		log.Printf("Failed to notify creator of bot %s about webhook removal: %v", botIDFromToken(bot.Token), err)
+	}
+	return nil
+}
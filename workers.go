@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 每个机器人的并发处理数和每个处理协程的队列长度，可以通过 BOT_WORKERS 和 BOT_QUEUE_DEPTH 覆盖
+const (
+	defaultBotWorkers    = 4
+	defaultBotQueueDepth = 100
+)
+
+// 队列已满时最多等待多久，期间暂停轮询，让 Telegram 保留后续更新；超时后丢弃该更新
+const updateQueueTimeout = 30 * time.Second
+
+const busyNotice = "机器人当前繁忙，消息未能送达，请稍后再发送。"
+
+// 一个机器人的更新处理队列。同一聊天的更新总是交给同一个处理协程，保证按顺序处理，
+// 一个慢请求只会拖慢与它共用协程的聊天
+type updateQueue struct {
+	workers []chan func()
+	wg      sync.WaitGroup
+}
+
+func newUpdateQueue(workers, depth int) *updateQueue {
+	q := &updateQueue{workers: make([]chan func(), workers)}
+	for i := range q.workers {
+		ch := make(chan func(), depth)
+		q.workers[i] = ch
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for handle := range ch {
+				handle()
+			}
+		}()
+	}
+	return q
+}
+
+// 把处理函数放入 key 对应的队列，队列满时最多等待 updateQueueTimeout。返回是否已入队
+func (q *updateQueue) submit(key int64, handle func()) (queued, deferred bool) {
+	ch := q.workers[uint64(key)%uint64(len(q.workers))]
+	select {
+	case ch <- handle:
+		return true, false
+	default:
+	}
+	timer := time.NewTimer(updateQueueTimeout)
+	defer timer.Stop()
+	select {
+	case ch <- handle:
+		return true, true
+	case <-timer.C:
+		return false, true
+	}
+}
+
+// 不再接收新的更新，等待已入队的更新处理完毕
+func (q *updateQueue) close() {
+	for _, ch := range q.workers {
+		close(ch)
+	}
+	q.wg.Wait()
+}
+
+// 所有处理协程中等待处理的更新数
+func (q *updateQueue) depth() int {
+	var n int
+	for _, ch := range q.workers {
+		n += len(ch)
+	}
+	return n
+}
+
+// 决定更新由哪个队列处理的聊天
+func updateChatKey(update botUpdate) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.ID
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From.ID
+	case update.PollAnswer != nil:
+		return update.PollAnswer.User.ID
+	case update.MessageReaction != nil:
+		return update.MessageReaction.Chat.ID
+	}
+	return 0
+}
+
+// 把机器人的更新分发给处理队列。轮询停止且队列处理完毕后返回最后一条更新之后的偏移，
+// 此前的更新都已处理或因队列已满被丢弃；没有收到更新时返回 0
+func (m *BotManager) dispatchUpdates(bot *tgbotapi.BotAPI, updates <-chan botUpdate, handle func(botUpdate)) (next int) {
+	token := bot.Token
+	q := newUpdateQueue(m.botWorkers, m.botQueueDepth)
+	m.mu.Lock()
+	m.queues[token] = q
+	m.mu.Unlock()
+
+	for update := range updates {
+		next = max(next, update.UpdateID+1)
+		queued, deferred := q.submit(updateChatKey(update), func() { handle(update) })
+		if deferred {
+			metrics.inc("forwardme_updates_deferred_total", "bot", botIDFromToken(token))
+		}
+		if queued {
+			continue
+		}
+		log.Printf("Update queue of bot %s is full, dropping update %d.", botIDFromToken(token), update.UpdateID)
+		metrics.inc("forwardme_updates_shed_total", "bot", botIDFromToken(token))
+		if update.Message != nil {
+			go bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, busyNotice))
+		}
+	}
+	// 轮询停止后处理完队列中剩余的更新
+	q.close()
+	return next
+}
+
+// 用户正在输入申诉内容的聊天，由处理协程共享
+type appealWaitlist struct {
+	mu    sync.Mutex
+	users map[int64]bool
+}
+
+func (w *appealWaitlist) add(userID int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.users[userID] = true
+}
+
+// 用户在名单中时移出并返回 true
+func (w *appealWaitlist) take(userID int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.users[userID] {
+		return false
+	}
+	delete(w.users, userID)
+	return true
+}
+
+// 各机器人等待处理的更新数
+func (m *BotManager) queueDepths() map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	depths := make(map[string]int, len(m.queues))
+	for token, q := range m.queues {
+		depths[botIDFromToken(token)] = q.depth()
+	}
+	return depths
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 用户资料、最近使用时间和消息数的合并写入间隔
+const userWriteFlushInterval = 5 * time.Second
+
+type userWriteKey struct {
+	token  string
+	userID int64
+}
+
+type pendingUserWrite struct {
+	username, firstName, lastName string
+	languageCode                  string
+	lastSeen                      int64
+	messages                      int
+}
+
+// 合并 bot_users 的频繁更新。用户在本进程中第一次出现时立即写入，保证其他功能能读到这一行；
+// 之后的更新先在内存中累加，定期在一个事务中写入
+type userWriteBuffer struct {
+	mu      sync.Mutex
+	known   map[userWriteKey]bool
+	pending map[userWriteKey]*pendingUserWrite
+}
+
+func newUserWriteBuffer() *userWriteBuffer {
+	return &userWriteBuffer{known: make(map[userWriteKey]bool), pending: make(map[userWriteKey]*pendingUserWrite)}
+}
+
+// 已写入过的用户把更新放入缓冲区并返回 true，否则返回 false，由调用方立即写入
+func (b *userWriteBuffer) add(token string, user *tgbotapi.User, now int64) bool {
+	key := userWriteKey{token, user.ID}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.known[key] {
+		return false
+	}
+	p, ok := b.pending[key]
+	if !ok {
+		p = &pendingUserWrite{}
+		b.pending[key] = p
+	}
+	p.username, p.firstName, p.lastName = user.UserName, user.FirstName, user.LastName
+	p.languageCode = user.LanguageCode
+	p.lastSeen = now
+	p.messages++
+	return true
+}
+
+func (b *userWriteBuffer) markKnown(token string, userID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.known[userWriteKey{token, userID}] = true
+}
+
+// 用户的数据被删除后丢弃缓冲的更新，下一条消息会重新写入
+func (b *userWriteBuffer) forget(token string, userID int64) {
+	key := userWriteKey{token, userID}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.known, key)
+	delete(b.pending, key)
+}
+
+func (b *userWriteBuffer) forgetBot(token string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.known {
+		if key.token == token {
+			delete(b.known, key)
+			delete(b.pending, key)
+		}
+	}
+}
+
+func (b *userWriteBuffer) take() map[userWriteKey]*pendingUserWrite {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := b.pending
+	b.pending = make(map[userWriteKey]*pendingUserWrite)
+	return pending
+}
+
+// 把缓冲的更新写入数据库。只更新已有的行，期间被删除的用户不会被重新写入
+func (m *BotManager) flushUserWrites() {
+	pending := m.userWrites.take()
+	if len(pending) == 0 {
+		return
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		log.Printf("Failed to flush %d user updates: %v", len(pending), err)
+		return
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`UPDATE bot_users SET username = ?, first_name = ?, last_name = ?,
+		language_code = COALESCE(NULLIF(?, ''), language_code), last_seen = MAX(last_seen, ?), message_count = message_count + ? WHERE bot_token = ? AND user_id = ?`)
+	if err != nil {
+		log.Printf("Failed to flush %d user updates: %v", len(pending), err)
+		return
+	}
+	defer stmt.Close()
+	for key, p := range pending {
+		if _, err := stmt.Exec(p.username, p.firstName, p.lastName, p.languageCode, p.lastSeen, p.messages, key.token, key.userID); err != nil {
+			log.Printf("Failed to flush %d user updates: %v", len(pending), err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to flush %d user updates: %v", len(pending), err)
+		return
+	}
+	metrics.inc("forwardme_write_flushes_total")
+	metrics.add("forwardme_batched_writes_total", int64(len(pending)))
+}
+
+func (m *BotManager) runUserWriteFlush() {
+	ticker := time.NewTicker(userWriteFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.flushUserWrites()
+	}
+}